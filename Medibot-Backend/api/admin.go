@@ -0,0 +1,110 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"medibot.go/auth"
+	"medibot.go/db/repo"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pageParams reads the limit/offset query parameters, falling back to sane defaults.
+func pageParams(c *gin.Context) (limit, offset int32) {
+	limit = defaultPageSize
+	if v, err := strconv.Atoi(c.Query("limit")); err == nil && v > 0 {
+		limit = int32(min(v, maxPageSize))
+	}
+	if v, err := strconv.Atoi(c.Query("offset")); err == nil && v > 0 {
+		offset = int32(v)
+	}
+	return limit, offset
+}
+
+// list users (admin only)
+func (h *MedibotHandler) handleListUsers(c *gin.Context) {
+	limit, offset := pageParams(c)
+
+	users, err := h.querier.ListUsers(c, repo.ListUsersParams{Limit: limit, Offset: offset})
+	if err != nil {
+		log.Printf("ERROR: Failed to list users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+type updateUserRoleParams struct {
+	Role string `json:"role" binding:"required,oneof=patient doctor admin"`
+}
+
+// change a user's role (admin only)
+func (h *MedibotHandler) handleUpdateUserRole(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req updateUserRoleParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Admins can't demote themselves, so there is always at least one admin left.
+	if userID == currentUser(c).ID && req.Role != auth.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot change your own role"})
+		return
+	}
+
+	user, err := h.querier.UpdateUserRole(c, repo.UpdateUserRoleParams{ID: userID, Role: req.Role})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		log.Printf("ERROR: Failed to update role of user %s: %v", userID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// delete a user and, through ON DELETE CASCADE, their conversations (admin only)
+func (h *MedibotHandler) handleDeleteUser(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if userID == currentUser(c).ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot delete your own account here"})
+		return
+	}
+
+	deleted, err := h.querier.DeleteUser(c, userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to delete user %s: %v", userID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+	if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
@@ -5,47 +5,134 @@ import (
 	// "strconv"
 	// "strings"
 
+	"context"
 	"errors"
 	"log"
 	"net/http"
+	"slices"
 	"time"
+	"unicode/utf8"
 
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5"
+	"medibot.go/audit"
+	"medibot.go/auth"
+	"medibot.go/chat"
 	"medibot.go/db/repo"
-	"medibot.go/gemini"
+	"medibot.go/history"
+	"medibot.go/llm"
+	"medibot.go/prompt"
+	"medibot.go/redflag"
+	"medibot.go/title"
+	"medibot.go/triage"
 )
 
 type MedibotHandler struct {
-	querier repo.Querier
-	geminiClient gemini.GeminiClient
+	querier repo.Store
+	provider llm.Provider
+	prompts  *prompt.Store
+	verifier *auth.Verifier
+	redflags *redflag.Engine
+	titles   *title.Worker
+	summarizer *history.Worker
+	quota    Quota
+	audit    *audit.Logger
+	hub      *chat.Hub
+	upgrader websocket.Upgrader
 }
 
-func NewMedibotHandler(querier repo.Querier, geminiClient gemini.GeminiClient) *MedibotHandler {
+func NewMedibotHandler(querier repo.Store, provider llm.Provider, prompts *prompt.Store, verifier *auth.Verifier, redflags *redflag.Engine, titles *title.Worker, summarizer *history.Worker, quota Quota, auditLog *audit.Logger, allowedOrigins []string) *MedibotHandler {
 	return &MedibotHandler{
 		querier:    querier,
-		geminiClient: geminiClient,
+		provider:   provider,
+		prompts:    prompts,
+		verifier:   verifier,
+		redflags:   redflags,
+		titles:     titles,
+		summarizer: summarizer,
+		quota:      quota,
+		audit:      auditLog,
+		hub:        chat.NewHub(querier),
+		upgrader:   newUpgrader(allowedOrigins),
 	}
 }
 
 // Register the endpoints
 func (h *MedibotHandler) WireHttpHandler() http.Handler {
 	r := gin.Default()
+	// The handlers pass the gin context to the repository: its values, such as the audit
+	// recorder and the caller, must come from the request's context.
+	r.ContextWithFallback = true
 	r.Use(gin.CustomRecovery(func(c *gin.Context, _ any) {
 		c.String(http.StatusInternalServerError, "Internal Server Error: panic")
 		c.AbortWithStatus(http.StatusInternalServerError)
 	}))
 
-	r.POST("/user", h.handleCreateUser)
-	r.GET("/user/", h.handleGetUserByEmail)
-	r.POST("/chat", h.handleConversation)
-	r.GET("/chat/messages", h.handleGetConMessages)
-	r.GET("/conversations", h.handleUserConvAndMessages)
-	r.DELETE("/conversation", h.handleDeleteConversation)
-	r.GET("/summary", h.handleGetSummary)
+	// Every route needs a verified identity token.
+	// Signing up only needs the token, everything else also needs a registered user.
+	// The access to patient data is written to the audit log.
+	authed := r.Group("/", h.requireToken(), h.auditAccess())
+	authed.POST("/user", h.handleCreateUser)
+
+	users := authed.Group("/", h.requireUser())
+	users.GET("/user/", h.handleGetUserByEmail)
+	users.GET("/me/export", h.handleExportMe)
+	users.DELETE("/me", requireRole(auth.RolePatient), h.handleEraseMe)
+	users.POST("/chat", h.handleConversation)
+	users.POST("/chat/stream", h.handleConversationStream)
+	users.GET("/chat/messages", h.handleGetConMessages)
+	users.GET("/conversations", h.handleUserConvAndMessages)
+	users.DELETE("/conversation", h.handleDeleteConversation)
+	users.PATCH("/conversation/:id", h.handleUpdateConversation)
+	users.GET("/summary", h.handleGetSummary)
+	users.GET("/summaries", h.handleListSummaries)
+	users.GET("/search", h.handleSearch)
+	users.GET("/specialties", h.handleListSpecialties)
+	users.GET("/notifications", h.handleListNotifications)
+	users.POST("/notifications/:id/read", h.handleMarkNotificationRead)
+	users.PUT("/on-call", requireRole(auth.RoleDoctor), h.handleUpdateOnCall)
+
+	// Doctor directory, everyone can browse it and only admins maintain it.
+	users.GET("/doctors", h.handleListDoctors)
+	users.GET("/doctors/:id", h.handleGetDoctor)
+	users.POST("/doctors", requireRole(auth.RoleAdmin), h.handleCreateDoctor)
+	users.PUT("/doctors/:id", requireRole(auth.RoleAdmin), h.handleUpdateDoctor)
+	users.DELETE("/doctors/:id", requireRole(auth.RoleAdmin), h.handleDeleteDoctor)
+	users.GET("/doctors/:id/availability", h.handleGetAvailability)
+	users.GET("/doctors/:id/slots", h.handleListSlots)
+	users.GET("/doctors/:id/calendar.ics", h.handleDoctorCalendar)
+	users.PUT("/availability", requireRole(auth.RoleDoctor), h.handleUpdateAvailability)
+
+	// Appointments, booked by patients in a doctor's free slots.
+	users.POST("/appointments", requireRole(auth.RolePatient), h.handleBookAppointment)
+	users.GET("/appointments", h.handleListAppointments)
+	users.GET("/appointments/:id", h.handleGetAppointment)
+	users.PUT("/appointments/:id", requireRole(auth.RolePatient), h.handleRescheduleAppointment)
+	users.POST("/appointments/:id/cancel", h.handleCancelAppointment)
+
+	// Referrals, patients send their summaries and doctors answer them.
+	users.POST("/referrals", requireRole(auth.RolePatient), h.handleCreateReferral)
+	users.GET("/referrals", h.handleListReferrals)
+	users.GET("/referrals/:id", h.handleGetReferral)
+	users.POST("/referrals/:id/accept", requireRole(auth.RoleDoctor), h.handleAnswerReferral(referralAccepted))
+	users.POST("/referrals/:id/decline", requireRole(auth.RoleDoctor), h.handleAnswerReferral(referralDeclined))
+	users.POST("/referrals/:id/close", h.handleCloseReferral)
+
+	// Real-time chat between a patient and the doctor who accepted their referral.
+	users.GET("/chat/ws", h.handleChatSocket)
+
+	admin := users.Group("/admin", requireRole(auth.RoleAdmin))
+	admin.GET("/users", h.handleListUsers)
+	admin.PUT("/users/:id/role", h.handleUpdateUserRole)
+	admin.DELETE("/users/:id", h.handleDeleteUser)
+	admin.GET("/usage/users", h.handleUsageByUser)
+	admin.GET("/usage/days", h.handleUsageByDay)
+	admin.GET("/audit", h.handleListAuditEvents)
+	admin.GET("/audit/verify", h.handleVerifyAuditLog)
 
 	return r
 }
@@ -59,7 +146,20 @@ func (h *MedibotHandler) handleCreateUser(c *gin.Context) {
 		return
 	}
 
-	if err = h.querier.CreateUser(c,req);err!=nil{
+	// The account is always created for the identity in the token, never for an arbitrary email.
+	claims, _ := auth.ClaimsFromContext(c.Request.Context())
+	req.Email = claims.Email
+
+	// Only patients register themselves: doctors are created by an admin (POST /doctors), and admins by promotion.
+	if req.Role == "" {
+		req.Role = auth.RolePatient
+	}
+	if req.Role != auth.RolePatient {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be patient, doctors are registered by an admin"})
+		return
+	}
+
+	if _, err = h.querier.CreateUser(c,req);err!=nil{
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -70,16 +170,12 @@ func (h *MedibotHandler) handleCreateUser(c *gin.Context) {
 	})
 }
 
-//get user by email
+//get the authenticated user's profile
+// The email query parameter is still accepted for older app versions but must match the token.
 func (h *MedibotHandler) handleGetUserByEmail(c *gin.Context){
-	email := c.Query("email") // Use c.Query() to get query parameters
-	if email == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "email query parameter is required"})
-		return
-	}
+	user := currentUser(c)
 
-	user, err := h.querier.GetUserByEmail(c, email)
-	if err != nil {
+	if email := c.Query("email"); email != "" && !strings.EqualFold(email, user.Email) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
 		return
 	}
@@ -88,10 +184,42 @@ func (h *MedibotHandler) handleGetUserByEmail(c *gin.Context){
 }
 
 type createConversationParams struct {
-	UserID string `json:"userId"`
 	Content string `json:"content"`
-	Sender string `json:"sender"`
+	Sender string `json:"sender"` // Deprecated: ignored, messages posted here are always the patient's ("user")
 	ConId string `json:"conId"` // Optional, if provided, will update the conversation
+	Locale string `json:"locale"` // Optional, e.g. "fr-CM"; defaults to defaultLocale
+	Specialty string `json:"specialty"` // Optional, persona of a new conversation; defaults to defaultSpecialty
+}
+
+const (
+	// defaultLocale is used when the app does not send the patient's locale.
+	defaultLocale = "en-CM"
+	// defaultSpecialty is the persona of conversations started without a specialty.
+	defaultSpecialty = "cardiology"
+	// earlierSummaryHeading introduces the rolling summary of a long conversation to the model.
+	earlierSummaryHeading = "Summary of the earlier part of this consultation:"
+)
+
+// chatTurn is one patient message being answered by the AI.
+// Nothing of it is saved until the reply is, see saveTurn.
+type chatTurn struct {
+	userID        uuid.UUID
+	conID         uuid.UUID
+	newConversation bool // conID is not saved yet, the conversation starts with this turn
+	userMessage   repo.CreateMessageParams // the patient's message
+	specialty     repo.Specialty
+	aiRequest     llm.Request
+	promptVersion string // prompt template version used for aiRequest.System
+	language      string // language of the patient's locale, e.g. "fr"
+	redFlag       string // red flag rule id the conversation was marked with, "" if none
+	title         string // title of the conversation, "" until one is generated or set
+	summary       string // rolling summary of the messages left out of aiRequest, "" if none
+	patientMessages int  // messages of the patient in the whole conversation, this one included
+	compact       bool   // the rolling summary should be regenerated once the turn is saved
+	idempotencyKey string // Idempotency-Key of the request, "" if none
+	// redFlagMatch is set when the incoming message matched an emergency rule,
+	// the turn is then answered with the rule's instructions instead of the AI.
+	redFlagMatch *redflag.Match
 }
 
 // create or update conversation and handle messages
@@ -105,14 +233,96 @@ func (h *MedibotHandler) handleConversation(c *gin.Context) {
 		return
 	}
 
-	// Parse user ID
-	userID, err := uuid.Parse(req.UserID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+	// A retried message gets the response of the original one
+	key, ok := h.claimIdempotencyKey(c, req, replayJSON(c))
+	if !ok {
+		return
+	}
+	if key != "" {
+		defer h.releaseIdempotencyKey(context.WithoutCancel(c.Request.Context()), currentUser(c).ID, key)
+	}
+
+	// Emergencies are always answered, they don't need the AI
+	if _, emergency := h.redflags.Check(req.Content); !emergency && !h.withinQuota(c) {
+		return
+	}
+
+	turn, ok := h.prepareConversationTurn(c, req)
+	if !ok {
+		return
+	}
+	turn.idempotencyKey = key
+
+	// Emergencies are answered right away, without the follow-up questions
+	if turn.redFlagMatch != nil {
+		_, response, err := h.answerRedFlag(c.Request.Context(), turn, req.Content)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save AI response"})
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
 		return
 	}
 
+	//prompt the ai
+	reply, err := h.provider.Generate(c.Request.Context(), turn.aiRequest)
+	if err != nil {
+        log.Printf("ERROR: AI request failed: %v", err)
+        status, message := aiErrorResponse(err)
+        c.JSON(status, gin.H{"error": message})
+        return
+    }
+
+	// Respond to frontend once the turn is saved
+	responsePayload, err := h.saveReply(c.Request.Context(), turn, reply)
+	if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save AI response"})
+        return
+    }
+
+	 c.JSON(http.StatusOK, responsePayload)
+}
+
+// aiErrorResponse is the status and the message shown to the patient when the AI could not answer.
+// The details are only logged, and nothing is saved as the assistant's reply.
+func aiErrorResponse(err error) (status int, message string) {
+	switch {
+	case errors.Is(err, llm.ErrUnavailable):
+		return http.StatusServiceUnavailable, "The assistant is very busy right now, please try again in a few minutes."
+	case errors.Is(err, llm.ErrBlocked):
+		return http.StatusUnprocessableEntity, "The assistant can't answer this message. Please describe your symptoms in other words. " +
+			"If you feel in danger, go to the nearest hospital emergency department or call emergency services."
+	case errors.Is(err, llm.ErrEmptyReply):
+		return http.StatusBadGateway, "The assistant did not find an answer, please rephrase your message or try again."
+	default:
+		return http.StatusBadGateway, "The assistant could not answer, please try again."
+	}
+}
+
+// prepareConversationTurn resolves the conversation, or picks the ID of a new one, and builds the AI request
+// from the rendered system prompt, the conversation history and the incoming user message.
+// Nothing is saved yet: the conversation and the message are only saved along with the reply.
+// On failure it writes the error response itself and returns ok=false.
+func (h *MedibotHandler) prepareConversationTurn(c *gin.Context, req createConversationParams) (turn chatTurn, ok bool) {
+	var err error
 	var conID uuid.UUID
+	var newConversation bool
+	var redFlag, conTitle string
+	user := currentUser(c)
+	userID := user.ID
+
+	locale := req.Locale
+	if locale == "" {
+		locale = defaultLocale
+	}
+
+	// An existing conversation keeps the persona it was started with,
+	// a new one uses the requested specialty.
+	specialtySlug := req.Specialty
+	if specialtySlug == "" {
+		specialtySlug = defaultSpecialty
+	}
 
 	if req.ConId != "" {
 		// Parse conversation ID
@@ -123,117 +333,245 @@ func (h *MedibotHandler) handleConversation(c *gin.Context) {
 		}
 
 		// Check if conversation exists
-		_, err := h.querier.GetConversation(c.Request.Context(), repo.GetConversationParams{
+		conversation, err := h.querier.GetConversation(c.Request.Context(), repo.GetConversationParams{
 			ID:     conID,
 			UserID: userID,
 		})
 
 		if err != nil {
-			if errors.Is(err, pgx.ErrNoRows) {
-				// Conversation not found → create a new one
-				conID, err = h.querier.CreateConversation(c, userID)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create conversation"})
-					return
-				}
-			} else {
+			if !errors.Is(err, pgx.ErrNoRows) {
 				c.JSON(http.StatusInternalServerError, gin.H{"details": err.Error()})
 				return
 			}
+			// Conversation not found → a new one is created below
+			conID = uuid.Nil
+		} else {
+			specialtySlug = conversation.Specialty
+			redFlag = conversation.RedFlag
+			conTitle = conversation.Title
 		}
-	} else {
-		// No conId provided → create a new conversation
-		conID, err = h.querier.CreateConversation(c, userID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create conversation"})
+	}
+
+	specialty, err := h.querier.GetSpecialty(c, specialtySlug)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown specialty"})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get specialty"})
+		return
+	}
+	if conID == uuid.Nil && !specialty.Active {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown specialty"})
+		return
 	}
 
-	// Create message
-	if err := h.querier.CreateMessage(c, repo.CreateMessageParams{
+	// render the latest version of the specialty's prompt, it is sent through the provider's system instruction field
+	system, err := h.prompts.Render(specialty.PromptName, prompt.Vars{
+		PatientName:       user.Username,
+		Locale:            locale,
+		Specialty:         specialty.Name,
+		FollowUpQuestions: int(specialty.FollowUpQuestions),
+		SeverityRules:     specialty.SeverityRules,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to render system prompt: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare AI request"})
+		return
+	}
+
+	if conID == uuid.Nil {
+		// No (existing) conversation → a new one under the chosen persona, saved with the first reply
+		conID = uuid.New()
+		newConversation = true
+	}
+
+	// Only the conversation's owner gets here: doctors post through the chat hub, under their server-side role.
+	userMessage := repo.CreateMessageParams{
 		ConID:   conID,
-		Sender:  req.Sender,
+		Sender:  "user",
 		Content: req.Content,
-	}); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create message"})
-		return
 	}
 
-	//get the messages in that conv
+	// Check the new message for emergency warning signs before involving the AI
+	var redFlagMatch *redflag.Match
+	if match, found := h.redflags.Check(req.Content); found {
+		redFlagMatch = &match
+		redFlag = match.Rule.ID
+	}
+
+	//get the messages in that conv, followed by the new one
 	messages,err := h.querier.GetConMessages(c,conID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get conversation messages"})
 		return
 	}
+	messages = append(messages, repo.Message{ConID: conID, Sender: userMessage.Sender, Content: userMessage.Content})
+
+	messages = history.ForModel(messages)
+	var patientMessages int
+	for _, msg := range messages {
+		if msg.Sender == "user" {
+			patientMessages++
+		}
+	}
 
-	// construct the ai gemini payload content
-	var aiContents []gemini.Content
+	// Long conversations only send their latest messages, the earlier ones are replaced by their rolling summary
+	summary, err := h.querier.GetRollingSummary(c, conID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("ERROR: Failed to get rolling summary of conversation %s: %v", conID.String(), err)
+	}
+	window := h.summarizer.Budget().Window(system.Text, messages, summary)
 
-	//add the system instruction as the first user role content
-	aiContents = append(aiContents, gemini.Content{
-		Role: "user",
-		Parts: []gemini.Part{
-			{Text: gemini.SystemInstruction},
-		},
-	})
+	var aiRequest llm.Request
+	aiRequest.System = system.Text
+	if window.Summary != "" {
+		aiRequest.System += "\n\n" + earlierSummaryHeading + "\n" + window.Summary
+	}
+	aiRequest.Messages = history.ToLLM(window.Messages)
+
+	return chatTurn{
+		userID:        userID,
+		conID:         conID,
+		newConversation: newConversation,
+		userMessage:   userMessage,
+		specialty:     specialty,
+		aiRequest:     aiRequest,
+		promptVersion: system.Version,
+		language:      localeLanguage(locale),
+		redFlag:       redFlag,
+		title:         conTitle,
+		summary:       window.Summary,
+		patientMessages: patientMessages,
+		compact:       window.Compact,
+		redFlagMatch:  redFlagMatch,
+	}, true
+}
 
-	// map db messages to ai content format
-	for _,msg := range messages {
-		aiRole := "user"
-		if msg.Sender == "assistant"{
-			aiRole = "model"
+// saveReply saves the turn answered by the AI with the prompt version, the model and the tokens that produced
+// the reply, and the triage once the consultation has concluded. It counts the tokens in the patient's daily
+// usage, saved or not, and returns the response to the patient.
+func (h *MedibotHandler) saveReply(ctx context.Context, turn chatTurn, reply llm.Reply) (gin.H, error) {
+	h.recordUsage(ctx, turn.userID, reply.Usage)
+
+	// Structured triage, null until the consultation has concluded
+	result := h.extractTriage(ctx, turn, reply.Text)
+
+	message := repo.CreateMessageParams{
+		ConID:            turn.conID,
+		Sender:           "assistant", // This must match your DB CHECK constraint
+		Content:          reply.Text,
+		PromptVersion:    turn.promptVersion,
+		Model:            reply.Model,
+		PromptTokens:     int32(reply.Usage.PromptTokens),
+		CompletionTokens: int32(reply.Usage.CompletionTokens),
+		TotalTokens:      int32(reply.Usage.TotalTokens),
+	}
+	return h.saveTurn(ctx, turn, message, func(q repo.Querier) (gin.H, error) {
+		var summary *repo.Summary
+		if result != nil {
+			saved, err := saveTriage(ctx, q, turn, *result)
+			if err != nil {
+				return nil, err
+			}
+			summary = &saved
 		}
 
+		return gin.H{
+			"conversationId": turn.conID.String(),
+			"aiResponse":     reply.Text,
+			"triage":         summary,
+			"emergency":      false,
+			"message":        "Message processed successfully",
+		}, nil
+	})
+}
+
+// saveTurn saves a turn in one transaction: the conversation when it is new, the patient's message,
+// the assistant's reply, the writes of respond and the response it returns, under the request's
+// Idempotency-Key. A failure saves nothing, so the patient can simply send the message again.
+func (h *MedibotHandler) saveTurn(ctx context.Context, turn chatTurn, reply repo.CreateMessageParams, respond func(q repo.Querier) (gin.H, error)) (gin.H, error) {
+	var response gin.H
+	err := h.querier.ExecTx(ctx, func(q repo.Querier) error {
+		if turn.newConversation {
+			if err := q.CreateConversation(ctx, repo.CreateConversationParams{
+				ID:        turn.conID,
+				UserID:    turn.userID,
+				Specialty: turn.specialty.Slug,
+			}); err != nil {
+				return err
+			}
+		}
+		if err := q.CreateMessage(ctx, turn.userMessage); err != nil {
+			return err
+		}
+		if err := q.CreateMessage(ctx, reply); err != nil {
+			return err
+		}
 
-		aiContents = append(aiContents, gemini.Content{
-            Role:  aiRole,
-            Parts: []gemini.Part{{Text: msg.Content}},
-        })
+		var err error
+		if response, err = respond(q); err != nil {
+			return err
+		}
+		return completeIdempotencyKey(ctx, q, turn.userID, turn.idempotencyKey, response)
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to save turn of conversation %s: %v", turn.conID.String(), err)
+		return nil, err
 	}
 
+	// Name the conversation in the background once it has an exchange to describe
+	if turn.title == "" {
+		h.titles.Enqueue(turn.conID, turn.userID)
+	}
+	if turn.compact {
+		h.summarizer.Enqueue(turn.conID, turn.userID)
+	}
 
-	//prompt the ai
-	aiResponseText,err := h.geminiClient.RequestResponse(aiContents)
-	if err != nil {
-        log.Printf("ERROR: Gemini AI request failed: %v", err)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "AI service error: " + err.Error()})
-        return
-    }
+	return response, nil
+}
 
-	    // Save AI's response to the database
-    if err := h.querier.CreateMessage(c.Request.Context(), repo.CreateMessageParams{
-        ConID:   conID,
-        Sender:  "assistant", // This must match your DB CHECK constraint
-        Content: aiResponseText,
-    }); err != nil {
-        log.Printf("ERROR: Failed to create AI response message: %v", err)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save AI response"})
-        return
-    }
+// extractTriage extracts the structured triage of the conversation once the patient has answered
+// the persona's follow-up questions. It returns nil while the consultation is still in progress.
+// Failures are only logged, they never block the reply to the patient.
+func (h *MedibotHandler) extractTriage(ctx context.Context, turn chatTurn, aiResponseText string) *triage.Result {
+	// The first message describes the symptom, the next ones answer the follow-up questions.
+	if turn.patientMessages <= int(turn.specialty.FollowUpQuestions) {
+		return nil
+	}
 
-	// Check if response starts with "summary" (case-insensitive) and save as summary
-	if strings.HasPrefix(strings.ToLower(aiResponseText), "summary") {
-		err := h.querier.CreateSummaries(c.Request.Context(), repo.CreateSummariesParams{
-			Content:        aiResponseText,
-			ConversationID: conID,
-			PatientID:      userID,
-			DoctorID:       uuid.Nil, // no doctor ID provided, using zero UUID
-		})
-		if err != nil {
-			log.Printf("ERROR: Failed to create summary: %v", err)
-			// Optionally, do NOT block response to frontend, just log
+	transcript := append(slices.Clip(turn.aiRequest.Messages), llm.Message{Role: llm.RoleAssistant, Text: aiResponseText})
+	if turn.summary != "" {
+		transcript = append([]llm.Message{{Role: llm.RoleAssistant, Text: earlierSummaryHeading + "\n" + turn.summary}}, transcript...)
+	}
+	result, usage, err := triage.Extract(ctx, h.provider, turn.specialty.Name, transcript)
+	h.recordUsage(ctx, turn.userID, usage)
+	if err != nil {
+		if !errors.Is(err, triage.ErrIncomplete) {
+			log.Printf("ERROR: Failed to extract triage for conversation %s: %v", turn.conID.String(), err)
 		}
+		return nil
 	}
 
-	// Respond to frontend
-    responsePayload := gin.H{
-        "conversationId": conID.String(),
-        "aiResponse":     aiResponseText, // Send the actual AI response text
-        "message":        "Message processed successfully",
-    }
+	// A conversation that raised an emergency stays a high severity case for the doctors.
+	if turn.redFlag != "" {
+		result.Severity = triage.SeverityHigh
+	}
+	return &result
+}
 
-	 c.JSON(http.StatusOK, responsePayload)
+// saveTriage stores the triage as the conversation's summary, within the turn's transaction.
+func saveTriage(ctx context.Context, q repo.Querier, turn chatTurn, result triage.Result) (repo.Summary, error) {
+	return q.UpsertTriageSummary(ctx, repo.UpsertTriageSummaryParams{
+		Content:            result.Summary,
+		ConversationID:     turn.conID,
+		PatientID:          turn.userID,
+		Severity:           result.Severity,
+		SuspectedCondition: result.SuspectedCondition,
+		RecommendedTests:   result.RecommendedTests,
+		LifestyleAdvice:    result.LifestyleAdvice,
+		Helpful:            result.Helpful(),
+	})
 }
 
 //get all the messages in a conversation
@@ -250,128 +588,211 @@ func (h *MedibotHandler) handleGetConMessages(c *gin.Context) {
 			return
 		}
 
-	messages, err := h.querier.GetConMessages(c, conID)
+	// Only the owner and the doctor who accepted its referral may read a conversation;
+	// anyone else gets the same answer as for a missing one.
+	if _, ok := h.conversationParticipant(c, conID); !ok {
+		return
+	}
+
+	limit, _ := pageParams(c)
+	before, hasBefore, err := parsePageCursor(c.Query("before"))
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid before cursor"})
+		return
+	}
+	after, hasAfter, err := parsePageCursor(c.Query("after"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid after cursor"})
+		return
+	}
+	if hasBefore && hasAfter {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use either before or after, not both"})
+		return
+	}
+
+	// One extra row tells whether there is another page.
+	var messages []repo.Message
+	if hasAfter {
+		messages, err = h.querier.ListMessagesAfter(c, repo.ListMessagesAfterParams{
+			ConID:           conID,
+			CursorTimestamp: after.timestamp(),
+			CursorID:        after.id,
+			PageLimit:       limit + 1,
+		})
+	} else {
+		messages, err = h.querier.ListMessagesBefore(c, repo.ListMessagesBeforeParams{
+			ConID:           conID,
+			HasCursor:       hasBefore,
+			CursorTimestamp: before.timestamp(),
+			CursorID:        before.id,
+			PageLimit:       limit + 1,
+		})
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to get messages of conversation %s: %v", conID.String(), err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get conversation messages"})
 		return
 	}
 
-	c.JSON(http.StatusOK, messages)
+	hasMore := len(messages) > int(limit)
+	messages = messages[:min(len(messages), int(limit))]
+	if !hasAfter {
+		// Pages before a cursor are read newest first, but always returned oldest first.
+		slices.Reverse(messages)
+	}
+
+	page := messagePage{Messages: messages}
+	if len(messages) > 0 {
+		oldest, newest := messages[0], messages[len(messages)-1]
+		page.Before = newPageCursor(oldest.Timestamp, oldest.ID)
+		page.After = newPageCursor(newest.Timestamp, newest.ID)
+	}
+	if hasAfter {
+		page.HasNewer = hasMore
+	} else {
+		page.HasOlder = hasMore
+	}
+
+	c.JSON(http.StatusOK, page)
 }
 
-// FrontendMessage represents a message as the frontend expects
-type FrontendMessage struct {
-	Sender string `json:"sender"` // "user" or "assistant"
-	Text   string `json:"text"`
-	// You might want to add ID and Timestamp if your frontend needs them for keys/display
-	// ID        string    `json:"id,omitempty"`
-	// Timestamp time.Time `json:"timestamp,omitempty"`
+// messagePage is one page of a conversation's messages, oldest first.
+// Before and After are the cursors to load the older and the newer messages.
+type messagePage struct {
+	Messages []repo.Message `json:"messages"`
+	Before   string         `json:"before,omitempty"`
+	After    string         `json:"after,omitempty"`
+	HasOlder bool           `json:"hasOlder"`
+	HasNewer bool           `json:"hasNewer"`
 }
 
-// FrontendConversation represents a conversation as the frontend expects
-type FrontendConversation struct {
-	ID        string            `json:"id"`
-	Title     string            `json:"title"`
-	Messages  []FrontendMessage `json:"messages"`
-	CreatedAt time.Time         `json:"createdAt"` // Add this for sorting on frontend
+// conversationHeader is a conversation as listed in the app's history, without its messages.
+type conversationHeader struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	Specialty    string    `json:"specialty"`
+	RedFlag      string    `json:"redFlag,omitempty"`
+	LastMessage  string    `json:"lastMessage"`
+	LastSender   string    `json:"lastSender,omitempty"`
+	LastActivity time.Time `json:"lastActivity"`
+	MessageCount int64     `json:"messageCount"`
+	CreatedAt    time.Time `json:"createdAt"`
 }
-//get all users conversations and messages
-func (h *MedibotHandler) handleUserConvAndMessages(c *gin.Context) {
-    userId := c.Query("userId")
-    if userId == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "userId query parameter is required"})
-        return
-    }
 
-    userID, err := uuid.Parse(userId)
-    if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
-        return
-    }
+// Lengths, in characters, of the parts of the messages shown in the conversation list.
+const (
+	headerTitleLength   = 80
+	headerPreviewLength = 120
+)
 
-    // Get the flat list of conversation messages from the database
-    // This returns a slice of repo.ListFullConversationsByUserIDRow
-    dbRows, err := h.querier.ListFullConversationsByUserID(c, userID)
-    if err != nil {
-        // If no rows are found, it's not an error, just an empty list
-        if errors.Is(err, pgx.ErrNoRows) {
-            c.JSON(http.StatusOK, []FrontendConversation{}) // Return empty array
-            return
-        }
-        log.Printf("ERROR: Failed to get full conversations for user %s: %v", userID.String(), err)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve conversations"})
-        return
-    }
+// shorten returns the first n characters of text.
+func shorten(text string, n int) string {
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	return string([]rune(text)[:n])
+}
 
-    // --- Data Transformation Logic ---
-    // Use a map to build conversations, keyed by conversation ID
-    conversationsMap := make(map[string]FrontendConversation)
-    conversationOrder := []string{} // To maintain the order of conversations as they appear in query results
-
-    for _, row := range dbRows {
-        convID := row.ConversationID.String()
-
-        // If conversation not in map, initialize it
-        if _, exists := conversationsMap[convID]; !exists {
-            conversationsMap[convID] = FrontendConversation{
-                ID:        convID,
-                Title:     "New Conversation", // Temporary title, will update with first message
-                Messages:  []FrontendMessage{},
-                CreatedAt: row.ConversationCreatedAt.Time, // Store the conversation's creation time
-            }
-            conversationOrder = append(conversationOrder, convID) // Add to order list
-        }
-
-		// Add message to the conversation
-		// Check if message_id is not null (for conversations with no messages yet, LEFT JOIN)
-		if row.MessageID != uuid.Nil { // Check if UUID is not zero value
-			 // Map sender from DB ('user', 'assistant') to frontend type ('user', 'assistant')
-			sender := row.MessageSender // Already matches frontend
-			if sender == "" { // Fallback, though your DB constraint should prevent this
-				sender = "user"
-			}
+// list the user's conversations, newest first, one page at a time (?cursor=&limit=)
+func (h *MedibotHandler) handleUserConvAndMessages(c *gin.Context) {
+	userID := currentUser(c).ID
 
-			msg := FrontendMessage{
-				Sender: sender,
-				Text:   row.MessageContent,
-				// You might add ID and Timestamp here if FrontendMessage struct is updated
-				// ID: row.MessageID.String(),
-				// Timestamp: row.MessageTimestamp.Time,
-			}
+	limit, _ := pageParams(c)
+	cursor, hasCursor, err := parsePageCursor(c.Query("cursor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
 
-			// Append message
-			currentConv := conversationsMap[convID]
-			currentConv.Messages = append(currentConv.Messages, msg)
-			conversationsMap[convID] = currentConv // Update map entry
-		}
-    }
+	// One extra row tells whether there is another page.
+	rows, err := h.querier.ListConversationHeaders(c, repo.ListConversationHeadersParams{
+		UserID:          userID,
+		HasCursor:       hasCursor,
+		CursorCreatedAt: cursor.timestamp(),
+		CursorID:        cursor.id,
+		PageLimit:       limit + 1,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to list conversations for user %s: %v", userID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve conversations"})
+		return
+	}
 
-    // Now, go back through the conversationsMap to set the title
-    // and compile into a slice based on the desired order (latest conversation first)
-    var frontendConversations []FrontendConversation
-    // Re-order by conversation_created_at DESC (which is how your query already orders)
-    // Or, you can explicitly sort here if the query order isn't guaranteed
-    // For now, let's assume `dbRows` are ordered such that the first message for a conversation
-    // is encountered relatively early.
-
-    // A more robust way to get the *actual* first message for the title:
-    // After processing all rows, iterate `conversationsMap`
-    for _, convID := range conversationOrder {
-        conv := conversationsMap[convID]
-        if len(conv.Messages) > 0 {
-            conv.Title = conv.Messages[0].Text // Set title to the first message's text
-        } else {
-            conv.Title = "Empty Conversation" // Handle cases with no messages
-        }
-        frontendConversations = append(frontendConversations, conv)
-    }
+	var nextCursor string
+	if len(rows) > int(limit) {
+		rows = rows[:limit]
+		last := rows[len(rows)-1]
+		nextCursor = newPageCursor(last.CreatedAt, last.ID)
+	}
 
-    // The `conversationOrder` slice will naturally have conversations in `c.created_at DESC`
-    // because `dbRows` are already sorted by `c.created_at DESC`.
+	conversations := make([]conversationHeader, 0, len(rows))
+	for _, row := range rows {
+		title := row.Title
+		if title == "" {
+			title = shorten(row.FirstMessage, headerTitleLength)
+		}
+		if title == "" {
+			title = "Empty Conversation"
+		}
+		conversations = append(conversations, conversationHeader{
+			ID:           row.ID.String(),
+			Title:        title,
+			Specialty:    row.Specialty,
+			RedFlag:      row.RedFlag,
+			LastMessage:  shorten(row.LastMessage, headerPreviewLength),
+			LastSender:   row.LastSender,
+			LastActivity: row.LastActivity.Time,
+			MessageCount: row.MessageCount,
+			CreatedAt:    row.CreatedAt.Time,
+		})
+	}
 
-    c.JSON(http.StatusOK, frontendConversations)
+	c.JSON(http.StatusOK, gin.H{
+		"conversations": conversations,
+		"nextCursor":    nextCursor,
+	})
 }
 
+type updateConversationParams struct {
+	Title string `json:"title" binding:"required"`
+}
+
+// rename a conversation
+func (h *MedibotHandler) handleUpdateConversation(c *gin.Context) {
+	conID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		return
+	}
+
+	var req updateConversationParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	conTitle := title.Clean(req.Title)
+	if conTitle == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "title is required"})
+		return
+	}
+
+	conversation, err := h.querier.UpdateConversationTitle(c, repo.UpdateConversationTitleParams{
+		ID:     conID,
+		UserID: currentUser(c).ID,
+		Title:  conTitle,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+			return
+		}
+		log.Printf("ERROR: Failed to rename conversation %s: %v", conID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update conversation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, conversation)
+}
 
 // Delete Conversation
 func (h *MedibotHandler) handleDeleteConversation(c *gin.Context) {
@@ -387,12 +808,19 @@ func (h *MedibotHandler) handleDeleteConversation(c *gin.Context) {
 		return
 	}
 
-	err = h.querier.DeleteConversation(c, conID)
+	deleted, err := h.querier.DeleteConversationForUser(c, repo.DeleteConversationForUserParams{
+		ID:     conID,
+		UserID: currentUser(c).ID,
+	})
 	if err != nil {
 		log.Printf("ERROR: Failed to delete conversation %s: %v", conID.String(), err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete conversation"})
 		return
 	}
+	if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Conversation deleted successfully"})
 }
@@ -411,12 +839,57 @@ func (h *MedibotHandler) handleGetSummary(c *gin.Context) {
 		return
 	}
 
-	summary, err := h.querier.GetSummary(c, summaryID)
+	summary, err := h.querier.GetSummaryForUser(c, repo.GetSummaryForUserParams{
+		ID:     summaryID,
+		UserID: currentUser(c).ID,
+	})
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Summary not found"})
+			return
+		}
 		log.Printf("ERROR: Failed to get summary %s: %v", summaryID.String(), err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve summary"})
 		return
 	}
 
 	c.JSON(http.StatusOK, summary)
-}
\ No newline at end of file
+}
+
+// List the caller's summaries: a patient's own, or the ones assigned to a doctor.
+// Optional filters: severity=low|moderate|high, sort=severity (most severe first) or recent (default).
+func (h *MedibotHandler) handleListSummaries(c *gin.Context) {
+	severity := c.Query("severity")
+	if severity != "" && !slices.Contains([]string{triage.SeverityLow, triage.SeverityModerate, triage.SeverityHigh}, severity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "severity must be low, moderate or high"})
+		return
+	}
+
+	limit, offset := pageParams(c)
+	summaries, err := h.querier.ListSummariesForUser(c, repo.ListSummariesForUserParams{
+		UserID:     currentUser(c).ID,
+		Severity:   severity,
+		BySeverity: c.Query("sort") == "severity",
+		PageLimit:  limit,
+		PageOffset: offset,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to list summaries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve summaries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summaries)
+}
+
+// List the assistant personas a conversation can be started with
+func (h *MedibotHandler) handleListSpecialties(c *gin.Context) {
+	specialties, err := h.querier.ListSpecialties(c)
+	if err != nil {
+		log.Printf("ERROR: Failed to list specialties: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve specialties"})
+		return
+	}
+
+	c.JSON(http.StatusOK, specialties)
+}
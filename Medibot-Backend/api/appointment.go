@@ -0,0 +1,479 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"medibot.go/auth"
+	"medibot.go/db/repo"
+	"medibot.go/schedule"
+)
+
+const (
+	defaultSlotDays = 7
+	maxSlotDays     = 31
+)
+
+// notificationKindAppointment is the kind of the notifications sent when an appointment is booked, moved or cancelled.
+const notificationKindAppointment = "appointment"
+
+// errAppointmentNotFound is returned from booking transactions when the appointment can't be changed.
+var errAppointmentNotFound = errors.New("appointment not found")
+
+type availabilityWindow struct {
+	Weekday     int32  `json:"weekday" binding:"min=0,max=6"` // 0 is Sunday
+	Start       string `json:"start" binding:"required"`      // "09:00"
+	End         string `json:"end" binding:"required"`        // "12:30", "24:00" for midnight
+	SlotMinutes int32  `json:"slotMinutes" binding:"omitempty,min=5,max=240"`
+}
+
+type updateAvailabilityParams struct {
+	Timezone string               `json:"timezone"` // IANA name, defaults to schedule.DefaultTimezone
+	Windows  []availabilityWindow `json:"windows" binding:"dive"`
+}
+
+// replace the current doctor's weekly availability (doctors only)
+func (h *MedibotHandler) handleUpdateAvailability(c *gin.Context) {
+	var req updateAvailabilityParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Timezone == "" {
+		req.Timezone = schedule.DefaultTimezone
+	}
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown timezone"})
+		return
+	}
+
+	doctorID := currentUser(c).ID
+	params := make([]repo.CreateAvailabilityParams, 0, len(req.Windows))
+	for _, window := range req.Windows {
+		start, err := schedule.ParseClock(window.Start)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		end, err := schedule.ParseClock(window.End)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if end <= start {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end must be after start"})
+			return
+		}
+		if window.SlotMinutes == 0 {
+			window.SlotMinutes = 30
+		}
+
+		params = append(params, repo.CreateAvailabilityParams{
+			DoctorID:    doctorID,
+			Weekday:     window.Weekday,
+			StartMinute: start,
+			EndMinute:   end,
+			SlotMinutes: window.SlotMinutes,
+			Timezone:    req.Timezone,
+		})
+	}
+
+	// The whole week is replaced at once, so a bad window leaves the previous availability untouched.
+	windows := []repo.DoctorAvailability{}
+	err := h.querier.ExecTx(c, func(q repo.Querier) error {
+		if err := q.DeleteDoctorAvailability(c, doctorID); err != nil {
+			return err
+		}
+		for _, p := range params {
+			window, err := q.CreateAvailability(c, p)
+			if err != nil {
+				return err
+			}
+			windows = append(windows, window)
+		}
+		return nil
+	})
+	if err != nil {
+		if isPgError(err, exclusionViolation) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Availability windows overlap"})
+			return
+		}
+		log.Printf("ERROR: Failed to update availability of doctor %s: %v", doctorID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update availability"})
+		return
+	}
+
+	c.JSON(http.StatusOK, windows)
+}
+
+// get a doctor's weekly availability
+func (h *MedibotHandler) handleGetAvailability(c *gin.Context) {
+	doctorID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid doctor ID"})
+		return
+	}
+
+	windows, err := h.querier.ListDoctorAvailability(c, doctorID)
+	if err != nil {
+		log.Printf("ERROR: Failed to list availability of doctor %s: %v", doctorID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve availability"})
+		return
+	}
+
+	c.JSON(http.StatusOK, windows)
+}
+
+// list a doctor's free slots, from=RFC 3339 time (default now) for days=N days (default 7)
+func (h *MedibotHandler) handleListSlots(c *gin.Context) {
+	doctorID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid doctor ID"})
+		return
+	}
+
+	from := time.Now()
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 time"})
+			return
+		}
+	}
+	if from.Before(time.Now()) {
+		from = time.Now()
+	}
+	days := defaultSlotDays
+	if v, err := strconv.Atoi(c.Query("days")); err == nil && v > 0 {
+		days = min(v, maxSlotDays)
+	}
+	to := from.AddDate(0, 0, days)
+
+	windows, err := h.querier.ListDoctorAvailability(c, doctorID)
+	if err != nil {
+		log.Printf("ERROR: Failed to list availability of doctor %s: %v", doctorID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve availability"})
+		return
+	}
+	booked, err := h.querier.ListDoctorAppointments(c, repo.ListDoctorAppointmentsParams{
+		DoctorID: doctorID,
+		Until:    to,
+		Since:    from,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to list appointments of doctor %s: %v", doctorID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve appointments"})
+		return
+	}
+
+	slots, err := schedule.Slots(windows, booked, from, to)
+	if err != nil {
+		log.Printf("ERROR: Failed to compute slots of doctor %s: %v", doctorID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute slots"})
+		return
+	}
+
+	c.JSON(http.StatusOK, slots)
+}
+
+// export a doctor's schedule as an iCalendar feed (the doctor themselves or an admin)
+func (h *MedibotHandler) handleDoctorCalendar(c *gin.Context) {
+	doctorID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid doctor ID"})
+		return
+	}
+
+	user := currentUser(c)
+	if user.ID != doctorID && user.Role != auth.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+		return
+	}
+
+	doctor, err := h.querier.GetDoctor(c, doctorID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Doctor not found"})
+			return
+		}
+		log.Printf("ERROR: Failed to get doctor %s: %v", doctorID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve doctor"})
+		return
+	}
+
+	// The last month and the next year of appointments, with those cancelled in the last month
+	now := time.Now()
+	appointments, err := h.querier.ListDoctorCalendar(c, repo.ListDoctorCalendarParams{
+		DoctorID:       doctorID,
+		CancelledSince: now.AddDate(0, -1, 0),
+		Until:          now.AddDate(1, 0, 0),
+		Since:          now.AddDate(0, -1, 0),
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to list appointments of doctor %s: %v", doctorID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve appointments"})
+		return
+	}
+
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="medibot-schedule.ics"`)
+	c.Status(http.StatusOK)
+	if err := schedule.WriteICS(c.Writer, "Medibot - Dr "+doctor.Username, appointments); err != nil {
+		log.Printf("ERROR: Failed to write calendar of doctor %s: %v", doctorID.String(), err)
+	}
+}
+
+type bookAppointmentParams struct {
+	DoctorID       uuid.UUID `json:"doctorId" binding:"required"`
+	StartsAt       time.Time `json:"startsAt" binding:"required"` // RFC 3339, must be the start of one of the doctor's slots
+	ConversationID uuid.UUID `json:"conversationId"`              // Optional
+	SummaryID      uuid.UUID `json:"summaryId"`                   // Optional
+	Note           string    `json:"note"`
+}
+
+// book an appointment in one of a doctor's free slots (patients only)
+func (h *MedibotHandler) handleBookAppointment(c *gin.Context) {
+	var req bookAppointmentParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.StartsAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "startsAt must be in the future"})
+		return
+	}
+
+	patientID := currentUser(c).ID
+
+	if req.ConversationID != uuid.Nil {
+		if _, err := h.querier.GetConversation(c, repo.GetConversationParams{ID: req.ConversationID, UserID: patientID}); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+				return
+			}
+			log.Printf("ERROR: Failed to get conversation %s: %v", req.ConversationID.String(), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get conversation"})
+			return
+		}
+	}
+	if req.SummaryID != uuid.Nil {
+		summary, err := h.querier.GetSummaryForUser(c, repo.GetSummaryForUserParams{ID: req.SummaryID, UserID: patientID})
+		if err != nil || summary.PatientID != patientID {
+			if err == nil || errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Summary not found"})
+				return
+			}
+			log.Printf("ERROR: Failed to get summary %s: %v", req.SummaryID.String(), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve summary"})
+			return
+		}
+	}
+
+	if _, err := h.querier.GetDoctor(c, req.DoctorID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown doctor"})
+			return
+		}
+		log.Printf("ERROR: Failed to get doctor %s: %v", req.DoctorID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve doctor"})
+		return
+	}
+
+	// The slot is checked against the availability and inserted in one transaction,
+	// the exclusion constraints reject it if someone booked an overlapping time meanwhile.
+	var appointment repo.Appointment
+	err := h.querier.ExecTx(c, func(q repo.Querier) error {
+		windows, err := q.ListDoctorAvailability(c, req.DoctorID)
+		if err != nil {
+			return err
+		}
+		slot, err := schedule.Fit(windows, req.StartsAt)
+		if err != nil {
+			return err
+		}
+
+		appointment, err = q.CreateAppointment(c, repo.CreateAppointmentParams{
+			DoctorID:       req.DoctorID,
+			PatientID:      patientID,
+			ConversationID: req.ConversationID,
+			SummaryID:      req.SummaryID,
+			StartsAt:       slot.StartsAt,
+			EndsAt:         slot.EndsAt,
+			Note:           req.Note,
+		})
+		return err
+	})
+	if err != nil {
+		h.appointmentError(c, err)
+		return
+	}
+
+	h.notify(c.Request.Context(), req.DoctorID, notificationKindAppointment, req.ConversationID,
+		"New appointment on "+appointment.StartsAt.UTC().Format(time.RFC1123))
+
+	c.JSON(http.StatusCreated, appointment)
+}
+
+// list the caller's upcoming appointments (patients) or schedule (doctors)
+func (h *MedibotHandler) handleListAppointments(c *gin.Context) {
+	since := time.Now()
+	if v := c.Query("since"); v != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 time"})
+			return
+		}
+	}
+
+	limit, offset := pageParams(c)
+	appointments, err := h.querier.ListAppointmentsForUser(c, repo.ListAppointmentsForUserParams{
+		UserID:     currentUser(c).ID,
+		Since:      since,
+		PageLimit:  limit,
+		PageOffset: offset,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to list appointments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve appointments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, appointments)
+}
+
+// get one of the caller's appointments
+func (h *MedibotHandler) handleGetAppointment(c *gin.Context) {
+	appointmentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return
+	}
+
+	appointment, err := h.querier.GetAppointmentForUser(c, repo.GetAppointmentForUserParams{ID: appointmentID, UserID: currentUser(c).ID})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+			return
+		}
+		log.Printf("ERROR: Failed to get appointment %s: %v", appointmentID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve appointment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, appointment)
+}
+
+type rescheduleAppointmentParams struct {
+	StartsAt time.Time `json:"startsAt" binding:"required"`
+}
+
+// move a booked appointment to another free slot of the same doctor (patients only)
+func (h *MedibotHandler) handleRescheduleAppointment(c *gin.Context) {
+	appointmentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return
+	}
+
+	var req rescheduleAppointmentParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.StartsAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "startsAt must be in the future"})
+		return
+	}
+
+	patientID := currentUser(c).ID
+
+	var appointment repo.Appointment
+	err = h.querier.ExecTx(c, func(q repo.Querier) error {
+		current, err := q.GetAppointmentForUser(c, repo.GetAppointmentForUserParams{ID: appointmentID, UserID: patientID})
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return errAppointmentNotFound
+			}
+			return err
+		}
+
+		windows, err := q.ListDoctorAvailability(c, current.DoctorID)
+		if err != nil {
+			return err
+		}
+		slot, err := schedule.Fit(windows, req.StartsAt)
+		if err != nil {
+			return err
+		}
+
+		appointment, err = q.RescheduleAppointment(c, repo.RescheduleAppointmentParams{
+			StartsAt:  slot.StartsAt,
+			EndsAt:    slot.EndsAt,
+			ID:        appointmentID,
+			PatientID: patientID,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errAppointmentNotFound
+		}
+		return err
+	})
+	if err != nil {
+		h.appointmentError(c, err)
+		return
+	}
+
+	h.notify(c.Request.Context(), appointment.DoctorID, notificationKindAppointment, appointment.ConversationID,
+		"Appointment moved to "+appointment.StartsAt.UTC().Format(time.RFC1123))
+
+	c.JSON(http.StatusOK, appointment)
+}
+
+// cancel a booked appointment, for either side
+func (h *MedibotHandler) handleCancelAppointment(c *gin.Context) {
+	appointmentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return
+	}
+
+	user := currentUser(c)
+	appointment, err := h.querier.CancelAppointment(c, repo.CancelAppointmentParams{ID: appointmentID, UserID: user.ID})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = errAppointmentNotFound
+		}
+		h.appointmentError(c, err)
+		return
+	}
+
+	// Tell the other side
+	other := appointment.DoctorID
+	if user.ID == appointment.DoctorID {
+		other = appointment.PatientID
+	}
+	h.notify(c.Request.Context(), other, notificationKindAppointment, appointment.ConversationID,
+		"Appointment of "+appointment.StartsAt.UTC().Format(time.RFC1123)+" cancelled")
+
+	c.JSON(http.StatusOK, appointment)
+}
+
+// appointmentError answers a failed booking, rescheduling or cancellation.
+func (h *MedibotHandler) appointmentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errAppointmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booked appointment not found"})
+	case errors.Is(err, schedule.ErrNotAvailable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case isPgError(err, exclusionViolation):
+		c.JSON(http.StatusConflict, gin.H{"error": "This slot is no longer available"})
+	default:
+		log.Printf("ERROR: Failed to update appointment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update appointment"})
+	}
+}
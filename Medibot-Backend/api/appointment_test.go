@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"medibot.go/auth"
+	"medibot.go/db/repo"
+	"medibot.go/schedule"
+)
+
+// nextMonday returns 00:00 of the next Monday in the default timezone, at least a day ahead.
+func nextMonday(t *testing.T) time.Time {
+	t.Helper()
+	loc, err := time.LoadLocation(schedule.DefaultTimezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().In(loc)
+	day := time.Date(now.Year(), now.Month(), now.Day()+2, 0, 0, 0, 0, loc)
+	for day.Weekday() != time.Monday {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day
+}
+
+// addMondayMornings makes doctor available on Monday mornings, 09:00 to 12:00 in 30 minute slots.
+func (s *fakeStore) addMondayMornings(doctor repo.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.availability = append(s.availability, repo.DoctorAvailability{
+		ID: uuid.New(), DoctorID: doctor.ID, Weekday: int32(time.Monday),
+		StartMinute: 9 * 60, EndMinute: 12 * 60, SlotMinutes: 30, Timezone: schedule.DefaultTimezone,
+	})
+}
+
+func TestBookAppointment(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	other := store.addUser(auth.RolePatient, "other@example.com")
+	doctor := store.addUser(auth.RoleDoctor, "doctor@example.com")
+	store.addMondayMornings(doctor)
+	server := newTestServer(t, store)
+	monday := nextMonday(t)
+
+	tests := []struct {
+		name     string
+		email    string
+		doctorID uuid.UUID
+		startsAt time.Time
+		want     int
+	}{
+		{"free slot", patient.Email, doctor.ID, monday.Add(9 * time.Hour), http.StatusCreated},
+		{"slot just booked by someone else", other.Email, doctor.ID, monday.Add(9 * time.Hour), http.StatusConflict},
+		{"patient already booked then", patient.Email, doctor.ID, monday.Add(9 * time.Hour), http.StatusConflict},
+		{"next slot", other.Email, doctor.ID, monday.Add(9*time.Hour + 30*time.Minute), http.StatusCreated},
+		{"not the start of a slot", other.Email, doctor.ID, monday.Add(10*time.Hour + 15*time.Minute), http.StatusBadRequest},
+		{"outside the availability", other.Email, doctor.ID, monday.Add(14 * time.Hour), http.StatusBadRequest},
+		{"in the past", other.Email, doctor.ID, time.Now().Add(-time.Hour), http.StatusBadRequest},
+		{"unknown doctor", other.Email, uuid.New(), monday.Add(11 * time.Hour), http.StatusBadRequest},
+		{"doctors can't book", doctor.Email, doctor.ID, monday.Add(11 * time.Hour), http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		rec := server.do("POST", "/appointments", tt.email, map[string]any{"doctorId": tt.doctorID, "startsAt": tt.startsAt})
+		if rec.Code != tt.want {
+			t.Errorf("%s: POST /appointments = %d, want %d: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	if len(store.appointments) != 2 {
+		t.Fatalf("booked %d appointments, want 2", len(store.appointments))
+	}
+	booked := store.appointments[0]
+	if booked.PatientID != patient.ID || !booked.EndsAt.Equal(monday.Add(9*time.Hour+30*time.Minute)) {
+		t.Errorf("appointment = %+v, want the patient's 09:00 to 09:30 slot", booked)
+	}
+
+	// The booked slots are no longer offered.
+	rec := server.do("GET", "/doctors/"+doctor.ID.String()+"/slots?from="+monday.UTC().Format(time.RFC3339)+"&days=1", patient.Email, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET slots = %d: %s", rec.Code, rec.Body)
+	}
+	var slots []schedule.Slot
+	if err := json.Unmarshal(rec.Body.Bytes(), &slots); err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 4 || !slots[0].StartsAt.Equal(monday.Add(10*time.Hour)) {
+		t.Errorf("slots = %v, want the 4 slots from 10:00", slots)
+	}
+}
+
+func TestDoctorCalendarListsCancellations(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	doctor := store.addUser(auth.RoleDoctor, "doctor@example.com")
+	store.addMondayMornings(doctor)
+	server := newTestServer(t, store)
+	monday := nextMonday(t)
+
+	var ids []string
+	for _, startsAt := range []time.Time{monday.Add(9 * time.Hour), monday.Add(10 * time.Hour)} {
+		rec := server.do("POST", "/appointments", patient.Email, map[string]any{"doctorId": doctor.ID, "startsAt": startsAt})
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("POST /appointments = %d: %s", rec.Code, rec.Body)
+		}
+		var appointment repo.Appointment
+		if err := json.Unmarshal(rec.Body.Bytes(), &appointment); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, appointment.ID.String())
+	}
+	if rec := server.do("POST", "/appointments/"+ids[1]+"/cancel", patient.Email, nil); rec.Code != http.StatusOK {
+		t.Fatalf("cancel = %d: %s", rec.Code, rec.Body)
+	}
+
+	if rec := server.do("GET", "/doctors/"+doctor.ID.String()+"/calendar.ics", patient.Email, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("GET calendar as the patient = %d, want 403", rec.Code)
+	}
+
+	rec := server.do("GET", "/doctors/"+doctor.ID.String()+"/calendar.ics", doctor.Email, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET calendar = %d: %s", rec.Code, rec.Body)
+	}
+	events := strings.Split(rec.Body.String(), "BEGIN:VEVENT")[1:]
+	if len(events) != 2 {
+		t.Fatalf("calendar has %d events, want 2:\n%s", len(events), rec.Body)
+	}
+	for i, want := range []string{"STATUS:CONFIRMED", "STATUS:CANCELLED"} {
+		if !strings.Contains(events[i], "UID:"+ids[i]) || !strings.Contains(events[i], want) {
+			t.Errorf("event %d = %q, want %s with %s", i, events[i], ids[i], want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"medibot.go/audit"
+	"medibot.go/auth"
+	"medibot.go/db/repo"
+)
+
+// auditAccess records the access to patient data made while handling the request, and writes it
+// to the audit log with the caller and their IP once the request is handled.
+// It must run after requireToken, the caller is resolved afterwards by requireUser.
+func (h *MedibotHandler) auditAccess() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recorder := &audit.Recorder{}
+		c.Request = c.Request.WithContext(audit.WithRecorder(c.Request.Context(), recorder))
+
+		c.Next()
+
+		events := recorder.Flush()
+		if len(events) == 0 {
+			return
+		}
+		actor := audit.Actor{IP: c.ClientIP(), Erased: recorder.ActorErased()}
+		if user, ok := auth.UserFromContext(c.Request.Context()); ok {
+			actor.ID, actor.Role = user.ID, user.Role
+		}
+		// The events are written even when the client is gone, the data was accessed anyway.
+		if err := h.audit.Write(context.WithoutCancel(c.Request.Context()), actor, events); err != nil {
+			log.Printf("ERROR: Failed to write %d audit events of %s: %v", len(events), actor.ID.String(), err)
+		}
+	}
+}
+
+// list the audit log, newest first (admin only, ?from=&to=&actorId=&action=&targetType=&targetId=&limit=&offset=)
+func (h *MedibotHandler) handleListAuditEvents(c *gin.Context) {
+	from, to, ok := usagePeriod(c)
+	if !ok {
+		return
+	}
+	limit, offset := pageParams(c)
+
+	ids := map[string]uuid.UUID{}
+	for _, param := range []string{"actorId", "targetId"} {
+		if v := c.Query(param); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			ids[param] = id
+		}
+	}
+
+	events, err := h.querier.ListAuditEvents(c, repo.ListAuditEventsParams{
+		FromDay:    from,
+		ToDay:      to,
+		ActorID:    ids["actorId"],
+		Action:     c.Query("action"),
+		TargetType: c.Query("targetType"),
+		TargetID:   ids["targetId"],
+		PageLimit:  limit,
+		PageOffset: offset,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to list audit events: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get audit events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// check that no audit event was changed or removed (admin only)
+func (h *MedibotHandler) handleVerifyAuditLog(c *gin.Context) {
+	result, err := h.audit.Verify(c)
+	if err != nil {
+		log.Printf("ERROR: Failed to verify audit log: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify audit log"})
+		return
+	}
+	if !result.Valid {
+		log.Printf("ALERT: Audit log chain is broken at event %d: %s", result.BrokenAt, result.Reason)
+	}
+
+	c.JSON(http.StatusOK, result)
+}
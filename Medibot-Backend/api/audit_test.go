@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"medibot.go/audit"
+	"medibot.go/auth"
+)
+
+func TestAccessIsAudited(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	stranger := store.addUser(auth.RolePatient, "stranger@example.com")
+	admin := store.addUser(auth.RoleAdmin, "admin@example.com")
+	conversation := store.addConversation(patient)
+	store.addMessage(conversation, "user", "I have a headache")
+	server := newTestServer(t, store)
+
+	path := "/chat/messages?conId=" + conversation.ID.String()
+	if rec := server.do("GET", path, patient.Email, nil); rec.Code != http.StatusOK {
+		t.Fatalf("GET /chat/messages = %d: %s", rec.Code, rec.Body)
+	}
+
+	want := []audit.Event{
+		{Action: audit.ActionRead, TargetType: audit.TargetConversation, TargetID: conversation.ID},
+		{Action: audit.ActionRead, TargetType: audit.TargetMessage, TargetID: conversation.ID},
+	}
+	if got := store.audited(); !slices.Equal(got, want) {
+		t.Fatalf("audited %+v, want %+v", got, want)
+	}
+	for _, event := range store.auditEvents {
+		if event.ActorID != patient.ID || event.ActorRole != auth.RolePatient || event.Ip != "192.0.2.1" {
+			t.Errorf("event %d was made by %s (%s) from %q, want the patient", event.ID, event.ActorID, event.ActorRole, event.Ip)
+		}
+	}
+
+	// A refused access and a request touching no patient data leave no trace.
+	if rec := server.do("GET", path, stranger.Email, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("GET /chat/messages as a stranger = %d", rec.Code)
+	}
+	server.do("GET", "/doctors", patient.Email, nil)
+	if got := len(store.audited()); got != len(want) {
+		t.Errorf("audited %d events, want %d", got, len(want))
+	}
+
+	rec := server.do("GET", "/admin/audit/verify", admin.Email, nil)
+	var result audit.Verification
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid || result.Events != int64(len(want)) {
+		t.Errorf("verification = %+v, want the chain valid", result)
+	}
+}
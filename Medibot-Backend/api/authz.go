@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Authorization rules:
+//   - patients only see and delete their own conversations and summaries
+//     (enforced by the owner scoped *ForUser queries),
+//   - doctors only see summaries assigned to them through summaries.doctor_id,
+//   - admins manage users but get no implicit access to medical data.
+
+// requireRole only lets authenticated users with one of the given roles through.
+// It must run after requireUser.
+func requireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(roles, currentUser(c).Role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"medibot.go/auth"
+)
+
+func TestAuthorization(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	other := store.addUser(auth.RolePatient, "other@example.com")
+	doctor := store.addUser(auth.RoleDoctor, "doctor@example.com")
+	stranger := store.addUser(auth.RoleDoctor, "stranger@example.com")
+	admin := store.addUser(auth.RoleAdmin, "admin@example.com")
+
+	referred := store.addConversation(patient)
+	store.addMessage(referred, "user", "My chest hurts")
+	store.refer(referred, doctor)
+	private := store.addConversation(patient)
+	store.addMessage(private, "user", "I have a rash")
+	summary := store.addSummary(referred, doctor.ID)
+
+	server := newTestServer(t, store)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		email  string
+		want   int
+	}{
+		{"anonymous", "GET", "/conversations", "", http.StatusUnauthorized},
+		{"unregistered", "GET", "/conversations", "nobody@example.com", http.StatusForbidden},
+
+		{"owner reads messages", "GET", "/chat/messages?conId=" + private.ID.String(), patient.Email, http.StatusOK},
+		{"other patient reads messages", "GET", "/chat/messages?conId=" + private.ID.String(), other.Email, http.StatusNotFound},
+		{"referred doctor reads messages", "GET", "/chat/messages?conId=" + referred.ID.String(), doctor.Email, http.StatusOK},
+		{"referred doctor reads another conversation", "GET", "/chat/messages?conId=" + private.ID.String(), doctor.Email, http.StatusNotFound},
+		{"other doctor reads messages", "GET", "/chat/messages?conId=" + referred.ID.String(), stranger.Email, http.StatusNotFound},
+
+		{"owner reads summary", "GET", "/summary?id=" + summary.ID.String(), patient.Email, http.StatusOK},
+		{"assigned doctor reads summary", "GET", "/summary?id=" + summary.ID.String(), doctor.Email, http.StatusOK},
+		{"other patient reads summary", "GET", "/summary?id=" + summary.ID.String(), other.Email, http.StatusNotFound},
+		{"other doctor reads summary", "GET", "/summary?id=" + summary.ID.String(), stranger.Email, http.StatusNotFound},
+
+		{"other patient deletes conversation", "DELETE", "/conversation?conId=" + private.ID.String(), other.Email, http.StatusNotFound},
+		{"doctor deletes conversation", "DELETE", "/conversation?conId=" + referred.ID.String(), doctor.Email, http.StatusNotFound},
+		{"owner deletes conversation", "DELETE", "/conversation?conId=" + private.ID.String(), patient.Email, http.StatusOK},
+
+		{"patient lists users", "GET", "/admin/users", patient.Email, http.StatusForbidden},
+		{"doctor lists users", "GET", "/admin/users", doctor.Email, http.StatusForbidden},
+		{"admin lists users", "GET", "/admin/users", admin.Email, http.StatusOK},
+		{"patient creates doctor", "POST", "/doctors", patient.Email, http.StatusForbidden},
+		{"patient erases doctor", "DELETE", "/doctors/" + doctor.ID.String(), patient.Email, http.StatusForbidden},
+		{"doctor erases own account", "DELETE", "/me", doctor.Email, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := server.do(tt.method, tt.path, tt.email, nil)
+			if rec.Code != tt.want {
+				t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.path, rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestCreateUserOnlyRegistersPatients(t *testing.T) {
+	tests := []struct {
+		name string
+		role string
+		want int
+	}{
+		{"default", "", http.StatusOK},
+		{"patient", auth.RolePatient, http.StatusOK},
+		{"doctor", auth.RoleDoctor, http.StatusBadRequest},
+		{"admin", auth.RoleAdmin, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			server := newTestServer(t, store)
+
+			rec := server.do("POST", "/user", "new@example.com", map[string]string{
+				"email":    "victim@example.com",
+				"username": "new",
+				"role":     tt.role,
+			})
+			if rec.Code != tt.want {
+				t.Fatalf("POST /user = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+
+			if tt.want != http.StatusOK {
+				if len(store.users) != 0 {
+					t.Errorf("a %s account was created", tt.role)
+				}
+				return
+			}
+			if len(store.users) != 1 {
+				t.Fatalf("created %d users, want 1", len(store.users))
+			}
+			if user := store.users[0]; user.Role != auth.RolePatient || user.Email != "new@example.com" {
+				t.Errorf("created %s %s, want a patient for the token's email", user.Role, user.Email)
+			}
+		})
+	}
+}
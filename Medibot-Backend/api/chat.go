@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5"
+	"medibot.go/auth"
+	"medibot.go/chat"
+	"medibot.go/db/repo"
+)
+
+// chatTokenProtocol is the WebSocket subprotocol announcing that the next one is the bearer token.
+// Browsers can't set headers on WebSocket requests: they open the socket with the protocols
+// [chatTokenProtocol, token], which unlike a query parameter never shows up in the request logs.
+const chatTokenProtocol = "medibot.bearer"
+
+// newUpgrader creates the chat socket upgrader accepting the pages of the same origin
+// or of one of allowedOrigins, e.g. https://app.example.com.
+func newUpgrader(allowedOrigins []string) websocket.Upgrader {
+	return websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		Subprotocols:    []string{chatTokenProtocol},
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				// Not a browser, the client is not running a page of another site.
+				return true
+			}
+			if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+				return true
+			}
+			return slices.ContainsFunc(allowedOrigins, func(allowed string) bool {
+				return strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin)
+			})
+		},
+	}
+}
+
+// socketToken returns the bearer token passed in the subprotocols of a WebSocket request, see chatTokenProtocol.
+func socketToken(r *http.Request) string {
+	protocols := websocket.Subprotocols(r)
+	if len(protocols) != 2 || protocols[0] != chatTokenProtocol {
+		return ""
+	}
+	return protocols[1]
+}
+
+// conversationParticipant returns how the current user takes part in a conversation:
+// as its patient, or as a doctor who accepted a referral of it or was alerted of its red flag.
+// On failure it writes the error response itself and returns ok=false.
+func (h *MedibotHandler) conversationParticipant(c *gin.Context, conID uuid.UUID) (participant chat.Participant, ok bool) {
+	user := currentUser(c)
+
+	_, err := h.querier.GetConversation(c, repo.GetConversationParams{ID: conID, UserID: user.ID})
+	if err == nil {
+		return chat.Participant{UserID: user.ID, Sender: "user"}, true
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("ERROR: Failed to get conversation %s: %v", conID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get conversation"})
+		return
+	}
+
+	if user.Role == auth.RoleDoctor {
+		_, err = h.querier.GetConversationForDoctor(c, repo.GetConversationForDoctorParams{ID: conID, DoctorID: user.ID})
+		if err == nil {
+			return chat.Participant{UserID: user.ID, Sender: "doctor"}, true
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("ERROR: Failed to get conversation %s: %v", conID.String(), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get conversation"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+	return
+}
+
+// handleChatSocket upgrades to a WebSocket where the patient and the doctor of a conversation
+// exchange messages in real time, see the chat package for the events.
+// Browsers can't set headers on WebSocket requests, so the token may also be passed as a subprotocol, see chatTokenProtocol.
+func (h *MedibotHandler) handleChatSocket(c *gin.Context) {
+	conID, err := uuid.Parse(c.Query("conId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		return
+	}
+
+	participant, ok := h.conversationParticipant(c, conID)
+	if !ok {
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader already answered the client with an error.
+		log.Printf("ERROR: Failed to upgrade chat connection: %v", err)
+		return
+	}
+
+	h.hub.Serve(c.Request.Context(), conn, conID, participant)
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"medibot.go/auth"
+	"medibot.go/chat"
+	"medibot.go/db/repo"
+	"medibot.go/llm"
+)
+
+func TestConversationIgnoresClientSender(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	conversation := store.addConversation(patient)
+	server := newTestServer(t, store, "How long does it last?", "Do you feel it lying down?", "Drink water and stand up slowly.")
+
+	for _, sender := range []string{"doctor", "assistant", ""} {
+		rec := server.do("POST", "/chat", patient.Email, map[string]string{
+			"conId":   conversation.ID.String(),
+			"content": "I feel dizzy when I stand up",
+			"sender":  sender,
+		})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST /chat = %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	var senders []string
+	for _, message := range store.storedMessages(conversation.ID) {
+		senders = append(senders, message.Sender)
+	}
+	if got, want := strings.Join(senders, ","), "user,assistant,user,assistant,user,assistant"; got != want {
+		t.Errorf("senders = %s, want %s", got, want)
+	}
+}
+
+// namedModel is a Generate-only provider answering as model.
+type namedModel struct {
+	llm.Provider
+	model string
+}
+
+func (p namedModel) Generate(ctx context.Context, req llm.Request) (llm.Reply, error) {
+	reply, err := p.Provider.Generate(ctx, req)
+	if err == nil {
+		reply.Model = p.model
+	}
+	return reply, err
+}
+
+func TestConversationRecordsTheAnsweringModel(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	server := newTestServer(t, store)
+	// The primary model has nothing left to say, the backup answers.
+	server.handler.provider = llm.NewFallback(namedModel{llm.NewScripted(), "primary"}, namedModel{llm.NewScripted("How long does it last?"), "backup"})
+
+	rec := server.do("POST", "/chat", patient.Email, map[string]string{"content": "I feel dizzy when I stand up"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /chat = %d: %s", rec.Code, rec.Body)
+	}
+	reply := store.messages[len(store.messages)-1]
+	if reply.Sender != "assistant" || reply.Model != "backup" {
+		t.Errorf("saved reply %+v, want the backup's model", reply)
+	}
+}
+
+// dialChat opens the chat socket of a conversation as the user with email.
+func dialChat(t *testing.T, server *testServer, url string, conversation repo.Conversation, email string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	header := http.Header{}
+	if email != "" {
+		header.Set("Authorization", "Bearer "+server.token(email))
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/chat/ws?conId="+conversation.ID.String(), header)
+	if err == nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, resp, err
+}
+
+// readEvent reads the next event, failing the test after a second.
+func readEvent(t *testing.T, conn *websocket.Conn) chat.Event {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var event chat.Event
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("failed to read event: %v", err)
+	}
+	return event
+}
+
+func TestChatSocket(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	doctor := store.addUser(auth.RoleDoctor, "doctor@example.com")
+	stranger := store.addUser(auth.RoleDoctor, "stranger@example.com")
+	conversation := store.addConversation(patient)
+	store.refer(conversation, doctor)
+	server := newTestServer(t, store)
+	ts := httptest.NewServer(server.router)
+	t.Cleanup(ts.Close)
+
+	for _, tt := range []struct {
+		name  string
+		email string
+		want  int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"other doctor", stranger.Email, http.StatusNotFound},
+	} {
+		if _, resp, err := dialChat(t, server, ts.URL, conversation, tt.email); err == nil || resp == nil || resp.StatusCode != tt.want {
+			t.Errorf("%s: dial = %v, want a %d", tt.name, err, tt.want)
+		}
+	}
+
+	patientConn, _, err := dialChat(t, server, ts.URL, conversation, patient.Email)
+	if err != nil {
+		t.Fatalf("patient dial: %v", err)
+	}
+	doctorConn, _, err := dialChat(t, server, ts.URL, conversation, doctor.Email)
+	if err != nil {
+		t.Fatalf("doctor dial: %v", err)
+	}
+
+	// The sender of a message is the participant's role, whatever the client claims.
+	if err := doctorConn.WriteJSON(chat.Event{Type: chat.EventMessage, Sender: "user", Content: " Please come in tomorrow. "}); err != nil {
+		t.Fatal(err)
+	}
+	for _, conn := range []*websocket.Conn{doctorConn, patientConn} {
+		event := readEvent(t, conn)
+		if event.Type != chat.EventMessage || event.Sender != "doctor" || event.UserID != doctor.ID || event.Content != "Please come in tomorrow." {
+			t.Errorf("event = %+v, want the doctor's message", event)
+		}
+	}
+
+	if err := patientConn.WriteJSON(chat.Event{Type: chat.EventMessage, Sender: "doctor", Content: "Thank you"}); err != nil {
+		t.Fatal(err)
+	}
+	if event := readEvent(t, doctorConn); event.Sender != "user" || event.UserID != patient.ID {
+		t.Errorf("event = %+v, want the patient's message", event)
+	}
+	readEvent(t, patientConn) // the patient's own message
+
+	// Typing indicators only go to the other participant.
+	if err := patientConn.WriteJSON(chat.Event{Type: chat.EventTyping}); err != nil {
+		t.Fatal(err)
+	}
+	if event := readEvent(t, doctorConn); event.Type != chat.EventTyping || event.Sender != "user" {
+		t.Errorf("event = %+v, want the patient typing", event)
+	}
+
+	if err := patientConn.WriteJSON(chat.Event{Type: chat.EventMessage, Content: "  "}); err != nil {
+		t.Fatal(err)
+	}
+	if event := readEvent(t, patientConn); event.Type != chat.EventError {
+		t.Errorf("event = %+v, want an error for an empty message", event)
+	}
+
+	var stored []string
+	for _, message := range store.storedMessages(conversation.ID) {
+		stored = append(stored, message.Sender+": "+message.Content)
+	}
+	if got, want := strings.Join(stored, "\n"), "doctor: Please come in tomorrow.\nuser: Thank you"; got != want {
+		t.Errorf("stored messages:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestChatSocketHandshake(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	conversation := store.addConversation(patient)
+	server := newTestServer(t, store)
+	ts := httptest.NewServer(server.router)
+	t.Cleanup(ts.Close)
+	socketURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/chat/ws?conId=" + conversation.ID.String()
+	token := server.token(patient.Email)
+
+	tests := []struct {
+		name      string
+		query     string
+		protocols []string
+		origin    string
+		want      int
+	}{
+		{"token as subprotocol", "", []string{chatTokenProtocol, token}, "", http.StatusSwitchingProtocols},
+		{"token in the query", "&access_token=" + token, nil, "", http.StatusUnauthorized},
+		{"token without its protocol", "", []string{token}, "", http.StatusUnauthorized},
+		{"allowed origin", "", []string{chatTokenProtocol, token}, testOrigin, http.StatusSwitchingProtocols},
+		{"same origin", "", []string{chatTokenProtocol, token}, ts.URL, http.StatusSwitchingProtocols},
+		{"other origin", "", []string{chatTokenProtocol, token}, "https://evil.example.com", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			dialer := websocket.Dialer{Subprotocols: tt.protocols}
+			conn, resp, err := dialer.Dial(socketURL+tt.query, header)
+			if resp == nil {
+				t.Fatalf("dial: %v", err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Fatalf("dial = %d (%v), want %d", resp.StatusCode, err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			// The server must pick the marker protocol, never echo the token.
+			if conn.Subprotocol() != chatTokenProtocol {
+				t.Errorf("subprotocol = %q, want %q", conn.Subprotocol(), chatTokenProtocol)
+			}
+		})
+	}
+}
+
+func TestChatSocketReadReceipts(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	doctor := store.addUser(auth.RoleDoctor, "doctor@example.com")
+	conversation := store.addConversation(patient)
+	first := store.addMessage(conversation, "doctor", "How are you feeling?")
+	second := store.addMessage(conversation, "doctor", "Any fever?")
+	elsewhere := store.addMessage(store.addConversation(patient), "assistant", "Drink water.")
+	store.refer(conversation, doctor)
+	server := newTestServer(t, store)
+	ts := httptest.NewServer(server.router)
+	t.Cleanup(ts.Close)
+
+	patientConn, _, err := dialChat(t, server, ts.URL, conversation, patient.Email)
+	if err != nil {
+		t.Fatalf("patient dial: %v", err)
+	}
+	doctorConn, _, err := dialChat(t, server, ts.URL, conversation, doctor.Email)
+	if err != nil {
+		t.Fatalf("doctor dial: %v", err)
+	}
+
+	// Only the receipts moving the marker forward within the conversation reach the doctor:
+	// the typing event sent last shows nothing was sent in between.
+	for _, id := range []uuid.UUID{second.ID, first.ID, second.ID, elsewhere.ID} {
+		if err := patientConn.WriteJSON(chat.Event{Type: chat.EventRead, MessageID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := patientConn.WriteJSON(chat.Event{Type: chat.EventTyping}); err != nil {
+		t.Fatal(err)
+	}
+
+	if event := readEvent(t, doctorConn); event.Type != chat.EventRead || event.MessageID != second.ID || event.UserID != patient.ID {
+		t.Errorf("event = %+v, want the patient's read receipt of the last message", event)
+	}
+	if event := readEvent(t, doctorConn); event.Type != chat.EventTyping {
+		t.Errorf("event = %+v, want the patient typing and no other receipt", event)
+	}
+}
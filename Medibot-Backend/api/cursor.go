@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// pageCursor is a keyset pagination position: the sort time and the id of a row.
+// Clients get it as an opaque string and send it back unchanged.
+type pageCursor struct {
+	at time.Time
+	id uuid.UUID
+}
+
+func newPageCursor(at pgtype.Timestamp, id uuid.UUID) string {
+	raw := strconv.FormatInt(at.Time.UnixMicro(), 10) + ":" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// parsePageCursor decodes a cursor made by newPageCursor. An empty string is no cursor (ok=false).
+func parsePageCursor(s string) (cursor pageCursor, ok bool, err error) {
+	if s == "" {
+		return pageCursor{}, false, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, false, errInvalidCursor
+	}
+	micros, id, found := strings.Cut(string(raw), ":")
+	if !found {
+		return pageCursor{}, false, errInvalidCursor
+	}
+	unixMicro, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return pageCursor{}, false, errInvalidCursor
+	}
+	cursor.id, err = uuid.Parse(id)
+	if err != nil {
+		return pageCursor{}, false, errInvalidCursor
+	}
+	cursor.at = time.UnixMicro(unixMicro).UTC()
+	return cursor, true, nil
+}
+
+func (p pageCursor) timestamp() pgtype.Timestamp {
+	return pgtype.Timestamp{Time: p.at, Valid: true}
+}
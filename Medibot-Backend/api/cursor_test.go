@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"medibot.go/auth"
+	"medibot.go/db/repo"
+)
+
+func TestPageCursorRoundTrip(t *testing.T) {
+	id := uuid.New()
+	at := time.Date(2026, 3, 2, 9, 30, 15, 123456000, time.UTC)
+
+	cursor, ok, err := parsePageCursor(newPageCursor(pgtype.Timestamp{Time: at, Valid: true}, id))
+	if err != nil || !ok {
+		t.Fatalf("parsePageCursor = %v, %v", ok, err)
+	}
+	if !cursor.at.Equal(at) || cursor.id != id {
+		t.Errorf("cursor = %v %s, want %v %s", cursor.at, cursor.id, at, id)
+	}
+
+	// Timestamps are kept to the microsecond, as Postgres stores them.
+	cursor, _, _ = parsePageCursor(newPageCursor(pgtype.Timestamp{Time: at.Add(789), Valid: true}, id))
+	if !cursor.at.Equal(at) {
+		t.Errorf("cursor at %v, want %v", cursor.at, at)
+	}
+
+	if _, ok, err := parsePageCursor(""); ok || err != nil {
+		t.Errorf("parsePageCursor(\"\") = %v, %v, want no cursor", ok, err)
+	}
+}
+
+func TestInvalidPageCursor(t *testing.T) {
+	valid := newPageCursor(pgtype.Timestamp{Time: time.Now(), Valid: true}, uuid.New())
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "not a cursor!"},
+		{"padded", base64.URLEncoding.EncodeToString([]byte("1772440215123456:" + uuid.NewString()))},
+		{"truncated", valid[:len(valid)-4]},
+		{"extra characters", valid + "x"},
+		{"no id", encode("1772440215123456")},
+		{"time is not a number", encode("yesterday:" + uuid.NewString())},
+		{"id is not a uuid", encode("1772440215123456:42")},
+	}
+
+	for _, tt := range tests {
+		if _, ok, err := parsePageCursor(tt.cursor); !errors.Is(err, errInvalidCursor) || ok {
+			t.Errorf("%s: parsePageCursor(%q) = %v, %v, want errInvalidCursor", tt.name, tt.cursor, ok, err)
+		}
+	}
+}
+
+// TestMessagePagesOverTimestampTies pages through messages sharing timestamps, which only
+// their ids tell apart: each page starts right where the previous one stopped.
+func TestMessagePagesOverTimestampTies(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	conversation := store.addConversation(patient)
+
+	// Messages 1 to 3 are saved in the same microsecond, so are 4 and 5.
+	at := time.Now().Truncate(time.Microsecond).Add(-time.Hour)
+	var want []uuid.UUID
+	for i := 1; i <= 5; i++ {
+		id := uuid.MustParse(fmt.Sprintf("00000000-0000-0000-0000-%012d", i))
+		timestamp := at
+		if i > 3 {
+			timestamp = at.Add(time.Second)
+		}
+		want = append(want, id)
+		store.messages = append(store.messages, repo.Message{ID: id, ConID: conversation.ID, Sender: "user", Content: fmt.Sprint(i),
+			Timestamp: pgtype.Timestamp{Time: timestamp, Valid: true}})
+	}
+	rand.Shuffle(len(store.messages), func(i, j int) { store.messages[i], store.messages[j] = store.messages[j], store.messages[i] })
+	server := newTestServer(t, store)
+
+	page := func(query string) messagePage {
+		t.Helper()
+		rec := server.do("GET", "/chat/messages?limit=2&conId="+conversation.ID.String()+query, patient.Email, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET messages%s = %d: %s", query, rec.Code, rec.Body)
+		}
+		var page messagePage
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		return page
+	}
+	ids := func(page messagePage) []uuid.UUID {
+		var ids []uuid.UUID
+		for _, message := range page.Messages {
+			ids = append(ids, message.ID)
+		}
+		return ids
+	}
+
+	latest := page("")
+	older := page("&before=" + url.QueryEscape(latest.Before))
+	oldest := page("&before=" + url.QueryEscape(older.Before))
+	newer := page("&after=" + url.QueryEscape(oldest.After))
+	newest := page("&after=" + url.QueryEscape(latest.After))
+
+	tests := []struct {
+		name      string
+		page      messagePage
+		want      []uuid.UUID
+		wantOlder bool
+		wantNewer bool
+	}{
+		{"latest", latest, want[3:5], true, false},
+		{"before the latest", older, want[1:3], true, false},
+		{"before that", oldest, want[0:1], false, false},
+		{"after the oldest", newer, want[1:3], false, true},
+		{"after the latest", newest, nil, false, false},
+	}
+
+	for _, tt := range tests {
+		if got := ids(tt.page); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: messages %v, want %v", tt.name, got, tt.want)
+		}
+		if tt.page.HasOlder != tt.wantOlder || tt.page.HasNewer != tt.wantNewer {
+			t.Errorf("%s: hasOlder %v, hasNewer %v, want %v and %v", tt.name, tt.page.HasOlder, tt.page.HasNewer, tt.wantOlder, tt.wantNewer)
+		}
+	}
+
+	for _, query := range []string{"&before=not-a-cursor", "&after=not-a-cursor", "&before=" + latest.Before + "&after=" + latest.After} {
+		rec := server.do("GET", "/chat/messages?conId="+conversation.ID.String()+query, patient.Email, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET messages%s = %d, want 400", query, rec.Code)
+		}
+	}
+}
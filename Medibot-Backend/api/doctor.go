@@ -0,0 +1,208 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"medibot.go/auth"
+	"medibot.go/db/repo"
+)
+
+// publicDoctor is a doctor as shown in the directory to every user: their email, license and
+// on-call status are only for admins, who get the whole repo.User.
+type publicDoctor struct {
+	ID         uuid.UUID `json:"id"`
+	Username   string    `json:"username"`
+	Specialty  string    `json:"specialty"`
+	Experience string    `json:"experience"`
+	Location   string    `json:"location"`
+}
+
+// directoryEntry returns doctor as the current user may see it.
+func directoryEntry(c *gin.Context, doctor repo.User) any {
+	if currentUser(c).Role == auth.RoleAdmin {
+		return doctor
+	}
+	return publicDoctor{
+		ID:         doctor.ID,
+		Username:   doctor.Username,
+		Specialty:  doctor.Specialty,
+		Experience: doctor.Experience,
+		Location:   doctor.Location,
+	}
+}
+
+// list doctors, optionally filtered by location (partial match) and specialty slug
+func (h *MedibotHandler) handleListDoctors(c *gin.Context) {
+	limit, offset := pageParams(c)
+
+	doctors, err := h.querier.ListDoctors(c, repo.ListDoctorsParams{
+		Location:   c.Query("location"),
+		Specialty:  c.Query("specialty"),
+		PageLimit:  limit,
+		PageOffset: offset,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to list doctors: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve doctors"})
+		return
+	}
+
+	directory := make([]any, 0, len(doctors))
+	for _, doctor := range doctors {
+		directory = append(directory, directoryEntry(c, doctor))
+	}
+	c.JSON(http.StatusOK, directory)
+}
+
+// get one doctor of the directory
+func (h *MedibotHandler) handleGetDoctor(c *gin.Context) {
+	doctorID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid doctor ID"})
+		return
+	}
+
+	doctor, err := h.querier.GetDoctor(c, doctorID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Doctor not found"})
+			return
+		}
+		log.Printf("ERROR: Failed to get doctor %s: %v", doctorID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve doctor"})
+		return
+	}
+
+	c.JSON(http.StatusOK, directoryEntry(c, doctor))
+}
+
+type doctorParams struct {
+	Email         string `json:"email"` // only used on creation, a doctor's email identifies their login
+	Username      string `json:"username" binding:"required"`
+	Experience    string `json:"experience"`
+	Location      string `json:"location"`
+	LicenseNumber string `json:"license_number" binding:"required"`
+	Specialty     string `json:"specialty"` // specialty slug, see GET /specialties
+}
+
+// validSpecialty reports whether slug is empty or an existing specialty.
+// On a database error it writes the error response itself.
+func (h *MedibotHandler) validSpecialty(c *gin.Context, slug string) bool {
+	if slug == "" {
+		return true
+	}
+
+	if _, err := h.querier.GetSpecialty(c, slug); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown specialty"})
+			return false
+		}
+		log.Printf("ERROR: Failed to get specialty %s: %v", slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get specialty"})
+		return false
+	}
+	return true
+}
+
+// add a doctor to the directory (admin only)
+// The doctor can sign in right away with an identity token for the same email.
+func (h *MedibotHandler) handleCreateDoctor(c *gin.Context) {
+	var req doctorParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email is required"})
+		return
+	}
+	if !h.validSpecialty(c, req.Specialty) {
+		return
+	}
+
+	doctor, err := h.querier.CreateDoctor(c, repo.CreateDoctorParams{
+		Email:         req.Email,
+		Username:      req.Username,
+		Experience:    req.Experience,
+		Location:      req.Location,
+		LicenseNumber: req.LicenseNumber,
+		Specialty:     req.Specialty,
+	})
+	if err != nil {
+		if isPgError(err, uniqueViolation) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A user with this email already exists"})
+			return
+		}
+		log.Printf("ERROR: Failed to create doctor: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create doctor"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, doctor)
+}
+
+// update a doctor's profile (admin only)
+func (h *MedibotHandler) handleUpdateDoctor(c *gin.Context) {
+	doctorID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid doctor ID"})
+		return
+	}
+
+	var req doctorParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.validSpecialty(c, req.Specialty) {
+		return
+	}
+
+	doctor, err := h.querier.UpdateDoctor(c, repo.UpdateDoctorParams{
+		ID:            doctorID,
+		Username:      req.Username,
+		Experience:    req.Experience,
+		Location:      req.Location,
+		LicenseNumber: req.LicenseNumber,
+		Specialty:     req.Specialty,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Doctor not found"})
+			return
+		}
+		log.Printf("ERROR: Failed to update doctor %s: %v", doctorID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update doctor"})
+		return
+	}
+
+	c.JSON(http.StatusOK, doctor)
+}
+
+// remove a doctor from the directory (admin only)
+// Their summaries are kept and become unassigned.
+func (h *MedibotHandler) handleDeleteDoctor(c *gin.Context) {
+	doctorID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid doctor ID"})
+		return
+	}
+
+	deleted, err := h.querier.DeleteDoctor(c, doctorID)
+	if err != nil {
+		log.Printf("ERROR: Failed to delete doctor %s: %v", doctorID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete doctor"})
+		return
+	}
+	if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Doctor not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Doctor deleted successfully"})
+}
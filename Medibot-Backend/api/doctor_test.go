@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"testing"
+
+	"medibot.go/auth"
+)
+
+func TestDoctorDirectoryHidesPrivateFields(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	doctor := store.addUser(auth.RoleDoctor, "doctor@example.com")
+	store.users[1].OnCall = true
+	store.users[1].LicenseNumber = "CM-1234"
+	store.users[1].Specialty = "cardiology"
+	store.users[1].Experience = "10 years at the Yaoundé General Hospital"
+	store.users[1].Location = "Yaoundé"
+	admin := store.addUser(auth.RoleAdmin, "admin@example.com")
+	server := newTestServer(t, store)
+
+	rec := server.do("GET", "/doctors", patient.Email, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /doctors = %d: %s", rec.Code, rec.Body)
+	}
+	var directory []map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &directory); err != nil {
+		t.Fatal(err)
+	}
+	if len(directory) != 1 {
+		t.Fatalf("listed %d doctors, want 1", len(directory))
+	}
+
+	rec = server.do("GET", "/doctors/"+doctor.ID.String(), patient.Email, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /doctors/:id = %d: %s", rec.Code, rec.Body)
+	}
+	var one map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &one); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"experience", "id", "location", "specialty", "username"}
+	for _, got := range []map[string]any{directory[0], one} {
+		if keys := slices.Sorted(maps.Keys(got)); !slices.Equal(keys, want) {
+			t.Errorf("fields = %v, want %v", keys, want)
+		}
+		if got["id"] != doctor.ID.String() || got["experience"] != "10 years at the Yaoundé General Hospital" ||
+			got["location"] != "Yaoundé" || got["specialty"] != "cardiology" {
+			t.Errorf("doctor = %v", got)
+		}
+	}
+
+	// Admins maintain the directory and see the whole record.
+	for _, path := range []string{"/doctors", "/doctors/" + doctor.ID.String()} {
+		rec := server.do("GET", path, admin.Email, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s as admin = %d: %s", path, rec.Code, rec.Body)
+		}
+		var full map[string]any
+		if path == "/doctors" {
+			var all []map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &all); err != nil || len(all) != 1 {
+				t.Fatalf("GET /doctors as admin = %s, %v", rec.Body, err)
+			}
+			full = all[0]
+		} else if err := json.Unmarshal(rec.Body.Bytes(), &full); err != nil {
+			t.Fatal(err)
+		}
+		if full["license_number"] != "CM-1234" || full["email"] != doctor.Email || full["on_call"] != true {
+			t.Errorf("GET %s as admin = %v, want the license, email and on-call status", path, full)
+		}
+	}
+}
@@ -0,0 +1,806 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"medibot.go/audit"
+	"medibot.go/auth"
+	"medibot.go/db/repo"
+	"medibot.go/history"
+	"medibot.go/llm"
+	"medibot.go/prompt"
+	"medibot.go/redflag"
+	"medibot.go/title"
+)
+
+// fakeStore is an in-memory repo.Store for the handler tests. The queries it doesn't implement
+// call the nil embedded Querier and panic, which the router answers with a 500.
+type fakeStore struct {
+	repo.Querier
+
+	mu            sync.Mutex
+	users         []repo.User
+	conversations []repo.Conversation
+	messages      []repo.Message
+	summaries     []repo.Summary
+	// doctors maps a conversation to the doctor who accepted the referral of its summary.
+	doctors       map[uuid.UUID]uuid.UUID
+	usage         []repo.RecordUsageParams
+	notifications []repo.CreateNotificationParams
+	searchResults []repo.SearchForUserRow // the results of any search
+	auditEvents   []repo.AuditEvent
+	// reads maps a conversation and a participant to the last message they read.
+	reads        map[[2]uuid.UUID]uuid.UUID
+	availability []repo.DoctorAvailability
+	appointments []repo.Appointment
+	referrals    []repo.Referral
+	// idempotencyKeys never expire, unlike the ones in the database.
+	idempotencyKeys []repo.IdempotencyKey
+	// assignErr fails AssignSummaryDoctor, e.g. to roll back an accepted referral.
+	assignErr error
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{doctors: map[uuid.UUID]uuid.UUID{}, reads: map[[2]uuid.UUID]uuid.UUID{}}
+}
+
+// ExecTx runs fn without isolation, the tests don't run concurrent transactions. The referrals
+// and summaries are restored when fn fails, as a rollback would.
+func (s *fakeStore) ExecTx(ctx context.Context, fn func(repo.Querier) error) error {
+	s.mu.Lock()
+	referrals, summaries := slices.Clone(s.referrals), slices.Clone(s.summaries)
+	s.mu.Unlock()
+
+	err := fn(s)
+	if err != nil {
+		s.mu.Lock()
+		s.referrals, s.summaries = referrals, summaries
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *fakeStore) addUser(role, email string) repo.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := repo.User{ID: uuid.New(), Email: email, Username: email, Role: role}
+	s.users = append(s.users, user)
+	return user
+}
+
+func (s *fakeStore) addConversation(owner repo.User) repo.Conversation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conversation := repo.Conversation{ID: uuid.New(), UserID: owner.ID, Specialty: "cardiology", CreatedAt: pgtype.Timestamp{Time: time.Now(), Valid: true}}
+	s.conversations = append(s.conversations, conversation)
+	return conversation
+}
+
+func (s *fakeStore) addMessage(conversation repo.Conversation, sender, content string) repo.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	message := repo.Message{ID: uuid.New(), ConID: conversation.ID, Sender: sender, Content: content, Timestamp: pgtype.Timestamp{Time: time.Now().Truncate(time.Microsecond), Valid: true}}
+	s.messages = append(s.messages, message)
+	return message
+}
+
+func (s *fakeStore) addSummary(conversation repo.Conversation, doctor uuid.UUID) repo.Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary := repo.Summary{ID: uuid.New(), ConversationID: conversation.ID, PatientID: conversation.UserID, DoctorID: doctor, Content: "Chest pain", Severity: "moderate"}
+	s.summaries = append(s.summaries, summary)
+	return summary
+}
+
+// refer gives doctor access to conversation, as an accepted referral does.
+func (s *fakeStore) refer(conversation repo.Conversation, doctor repo.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.doctors[conversation.ID] = doctor.ID
+}
+
+func (s *fakeStore) GetUserByEmail(ctx context.Context, email string) (repo.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return repo.User{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) GetUser(ctx context.Context, id uuid.UUID) (repo.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return repo.User{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) GetDoctor(ctx context.Context, id uuid.UUID) (repo.User, error) {
+	user, err := s.GetUser(ctx, id)
+	if err == nil && user.Role != auth.RoleDoctor {
+		return repo.User{}, pgx.ErrNoRows
+	}
+	return user, err
+}
+
+func (s *fakeStore) ListDoctors(ctx context.Context, arg repo.ListDoctorsParams) ([]repo.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var doctors []repo.User
+	for _, user := range s.users {
+		if user.Role == auth.RoleDoctor {
+			doctors = append(doctors, user)
+		}
+	}
+	return doctors, nil
+}
+
+func (s *fakeStore) CreateUser(ctx context.Context, arg repo.CreateUserParams) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := repo.User{ID: uuid.New(), Email: arg.Email, Username: arg.Username, Role: arg.Role, Location: arg.Location}
+	s.users = append(s.users, user)
+	return user.ID, nil
+}
+
+func (s *fakeStore) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.users)
+	s.users = slices.DeleteFunc(s.users, func(u repo.User) bool { return u.ID == id })
+	if len(s.users) == n {
+		return 0, nil
+	}
+	// ON DELETE CASCADE
+	var owned []uuid.UUID
+	s.conversations = slices.DeleteFunc(s.conversations, func(c repo.Conversation) bool {
+		if c.UserID == id {
+			owned = append(owned, c.ID)
+			return true
+		}
+		return false
+	})
+	s.messages = slices.DeleteFunc(s.messages, func(m repo.Message) bool { return slices.Contains(owned, m.ConID) })
+	s.summaries = slices.DeleteFunc(s.summaries, func(sum repo.Summary) bool { return sum.PatientID == id })
+	return 1, nil
+}
+
+func (s *fakeStore) ExportConversations(ctx context.Context, userID uuid.UUID) ([]repo.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var conversations []repo.Conversation
+	for _, conversation := range s.conversations {
+		if conversation.UserID == userID {
+			conversations = append(conversations, conversation)
+		}
+	}
+	return conversations, nil
+}
+
+func (s *fakeStore) ExportMessages(ctx context.Context, userID uuid.UUID) ([]repo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var messages []repo.Message
+	for _, conversation := range s.conversations {
+		if conversation.UserID == userID {
+			messages = append(messages, s.conversationMessages(conversation.ID)...)
+		}
+	}
+	return messages, nil
+}
+
+func (s *fakeStore) ExportSummaries(ctx context.Context, patientID uuid.UUID) ([]repo.Summary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var summaries []repo.Summary
+	for _, summary := range s.summaries {
+		if summary.PatientID == patientID {
+			summaries = append(summaries, summary)
+		}
+	}
+	return summaries, nil
+}
+
+func (s *fakeStore) GetConversation(ctx context.Context, arg repo.GetConversationParams) (repo.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conversation := range s.conversations {
+		if conversation.ID == arg.ID && conversation.UserID == arg.UserID {
+			return conversation, nil
+		}
+	}
+	return repo.Conversation{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) GetConversationForDoctor(ctx context.Context, arg repo.GetConversationForDoctorParams) (repo.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alerted := slices.ContainsFunc(s.notifications, func(n repo.CreateNotificationParams) bool {
+		return n.ConversationID == arg.ID && n.UserID == arg.DoctorID && n.Kind == notificationKindRedFlag
+	})
+	if s.doctors[arg.ID] != arg.DoctorID && !alerted {
+		return repo.Conversation{}, pgx.ErrNoRows
+	}
+	for _, conversation := range s.conversations {
+		if conversation.ID == arg.ID {
+			return conversation, nil
+		}
+	}
+	return repo.Conversation{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) DeleteConversationForUser(ctx context.Context, arg repo.DeleteConversationForUserParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.conversations)
+	s.conversations = slices.DeleteFunc(s.conversations, func(c repo.Conversation) bool {
+		return c.ID == arg.ID && c.UserID == arg.UserID
+	})
+	return int64(n - len(s.conversations)), nil
+}
+
+// storedMessages returns the messages of a conversation, oldest first.
+func (s *fakeStore) storedMessages(conID uuid.UUID) []repo.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conversationMessages(conID)
+}
+
+// conversationMessages is storedMessages for a caller holding the lock.
+func (s *fakeStore) conversationMessages(conID uuid.UUID) []repo.Message {
+	var messages []repo.Message
+	for _, message := range s.messages {
+		if message.ConID == conID {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// compareMessages orders messages by timestamp then id, as the message pages are.
+func compareMessages(a, b repo.Message) int {
+	if c := a.Timestamp.Time.Compare(b.Timestamp.Time); c != 0 {
+		return c
+	}
+	return bytes.Compare(a.ID[:], b.ID[:])
+}
+
+func (s *fakeStore) ListMessagesBefore(ctx context.Context, arg repo.ListMessagesBeforeParams) ([]repo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cursor := repo.Message{Timestamp: arg.CursorTimestamp, ID: arg.CursorID}
+	messages := slices.DeleteFunc(s.conversationMessages(arg.ConID), func(m repo.Message) bool {
+		return arg.HasCursor && compareMessages(m, cursor) >= 0
+	})
+	slices.SortFunc(messages, func(a, b repo.Message) int { return compareMessages(b, a) })
+	return messages[:min(len(messages), int(arg.PageLimit))], nil
+}
+
+func (s *fakeStore) ListMessagesAfter(ctx context.Context, arg repo.ListMessagesAfterParams) ([]repo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cursor := repo.Message{Timestamp: arg.CursorTimestamp, ID: arg.CursorID}
+	messages := slices.DeleteFunc(s.conversationMessages(arg.ConID), func(m repo.Message) bool {
+		return compareMessages(m, cursor) <= 0
+	})
+	slices.SortFunc(messages, compareMessages)
+	return messages[:min(len(messages), int(arg.PageLimit))], nil
+}
+
+func (s *fakeStore) GetConMessages(ctx context.Context, id uuid.UUID) ([]repo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conversationMessages(id), nil
+}
+
+func (s *fakeStore) CreateConversation(ctx context.Context, arg repo.CreateConversationParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conversations = append(s.conversations, repo.Conversation{ID: arg.ID, UserID: arg.UserID, Specialty: arg.Specialty})
+	return nil
+}
+
+func (s *fakeStore) CreateMessage(ctx context.Context, arg repo.CreateMessageParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, repo.Message{ID: uuid.New(), ConID: arg.ConID, Sender: arg.Sender, Content: arg.Content,
+		Timestamp: pgtype.Timestamp{Time: time.Now().Truncate(time.Microsecond), Valid: true}, PromptVersion: arg.PromptVersion, Model: arg.Model})
+	return nil
+}
+
+func (s *fakeStore) CreateChatMessage(ctx context.Context, arg repo.CreateChatMessageParams) (repo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	message := repo.Message{ID: uuid.New(), ConID: arg.ConID, Sender: arg.Sender, Content: arg.Content, Timestamp: pgtype.Timestamp{Time: time.Now().Truncate(time.Microsecond), Valid: true}}
+	s.messages = append(s.messages, message)
+	return message, nil
+}
+
+func (s *fakeStore) MarkConversationRead(ctx context.Context, arg repo.MarkConversationReadParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The messages are stored in order, their index orders them.
+	index := func(id uuid.UUID) int {
+		return slices.IndexFunc(s.messages, func(m repo.Message) bool { return m.ID == id && m.ConID == arg.ConversationID })
+	}
+	read := index(arg.LastReadMessageID)
+	if read < 0 {
+		return 0, nil
+	}
+	key := [2]uuid.UUID{arg.ConversationID, arg.UserID}
+	if last, ok := s.reads[key]; ok && index(last) >= read {
+		return 0, nil
+	}
+	s.reads[key] = arg.LastReadMessageID
+	return 1, nil
+}
+
+func (s *fakeStore) MarkConversationRedFlag(ctx context.Context, arg repo.MarkConversationRedFlagParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.conversations {
+		if s.conversations[i].ID == arg.ID {
+			s.conversations[i].RedFlag = arg.RedFlag
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) GetSpecialty(ctx context.Context, slug string) (repo.Specialty, error) {
+	if slug != "cardiology" {
+		return repo.Specialty{}, pgx.ErrNoRows
+	}
+	return repo.Specialty{Slug: slug, Name: "Cardiology", PromptName: "cardiology", FollowUpQuestions: 3, Active: true}, nil
+}
+
+func (s *fakeStore) GetRollingSummary(ctx context.Context, conversationID uuid.UUID) (repo.RollingSummary, error) {
+	return repo.RollingSummary{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) RecordUsage(ctx context.Context, arg repo.RecordUsageParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage = append(s.usage, arg)
+	return nil
+}
+
+func (s *fakeStore) ListOnCallDoctors(ctx context.Context) ([]repo.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var doctors []repo.User
+	for _, user := range s.users {
+		if user.Role == auth.RoleDoctor && user.OnCall {
+			doctors = append(doctors, user)
+		}
+	}
+	return doctors, nil
+}
+
+func (s *fakeStore) CreateNotification(ctx context.Context, arg repo.CreateNotificationParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifications = append(s.notifications, arg)
+	return nil
+}
+
+func (s *fakeStore) ListDoctorAvailability(ctx context.Context, doctorID uuid.UUID) ([]repo.DoctorAvailability, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var windows []repo.DoctorAvailability
+	for _, window := range s.availability {
+		if window.DoctorID == doctorID {
+			windows = append(windows, window)
+		}
+	}
+	return windows, nil
+}
+
+// CreateAppointment rejects an overlapping booking of the doctor or the patient as the exclusion constraints do.
+func (s *fakeStore) CreateAppointment(ctx context.Context, arg repo.CreateAppointmentParams) (repo.Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.appointments {
+		overlaps := other.StartsAt.Before(arg.EndsAt) && arg.StartsAt.Before(other.EndsAt)
+		if other.Status == "booked" && overlaps && (other.DoctorID == arg.DoctorID || other.PatientID == arg.PatientID) {
+			return repo.Appointment{}, &pgconn.PgError{Code: exclusionViolation}
+		}
+	}
+	now := time.Now()
+	appointment := repo.Appointment{
+		ID: uuid.New(), DoctorID: arg.DoctorID, PatientID: arg.PatientID, ConversationID: arg.ConversationID, SummaryID: arg.SummaryID,
+		StartsAt: arg.StartsAt, EndsAt: arg.EndsAt, Status: "booked", Note: arg.Note, CreatedAt: now, UpdatedAt: now,
+	}
+	s.appointments = append(s.appointments, appointment)
+	return appointment, nil
+}
+
+func (s *fakeStore) CancelAppointment(ctx context.Context, arg repo.CancelAppointmentParams) (repo.Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, appointment := range s.appointments {
+		if appointment.ID == arg.ID && (appointment.PatientID == arg.UserID || appointment.DoctorID == arg.UserID) && appointment.Status == "booked" {
+			s.appointments[i].Status = "cancelled"
+			s.appointments[i].UpdatedAt = time.Now()
+			return s.appointments[i], nil
+		}
+	}
+	return repo.Appointment{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) ListDoctorAppointments(ctx context.Context, arg repo.ListDoctorAppointmentsParams) ([]repo.Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var appointments []repo.Appointment
+	for _, a := range s.appointments {
+		if a.DoctorID == arg.DoctorID && a.Status == "booked" && a.StartsAt.Before(arg.Until) && a.EndsAt.After(arg.Since) {
+			appointments = append(appointments, a)
+		}
+	}
+	return appointments, nil
+}
+
+func (s *fakeStore) ListDoctorCalendar(ctx context.Context, arg repo.ListDoctorCalendarParams) ([]repo.Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var appointments []repo.Appointment
+	for _, a := range s.appointments {
+		listed := a.Status == "booked" || (a.Status == "cancelled" && !a.UpdatedAt.Before(arg.CancelledSince))
+		if a.DoctorID == arg.DoctorID && listed && a.StartsAt.Before(arg.Until) && a.EndsAt.After(arg.Since) {
+			appointments = append(appointments, a)
+		}
+	}
+	return appointments, nil
+}
+
+func (s *fakeStore) UpsertTriageSummary(ctx context.Context, arg repo.UpsertTriageSummaryParams) (repo.Summary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary := repo.Summary{ID: uuid.New(), ConversationID: arg.ConversationID, PatientID: arg.PatientID, Content: arg.Content, Severity: arg.Severity}
+	s.summaries = append(s.summaries, summary)
+	return summary, nil
+}
+
+func (s *fakeStore) GetSummaryForUser(ctx context.Context, arg repo.GetSummaryForUserParams) (repo.Summary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, summary := range s.summaries {
+		if summary.ID == arg.ID && (summary.PatientID == arg.UserID || summary.DoctorID == arg.UserID) {
+			return summary, nil
+		}
+	}
+	return repo.Summary{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) GetSummary(ctx context.Context, id uuid.UUID) (repo.Summary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, summary := range s.summaries {
+		if summary.ID == id {
+			return summary, nil
+		}
+	}
+	return repo.Summary{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) AssignSummaryDoctor(ctx context.Context, arg repo.AssignSummaryDoctorParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.assignErr != nil {
+		return s.assignErr
+	}
+	for i, summary := range s.summaries {
+		if summary.ID == arg.ID {
+			s.summaries[i].DoctorID = arg.DoctorID
+		}
+	}
+	return nil
+}
+
+// CreateReferral rejects a second open referral of a summary as the partial unique index does.
+func (s *fakeStore) CreateReferral(ctx context.Context, arg repo.CreateReferralParams) (repo.Referral, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.referrals {
+		if other.SummaryID == arg.SummaryID && (other.Status == "pending" || other.Status == "accepted") {
+			return repo.Referral{}, &pgconn.PgError{Code: uniqueViolation}
+		}
+	}
+	now := time.Now()
+	referral := repo.Referral{
+		ID: uuid.New(), SummaryID: arg.SummaryID, PatientID: arg.PatientID, DoctorID: arg.DoctorID,
+		Status: "pending", Note: arg.Note, CreatedAt: now, UpdatedAt: now,
+	}
+	s.referrals = append(s.referrals, referral)
+	return referral, nil
+}
+
+func (s *fakeStore) GetReferralForUser(ctx context.Context, arg repo.GetReferralForUserParams) (repo.Referral, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, referral := range s.referrals {
+		if referral.ID == arg.ID && (referral.PatientID == arg.UserID || referral.DoctorID == arg.UserID) {
+			return referral, nil
+		}
+	}
+	return repo.Referral{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) UpdateReferralStatus(ctx context.Context, arg repo.UpdateReferralStatusParams) (repo.Referral, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, referral := range s.referrals {
+		if referral.ID == arg.ID && referral.DoctorID == arg.DoctorID && referral.Status == arg.FromStatus {
+			s.referrals[i].Status = arg.ToStatus
+			s.referrals[i].UpdatedAt = time.Now()
+			return s.referrals[i], nil
+		}
+	}
+	return repo.Referral{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) CloseReferral(ctx context.Context, arg repo.CloseReferralParams) (repo.Referral, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, referral := range s.referrals {
+		answered := referral.Status == "accepted" || referral.Status == "declined"
+		if referral.ID == arg.ID && (referral.PatientID == arg.UserID || referral.DoctorID == arg.UserID) && answered {
+			s.referrals[i].Status = "closed"
+			s.referrals[i].UpdatedAt = time.Now()
+			return s.referrals[i], nil
+		}
+	}
+	return repo.Referral{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) ReserveIdempotencyKey(ctx context.Context, arg repo.ReserveIdempotencyKeyParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range s.idempotencyKeys {
+		if key.UserID == arg.UserID && key.Key == arg.Key {
+			return 0, nil
+		}
+	}
+	s.idempotencyKeys = append(s.idempotencyKeys, repo.IdempotencyKey{UserID: arg.UserID, Key: arg.Key, RequestHash: arg.RequestHash, CreatedAt: time.Now()})
+	return 1, nil
+}
+
+func (s *fakeStore) GetIdempotencyKey(ctx context.Context, arg repo.GetIdempotencyKeyParams) (repo.IdempotencyKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range s.idempotencyKeys {
+		if key.UserID == arg.UserID && key.Key == arg.Key {
+			return key, nil
+		}
+	}
+	return repo.IdempotencyKey{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) CompleteIdempotencyKey(ctx context.Context, arg repo.CompleteIdempotencyKeyParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, key := range s.idempotencyKeys {
+		if key.UserID == arg.UserID && key.Key == arg.Key {
+			s.idempotencyKeys[i].StatusCode = arg.StatusCode
+			s.idempotencyKeys[i].Response = arg.Response
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) ReleaseIdempotencyKey(ctx context.Context, arg repo.ReleaseIdempotencyKeyParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idempotencyKeys = slices.DeleteFunc(s.idempotencyKeys, func(key repo.IdempotencyKey) bool {
+		return key.UserID == arg.UserID && key.Key == arg.Key && key.StatusCode == 0
+	})
+	return nil
+}
+
+func (s *fakeStore) ListUsers(ctx context.Context, arg repo.ListUsersParams) ([]repo.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.users), nil
+}
+
+func (s *fakeStore) SearchForUser(ctx context.Context, arg repo.SearchForUserParams) ([]repo.SearchForUserRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.searchResults), nil
+}
+
+func (s *fakeStore) LockAuditLog(ctx context.Context) error {
+	return nil
+}
+
+func (s *fakeStore) GetLastAuditEvent(ctx context.Context) (repo.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.auditEvents) == 0 {
+		return repo.AuditEvent{}, pgx.ErrNoRows
+	}
+	return s.auditEvents[len(s.auditEvents)-1], nil
+}
+
+func (s *fakeStore) CreateAuditEvent(ctx context.Context, arg repo.CreateAuditEventParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auditEvents = append(s.auditEvents, repo.AuditEvent(arg))
+	return nil
+}
+
+func (s *fakeStore) ListAuditChain(ctx context.Context, arg repo.ListAuditChainParams) ([]repo.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []repo.AuditEvent
+	for _, event := range s.auditEvents {
+		if event.ID > arg.ID && len(events) < int(arg.Limit) {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (s *fakeStore) PseudonymizeAuditEvents(ctx context.Context, actorID uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var updated int64
+	for i := range s.auditEvents {
+		if s.auditEvents[i].ActorID == actorID {
+			s.auditEvents[i].ActorID, s.auditEvents[i].Ip = uuid.Nil, ""
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+// audited returns the audit events written, without their chaining.
+func (s *fakeStore) audited() []audit.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []audit.Event
+	for _, e := range s.auditEvents {
+		events = append(events, audit.Event{Action: e.Action, TargetType: e.TargetType, TargetID: e.TargetID})
+	}
+	return events
+}
+
+const (
+	testIssuer   = "https://securetoken.google.com/medibot-test"
+	testAudience = "medibot-test"
+	testKeyID    = "test-key"
+	testAuditKey = "medibot-test-audit-key-0123456789"
+	testOrigin   = "https://app.example.com"
+)
+
+// testServer is the API wired as in main, on a fakeStore, with a token issuer of its own.
+type testServer struct {
+	t       *testing.T
+	store   *fakeStore // nil on the test database
+	handler *MedibotHandler
+	router  http.Handler
+	key     *rsa.PrivateKey
+}
+
+// newTestServer returns the API on store, with a model answering the replies in order.
+func newTestServer(t *testing.T, store *fakeStore, replies ...string) *testServer {
+	t.Helper()
+	server := newTestServerOn(t, store, replies...)
+	server.store = store
+	return server
+}
+
+// newTestServerOn returns the API on any store, such as the test database.
+func newTestServerOn(t *testing.T, store repo.Store, replies ...string) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kid": testKeyID,
+		"kty": "RSA",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := auth.NewKeySet(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prompts, err := prompt.NewStore("../prompts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redflags, err := redflag.NewEngine("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := llm.NewScripted(replies...)
+
+	// The title and summary workers are not run: their queues only fill up.
+	handler := NewMedibotHandler(audit.NewStore(store), provider, prompts, auth.NewVerifier(keys, testIssuer, testAudience), redflags,
+		title.NewWorker(store, provider), history.NewWorker(store, provider, history.Budget{}), Quota{}, audit.NewLogger(store, []byte(testAuditKey)), []string{testOrigin})
+	return &testServer{t: t, handler: handler, router: handler.WireHttpHandler(), key: key}
+}
+
+// token returns a valid identity token for email.
+func (s *testServer) token(email string) string {
+	s.t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, auth.Claims{
+		Email:         email,
+		EmailVerified: true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{testAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	token.Header["kid"] = testKeyID
+	raw, err := token.SignedString(s.key)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return raw
+}
+
+// do sends a request as the user with email, anonymously when email is empty, with body encoded as JSON.
+func (s *testServer) do(method, path, email string, body any) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if email != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token(email))
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"medibot.go/db/repo"
+)
+
+const (
+	// idempotencyKeyHeader lets the app retry a chat message safely: a request sent again with the
+	// same key gets the original response instead of prompting the model and saving it twice.
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader is set on the responses replayed from an earlier request.
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength is the longest key accepted, a UUID is enough.
+	maxIdempotencyKeyLength = 255
+)
+
+// claimIdempotencyKey claims the request's Idempotency-Key, it returns "" when the client sent none.
+// When the key was already used, the request is answered here: by replay with the original
+// response, or with an error if the request differs or is still in progress, and ok is false.
+// On failure it writes the error response itself and returns ok=false.
+func (h *MedibotHandler) claimIdempotencyKey(c *gin.Context, req any, replay func(status int, response []byte)) (key string, ok bool) {
+	key = c.GetHeader(idempotencyKeyHeader)
+	if key == "" {
+		return "", true
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+		return "", false
+	}
+
+	requestHash, err := idempotencyRequestHash(c.FullPath(), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+
+	userID := currentUser(c).ID
+	reserved, err := h.querier.ReserveIdempotencyKey(c, repo.ReserveIdempotencyKeyParams{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to reserve idempotency key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process message"})
+		return "", false
+	}
+	if reserved > 0 {
+		return key, true
+	}
+
+	previous, err := h.querier.GetIdempotencyKey(c, repo.GetIdempotencyKeyParams{
+		UserID: userID,
+		Key:    key,
+	})
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		// Released by the request that held it in the meantime
+		c.JSON(http.StatusConflict, gin.H{"error": "The previous request with this Idempotency-Key failed, please retry"})
+	case err != nil:
+		log.Printf("ERROR: Failed to get idempotency key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process message"})
+	case previous.RequestHash != requestHash:
+		c.JSON(http.StatusConflict, gin.H{"error": "This Idempotency-Key was already used for another request"})
+	case previous.StatusCode == 0:
+		c.JSON(http.StatusConflict, gin.H{"error": "The request with this Idempotency-Key is still being processed"})
+	default:
+		replay(int(previous.StatusCode), previous.Response)
+	}
+	return "", false
+}
+
+// idempotencyRequestHash identifies a request by its route and body, a key is only replayed for the same request.
+func idempotencyRequestHash(route string, req any) (string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(append([]byte(route+"\n"), body...))
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// releaseIdempotencyKey frees the key of a request whose turn was not saved, so it can be retried.
+// It does nothing once the response is stored. Failures are only logged, the key then expires by itself.
+func (h *MedibotHandler) releaseIdempotencyKey(ctx context.Context, userID uuid.UUID, key string) {
+	if err := h.querier.ReleaseIdempotencyKey(ctx, repo.ReleaseIdempotencyKeyParams{
+		UserID: userID,
+		Key:    key,
+	}); err != nil {
+		log.Printf("ERROR: Failed to release idempotency key of user %s: %v", userID.String(), err)
+	}
+}
+
+// completeIdempotencyKey stores the response of the request holding key, within the turn's transaction.
+func completeIdempotencyKey(ctx context.Context, q repo.Querier, userID uuid.UUID, key string, response gin.H) error {
+	if key == "" {
+		return nil
+	}
+	body, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return q.CompleteIdempotencyKey(ctx, repo.CompleteIdempotencyKeyParams{
+		UserID:     userID,
+		Key:        key,
+		StatusCode: http.StatusOK,
+		Response:   body,
+	})
+}
+
+// replayJSON answers a retried request with the original JSON response.
+func replayJSON(c *gin.Context) func(status int, response []byte) {
+	return func(status int, response []byte) {
+		c.Header(idempotentReplayedHeader, "true")
+		c.Data(status, "application/json; charset=utf-8", response)
+	}
+}
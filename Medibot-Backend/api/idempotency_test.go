@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"medibot.go/auth"
+	"medibot.go/db/repo"
+)
+
+// postChat sends a chat message as the user with email, under the Idempotency-Key key.
+func (s *testServer) postChat(email, key, content string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	body, err := json.Marshal(map[string]string{"content": content})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/chat", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.token(email))
+	req.Header.Set(idempotencyKeyHeader, key)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotentChatReplaysTheResponse(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	server := newTestServer(t, store, "How long does it last?", "Do you feel it lying down?")
+
+	first := server.postChat(patient.Email, "key-1", "I feel dizzy when I stand up")
+	if first.Code != http.StatusOK {
+		t.Fatalf("POST /chat = %d: %s", first.Code, first.Body)
+	}
+
+	tests := []struct {
+		name       string
+		key        string
+		content    string
+		want       int
+		wantReplay bool
+	}{
+		{"retry", "key-1", "I feel dizzy when I stand up", http.StatusOK, true},
+		{"same key, other message", "key-1", "I have a headache", http.StatusConflict, false},
+		{"new key", "key-2", "I feel dizzy when I stand up", http.StatusOK, false},
+	}
+
+	for _, tt := range tests {
+		rec := server.postChat(patient.Email, tt.key, tt.content)
+		if rec.Code != tt.want {
+			t.Errorf("%s: POST /chat = %d, want %d: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+		if replayed := rec.Header().Get(idempotentReplayedHeader) == "true"; replayed != tt.wantReplay {
+			t.Errorf("%s: replayed = %v, want %v", tt.name, replayed, tt.wantReplay)
+		}
+		if tt.wantReplay && rec.Body.String() != first.Body.String() {
+			t.Errorf("%s: replayed %s, want the original response %s", tt.name, rec.Body, first.Body)
+		}
+	}
+
+	// The retry saved nothing and didn't prompt the model again: only the two turns are stored.
+	if len(store.messages) != 4 {
+		t.Errorf("stored %d messages, want 4", len(store.messages))
+	}
+}
+
+func TestIdempotentChatInFlight(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	server := newTestServer(t, store) // no reply scripted: the model is never asked
+
+	// The same message is still being answered under the key.
+	hash, err := idempotencyRequestHash("/chat", createConversationParams{Content: "I feel dizzy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.idempotencyKeys = append(store.idempotencyKeys, repo.IdempotencyKey{UserID: patient.ID, Key: "key-1", RequestHash: hash})
+
+	rec := server.postChat(patient.Email, "key-1", "I feel dizzy")
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "still being processed") {
+		t.Errorf("POST /chat = %d %s, want 409 as the request is in progress", rec.Code, rec.Body)
+	}
+	if len(store.messages) != 0 || len(store.idempotencyKeys) != 1 {
+		t.Errorf("stored %d messages and %d keys, want the key of the request in progress only", len(store.messages), len(store.idempotencyKeys))
+	}
+}
+
+func TestIdempotencyKeyReleasedAfterProviderFailure(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	server := newTestServer(t, store) // no reply scripted: every call to the model fails
+
+	// The retry reaches the model again instead of finding the key taken.
+	for range 2 {
+		rec := server.postChat(patient.Email, "key-1", "I feel dizzy")
+		if rec.Code != http.StatusBadGateway {
+			t.Errorf("POST /chat = %d, want 502: %s", rec.Code, rec.Body)
+		}
+		if len(store.idempotencyKeys) != 0 || len(store.messages) != 0 {
+			t.Errorf("kept %d keys and %d messages after the failure, want none", len(store.idempotencyKeys), len(store.messages))
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"medibot.go/audit"
+	"medibot.go/db/repo"
+)
+
+// exportBundle is everything Medibot keeps about a patient, as they download it.
+type exportBundle struct {
+	ExportedAt    time.Time            `json:"exportedAt"`
+	Profile       repo.User            `json:"profile"`
+	Conversations []exportConversation `json:"conversations"`
+	Summaries     []repo.Summary       `json:"summaries"`
+}
+
+type exportConversation struct {
+	repo.Conversation
+	Messages []repo.Message `json:"messages"`
+}
+
+// download all the data of the authenticated user, as one JSON document or a ZIP archive (?format=json|zip)
+func (h *MedibotHandler) handleExportMe(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or zip"})
+		return
+	}
+
+	bundle, ok := h.exportUser(c, currentUser(c))
+	if !ok {
+		return
+	}
+
+	filename := "medibot-export-" + bundle.ExportedAt.Format("2006-01-02")
+	if format == "json" {
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		c.JSON(http.StatusOK, bundle)
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+	if err := writeExportZip(c.Writer, bundle); err != nil {
+		// The archive is already partly sent, the client gets a truncated file.
+		log.Printf("ERROR: Failed to write the export of user %s: %v", bundle.Profile.ID.String(), err)
+	}
+}
+
+// exportUser gathers the data of user. On failure it writes the error response itself and returns ok=false.
+func (h *MedibotHandler) exportUser(c *gin.Context, user repo.User) (bundle exportBundle, ok bool) {
+	conversations, err := h.querier.ExportConversations(c, user.ID)
+	if err != nil {
+		log.Printf("ERROR: Failed to export conversations of user %s: %v", user.ID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export your data"})
+		return bundle, false
+	}
+	messages, err := h.querier.ExportMessages(c, user.ID)
+	if err != nil {
+		log.Printf("ERROR: Failed to export messages of user %s: %v", user.ID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export your data"})
+		return bundle, false
+	}
+	summaries, err := h.querier.ExportSummaries(c, user.ID)
+	if err != nil {
+		log.Printf("ERROR: Failed to export summaries of user %s: %v", user.ID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export your data"})
+		return bundle, false
+	}
+
+	bundle = exportBundle{
+		ExportedAt:    time.Now().UTC(),
+		Profile:       user,
+		Conversations: make([]exportConversation, len(conversations)),
+		Summaries:     summaries,
+	}
+	index := make(map[uuid.UUID]int, len(conversations))
+	for i, conversation := range conversations {
+		bundle.Conversations[i] = exportConversation{Conversation: conversation, Messages: []repo.Message{}}
+		index[conversation.ID] = i
+	}
+	// A message of a conversation started after the conversations were read is left out.
+	for _, message := range messages {
+		if i, found := index[message.ConID]; found {
+			bundle.Conversations[i].Messages = append(bundle.Conversations[i].Messages, message)
+		}
+	}
+	return bundle, true
+}
+
+// writeExportZip writes bundle as a ZIP archive: the profile, the summaries, and one file per conversation
+// with its messages.
+func writeExportZip(w io.Writer, bundle exportBundle) error {
+	archive := zip.NewWriter(w)
+	add := func(name string, v any) error {
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: bundle.ExportedAt})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+
+	if err := add("profile.json", bundle.Profile); err != nil {
+		return err
+	}
+	if err := add("summaries.json", bundle.Summaries); err != nil {
+		return err
+	}
+	for _, conversation := range bundle.Conversations {
+		name := fmt.Sprintf("conversations/%s-%s.json", conversation.CreatedAt.Time.Format("2006-01-02"), conversation.ID.String())
+		if err := add(name, conversation); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// erase the authenticated patient's account with all their conversations, messages, summaries,
+// referrals, appointments, notifications and usage (patients only)
+// The audit log is kept, pseudonymized: the events of the user lose their id and IP, only keyed hashes of them are left.
+func (h *MedibotHandler) handleEraseMe(c *gin.Context) {
+	user := currentUser(c)
+
+	// Everything else that belongs to the user is deleted with them by the foreign keys.
+	var deleted int64
+	err := h.querier.ExecTx(c, func(q repo.Querier) error {
+		var err error
+		if deleted, err = q.DeleteUser(c, user.ID); err != nil || deleted == 0 {
+			return err
+		}
+		_, err = q.PseudonymizeAuditEvents(c, user.ID)
+		return err
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to erase user %s: %v", user.ID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete your data"})
+		return
+	}
+	if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	// The events of this request are written once it is handled, pseudonymized too.
+	audit.ForgetActor(c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account and data deleted successfully"})
+}
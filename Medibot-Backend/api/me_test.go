@@ -0,0 +1,225 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"medibot.go/audit"
+	"medibot.go/auth"
+	"medibot.go/db/repo"
+	"medibot.go/db/repotest"
+)
+
+// exported decodes a JSON export.
+func exported(t *testing.T, body []byte) exportBundle {
+	t.Helper()
+	var bundle exportBundle
+	if err := json.Unmarshal(body, &bundle); err != nil {
+		t.Fatalf("invalid export: %v", err)
+	}
+	return bundle
+}
+
+// zipEntries lists the files of a ZIP export.
+func zipEntries(t *testing.T, body []byte) []string {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("invalid archive: %v", err)
+	}
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestExportMe(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	other := store.addUser(auth.RolePatient, "other@example.com")
+	conversation := store.addConversation(patient)
+	store.addMessage(conversation, "user", "I have a headache")
+	store.addMessage(conversation, "assistant", "Since when?")
+	summary := store.addSummary(conversation, uuid.Nil)
+	store.addMessage(store.addConversation(other), "user", "Not mine")
+	server := newTestServer(t, store)
+
+	rec := server.do("GET", "/me/export", patient.Email, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /me/export = %d: %s", rec.Code, rec.Body)
+	}
+	bundle := exported(t, rec.Body.Bytes())
+	if bundle.Profile.ID != patient.ID || len(bundle.Conversations) != 1 || len(bundle.Summaries) != 1 {
+		t.Fatalf("export = %+v, want the patient's conversation and summary", bundle)
+	}
+	if got := bundle.Conversations[0]; got.ID != conversation.ID || len(got.Messages) != 2 || got.Messages[0].Content != "I have a headache" {
+		t.Errorf("conversation = %+v, want its 2 messages in order", got)
+	}
+
+	wantAudited := []audit.Event{
+		{Action: audit.ActionRead, TargetType: audit.TargetConversation, TargetID: conversation.ID},
+		{Action: audit.ActionRead, TargetType: audit.TargetMessage, TargetID: conversation.ID},
+		{Action: audit.ActionRead, TargetType: audit.TargetSummary, TargetID: summary.ID},
+	}
+	if got := store.audited(); !slices.Equal(got, wantAudited) {
+		t.Errorf("audited %+v, want %+v", got, wantAudited)
+	}
+
+	rec = server.do("GET", "/me/export?format=zip", patient.Email, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("GET /me/export?format=zip = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	want := []string{"profile.json", "summaries.json", "conversations/" + conversation.CreatedAt.Time.Format("2006-01-02") + "-" + conversation.ID.String() + ".json"}
+	if got := zipEntries(t, rec.Body.Bytes()); !slices.Equal(got, want) {
+		t.Errorf("archive = %v, want %v", got, want)
+	}
+
+	if rec := server.do("GET", "/me/export?format=xml", patient.Email, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /me/export?format=xml = %d, want 400", rec.Code)
+	}
+}
+
+func TestEraseMe(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	doctor := store.addUser(auth.RoleDoctor, "doctor@example.com")
+	admin := store.addUser(auth.RoleAdmin, "admin@example.com")
+	conversation := store.addConversation(patient)
+	store.addMessage(conversation, "user", "I have a headache")
+	store.addSummary(conversation, uuid.Nil)
+	server := newTestServer(t, store)
+
+	server.do("GET", "/chat/messages?conId="+conversation.ID.String(), patient.Email, nil)
+	server.do("GET", "/admin/users", admin.Email, nil)
+	before := len(store.auditEvents)
+	patientHash := store.auditEvents[0].ActorHash
+
+	if rec := server.do("DELETE", "/me", doctor.Email, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("DELETE /me as a doctor = %d, want 403", rec.Code)
+	}
+	if rec := server.do("DELETE", "/me", patient.Email, nil); rec.Code != http.StatusOK {
+		t.Fatalf("DELETE /me = %d: %s", rec.Code, rec.Body)
+	}
+
+	if _, err := store.GetUser(context.Background(), patient.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("GetUser = %v, want the user gone", err)
+	}
+	if len(store.conversations) != 0 || len(store.messages) != 0 || len(store.summaries) != 0 {
+		t.Errorf("left %d conversations, %d messages and %d summaries", len(store.conversations), len(store.messages), len(store.summaries))
+	}
+
+	// The patient's events, the erasure included, only keep the pseudonym of the patient.
+	if len(store.auditEvents) <= before {
+		t.Fatal("the erasure was not audited")
+	}
+	var pseudonymized int
+	for _, event := range store.auditEvents {
+		if event.ActorID == patient.ID || (event.ActorHash == patientHash && (event.ActorID != uuid.Nil || event.Ip != "")) {
+			t.Errorf("event %d still identifies the patient: %+v", event.ID, event)
+		}
+		if event.ActorHash == patientHash {
+			pseudonymized++
+		}
+		if event.ActorHash != patientHash && event.ActorID != admin.ID {
+			t.Errorf("event %d = %+v, want the patient's or the admin's", event.ID, event)
+		}
+	}
+	if pseudonymized == 0 || pseudonymized == len(store.auditEvents) {
+		t.Errorf("pseudonymized %d of %d events, want only the patient's", pseudonymized, len(store.auditEvents))
+	}
+	last := store.auditEvents[len(store.auditEvents)-1]
+	if last.Action != audit.ActionDelete || last.TargetID != patient.ID {
+		t.Errorf("last event = %+v, want the deletion of the patient", last)
+	}
+
+	rec := server.do("GET", "/admin/audit/verify", admin.Email, nil)
+	var result audit.Verification
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid {
+		t.Errorf("verification = %+v, want the chain still valid", result)
+	}
+}
+
+// TestExportAndEraseOnDatabase runs the export and the erasure against Postgres, with the triggers guarding the audit log.
+func TestExportAndEraseOnDatabase(t *testing.T) {
+	pool := repotest.Pool(t)
+	ctx := context.Background()
+	store := repo.NewStore(pool)
+	server := newTestServerOn(t, store)
+
+	patient := repotest.CreateUser(t, store, auth.RolePatient)
+	admin := repotest.CreateUser(t, store, auth.RoleAdmin)
+	conID := uuid.New()
+	if err := store.CreateConversation(ctx, repo.CreateConversationParams{ID: conID, UserID: patient.ID, Specialty: "cardiology"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"I have a headache", "Since when?"} {
+		if err := store.CreateMessage(ctx, repo.CreateMessageParams{ConID: conID, Sender: "user", Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := server.do("GET", "/me/export", patient.Email, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /me/export = %d: %s", rec.Code, rec.Body)
+	}
+	bundle := exported(t, rec.Body.Bytes())
+	if len(bundle.Conversations) != 1 || len(bundle.Conversations[0].Messages) != 2 || bundle.Conversations[0].Messages[1].Content != "Since when?" {
+		t.Errorf("export = %+v, want the conversation and its 2 messages", bundle)
+	}
+	if rec := server.do("GET", "/me/export?format=zip", patient.Email, nil); rec.Code != http.StatusOK || len(zipEntries(t, rec.Body.Bytes())) != 3 {
+		t.Errorf("GET /me/export?format=zip = %d, want the profile, the summaries and the conversation", rec.Code)
+	}
+
+	var exportEvents []int64
+	rows, err := pool.Query(ctx, "SELECT id FROM audit_events WHERE actor_id = $1 ORDER BY id", patient.ID)
+	if err == nil {
+		exportEvents, err = pgx.CollectRows(rows, pgx.RowTo[int64])
+	}
+	if err != nil || len(exportEvents) == 0 {
+		t.Fatalf("audit events of the export = %v, %v", exportEvents, err)
+	}
+	if _, err := pool.Exec(ctx, "UPDATE audit_events SET action = 'create' WHERE id = $1", exportEvents[0]); err == nil {
+		t.Error("an audit event was changed")
+	}
+
+	if rec := server.do("DELETE", "/me", patient.Email, nil); rec.Code != http.StatusOK {
+		t.Fatalf("DELETE /me = %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := store.GetUser(ctx, patient.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("GetUser = %v, want the user gone", err)
+	}
+	if messages, err := store.GetConMessages(ctx, conID); err != nil || len(messages) != 0 {
+		t.Errorf("messages = %v, %v, want them gone", messages, err)
+	}
+
+	var identified, pseudonymized int
+	err = pool.QueryRow(ctx, "SELECT count(*) FILTER (WHERE actor_id = $1 OR (id = ANY($2) AND ip <> '')), count(*) FILTER (WHERE actor_hash = (SELECT actor_hash FROM audit_events WHERE id = $3)) FROM audit_events",
+		patient.ID, exportEvents, exportEvents[0]).Scan(&identified, &pseudonymized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identified != 0 || pseudonymized <= len(exportEvents) {
+		t.Errorf("%d events identify the patient and %d are pseudonymized, want none and the export's and erasure's", identified, pseudonymized)
+	}
+
+	rec = server.do("GET", "/admin/audit/verify", admin.Email, nil)
+	var result audit.Verification
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid {
+		t.Errorf("verification = %+v, want the chain still valid", result)
+	}
+}
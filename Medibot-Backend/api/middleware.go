@@ -0,0 +1,66 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5"
+	"medibot.go/auth"
+	"medibot.go/db/repo"
+)
+
+// requireToken verifies the bearer identity token and stores its claims on the request context.
+// It is enough for routes used before the caller has a users row (sign up).
+func (h *MedibotHandler) requireToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := auth.BearerToken(c.GetHeader("Authorization"))
+		if token == "" && websocket.IsWebSocketUpgrade(c.Request) {
+			// Browsers can't send headers when opening a WebSocket.
+			token = socketToken(c.Request)
+		}
+
+		claims, err := h.verifier.Verify(c.Request.Context(), token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		c.Request = c.Request.WithContext(auth.WithClaims(c.Request.Context(), claims))
+		c.Next()
+	}
+}
+
+// requireUser resolves the verified token to a registered repo.User and stores it on the request context.
+// It must run after requireToken.
+func (h *MedibotHandler) requireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := auth.ClaimsFromContext(c.Request.Context())
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		user, err := h.querier.GetUserByEmail(c.Request.Context(), claims.Email)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "user is not registered"})
+				return
+			}
+			log.Printf("ERROR: Failed to resolve authenticated user: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve user"})
+			return
+		}
+
+		c.Request = c.Request.WithContext(auth.WithUser(c.Request.Context(), user))
+		c.Next()
+	}
+}
+
+// currentUser returns the authenticated user put on the request context by requireUser.
+func currentUser(c *gin.Context) repo.User {
+	user, _ := auth.UserFromContext(c.Request.Context())
+	return user
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"medibot.go/db/repo"
+)
+
+// list the caller's notifications, newest first
+func (h *MedibotHandler) handleListNotifications(c *gin.Context) {
+	limit, offset := pageParams(c)
+
+	notifications, err := h.querier.ListNotifications(c, repo.ListNotificationsParams{
+		UserID: currentUser(c).ID,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to list notifications: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, notifications)
+}
+
+// mark one of the caller's notifications as read
+func (h *MedibotHandler) handleMarkNotificationRead(c *gin.Context) {
+	notificationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	updated, err := h.querier.MarkNotificationRead(c, repo.MarkNotificationReadParams{
+		ID:     notificationID,
+		UserID: currentUser(c).ID,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to mark notification %s as read: %v", notificationID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+		return
+	}
+	if updated == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found or already read"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+type updateOnCallParams struct {
+	OnCall *bool `json:"onCall" binding:"required"`
+}
+
+// start or stop receiving emergency alerts (doctors only)
+func (h *MedibotHandler) handleUpdateOnCall(c *gin.Context) {
+	var req updateOnCallParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.querier.SetUserOnCall(c, repo.SetUserOnCallParams{
+		ID:     currentUser(c).ID,
+		OnCall: *req.OnCall,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to update on-call status: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update on-call status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,19 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Postgres error codes answered with a client error.
+const (
+	uniqueViolation    = "23505"
+	exclusionViolation = "23P01" // overlapping availability windows or appointments
+)
+
+// isPgError reports whether err is a Postgres error with the given code.
+func isPgError(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"medibot.go/db/repo"
+	"medibot.go/triage"
+)
+
+// notificationKindRedFlag is the kind of the notifications sent to on-call doctors for an emergency.
+const notificationKindRedFlag = "red_flag"
+
+// answerRedFlag replies to a message that matched an emergency rule without calling the AI:
+// it saves the turn with the emergency instructions as the assistant reply, marks the conversation
+// as a high severity case and alerts the on-call doctors in the same transaction, so the patient
+// is only told a doctor was alerted when one was.
+// It returns the instructions and the response to the patient.
+func (h *MedibotHandler) answerRedFlag(ctx context.Context, turn chatTurn, patientMessage string) (string, gin.H, error) {
+	match := *turn.redFlagMatch
+	log.Printf("ALERT: Red flag %q in conversation %s (matched %q)", match.Rule.ID, turn.conID.String(), match.Phrase)
+
+	doctors, err := h.querier.ListOnCallDoctors(ctx)
+	if err != nil {
+		log.Printf("ERROR: Failed to list on-call doctors: %v", err)
+	}
+	if len(doctors) == 0 {
+		log.Printf("WARNING: No doctor is on call for red flag in conversation %s", turn.conID.String())
+	}
+	instructions := match.Instructions(turn.language, len(doctors) > 0)
+
+	reply := repo.CreateMessageParams{
+		ConID:         turn.conID,
+		Sender:        "assistant",
+		Content:       instructions,
+		PromptVersion: "redflag:" + match.Rule.ID,
+	}
+	response, err := h.saveTurn(ctx, turn, reply, func(q repo.Querier) (gin.H, error) {
+		if err := q.MarkConversationRedFlag(ctx, repo.MarkConversationRedFlagParams{
+			ID:      turn.conID,
+			RedFlag: match.Rule.ID,
+		}); err != nil {
+			return nil, err
+		}
+
+		summary, err := q.UpsertTriageSummary(ctx, repo.UpsertTriageSummaryParams{
+			Content:            fmt.Sprintf("Emergency red flag (%s). The patient wrote: %q", match.Rule.Name, patientMessage),
+			ConversationID:     turn.conID,
+			PatientID:          turn.userID,
+			Severity:           triage.SeverityHigh,
+			SuspectedCondition: match.Rule.Name,
+			RecommendedTests:   []string{},
+			LifestyleAdvice:    []string{},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// The alert names the rule, not the patient's words: they are read in the conversation, behind its access check.
+		body := fmt.Sprintf("%s: open the conversation at %s", match.Rule.Name, conversationLink(turn.conID))
+		for _, doctor := range doctors {
+			if err := q.CreateNotification(ctx, repo.CreateNotificationParams{
+				UserID:         doctor.ID,
+				Kind:           notificationKindRedFlag,
+				ConversationID: turn.conID,
+				Body:           body,
+			}); err != nil {
+				return nil, err
+			}
+		}
+
+		return gin.H{
+			"conversationId": turn.conID.String(),
+			"aiResponse":     instructions,
+			"triage":         summary,
+			"emergency":      true,
+			"redFlag":        match.Rule.ID,
+			"doctorAlerted":  len(doctors) > 0,
+			"message":        "Message processed successfully",
+		}, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return instructions, response, nil
+}
+
+// conversationLink returns the API path of a conversation's messages.
+func conversationLink(conID uuid.UUID) string {
+	return "/chat/messages?conId=" + conID.String()
+}
+
+// localeLanguage returns the language part of a locale, e.g. "fr" for "fr-CM".
+func localeLanguage(locale string) string {
+	language, _, _ := strings.Cut(locale, "-")
+	return strings.ToLower(language)
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"medibot.go/auth"
+)
+
+func TestRedFlagAlertsOnCallDoctors(t *testing.T) {
+	const message = "My husband left, and now I can’t breathe"
+
+	tests := []struct {
+		name        string
+		onCall      bool
+		wantAlerted bool
+		wantNotice  string
+	}{
+		{"doctor on call", true, true, "A doctor on call has been alerted."},
+		{"no doctor on call", false, false, "No doctor is on call right now"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			patient := store.addUser(auth.RolePatient, "patient@example.com")
+			doctor := store.addUser(auth.RoleDoctor, "doctor@example.com")
+			store.users[1].OnCall = tt.onCall
+			server := newTestServer(t, store) // no reply scripted: the model is never asked
+
+			rec := server.do("POST", "/chat", patient.Email, map[string]string{"content": message})
+			if rec.Code != http.StatusOK {
+				t.Fatalf("POST /chat = %d: %s", rec.Code, rec.Body)
+			}
+			var response struct {
+				ConversationID string `json:"conversationId"`
+				AIResponse     string `json:"aiResponse"`
+				RedFlag        string `json:"redFlag"`
+				DoctorAlerted  bool   `json:"doctorAlerted"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.RedFlag != "breathing" || response.DoctorAlerted != tt.wantAlerted {
+				t.Errorf("response = %+v", response)
+			}
+			if !strings.Contains(response.AIResponse, tt.wantNotice) {
+				t.Errorf("reply = %q, want it to say %q", response.AIResponse, tt.wantNotice)
+			}
+
+			if !tt.onCall {
+				if len(store.notifications) != 0 {
+					t.Errorf("sent %d notifications without a doctor on call", len(store.notifications))
+				}
+				return
+			}
+			if len(store.notifications) != 1 {
+				t.Fatalf("sent %d notifications, want 1", len(store.notifications))
+			}
+			notification := store.notifications[0]
+			if notification.UserID != doctor.ID || notification.ConversationID.String() != response.ConversationID {
+				t.Errorf("notification = %+v", notification)
+			}
+			if strings.Contains(notification.Body, "husband") || !strings.Contains(notification.Body, "/chat/messages?conId="+response.ConversationID) {
+				t.Errorf("notification body = %q, want the rule and a link, not the patient's words", notification.Body)
+			}
+
+			// The alerted doctor has no referral yet, but can open the link.
+			rec = server.do("GET", "/chat/messages?conId="+response.ConversationID, doctor.Email, nil)
+			if rec.Code != http.StatusOK {
+				t.Errorf("GET the alert's link as the doctor = %d: %s", rec.Code, rec.Body)
+			}
+			other := store.addUser(auth.RoleDoctor, "other@example.com")
+			rec = server.do("GET", "/chat/messages?conId="+response.ConversationID, other.Email, nil)
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("GET the alert's link as a doctor who was not alerted = %d, want 404", rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"medibot.go/db/repo"
+)
+
+// Referral statuses, matching the referrals.status CHECK constraint.
+// A referral goes pending -> accepted | declined -> closed.
+const (
+	referralPending  = "pending"
+	referralAccepted = "accepted"
+	referralDeclined = "declined"
+	referralClosed   = "closed"
+)
+
+// Kinds of the notifications sent along the referral workflow.
+const (
+	notificationKindReferral         = "referral"
+	notificationKindReferralAnswered = "referral_answered"
+)
+
+type createReferralParams struct {
+	SummaryID uuid.UUID `json:"summaryId" binding:"required"`
+	DoctorID  uuid.UUID `json:"doctorId" binding:"required"`
+	Note      string    `json:"note"`
+}
+
+// send one of the patient's summaries to a doctor (patients only)
+func (h *MedibotHandler) handleCreateReferral(c *gin.Context) {
+	var req createReferralParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	patient := currentUser(c)
+
+	summary, err := h.querier.GetSummaryForUser(c, repo.GetSummaryForUserParams{ID: req.SummaryID, UserID: patient.ID})
+	if err != nil || summary.PatientID != patient.ID {
+		if err == nil || errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Summary not found"})
+			return
+		}
+		log.Printf("ERROR: Failed to get summary %s: %v", req.SummaryID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve summary"})
+		return
+	}
+
+	doctor, err := h.querier.GetDoctor(c, req.DoctorID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown doctor"})
+			return
+		}
+		log.Printf("ERROR: Failed to get doctor %s: %v", req.DoctorID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve doctor"})
+		return
+	}
+
+	referral, err := h.querier.CreateReferral(c, repo.CreateReferralParams{
+		SummaryID: summary.ID,
+		PatientID: patient.ID,
+		DoctorID:  doctor.ID,
+		Note:      req.Note,
+	})
+	if err != nil {
+		if isPgError(err, uniqueViolation) {
+			c.JSON(http.StatusConflict, gin.H{"error": "This summary already has an open referral"})
+			return
+		}
+		log.Printf("ERROR: Failed to create referral: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create referral"})
+		return
+	}
+
+	h.notify(c.Request.Context(), doctor.ID, notificationKindReferral, summary.ConversationID,
+		fmt.Sprintf("New referral from %s (%s severity): %s", patient.Username, summary.Severity, summary.SuspectedCondition))
+
+	c.JSON(http.StatusCreated, referral)
+}
+
+// list the referrals a patient sent or a doctor received, optionally filtered by status
+func (h *MedibotHandler) handleListReferrals(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && !slices.Contains([]string{referralPending, referralAccepted, referralDeclined, referralClosed}, status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, accepted, declined or closed"})
+		return
+	}
+
+	limit, offset := pageParams(c)
+	referrals, err := h.querier.ListReferralsForUser(c, repo.ListReferralsForUserParams{
+		UserID:     currentUser(c).ID,
+		Status:     status,
+		PageLimit:  limit,
+		PageOffset: offset,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to list referrals: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve referrals"})
+		return
+	}
+
+	c.JSON(http.StatusOK, referrals)
+}
+
+// get the current state of a referral, for either side
+func (h *MedibotHandler) handleGetReferral(c *gin.Context) {
+	referralID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid referral ID"})
+		return
+	}
+
+	referral, err := h.querier.GetReferralForUser(c, repo.GetReferralForUserParams{ID: referralID, UserID: currentUser(c).ID})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Referral not found"})
+			return
+		}
+		log.Printf("ERROR: Failed to get referral %s: %v", referralID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve referral"})
+		return
+	}
+
+	c.JSON(http.StatusOK, referral)
+}
+
+// handleAnswerReferral lets the doctor accept or decline a pending referral (doctors only).
+// Accepting also assigns the summary to the doctor, in the same transaction.
+func (h *MedibotHandler) handleAnswerReferral(status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		referralID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid referral ID"})
+			return
+		}
+
+		doctor := currentUser(c)
+
+		var referral repo.Referral
+		err = h.querier.ExecTx(c, func(q repo.Querier) error {
+			var err error
+			referral, err = q.UpdateReferralStatus(c, repo.UpdateReferralStatusParams{
+				ToStatus:   status,
+				ID:         referralID,
+				DoctorID:   doctor.ID,
+				FromStatus: referralPending,
+			})
+			if err != nil {
+				return err
+			}
+
+			if status != referralAccepted {
+				return nil
+			}
+			return q.AssignSummaryDoctor(c, repo.AssignSummaryDoctorParams{
+				ID:       referral.SummaryID,
+				DoctorID: doctor.ID,
+			})
+		})
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				h.referralNotUpdated(c, referralID, doctor.ID)
+				return
+			}
+			log.Printf("ERROR: Failed to %s referral %s: %v", status, referralID.String(), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update referral"})
+			return
+		}
+
+		// Notifications link to the conversation the referred summary is about.
+		if summary, err := h.querier.GetSummary(c, referral.SummaryID); err != nil {
+			log.Printf("ERROR: Failed to get summary %s: %v", referral.SummaryID.String(), err)
+		} else {
+			h.notify(c.Request.Context(), referral.PatientID, notificationKindReferralAnswered, summary.ConversationID,
+				fmt.Sprintf("Dr %s has %s your referral", doctor.Username, status))
+		}
+
+		c.JSON(http.StatusOK, referral)
+	}
+}
+
+// close an answered referral, for either side
+func (h *MedibotHandler) handleCloseReferral(c *gin.Context) {
+	referralID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid referral ID"})
+		return
+	}
+
+	userID := currentUser(c).ID
+	referral, err := h.querier.CloseReferral(c, repo.CloseReferralParams{ID: referralID, UserID: userID})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.referralNotUpdated(c, referralID, userID)
+			return
+		}
+		log.Printf("ERROR: Failed to close referral %s: %v", referralID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update referral"})
+		return
+	}
+
+	c.JSON(http.StatusOK, referral)
+}
+
+// referralNotUpdated answers a status change that matched no row: either the referral is not
+// visible to the user, or it is not in a status the change is allowed from.
+func (h *MedibotHandler) referralNotUpdated(c *gin.Context, referralID, userID uuid.UUID) {
+	referral, err := h.querier.GetReferralForUser(c, repo.GetReferralForUserParams{ID: referralID, UserID: userID})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Referral not found"})
+			return
+		}
+		log.Printf("ERROR: Failed to get referral %s: %v", referralID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve referral"})
+		return
+	}
+
+	c.JSON(http.StatusConflict, gin.H{"error": "Referral is " + referral.Status})
+}
+
+// notify stores a notification for a user. Failures are only logged.
+func (h *MedibotHandler) notify(ctx context.Context, userID uuid.UUID, kind string, conID uuid.UUID, body string) {
+	if err := h.querier.CreateNotification(ctx, repo.CreateNotificationParams{
+		UserID:         userID,
+		Kind:           kind,
+		ConversationID: conID,
+		Body:           body,
+	}); err != nil {
+		log.Printf("ERROR: Failed to notify user %s: %v", userID.String(), err)
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"medibot.go/auth"
+	"medibot.go/db/repo"
+)
+
+// createReferral sends summary to doctor as the patient with email and returns the new referral.
+func (s *testServer) createReferral(email string, summary repo.Summary, doctor repo.User) repo.Referral {
+	s.t.Helper()
+	rec := s.do("POST", "/referrals", email, map[string]any{"summaryId": summary.ID, "doctorId": doctor.ID, "note": "Please have a look"})
+	if rec.Code != http.StatusCreated {
+		s.t.Fatalf("POST /referrals = %d: %s", rec.Code, rec.Body)
+	}
+	var referral repo.Referral
+	if err := json.Unmarshal(rec.Body.Bytes(), &referral); err != nil {
+		s.t.Fatal(err)
+	}
+	return referral
+}
+
+func TestCreateReferral(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	other := store.addUser(auth.RolePatient, "other@example.com")
+	doctor := store.addUser(auth.RoleDoctor, "doctor@example.com")
+	summary := store.addSummary(store.addConversation(patient), uuid.Nil)
+	server := newTestServer(t, store)
+
+	referral := server.createReferral(patient.Email, summary, doctor)
+	if referral.Status != referralPending || referral.PatientID != patient.ID || referral.DoctorID != doctor.ID || referral.SummaryID != summary.ID {
+		t.Errorf("referral = %+v, want a pending referral of the summary to the doctor", referral)
+	}
+	if len(store.notifications) != 1 || store.notifications[0].UserID != doctor.ID || store.notifications[0].Kind != notificationKindReferral {
+		t.Errorf("notifications = %+v, want the doctor notified", store.notifications)
+	}
+
+	tests := []struct {
+		name      string
+		email     string
+		summaryID uuid.UUID
+		doctorID  uuid.UUID
+		want      int
+	}{
+		{"summary already referred", patient.Email, summary.ID, doctor.ID, http.StatusConflict},
+		{"someone else's summary", other.Email, summary.ID, doctor.ID, http.StatusNotFound},
+		{"unknown summary", patient.Email, uuid.New(), doctor.ID, http.StatusNotFound},
+		{"not a doctor", patient.Email, summary.ID, other.ID, http.StatusBadRequest},
+		{"doctors can't refer", doctor.Email, summary.ID, doctor.ID, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		rec := server.do("POST", "/referrals", tt.email, map[string]any{"summaryId": tt.summaryID, "doctorId": tt.doctorID})
+		if rec.Code != tt.want {
+			t.Errorf("%s: POST /referrals = %d, want %d: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+	if len(store.referrals) != 1 {
+		t.Errorf("created %d referrals, want 1", len(store.referrals))
+	}
+
+	// Once the referral is declined the summary can be sent again.
+	if rec := server.do("POST", "/referrals/"+referral.ID.String()+"/decline", doctor.Email, nil); rec.Code != http.StatusOK {
+		t.Fatalf("decline = %d: %s", rec.Code, rec.Body)
+	}
+	server.createReferral(patient.Email, summary, doctor)
+}
+
+func TestAnswerReferral(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	doctor := store.addUser(auth.RoleDoctor, "doctor@example.com")
+	otherDoctor := store.addUser(auth.RoleDoctor, "other-doctor@example.com")
+	summary := store.addSummary(store.addConversation(patient), uuid.Nil)
+	server := newTestServer(t, store)
+	referral := server.createReferral(patient.Email, summary, doctor)
+	path := "/referrals/" + referral.ID.String()
+
+	tests := []struct {
+		name  string
+		email string
+		path  string
+		want  int
+	}{
+		{"someone else's referral", otherDoctor.Email, path + "/accept", http.StatusNotFound},
+		{"patients can't accept", patient.Email, path + "/accept", http.StatusForbidden},
+		{"not answered yet", patient.Email, path + "/close", http.StatusConflict},
+		{"unknown referral", doctor.Email, "/referrals/" + uuid.NewString() + "/accept", http.StatusNotFound},
+		{"accepted", doctor.Email, path + "/accept", http.StatusOK},
+		{"already accepted", doctor.Email, path + "/decline", http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		rec := server.do("POST", tt.path, tt.email, nil)
+		if rec.Code != tt.want {
+			t.Errorf("%s: POST %s = %d, want %d: %s", tt.name, tt.path, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	if store.referrals[0].Status != referralAccepted || store.summaries[0].DoctorID != doctor.ID {
+		t.Errorf("referral %s, summary assigned to %s, want accepted and assigned to the doctor", store.referrals[0].Status, store.summaries[0].DoctorID)
+	}
+	answered := store.notifications[len(store.notifications)-1]
+	if answered.UserID != patient.ID || answered.Kind != notificationKindReferralAnswered || answered.ConversationID != summary.ConversationID {
+		t.Errorf("last notification = %+v, want the patient told about the conversation", answered)
+	}
+}
+
+func TestAcceptReferralRollsBack(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	doctor := store.addUser(auth.RoleDoctor, "doctor@example.com")
+	summary := store.addSummary(store.addConversation(patient), uuid.Nil)
+	server := newTestServer(t, store)
+	referral := server.createReferral(patient.Email, summary, doctor)
+
+	store.assignErr = errors.New("connection reset")
+	if rec := server.do("POST", "/referrals/"+referral.ID.String()+"/accept", doctor.Email, nil); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("accept = %d, want 500: %s", rec.Code, rec.Body)
+	}
+	if store.referrals[0].Status != referralPending || store.summaries[0].DoctorID != uuid.Nil {
+		t.Errorf("referral %s, summary assigned to %s, want the status update rolled back", store.referrals[0].Status, store.summaries[0].DoctorID)
+	}
+
+	// The referral is still pending, the doctor can accept it once the database is back.
+	store.assignErr = nil
+	if rec := server.do("POST", "/referrals/"+referral.ID.String()+"/accept", doctor.Email, nil); rec.Code != http.StatusOK {
+		t.Fatalf("accept = %d: %s", rec.Code, rec.Body)
+	}
+	if store.summaries[0].DoctorID != doctor.ID {
+		t.Errorf("summary assigned to %s, want %s", store.summaries[0].DoctorID, doctor.ID)
+	}
+}
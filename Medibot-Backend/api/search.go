@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"medibot.go/db/repo"
+	"medibot.go/encryption"
+)
+
+// The search query delimits the matches in a snippet with these private use characters,
+// which it removes from the content first.
+const (
+	snippetMatchStart = "\ue000"
+	snippetMatchStop  = "\ue001"
+)
+
+var snippetMarkup = strings.NewReplacer(snippetMatchStart, "<b>", snippetMatchStop, "</b>")
+
+// highlightSnippet returns a search snippet as HTML: the content is escaped, only the
+// highlighting of the matches is markup.
+func highlightSnippet(snippet string) string {
+	return snippetMarkup.Replace(html.EscapeString(snippet))
+}
+
+// search the caller's messages and summaries (?q=&limit=&offset=)
+// The snippets are HTML, with the matches in <b></b>.
+// Patients search their own consultations, doctors also the ones referred to them.
+// It is not available when the medical content is encrypted, the database only sees ciphertext.
+func (h *MedibotHandler) handleSearch(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q query parameter is required"})
+		return
+	}
+	limit, offset := pageParams(c)
+
+	results, err := h.querier.SearchForUser(c, repo.SearchForUserParams{
+		Query:      query,
+		UserID:     currentUser(c).ID,
+		PageLimit:  limit,
+		PageOffset: offset,
+	})
+	if errors.Is(err, encryption.ErrSearchUnavailable) {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Search is not available on this server"})
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to search for user %s: %v", currentUser(c).ID.String(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search"})
+		return
+	}
+
+	for i := range results {
+		results[i].Snippet = highlightSnippet(results[i].Snippet)
+	}
+	c.JSON(http.StatusOK, results)
+}
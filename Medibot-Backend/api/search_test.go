@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"medibot.go/auth"
+	"medibot.go/db/repo"
+)
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct {
+		snippet string
+		want    string
+	}{
+		{"sharp \ue000pain\ue001 in the chest", "sharp <b>pain</b> in the chest"},
+		{"no match", "no match"},
+		{"<script>alert(1)</script> \ue000pain\ue001", "&lt;script&gt;alert(1)&lt;/script&gt; <b>pain</b>"},
+		{"<b>fake</b> & \ue000douleur\ue001 d'estomac", "&lt;b&gt;fake&lt;/b&gt; &amp; <b>douleur</b> d&#39;estomac"},
+	}
+
+	for _, tt := range tests {
+		if got := highlightSnippet(tt.snippet); got != tt.want {
+			t.Errorf("highlightSnippet(%q) = %q, want %q", tt.snippet, got, tt.want)
+		}
+	}
+}
+
+func TestSearchEscapesSnippets(t *testing.T) {
+	store := newFakeStore()
+	patient := store.addUser(auth.RolePatient, "patient@example.com")
+	store.searchResults = []repo.SearchForUserRow{
+		{Kind: "message", ID: uuid.New(), Snippet: `<img src=x onerror="alert(1)"> chest ` + snippetMatchStart + "pain" + snippetMatchStop},
+	}
+	server := newTestServer(t, store)
+
+	rec := server.do("GET", "/search?q=pain", patient.Email, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /search = %d: %s", rec.Code, rec.Body)
+	}
+	var results []repo.SearchForUserRow
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if want := `&lt;img src=x onerror=&#34;alert(1)&#34;&gt; chest <b>pain</b>`; len(results) != 1 || results[0].Snippet != want {
+		t.Errorf("results = %+v, want the snippet %q", results, want)
+	}
+}
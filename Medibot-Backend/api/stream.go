@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleConversationStream works like handleConversation but forwards the AI reply to the client
+// as Server-Sent Events while the model is still generating it.
+//
+// Events sent:
+//   - "conversation": {"conversationId"} as soon as the conversation is resolved
+//   - "chunk":        {"text"} for every piece of the reply
+//   - "done":         {"conversationId", "aiResponse", "triage", "emergency", "message"} once the reply is saved
+//   - "error":        {"error"} if the AI call or saving the reply fails mid-stream
+//
+// A request retried with the same Idempotency-Key replays the saved reply as a single chunk.
+func (h *MedibotHandler) handleConversationStream(c *gin.Context) {
+	var req createConversationParams
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A retried message gets the reply of the original one
+	key, ok := h.claimIdempotencyKey(c, req, replayStream(c))
+	if !ok {
+		return
+	}
+	if key != "" {
+		defer h.releaseIdempotencyKey(context.WithoutCancel(c.Request.Context()), currentUser(c).ID, key)
+	}
+
+	// Emergencies are always answered, they don't need the AI
+	if _, emergency := h.redflags.Check(req.Content); !emergency && !h.withinQuota(c) {
+		return
+	}
+
+	turn, ok := h.prepareConversationTurn(c, req)
+	if !ok {
+		return
+	}
+	turn.idempotencyKey = key
+
+	startEventStream(c)
+
+	c.SSEvent("conversation", gin.H{"conversationId": turn.conID.String()})
+	c.Writer.Flush()
+
+	// Emergencies are answered right away with the rule's instructions, sent as a single chunk
+	if turn.redFlagMatch != nil {
+		instructions, response, err := h.answerRedFlag(c.Request.Context(), turn, req.Content)
+		if err != nil {
+			c.SSEvent("error", gin.H{"error": "Failed to save AI response"})
+			c.Writer.Flush()
+			return
+		}
+
+		c.SSEvent("chunk", gin.H{"text": instructions})
+		c.SSEvent("done", response)
+		c.Writer.Flush()
+		return
+	}
+
+	// The request context is cancelled when the client goes away, which also aborts the AI stream.
+	reply, err := h.provider.Stream(c.Request.Context(), turn.aiRequest, func(text string) error {
+		c.SSEvent("chunk", gin.H{"text": text})
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		log.Printf("ERROR: AI stream failed: %v", err)
+		_, message := aiErrorResponse(err)
+		c.SSEvent("error", gin.H{"error": message})
+		c.Writer.Flush()
+		return
+	}
+
+	// Only the assembled reply is persisted, never the partial chunks.
+	response, err := h.saveReply(c.Request.Context(), turn, reply)
+	if err != nil {
+		c.SSEvent("error", gin.H{"error": "Failed to save AI response"})
+		c.Writer.Flush()
+		return
+	}
+
+	c.SSEvent("done", response)
+	c.Writer.Flush()
+}
+
+// startEventStream sends the headers of a Server-Sent Events response.
+func startEventStream(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // disable proxy buffering (nginx)
+	c.Status(http.StatusOK)
+}
+
+// replayStream answers a retried request with the events of the original one,
+// the saved reply being sent as a single chunk.
+func replayStream(c *gin.Context) func(status int, response []byte) {
+	return func(status int, response []byte) {
+		var done gin.H
+		if err := json.Unmarshal(response, &done); err != nil {
+			log.Printf("ERROR: Failed to decode saved response: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process message"})
+			return
+		}
+
+		c.Header(idempotentReplayedHeader, "true")
+		startEventStream(c)
+		c.SSEvent("conversation", gin.H{"conversationId": done["conversationId"]})
+		c.SSEvent("chunk", gin.H{"text": done["aiResponse"]})
+		c.SSEvent("done", done)
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"medibot.go/db/repo"
+	"medibot.go/llm"
+)
+
+// Quota limits the AI usage of every user per UTC day. A zero limit is unlimited.
+type Quota struct {
+	DailyRequests int64
+	DailyTokens   int64
+}
+
+// defaultUsageDays is the period of the usage reports when no from is given.
+const defaultUsageDays = 30
+
+// withinQuota reports whether the current user may still call the AI today.
+// Otherwise it writes a 429 response, with Retry-After set to the next UTC midnight.
+func (h *MedibotHandler) withinQuota(c *gin.Context) bool {
+	if h.quota.DailyRequests <= 0 && h.quota.DailyTokens <= 0 {
+		return true
+	}
+
+	userID := currentUser(c).ID
+	usage, err := h.querier.GetTodayUsage(c, userID)
+	if err != nil {
+		// The quota protects our costs, not the patient: don't turn them away over it.
+		log.Printf("ERROR: Failed to get today's usage of user %s: %v", userID.String(), err)
+		return true
+	}
+
+	exceeded := (h.quota.DailyRequests > 0 && usage.Requests >= h.quota.DailyRequests) ||
+		(h.quota.DailyTokens > 0 && usage.TotalTokens >= h.quota.DailyTokens)
+	if !exceeded {
+		return true
+	}
+
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	c.Header("Retry-After", strconv.Itoa(int(midnight.Sub(now).Seconds())+1))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":   "You have reached today's limit of messages to the assistant. You can continue tomorrow.",
+		"resetAt": midnight,
+	})
+	return false
+}
+
+// recordUsage adds an AI request to the user's daily usage. Failures are only logged.
+func (h *MedibotHandler) recordUsage(ctx context.Context, userID uuid.UUID, usage llm.Usage) {
+	if err := h.querier.RecordUsage(ctx, repo.RecordUsageParams{
+		UserID:           userID,
+		PromptTokens:     int64(usage.PromptTokens),
+		CompletionTokens: int64(usage.CompletionTokens),
+		TotalTokens:      int64(usage.TotalTokens),
+	}); err != nil {
+		log.Printf("ERROR: Failed to record AI usage of user %s: %v", userID.String(), err)
+	}
+}
+
+// usagePeriod reads the from and to query parameters (YYYY-MM-DD, UTC days included),
+// by default the last defaultUsageDays days.
+// On failure it writes the error response itself and returns ok=false.
+func usagePeriod(c *gin.Context) (from, to pgtype.Date, ok bool) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	fromDay := today.AddDate(0, 0, -defaultUsageDays+1)
+	toDay := today
+
+	for param, day := range map[string]*time.Time{"from": &fromDay, "to": &toDay} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + " date, expected YYYY-MM-DD"})
+			return from, to, false
+		}
+		*day = parsed
+	}
+	if toDay.Before(fromDay) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return from, to, false
+	}
+
+	return pgtype.Date{Time: fromDay, Valid: true}, pgtype.Date{Time: toDay, Valid: true}, true
+}
+
+// report the AI usage per user, biggest consumers first (admin only, ?from=&to=&limit=&offset=)
+func (h *MedibotHandler) handleUsageByUser(c *gin.Context) {
+	from, to, ok := usagePeriod(c)
+	if !ok {
+		return
+	}
+	limit, offset := pageParams(c)
+
+	usage, err := h.querier.ListUsageByUser(c, repo.ListUsageByUserParams{
+		FromDay:    from,
+		ToDay:      to,
+		PageLimit:  limit,
+		PageOffset: offset,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to list usage by user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// report the AI usage per day, of everyone or of one user (admin only, ?from=&to=&userId=)
+func (h *MedibotHandler) handleUsageByDay(c *gin.Context) {
+	from, to, ok := usagePeriod(c)
+	if !ok {
+		return
+	}
+
+	var userID uuid.UUID
+	if v := c.Query("userId"); v != "" {
+		var err error
+		if userID, err = uuid.Parse(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+	}
+
+	usage, err := h.querier.ListUsageByDay(c, repo.ListUsageByDayParams{
+		FromDay: from,
+		ToDay:   to,
+		UserID:  userID,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to list usage by day: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
@@ -0,0 +1,267 @@
+// Package audit keeps a tamper-evident record of who read, created or deleted patient data.
+//
+// The repository hooks of Store record the events of a request in its Recorder, and the API
+// middleware writes them with the actor and the IP once the request is handled. Every event is
+// chained to the previous one by its hash, so changing or removing one is detected by Verify.
+//
+// The hash covers keyed hashes of the actor and the IP rather than their values: when a user is
+// erased their events are pseudonymized, only the keyed hashes are left, and the chain still holds.
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"medibot.go/db/repo"
+)
+
+// Actions recorded.
+const (
+	ActionRead   = "read"
+	ActionCreate = "create"
+	ActionDelete = "delete"
+)
+
+// Types of the targets. Messages are identified by their conversation.
+const (
+	TargetConversation = "conversation"
+	TargetMessage      = "message"
+	TargetSummary      = "summary"
+	TargetUser         = "user"
+)
+
+// Event is an access to a piece of patient data.
+type Event struct {
+	Action     string
+	TargetType string
+	TargetID   uuid.UUID
+}
+
+// Actor is who made the request the events come from.
+// ID is the nil UUID when the caller is not a registered user yet (sign up).
+type Actor struct {
+	ID   uuid.UUID
+	Role string
+	IP   string
+	// Erased is set when the request erased the actor: the events are written pseudonymized.
+	Erased bool
+}
+
+// Recorder collects the events of a request until they are written.
+type Recorder struct {
+	mu     sync.Mutex
+	events []Event
+	erased bool
+}
+
+type recorderKey struct{}
+
+// WithRecorder returns a context whose repository accesses are recorded by r.
+func WithRecorder(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+// Record adds events to the recorder of ctx. Without recorder, e.g. in the background workers,
+// the events are not recorded: only the access made on behalf of a user is audited.
+func Record(ctx context.Context, events ...Event) {
+	r, ok := ctx.Value(recorderKey{}).(*Recorder)
+	if !ok || len(events) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, events...)
+}
+
+// ForgetActor marks the actor of the request of ctx as erased, once their past events were pseudonymized.
+func ForgetActor(ctx context.Context) {
+	r, ok := ctx.Value(recorderKey{}).(*Recorder)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.erased = true
+}
+
+// ActorErased tells whether the request erased its actor, see ForgetActor.
+func (r *Recorder) ActorErased() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.erased
+}
+
+// Flush returns the recorded events and forgets them.
+func (r *Recorder) Flush() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+// LogStore is the part of the repository the Logger writes and reads the chain with.
+type LogStore interface {
+	ExecTx(ctx context.Context, fn func(repo.Querier) error) error
+	ListAuditChain(ctx context.Context, arg repo.ListAuditChainParams) ([]repo.AuditEvent, error)
+}
+
+// MinKeySize is the minimum size of the key of the actors' and IPs' hashes.
+const MinKeySize = 32
+
+// Logger appends events to the audit log.
+type Logger struct {
+	store LogStore
+	key   []byte
+}
+
+// NewLogger creates a Logger writing to store, hashing the actors and IPs with key.
+// The key must stay the same for the life of the log, Verify needs it.
+func NewLogger(store LogStore, key []byte) *Logger {
+	return &Logger{store: store, key: key}
+}
+
+// Write appends the events of actor to the chain, all at once. The events of an erased actor only
+// keep the hashes of their ID and IP.
+func (l *Logger) Write(ctx context.Context, actor Actor, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	return l.store.ExecTx(ctx, func(q repo.Querier) error {
+		if err := q.LockAuditLog(ctx); err != nil {
+			return err
+		}
+		last, err := q.GetLastAuditEvent(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		// Stored with microseconds, the hash must cover the time as it is read back.
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		for _, event := range events {
+			entry := repo.AuditEvent{
+				ID:         last.ID + 1,
+				CreatedAt:  now,
+				ActorID:    actor.ID,
+				ActorHash:  l.actorHash(actor.ID),
+				ActorRole:  actor.Role,
+				Action:     event.Action,
+				TargetType: event.TargetType,
+				TargetID:   event.TargetID,
+				Ip:         actor.IP,
+				IpHash:     l.ipHash(last.ID+1, actor.IP),
+				PrevHash:   last.Hash,
+			}
+			if actor.Erased {
+				entry.ActorID, entry.Ip = uuid.Nil, ""
+			}
+			entry.Hash = Hash(entry)
+
+			if err := q.CreateAuditEvent(ctx, repo.CreateAuditEventParams(entry)); err != nil {
+				return err
+			}
+			last = entry
+		}
+		return nil
+	})
+}
+
+// Hash is the hash of an event, chained to the previous one through PrevHash. The event's own Hash is ignored,
+// and so are the actor's ID and the IP, erased with the user: their keyed hashes stand for them.
+func Hash(e repo.AuditEvent) string {
+	// Encoding a struct keeps the fields in order, the same event always gives the same bytes.
+	canonical, _ := json.Marshal(struct {
+		ID         int64
+		CreatedAt  string
+		ActorHash  string
+		ActorRole  string
+		Action     string
+		TargetType string
+		TargetID   uuid.UUID
+		IPHash     string
+		PrevHash   string
+	}{e.ID, e.CreatedAt.UTC().Format(time.RFC3339Nano), e.ActorHash, e.ActorRole, e.Action, e.TargetType, e.TargetID, e.IpHash, e.PrevHash})
+
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// actorHash is the pseudonym of an actor: the same for all their events, and only the key's holder
+// can tell whose it is.
+func (l *Logger) actorHash(id uuid.UUID) string {
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write(id[:])
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ipHash is the hash of the IP of event id. It differs from one event to the next, so the events of
+// an IP can't be linked once the IPs are gone.
+func (l *Logger) ipHash(id int64, ip string) string {
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write(binary.BigEndian.AppendUint64(nil, uint64(id)))
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyBatchSize is the number of events read at once by Verify.
+const verifyBatchSize = 1000
+
+// Verification is the result of Verify.
+type Verification struct {
+	Events int64 `json:"events"` // events checked
+	Valid  bool  `json:"valid"`
+	// BrokenAt is the first event that doesn't match the chain, and Reason why, when the chain is not valid.
+	BrokenAt int64  `json:"brokenAt,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Verify walks the whole chain and checks that no event was changed, removed or inserted.
+// The actor and the IP of an event are checked against their hashes, unless they were erased.
+func (l *Logger) Verify(ctx context.Context) (Verification, error) {
+	var result Verification
+	var previous repo.AuditEvent
+	for {
+		events, err := l.store.ListAuditChain(ctx, repo.ListAuditChainParams{ID: previous.ID, Limit: verifyBatchSize})
+		if err != nil {
+			return result, err
+		}
+
+		for _, event := range events {
+			var reason string
+			switch {
+			case event.ID != previous.ID+1:
+				reason = fmt.Sprintf("events %d to %d are missing", previous.ID+1, event.ID-1)
+			case event.PrevHash != previous.Hash:
+				reason = "previous hash doesn't match the previous event"
+			case event.Hash != Hash(event):
+				reason = "hash doesn't match the event"
+			case event.ActorID != uuid.Nil && event.ActorHash != l.actorHash(event.ActorID):
+				reason = "actor doesn't match the actor's hash"
+			case event.Ip != "" && event.IpHash != l.ipHash(event.ID, event.Ip):
+				reason = "ip doesn't match the ip's hash"
+			}
+			if reason != "" {
+				result.BrokenAt, result.Reason = event.ID, reason
+				return result, nil
+			}
+			result.Events++
+			previous = event
+		}
+
+		if len(events) < verifyBatchSize {
+			result.Valid = true
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"medibot.go/db/repo"
+)
+
+// chainStore keeps the audit log in memory.
+type chainStore struct {
+	repo.Querier
+	events []repo.AuditEvent
+}
+
+func (s *chainStore) ExecTx(ctx context.Context, fn func(repo.Querier) error) error {
+	events := s.events
+	err := fn(s)
+	if err != nil {
+		s.events = events
+	}
+	return err
+}
+
+func (s *chainStore) LockAuditLog(ctx context.Context) error {
+	return nil
+}
+
+func (s *chainStore) GetLastAuditEvent(ctx context.Context) (repo.AuditEvent, error) {
+	if len(s.events) == 0 {
+		return repo.AuditEvent{}, pgx.ErrNoRows
+	}
+	return s.events[len(s.events)-1], nil
+}
+
+func (s *chainStore) CreateAuditEvent(ctx context.Context, arg repo.CreateAuditEventParams) error {
+	s.events = append(s.events, repo.AuditEvent(arg))
+	return nil
+}
+
+func (s *chainStore) ListAuditChain(ctx context.Context, arg repo.ListAuditChainParams) ([]repo.AuditEvent, error) {
+	var events []repo.AuditEvent
+	for _, event := range s.events {
+		if event.ID > arg.ID && len(events) < int(arg.Limit) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// writeChain writes three requests of two events each.
+func writeChain(t *testing.T) (*chainStore, *Logger) {
+	t.Helper()
+	store := &chainStore{}
+	logger := NewLogger(store, testKey)
+	for range 3 {
+		actor := Actor{ID: uuid.New(), Role: "patient", IP: "192.0.2.1"}
+		conID := uuid.New()
+		events := []Event{{ActionRead, TargetConversation, conID}, {ActionRead, TargetMessage, conID}}
+		if err := logger.Write(context.Background(), actor, events); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store, logger
+}
+
+func TestWriteChainsEvents(t *testing.T) {
+	store, logger := writeChain(t)
+
+	if len(store.events) != 6 {
+		t.Fatalf("wrote %d events, want 6", len(store.events))
+	}
+	for i, event := range store.events {
+		if event.ID != int64(i+1) || event.Hash != Hash(event) {
+			t.Errorf("event %d = %+v, want id %d and its hash", i, event, i+1)
+		}
+		if i > 0 && event.PrevHash != store.events[i-1].Hash {
+			t.Errorf("event %d is not chained to the previous one", event.ID)
+		}
+	}
+
+	result, err := logger.Verify(context.Background())
+	if err != nil || !result.Valid || result.Events != 6 {
+		t.Errorf("Verify = %+v, %v, want 6 valid events", result, err)
+	}
+}
+
+func TestWriteWithoutEvents(t *testing.T) {
+	store := &chainStore{}
+	if err := NewLogger(store, testKey).Write(context.Background(), Actor{}, nil); err != nil || len(store.events) != 0 {
+		t.Errorf("Write(nil) = %v and wrote %d events", err, len(store.events))
+	}
+}
+
+func TestHashCoversEveryField(t *testing.T) {
+	store, _ := writeChain(t)
+	event := store.events[1]
+
+	changes := map[string]func(e *repo.AuditEvent){
+		"id":          func(e *repo.AuditEvent) { e.ID++ },
+		"time":        func(e *repo.AuditEvent) { e.CreatedAt = e.CreatedAt.Add(1) },
+		"actor":       func(e *repo.AuditEvent) { e.ActorHash = "" },
+		"role":        func(e *repo.AuditEvent) { e.ActorRole = "admin" },
+		"action":      func(e *repo.AuditEvent) { e.Action = ActionDelete },
+		"target type": func(e *repo.AuditEvent) { e.TargetType = TargetSummary },
+		"target":      func(e *repo.AuditEvent) { e.TargetID = uuid.New() },
+		"ip":          func(e *repo.AuditEvent) { e.IpHash = "" },
+		"previous":    func(e *repo.AuditEvent) { e.PrevHash = "" },
+	}
+	for name, change := range changes {
+		changed := event
+		change(&changed)
+		if Hash(changed) == event.Hash {
+			t.Errorf("changing the %s keeps the hash", name)
+		}
+	}
+	if Hash(event) != event.Hash {
+		t.Error("the hash of an event changes")
+	}
+
+	// The actor and the IP are left out, they can be erased.
+	event.ActorID, event.Ip = uuid.Nil, ""
+	if Hash(event) != store.events[1].Hash {
+		t.Error("erasing the actor changes the hash")
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name       string
+		tamper     func(events []repo.AuditEvent) []repo.AuditEvent
+		wantBroken int64
+		wantReason string
+	}{
+		{
+			name: "changed event",
+			tamper: func(events []repo.AuditEvent) []repo.AuditEvent {
+				events[2].Action = ActionDelete
+				return events
+			},
+			wantBroken: 3,
+			wantReason: "hash doesn't match the event",
+		},
+		{
+			name: "changed actor",
+			tamper: func(events []repo.AuditEvent) []repo.AuditEvent {
+				events[2].ActorID = events[0].ActorID
+				return events
+			},
+			wantBroken: 3,
+			wantReason: "actor doesn't match the actor's hash",
+		},
+		{
+			name: "changed ip",
+			tamper: func(events []repo.AuditEvent) []repo.AuditEvent {
+				events[2].Ip = "198.51.100.7"
+				return events
+			},
+			wantBroken: 3,
+			wantReason: "ip doesn't match the ip's hash",
+		},
+		{
+			name: "rehashed event",
+			tamper: func(events []repo.AuditEvent) []repo.AuditEvent {
+				events[2].Action = ActionDelete
+				events[2].Hash = Hash(events[2])
+				return events
+			},
+			wantBroken: 4,
+			wantReason: "previous hash doesn't match the previous event",
+		},
+		{
+			name: "removed event",
+			tamper: func(events []repo.AuditEvent) []repo.AuditEvent {
+				return append(events[:3], events[4:]...)
+			},
+			wantBroken: 5,
+			wantReason: "events 4 to 4 are missing",
+		},
+		{
+			name: "removed tail",
+			tamper: func(events []repo.AuditEvent) []repo.AuditEvent {
+				return events[:5]
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, logger := writeChain(t)
+			store.events = tt.tamper(store.events)
+
+			result, err := logger.Verify(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantBroken == 0 {
+				// The chain can't tell that its last events were removed.
+				if !result.Valid {
+					t.Errorf("Verify = %+v, want valid", result)
+				}
+				return
+			}
+			if result.Valid || result.BrokenAt != tt.wantBroken || result.Reason != tt.wantReason {
+				t.Errorf("Verify = %+v, want broken at %d: %s", result, tt.wantBroken, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestPseudonymizedChainIsValid(t *testing.T) {
+	store, logger := writeChain(t)
+	erased := store.events[2].ActorID
+	ctx := context.Background()
+
+	// The erasure clears the actor and the IP of the user's past events, as PseudonymizeAuditEvents does,
+	// and the events of the erasing request are written without them.
+	for i := range store.events {
+		if store.events[i].ActorID == erased {
+			store.events[i].ActorID, store.events[i].Ip = uuid.Nil, ""
+		}
+	}
+	if err := logger.Write(ctx, Actor{ID: erased, Role: "patient", IP: "192.0.2.1", Erased: true}, []Event{{ActionDelete, TargetUser, erased}}); err != nil {
+		t.Fatal(err)
+	}
+
+	last := store.events[len(store.events)-1]
+	if last.ActorID != uuid.Nil || last.Ip != "" {
+		t.Errorf("event of an erased actor = %+v, want no actor and no IP", last)
+	}
+	for _, event := range []repo.AuditEvent{store.events[2], store.events[3], last} {
+		if event.ActorHash != logger.actorHash(erased) {
+			t.Errorf("event %d lost the pseudonym of its actor", event.ID)
+		}
+	}
+	if store.events[2].IpHash == store.events[3].IpHash {
+		t.Error("the IP hashes of two events are the same, they link the events")
+	}
+
+	result, err := logger.Verify(ctx)
+	if err != nil || !result.Valid || result.Events != 7 {
+		t.Errorf("Verify = %+v, %v, want 7 valid events", result, err)
+	}
+
+	// Another key can't verify the actors.
+	if result, _ := NewLogger(store, []byte("another key, just as long as this")).Verify(ctx); result.Valid {
+		t.Error("Verify with another key = valid")
+	}
+}
+
+func TestRecord(t *testing.T) {
+	event := Event{ActionRead, TargetUser, uuid.New()}
+
+	// Without recorder, e.g. in a background worker, nothing happens.
+	Record(context.Background(), event)
+
+	recorder := &Recorder{}
+	ctx := WithRecorder(context.Background(), recorder)
+	Record(ctx, event)
+	Record(ctx)
+	Record(ctx, event)
+	if got := recorder.Flush(); len(got) != 2 || got[0] != event {
+		t.Errorf("Flush = %+v, want the event twice", got)
+	}
+	if got := recorder.Flush(); len(got) != 0 {
+		t.Errorf("Flush = %+v after a flush, want nothing", got)
+	}
+
+	ForgetActor(context.Background())
+	if recorder.ActorErased() {
+		t.Error("the actor is erased before ForgetActor")
+	}
+	ForgetActor(ctx)
+	if !recorder.ActorErased() {
+		t.Error("the actor is not erased after ForgetActor")
+	}
+}
+
+func TestWriteFailureLeavesChainIntact(t *testing.T) {
+	store, logger := writeChain(t)
+	failing := &failingStore{chainStore: store}
+
+	err := NewLogger(failing, testKey).Write(context.Background(), Actor{}, []Event{{ActionRead, TargetUser, uuid.New()}, {ActionRead, TargetUser, uuid.New()}})
+	if !errors.Is(err, errWrite) {
+		t.Fatalf("Write = %v, want the failure", err)
+	}
+	if result, err := logger.Verify(context.Background()); err != nil || !result.Valid || result.Events != 6 {
+		t.Errorf("Verify = %+v, %v, want the 6 events written before", result, err)
+	}
+}
+
+var errWrite = errors.New("write failed")
+
+// failingStore fails the second event of a write.
+type failingStore struct {
+	*chainStore
+	written int
+}
+
+func (s *failingStore) ExecTx(ctx context.Context, fn func(repo.Querier) error) error {
+	return s.chainStore.ExecTx(ctx, func(repo.Querier) error { return fn(s) })
+}
+
+func (s *failingStore) CreateAuditEvent(ctx context.Context, arg repo.CreateAuditEventParams) error {
+	if s.written++; s.written == 2 {
+		return errWrite
+	}
+	return s.chainStore.CreateAuditEvent(ctx, arg)
+}
@@ -0,0 +1,273 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"medibot.go/db/repo"
+)
+
+// Querier records the reads, creations and deletions of conversations, messages, summaries
+// and users in the recorder of the context. The other queries are passed through.
+type Querier struct {
+	repo.Querier
+	// pending holds the events of a transaction until it is committed, nil outside transactions.
+	pending *[]Event
+}
+
+// NewQuerier wraps q.
+func NewQuerier(q repo.Querier) *Querier {
+	return &Querier{Querier: q}
+}
+
+// Store is a Querier whose transactions are recorded too, once committed.
+type Store struct {
+	*Querier
+	store repo.Store
+}
+
+// NewStore wraps store.
+func NewStore(store repo.Store) *Store {
+	return &Store{Querier: NewQuerier(store), store: store}
+}
+
+// ExecTx implements repo.Store.
+func (s *Store) ExecTx(ctx context.Context, fn func(repo.Querier) error) error {
+	var pending []Event
+	err := s.store.ExecTx(ctx, func(q repo.Querier) error {
+		return fn(&Querier{Querier: q, pending: &pending})
+	})
+	if err == nil {
+		Record(ctx, pending...)
+	}
+	return err
+}
+
+var _ repo.Store = (*Store)(nil)
+
+func (q *Querier) record(ctx context.Context, events ...Event) {
+	if q.pending != nil {
+		*q.pending = append(*q.pending, events...)
+		return
+	}
+	Record(ctx, events...)
+}
+
+func (q *Querier) CreateConversation(ctx context.Context, arg repo.CreateConversationParams) error {
+	err := q.Querier.CreateConversation(ctx, arg)
+	if err == nil {
+		q.record(ctx, Event{ActionCreate, TargetConversation, arg.ID})
+	}
+	return err
+}
+
+func (q *Querier) GetConversation(ctx context.Context, arg repo.GetConversationParams) (repo.Conversation, error) {
+	conversation, err := q.Querier.GetConversation(ctx, arg)
+	if err == nil {
+		q.record(ctx, Event{ActionRead, TargetConversation, conversation.ID})
+	}
+	return conversation, err
+}
+
+func (q *Querier) GetConversationForDoctor(ctx context.Context, arg repo.GetConversationForDoctorParams) (repo.Conversation, error) {
+	conversation, err := q.Querier.GetConversationForDoctor(ctx, arg)
+	if err == nil {
+		q.record(ctx, Event{ActionRead, TargetConversation, conversation.ID})
+	}
+	return conversation, err
+}
+
+func (q *Querier) ListConversationHeaders(ctx context.Context, arg repo.ListConversationHeadersParams) ([]repo.ListConversationHeadersRow, error) {
+	rows, err := q.Querier.ListConversationHeaders(ctx, arg)
+	for _, row := range rows {
+		q.record(ctx, Event{ActionRead, TargetConversation, row.ID})
+	}
+	return rows, err
+}
+
+func (q *Querier) ExportConversations(ctx context.Context, userID uuid.UUID) ([]repo.Conversation, error) {
+	conversations, err := q.Querier.ExportConversations(ctx, userID)
+	for _, conversation := range conversations {
+		q.record(ctx, Event{ActionRead, TargetConversation, conversation.ID})
+	}
+	return conversations, err
+}
+
+func (q *Querier) DeleteConversation(ctx context.Context, id uuid.UUID) error {
+	err := q.Querier.DeleteConversation(ctx, id)
+	if err == nil {
+		q.record(ctx, Event{ActionDelete, TargetConversation, id})
+	}
+	return err
+}
+
+func (q *Querier) DeleteConversationForUser(ctx context.Context, arg repo.DeleteConversationForUserParams) (int64, error) {
+	deleted, err := q.Querier.DeleteConversationForUser(ctx, arg)
+	if deleted > 0 {
+		q.record(ctx, Event{ActionDelete, TargetConversation, arg.ID})
+	}
+	return deleted, err
+}
+
+func (q *Querier) CreateMessage(ctx context.Context, arg repo.CreateMessageParams) error {
+	err := q.Querier.CreateMessage(ctx, arg)
+	if err == nil {
+		q.record(ctx, Event{ActionCreate, TargetMessage, arg.ConID})
+	}
+	return err
+}
+
+func (q *Querier) CreateChatMessage(ctx context.Context, arg repo.CreateChatMessageParams) (repo.Message, error) {
+	message, err := q.Querier.CreateChatMessage(ctx, arg)
+	if err == nil {
+		q.record(ctx, Event{ActionCreate, TargetMessage, message.ConID})
+	}
+	return message, err
+}
+
+func (q *Querier) GetConMessages(ctx context.Context, id uuid.UUID) ([]repo.Message, error) {
+	messages, err := q.Querier.GetConMessages(ctx, id)
+	if err == nil {
+		q.record(ctx, Event{ActionRead, TargetMessage, id})
+	}
+	return messages, err
+}
+
+func (q *Querier) GetConMessagesForUser(ctx context.Context, arg repo.GetConMessagesForUserParams) ([]repo.Message, error) {
+	messages, err := q.Querier.GetConMessagesForUser(ctx, arg)
+	if err == nil {
+		q.record(ctx, Event{ActionRead, TargetMessage, arg.ID})
+	}
+	return messages, err
+}
+
+func (q *Querier) ListMessagesBefore(ctx context.Context, arg repo.ListMessagesBeforeParams) ([]repo.Message, error) {
+	messages, err := q.Querier.ListMessagesBefore(ctx, arg)
+	if err == nil {
+		q.record(ctx, Event{ActionRead, TargetMessage, arg.ConID})
+	}
+	return messages, err
+}
+
+func (q *Querier) ListMessagesAfter(ctx context.Context, arg repo.ListMessagesAfterParams) ([]repo.Message, error) {
+	messages, err := q.Querier.ListMessagesAfter(ctx, arg)
+	if err == nil {
+		q.record(ctx, Event{ActionRead, TargetMessage, arg.ConID})
+	}
+	return messages, err
+}
+
+// ExportMessages records one read per conversation, like the other message queries.
+func (q *Querier) ExportMessages(ctx context.Context, userID uuid.UUID) ([]repo.Message, error) {
+	messages, err := q.Querier.ExportMessages(ctx, userID)
+	for i, message := range messages {
+		// The messages are grouped by conversation.
+		if i == 0 || message.ConID != messages[i-1].ConID {
+			q.record(ctx, Event{ActionRead, TargetMessage, message.ConID})
+		}
+	}
+	return messages, err
+}
+
+func (q *Querier) GetSummary(ctx context.Context, id uuid.UUID) (repo.Summary, error) {
+	summary, err := q.Querier.GetSummary(ctx, id)
+	if err == nil {
+		q.record(ctx, Event{ActionRead, TargetSummary, summary.ID})
+	}
+	return summary, err
+}
+
+func (q *Querier) GetSummaryForUser(ctx context.Context, arg repo.GetSummaryForUserParams) (repo.Summary, error) {
+	summary, err := q.Querier.GetSummaryForUser(ctx, arg)
+	if err == nil {
+		q.record(ctx, Event{ActionRead, TargetSummary, summary.ID})
+	}
+	return summary, err
+}
+
+func (q *Querier) ListSummariesForUser(ctx context.Context, arg repo.ListSummariesForUserParams) ([]repo.Summary, error) {
+	summaries, err := q.Querier.ListSummariesForUser(ctx, arg)
+	for _, summary := range summaries {
+		q.record(ctx, Event{ActionRead, TargetSummary, summary.ID})
+	}
+	return summaries, err
+}
+
+func (q *Querier) ExportSummaries(ctx context.Context, patientID uuid.UUID) ([]repo.Summary, error) {
+	summaries, err := q.Querier.ExportSummaries(ctx, patientID)
+	for _, summary := range summaries {
+		q.record(ctx, Event{ActionRead, TargetSummary, summary.ID})
+	}
+	return summaries, err
+}
+
+func (q *Querier) UpsertTriageSummary(ctx context.Context, arg repo.UpsertTriageSummaryParams) (repo.Summary, error) {
+	summary, err := q.Querier.UpsertTriageSummary(ctx, arg)
+	if err == nil {
+		q.record(ctx, Event{ActionCreate, TargetSummary, summary.ID})
+	}
+	return summary, err
+}
+
+func (q *Querier) SearchForUser(ctx context.Context, arg repo.SearchForUserParams) ([]repo.SearchForUserRow, error) {
+	results, err := q.Querier.SearchForUser(ctx, arg)
+	for _, result := range results {
+		if result.Kind == TargetSummary {
+			q.record(ctx, Event{ActionRead, TargetSummary, result.ID})
+		} else {
+			q.record(ctx, Event{ActionRead, TargetMessage, result.ConversationID})
+		}
+	}
+	return results, err
+}
+
+func (q *Querier) CreateUser(ctx context.Context, arg repo.CreateUserParams) (uuid.UUID, error) {
+	id, err := q.Querier.CreateUser(ctx, arg)
+	if err == nil {
+		q.record(ctx, Event{ActionCreate, TargetUser, id})
+	}
+	return id, err
+}
+
+func (q *Querier) CreateDoctor(ctx context.Context, arg repo.CreateDoctorParams) (repo.User, error) {
+	doctor, err := q.Querier.CreateDoctor(ctx, arg)
+	if err == nil {
+		q.record(ctx, Event{ActionCreate, TargetUser, doctor.ID})
+	}
+	return doctor, err
+}
+
+// GetUserByEmail is not recorded: it resolves the caller of every request.
+// The doctor directory (ListDoctors, GetDoctor) is public and not recorded either.
+
+func (q *Querier) GetUser(ctx context.Context, id uuid.UUID) (repo.User, error) {
+	user, err := q.Querier.GetUser(ctx, id)
+	if err == nil {
+		q.record(ctx, Event{ActionRead, TargetUser, id})
+	}
+	return user, err
+}
+
+func (q *Querier) ListUsers(ctx context.Context, arg repo.ListUsersParams) ([]repo.User, error) {
+	users, err := q.Querier.ListUsers(ctx, arg)
+	for _, user := range users {
+		q.record(ctx, Event{ActionRead, TargetUser, user.ID})
+	}
+	return users, err
+}
+
+func (q *Querier) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	deleted, err := q.Querier.DeleteUser(ctx, id)
+	if deleted > 0 {
+		q.record(ctx, Event{ActionDelete, TargetUser, id})
+	}
+	return deleted, err
+}
+
+func (q *Querier) DeleteDoctor(ctx context.Context, id uuid.UUID) (int64, error) {
+	deleted, err := q.Querier.DeleteDoctor(ctx, id)
+	if deleted > 0 {
+		q.record(ctx, Event{ActionDelete, TargetUser, id})
+	}
+	return deleted, err
+}
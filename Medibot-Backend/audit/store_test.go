@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"medibot.go/db/repo"
+)
+
+// conversationStore knows one conversation and one user.
+type conversationStore struct {
+	repo.Querier
+	conversation repo.Conversation
+	userID       uuid.UUID
+}
+
+func (s *conversationStore) ExecTx(ctx context.Context, fn func(repo.Querier) error) error {
+	return fn(s)
+}
+
+func (s *conversationStore) GetConversation(ctx context.Context, arg repo.GetConversationParams) (repo.Conversation, error) {
+	if arg.ID != s.conversation.ID || arg.UserID != s.conversation.UserID {
+		return repo.Conversation{}, pgx.ErrNoRows
+	}
+	return s.conversation, nil
+}
+
+func (s *conversationStore) CreateConversation(ctx context.Context, arg repo.CreateConversationParams) error {
+	return nil
+}
+
+func (s *conversationStore) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	if id != s.userID {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func TestStoreRecordsAccess(t *testing.T) {
+	conversation := repo.Conversation{ID: uuid.New(), UserID: uuid.New()}
+	userID := uuid.New()
+	store := NewStore(&conversationStore{conversation: conversation, userID: userID})
+	recorder := &Recorder{}
+	ctx := WithRecorder(context.Background(), recorder)
+
+	store.GetConversation(ctx, repo.GetConversationParams{ID: conversation.ID, UserID: conversation.UserID})
+	store.GetConversation(ctx, repo.GetConversationParams{ID: conversation.ID, UserID: uuid.New()}) // not found
+	store.DeleteUser(ctx, uuid.New())                                                               // nothing deleted
+	store.DeleteUser(ctx, userID)
+
+	want := []Event{{ActionRead, TargetConversation, conversation.ID}, {ActionDelete, TargetUser, userID}}
+	if got := recorder.Flush(); !slices.Equal(got, want) {
+		t.Errorf("recorded %+v, want %+v", got, want)
+	}
+}
+
+func TestStoreRecordsCommittedTransactions(t *testing.T) {
+	store := NewStore(&conversationStore{})
+	recorder := &Recorder{}
+	ctx := WithRecorder(context.Background(), recorder)
+	created, rolledBack := uuid.New(), uuid.New()
+
+	err := store.ExecTx(ctx, func(q repo.Querier) error {
+		if err := q.CreateConversation(ctx, repo.CreateConversationParams{ID: rolledBack}); err != nil {
+			return err
+		}
+		if got := recorder.Flush(); len(got) != 0 {
+			t.Errorf("recorded %+v before the commit", got)
+		}
+		return errors.New("rolled back")
+	})
+	if err == nil {
+		t.Fatal("ExecTx didn't fail")
+	}
+	if got := recorder.Flush(); len(got) != 0 {
+		t.Errorf("recorded %+v for a rolled back transaction", got)
+	}
+
+	err = store.ExecTx(ctx, func(q repo.Querier) error {
+		return q.CreateConversation(ctx, repo.CreateConversationParams{ID: created})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := recorder.Flush(), []Event{{ActionCreate, TargetConversation, created}}; !slices.Equal(got, want) {
+		t.Errorf("recorded %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyRefreshInterval controls how often a JWKS fetched from a URL is reloaded.
+// Firebase rotates its signing keys every few hours, so an hour keeps us well within that window.
+const KeyRefreshInterval = time.Hour
+
+// MinRefreshInterval is the least time between two fetches of a remote JWKS. Tokens signed with an
+// unknown key ID, which may be forged, can't make us fetch it more often.
+const MinRefreshInterval = time.Minute
+
+// jsonWebKey is a single entry of a JSON Web Key Set. Only RSA keys are supported.
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// KeySet holds the public keys used to verify token signatures.
+// The keys come either from a local JWKS file or from a JWKS URL that is periodically refreshed.
+type KeySet struct {
+	source string
+	client *http.Client
+	now    func() time.Time
+
+	mu        sync.RWMutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+	// triedAt is the time of the last fetch, successful or not.
+	triedAt time.Time
+}
+
+// NewKeySet creates a KeySet from a JWKS file path or an http(s) URL and loads the keys once
+// so that a misconfiguration is reported at startup.
+func NewKeySet(ctx context.Context, source string) (*KeySet, error) {
+	ks := &KeySet{
+		source: source,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}
+
+	ks.claimRefresh()
+	if err := ks.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// Key returns the public key with the given key ID, reloading a remote key set when it is stale
+// or when the key ID is unknown (the issuer may have rotated its keys), at most once per MinRefreshInterval.
+// A known key is still used when reloading a stale key set fails.
+func (ks *KeySet) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	ks.mu.RLock()
+	key, ok := ks.keys[kid]
+	stale := ks.isRemote() && ks.now().Sub(ks.fetchedAt) > KeyRefreshInterval
+	ks.mu.RUnlock()
+
+	if ok && !stale {
+		return key, nil
+	}
+
+	if ks.isRemote() && ks.claimRefresh() {
+		if err := ks.refresh(ctx); err != nil && !ok {
+			return nil, err
+		}
+
+		ks.mu.RLock()
+		if refreshed, found := ks.keys[kid]; found {
+			key, ok = refreshed, true
+		}
+		ks.mu.RUnlock()
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	return key, nil
+}
+
+// claimRefresh reports whether the key set may be fetched now, and if so records the attempt.
+func (ks *KeySet) claimRefresh() bool {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := ks.now()
+	if !ks.triedAt.IsZero() && now.Sub(ks.triedAt) < MinRefreshInterval {
+		return false
+	}
+	ks.triedAt = now
+	return true
+}
+
+func (ks *KeySet) isRemote() bool {
+	return strings.HasPrefix(ks.source, "http://") || strings.HasPrefix(ks.source, "https://")
+}
+
+// refresh (re)loads the key set from its source.
+func (ks *KeySet) refresh(ctx context.Context) error {
+	raw, err := ks.read(ctx)
+	if err != nil {
+		return err
+	}
+
+	var set jsonWebKeySet
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		key, err := parseRSAKey(k)
+		if err != nil {
+			return fmt.Errorf("invalid JWKS key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return fmt.Errorf("JWKS from %s contains no RSA signing keys", ks.source)
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.fetchedAt = ks.now()
+	ks.mu.Unlock()
+
+	return nil
+}
+
+func (ks *KeySet) read(ctx context.Context) ([]byte, error) {
+	if !ks.isRemote() {
+		raw, err := os.ReadFile(ks.source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+		}
+		return raw, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", ks.source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned non-OK status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// parseRSAKey builds an RSA public key from the base64url encoded modulus and exponent.
+func parseRSAKey(k jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 {
+		return nil, fmt.Errorf("invalid exponent")
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(exponent.Int64()),
+	}, nil
+}
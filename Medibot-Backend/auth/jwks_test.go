@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// jwksServer serves a JWKS that can be swapped, and counts the fetches.
+type jwksServer struct {
+	mu      sync.Mutex
+	body    []byte
+	fetches int
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetches++
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.body)
+}
+
+func (s *jwksServer) publish(body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body = body
+}
+
+func (s *jwksServer) fetched() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+// newRemoteKeySet returns a KeySet of server whose clock is *now.
+func newRemoteKeySet(t *testing.T, server *jwksServer, now *time.Time) *KeySet {
+	t.Helper()
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	ks := &KeySet{source: ts.URL, client: ts.Client(), now: func() time.Time { return *now }}
+	ks.claimRefresh()
+	if err := ks.refresh(context.Background()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	return ks
+}
+
+func TestKeySetFromFile(t *testing.T) {
+	k := newTestKey(t, "key-1")
+	ks, err := NewKeySet(context.Background(), writeJWKS(t, k))
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+
+	key, err := ks.Key(context.Background(), "key-1")
+	if err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+	if !key.Equal(&k.key.PublicKey) {
+		t.Error("Key returned another key")
+	}
+	if _, err := ks.Key(context.Background(), "key-2"); err == nil {
+		t.Error("Key found an unknown key ID")
+	}
+}
+
+func TestKeySetRejectsEmptySet(t *testing.T) {
+	if _, err := NewKeySet(context.Background(), writeJWKS(t)); err == nil {
+		t.Error("NewKeySet accepted a JWKS without keys")
+	}
+}
+
+func TestKeySetRateLimitsUnknownKeys(t *testing.T) {
+	old, rotated := newTestKey(t, "old"), newTestKey(t, "rotated")
+	server := &jwksServer{body: jwks(t, old)}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	ks := newRemoteKeySet(t, server, &now)
+
+	// A stream of tokens with forged key IDs makes no fetch within the minute.
+	for range 100 {
+		if _, err := ks.Key(context.Background(), "forged"); err == nil {
+			t.Fatal("Key found a forged key ID")
+		}
+	}
+	if got := server.fetched(); got != 1 {
+		t.Fatalf("fetched %d times, want only the initial fetch", got)
+	}
+
+	// The issuer rotates its keys: the new key is found once the minute is over, with a single fetch.
+	server.publish(jwks(t, old, rotated))
+	now = now.Add(MinRefreshInterval)
+	for range 10 {
+		if _, err := ks.Key(context.Background(), "rotated"); err != nil {
+			t.Fatalf("Key(rotated): %v", err)
+		}
+		if _, err := ks.Key(context.Background(), "forged"); err == nil {
+			t.Fatal("Key found a forged key ID")
+		}
+	}
+	if got := server.fetched(); got != 2 {
+		t.Errorf("fetched %d times, want 2", got)
+	}
+}
+
+func TestKeySetRefreshesStaleKeys(t *testing.T) {
+	k := newTestKey(t, "key-1")
+	server := &jwksServer{body: jwks(t, k)}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	ks := newRemoteKeySet(t, server, &now)
+
+	if _, err := ks.Key(context.Background(), "key-1"); err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+	if got := server.fetched(); got != 1 {
+		t.Fatalf("fetched %d times, a fresh known key needs no fetch", got)
+	}
+
+	now = now.Add(KeyRefreshInterval + time.Second)
+	if _, err := ks.Key(context.Background(), "key-1"); err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+	if got := server.fetched(); got != 2 {
+		t.Errorf("fetched %d times, a stale key set is reloaded", got)
+	}
+
+	// The issuer is down: the known key keeps working.
+	server.publish([]byte("oops"))
+	now = now.Add(KeyRefreshInterval + time.Second)
+	if _, err := ks.Key(context.Background(), "key-1"); err != nil {
+		t.Errorf("Key failed when the reload of a known key failed: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+// Package auth verifies the identity tokens issued to app users (Firebase ID tokens)
+// and carries the authenticated user through the request context.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"medibot.go/db/repo"
+)
+
+var (
+	// ErrMissingToken is returned when a request carries no bearer token.
+	ErrMissingToken = errors.New("missing bearer token")
+	// ErrInvalidToken is returned when a token fails signature or claim validation.
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// User roles as stored in users.role.
+const (
+	RolePatient = "patient"
+	RoleDoctor  = "doctor"
+	RoleAdmin   = "admin"
+)
+
+// Claims are the identity token claims the API relies on.
+type Claims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	jwt.RegisteredClaims
+}
+
+// Verifier validates RS256 signed identity tokens against a KeySet, issuer and audience.
+type Verifier struct {
+	keys     *KeySet
+	issuer   string
+	audience string
+}
+
+// NewVerifier creates a Verifier. For Firebase the issuer is "https://securetoken.google.com/<project-id>"
+// and the audience is the project ID.
+func NewVerifier(keys *KeySet, issuer, audience string) *Verifier {
+	return &Verifier{
+		keys:     keys,
+		issuer:   issuer,
+		audience: audience,
+	}
+}
+
+// Verify parses the raw token, checks its signature, expiry, issuer and audience and that its email is verified,
+// and returns its claims.
+func (v *Verifier) Verify(ctx context.Context, rawToken string) (*Claims, error) {
+	if rawToken == "" {
+		return nil, ErrMissingToken
+	}
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(rawToken, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithAudience(v.audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if claims.Email == "" {
+		return nil, fmt.Errorf("%w: token has no email claim", ErrInvalidToken)
+	}
+	// Users are resolved by email: an unverified address could be anybody's.
+	if !claims.EmailVerified {
+		return nil, fmt.Errorf("%w: email is not verified", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>" header value.
+func BearerToken(header string) string {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+type contextKey int
+
+const (
+	claimsKey contextKey = iota
+	userKey
+)
+
+// WithClaims returns a copy of ctx carrying the verified token claims.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey, claims)
+}
+
+// ClaimsFromContext returns the verified token claims stored in ctx, if any.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(*Claims)
+	return claims, ok
+}
+
+// WithUser returns a copy of ctx carrying the authenticated user.
+func WithUser(ctx context.Context, user repo.User) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// UserFromContext returns the authenticated user stored in ctx, if any.
+func UserFromContext(ctx context.Context) (repo.User, bool) {
+	user, ok := ctx.Value(userKey).(repo.User)
+	return user, ok
+}
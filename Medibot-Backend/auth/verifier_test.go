@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://securetoken.google.com/medibot-test"
+	testAudience = "medibot-test"
+)
+
+// testKey is a signing key of the tests, published in their JWKS under kid.
+type testKey struct {
+	kid string
+	key *rsa.PrivateKey
+}
+
+func newTestKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return testKey{kid: kid, key: key}
+}
+
+// jwks returns the JSON Web Key Set publishing the public part of keys.
+func jwks(t *testing.T, keys ...testKey) []byte {
+	t.Helper()
+	var set jsonWebKeySet
+	for _, k := range keys {
+		set.Keys = append(set.Keys, jsonWebKey{
+			Kid: k.kid,
+			Kty: "RSA",
+			Alg: "RS256",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(k.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.key.E)).Bytes()),
+		})
+	}
+	raw, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// writeJWKS writes the JWKS of keys to a temporary file and returns its path.
+func writeJWKS(t *testing.T, keys ...testKey) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks(t, keys...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// validClaims are the claims of a token the test verifier accepts.
+func validClaims() Claims {
+	return Claims{
+		Email:         "patient@example.com",
+		EmailVerified: true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{testAudience},
+			Subject:   "firebase-uid",
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+}
+
+// sign returns claims signed by k with RS256.
+func (k testKey) sign(t *testing.T, claims Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = k.kid
+	raw, err := token.SignedString(k.key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return raw
+}
+
+func TestVerify(t *testing.T) {
+	signing := newTestKey(t, "key-1")
+	unpublished := newTestKey(t, "key-2")
+	forged := testKey{kid: signing.kid, key: unpublished.key} // claims to be key-1
+
+	keys, err := NewKeySet(context.Background(), writeJWKS(t, signing))
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	verifier := NewVerifier(keys, testIssuer, testAudience)
+
+	hs256, err := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims()).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"valid", signing.sign(t, validClaims()), nil},
+		{"missing", "", ErrMissingToken},
+		{"garbage", "not.a.token", ErrInvalidToken},
+		{"unverified email", signing.sign(t, func() Claims { c := validClaims(); c.EmailVerified = false; return c }()), ErrInvalidToken},
+		{"no email", signing.sign(t, func() Claims { c := validClaims(); c.Email = ""; return c }()), ErrInvalidToken},
+		{"expired", signing.sign(t, func() Claims {
+			c := validClaims()
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			return c
+		}()), ErrInvalidToken},
+		{"no expiry", signing.sign(t, func() Claims { c := validClaims(); c.ExpiresAt = nil; return c }()), ErrInvalidToken},
+		{"other issuer", signing.sign(t, func() Claims { c := validClaims(); c.Issuer = "https://evil.example.com"; return c }()), ErrInvalidToken},
+		{"other audience", signing.sign(t, func() Claims { c := validClaims(); c.Audience = jwt.ClaimStrings{"other-project"}; return c }()), ErrInvalidToken},
+		{"unknown key", unpublished.sign(t, validClaims()), ErrInvalidToken},
+		{"forged signature", forged.sign(t, validClaims()), ErrInvalidToken},
+		{"symmetric algorithm", hs256, ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(context.Background(), tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && claims.Email != "patient@example.com" {
+				t.Errorf("email = %q", claims.Email)
+			}
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := map[string]string{
+		"Bearer abc":   "abc",
+		"bearer  abc ": "abc",
+		"Basic abc":    "",
+		"Bearer":       "",
+		"":             "",
+	}
+	for header, want := range tests {
+		if got := BearerToken(header); got != want {
+			t.Errorf("BearerToken(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
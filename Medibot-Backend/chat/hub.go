@@ -0,0 +1,292 @@
+// Package chat relays real-time messages between the patient and the doctor of a conversation
+// over WebSockets. The Hub keeps one room per conversation, persists the messages and fans them
+// out to every connected participant, together with typing indicators and read receipts.
+package chat
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"medibot.go/db/repo"
+)
+
+// Event types exchanged with the clients.
+const (
+	EventMessage = "message" // client → server: {"type","content"}, server → clients: the stored message
+	EventTyping  = "typing"  // client → server: {"type"}, server → other clients: who is typing
+	EventRead    = "read"    // client → server: {"type","messageId"}, server → other clients: the read receipt
+	EventError   = "error"   // server → client: {"type","error"}
+)
+
+const (
+	// writeWait is the time allowed to write an event to the client.
+	writeWait = 10 * time.Second
+	// pongWait is the time allowed to read the next pong from the client.
+	pongWait = 60 * time.Second
+	// pingPeriod must be less than pongWait.
+	pingPeriod = (pongWait * 9) / 10
+	// maxEventSize is the largest event accepted from a client.
+	maxEventSize = 16 * 1024
+	// sendBuffer is the number of events queued for a client before it is considered too slow.
+	sendBuffer = 32
+)
+
+// Event is a JSON frame sent or received on the socket.
+type Event struct {
+	Type           string    `json:"type"`
+	ConversationID uuid.UUID `json:"conversationId,omitzero"`
+	MessageID      uuid.UUID `json:"messageId,omitzero"`
+	UserID         uuid.UUID `json:"userId,omitzero"`
+	Sender         string    `json:"sender,omitempty"`
+	Content        string    `json:"content,omitempty"`
+	Timestamp      time.Time `json:"timestamp,omitzero"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// Participant is an authenticated user allowed in a conversation.
+type Participant struct {
+	UserID uuid.UUID
+	Sender string // messages.sender of the participant: "user" for the patient or "doctor"
+}
+
+// Store is the part of the repository the hub needs to persist messages and read receipts.
+type Store interface {
+	CreateChatMessage(ctx context.Context, arg repo.CreateChatMessageParams) (repo.Message, error)
+	MarkConversationRead(ctx context.Context, arg repo.MarkConversationReadParams) (int64, error)
+}
+
+type client struct {
+	conn        *websocket.Conn
+	send        chan Event
+	conID       uuid.UUID
+	participant Participant
+}
+
+// Hub fans the events of a conversation out to its connected clients.
+type Hub struct {
+	store Store
+
+	mu    sync.Mutex
+	rooms map[uuid.UUID]map[*client]struct{}
+}
+
+// NewHub creates a Hub persisting through store.
+func NewHub(store Store) *Hub {
+	return &Hub{
+		store: store,
+		rooms: make(map[uuid.UUID]map[*client]struct{}),
+	}
+}
+
+// Serve relays the events of an upgraded connection until it is closed.
+// The caller must have checked that the participant belongs to the conversation.
+func (h *Hub) Serve(ctx context.Context, conn *websocket.Conn, conID uuid.UUID, participant Participant) {
+	c := &client{
+		conn:        conn,
+		send:        make(chan Event, sendBuffer),
+		conID:       conID,
+		participant: participant,
+	}
+
+	h.register(c)
+	go c.writePump()
+
+	h.readPump(ctx, c)
+
+	h.unregister(c)
+}
+
+func (h *Hub) register(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room, ok := h.rooms[c.conID]
+	if !ok {
+		room = make(map[*client]struct{})
+		h.rooms[c.conID] = room
+	}
+	room[c] = struct{}{}
+}
+
+// unregister removes the client and closes its send channel, which stops its writePump.
+func (h *Hub) unregister(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room := h.rooms[c.conID]
+	if _, ok := room[c]; !ok {
+		return
+	}
+	delete(room, c)
+	if len(room) == 0 {
+		delete(h.rooms, c.conID)
+	}
+	close(c.send)
+}
+
+// broadcast queues the event for every client of the conversation except skip (nil for everyone).
+// A client whose queue is full is disconnected rather than slowing the others down.
+func (h *Hub) broadcast(conID uuid.UUID, event Event, skip *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.rooms[conID] {
+		if c == skip {
+			continue
+		}
+		select {
+		case c.send <- event:
+		default:
+			log.Printf("WARNING: Dropping slow chat client of user %s", c.participant.UserID.String())
+			c.conn.Close()
+		}
+	}
+}
+
+// reply queues an event for a single client.
+func (h *Hub) reply(c *client, event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.rooms[c.conID][c]; !ok {
+		return
+	}
+	select {
+	case c.send <- event:
+	default:
+	}
+}
+
+// readPump handles the events sent by the client until the connection fails or is closed.
+func (h *Hub) readPump(ctx context.Context, c *client) {
+	defer c.conn.Close()
+
+	c.conn.SetReadLimit(maxEventSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		var event Event
+		if err := c.conn.ReadJSON(&event); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("ERROR: Chat connection of user %s failed: %v", c.participant.UserID.String(), err)
+			}
+			return
+		}
+
+		switch event.Type {
+		case EventMessage:
+			h.handleMessage(ctx, c, event)
+		case EventTyping:
+			h.broadcast(c.conID, Event{
+				Type:           EventTyping,
+				ConversationID: c.conID,
+				UserID:         c.participant.UserID,
+				Sender:         c.participant.Sender,
+			}, c)
+		case EventRead:
+			h.handleRead(ctx, c, event)
+		default:
+			h.reply(c, Event{Type: EventError, Error: "unknown event type"})
+		}
+	}
+}
+
+// handleMessage stores a chat message and sends it to every participant, the sender included,
+// so the sender learns the stored id and timestamp.
+func (h *Hub) handleMessage(ctx context.Context, c *client, event Event) {
+	content := strings.TrimSpace(event.Content)
+	if content == "" {
+		h.reply(c, Event{Type: EventError, Error: "content is required"})
+		return
+	}
+
+	msg, err := h.store.CreateChatMessage(ctx, repo.CreateChatMessageParams{
+		ConID:   c.conID,
+		Sender:  c.participant.Sender,
+		Content: content,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to save chat message: %v", err)
+		h.reply(c, Event{Type: EventError, Error: "Failed to save message"})
+		return
+	}
+
+	h.broadcast(c.conID, Event{
+		Type:           EventMessage,
+		ConversationID: c.conID,
+		MessageID:      msg.ID,
+		UserID:         c.participant.UserID,
+		Sender:         msg.Sender,
+		Content:        msg.Content,
+		Timestamp:      msg.Timestamp.Time,
+	}, nil)
+}
+
+// handleRead stores how far the participant has read and tells the other participants.
+// A message of another conversation, or older than the one already read, changes nothing.
+func (h *Hub) handleRead(ctx context.Context, c *client, event Event) {
+	if event.MessageID == uuid.Nil {
+		h.reply(c, Event{Type: EventError, Error: "messageId is required"})
+		return
+	}
+
+	marked, err := h.store.MarkConversationRead(ctx, repo.MarkConversationReadParams{
+		ConversationID:    c.conID,
+		UserID:            c.participant.UserID,
+		LastReadMessageID: event.MessageID,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to save read receipt: %v", err)
+		h.reply(c, Event{Type: EventError, Error: "Failed to save read receipt"})
+		return
+	}
+	if marked == 0 {
+		return
+	}
+
+	h.broadcast(c.conID, Event{
+		Type:           EventRead,
+		ConversationID: c.conID,
+		MessageID:      event.MessageID,
+		UserID:         c.participant.UserID,
+		Sender:         c.participant.Sender,
+		Timestamp:      time.Now(),
+	}, c)
+}
+
+// writePump sends the queued events and keeps the connection alive with pings.
+// It is the only goroutine writing to the connection.
+func (c *client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case event, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
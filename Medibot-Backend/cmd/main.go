@@ -8,13 +8,24 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/ardanlabs/conf/v3"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 	"medibot.go/api"
+	"medibot.go/audit"
+	"medibot.go/auth"
 	"medibot.go/db/repo"
+	"medibot.go/encryption"
 	"medibot.go/gemini"
+	"medibot.go/history"
+	"medibot.go/llm"
+	"medibot.go/prompt"
+	"medibot.go/redflag"
+	"medibot.go/retention"
+	"medibot.go/title"
 )
 
 // DBConfig holds the database configuration. This struct is populated from the .env in the current directory.
@@ -27,20 +38,95 @@ type DBConfig struct {
 	TLSDisabled bool   `conf:"env:DB_TLS_DISABLED"`
 }
 
+// AuthConfig holds the identity token verification settings. This struct is populated from the .env in the current directory.
+// For Firebase, JWKS is https://www.googleapis.com/service_accounts/v1/jwk/securetoken@system.gserviceaccount.com,
+// the issuer is https://securetoken.google.com/<project-id> and the audience is the project ID.
+type AuthConfig struct {
+	JWKS     string `conf:"env:AUTH_JWKS,required"` // path to a JWKS file or an http(s) URL serving one
+	Issuer   string `conf:"env:AUTH_ISSUER,required"`
+	Audience string `conf:"env:AUTH_AUDIENCE,required"`
+}
+
+// LLMConfig selects and configures the AI provider. This struct is populated from the .env in the current directory.
+type LLMConfig struct {
+	Provider      string `conf:"env:LLM_PROVIDER,default:gemini"` // gemini or openai
+	// Fallbacks are tried in order when DEFAULT_MODEL fails, times out or answers nothing,
+	// as provider:model pairs separated by ";", e.g. gemini:gemini-1.5-flash;openai:llama3.
+	Fallbacks     []string `conf:"env:LLM_FALLBACKS"`
+	GeminiBaseURL string `conf:"env:GEMINI_BASE_URL,default:https://generativelanguage.googleapis.com/v1beta/models"`
+	OpenAIBaseURL string `conf:"env:OPENAI_BASE_URL"` // any OpenAI-compatible server, e.g. http://localhost:11434/v1
+	OpenAIApiKey  string `conf:"env:OPENAI_API_KEY,mask"`
+	OpenAITimeout time.Duration `conf:"env:OPENAI_TIMEOUT,default:60s"` // per call, streaming included
+	// Resilience of the Gemini client: a deadline per call (retries included), how many times transient
+	// errors are retried, and after how many failed calls the circuit opens and for how long.
+	GeminiTimeout          time.Duration `conf:"env:GEMINI_TIMEOUT,default:60s"`
+	GeminiMaxRetries       int           `conf:"env:GEMINI_MAX_RETRIES,default:3"`
+	GeminiBreakerThreshold int           `conf:"env:GEMINI_BREAKER_THRESHOLD,default:5"`
+	GeminiBreakerCooldown  time.Duration `conf:"env:GEMINI_BREAKER_COOLDOWN,default:30s"`
+	// Daily AI quotas of every user, per UTC day; 0 is unlimited.
+	DailyRequestQuota int64 `conf:"env:AI_DAILY_REQUEST_QUOTA,default:0"`
+	DailyTokenQuota   int64 `conf:"env:AI_DAILY_TOKEN_QUOTA,default:0"`
+	// Estimated tokens of conversation sent per turn, and how many latest messages are always sent verbatim.
+	// The earlier messages are replaced by a rolling summary.
+	ContextTokenBudget int `conf:"env:CONTEXT_TOKEN_BUDGET,default:8000"`
+	ContextMinRecent   int `conf:"env:CONTEXT_MIN_RECENT,default:6"`
+}
+
+// EncryptionConfig holds the master keys encrypting the medical content at rest. This struct is populated from the .env in the current directory.
+// Keys are written id:base64-key (32 random bytes, e.g. `openssl rand -base64 32`), the first one encrypts and the others
+// only decrypt the values written before a rotation, until `medibot rekey` has run. Without any key the content is stored in plaintext.
+// The database can't search encrypted content: with a key, GET /search answers 501 Not Implemented.
+type EncryptionConfig struct {
+	Keys    []string `conf:"env:ENCRYPTION_KEYS,mask"` // separated by ";"
+	Keyfile string   `conf:"env:ENCRYPTION_KEYFILE"`   // path to a file with one key per line, used when ENCRYPTION_KEYS is empty
+}
+
+// RetentionConfig sets how long patient data is kept. This struct is populated from the .env in the current directory.
+// A zero period keeps the data forever. With RETENTION_DRY_RUN the worker only logs what it would purge.
+type RetentionConfig struct {
+	ConversationDays    int           `conf:"env:RETENTION_CONVERSATION_DAYS,default:0"`     // triage conversations never shared with a doctor nor red flagged, after their last message
+	SummaryArchiveYears int           `conf:"env:RETENTION_SUMMARY_ARCHIVE_YEARS,default:0"` // summaries, after they were written
+	Interval            time.Duration `conf:"env:RETENTION_INTERVAL,default:24h"`
+	BatchSize           int           `conf:"env:RETENTION_BATCH_SIZE,default:500"`
+	DryRun              bool          `conf:"env:RETENTION_DRY_RUN"`
+}
+
+// AuditConfig holds the key of the audit log. This struct is populated from the .env in the current directory.
+// The audit log only keeps keyed hashes of the actors and IPs of the erased users: the key must be at least
+// 32 random bytes (e.g. `openssl rand -base64 32`) and never change, the log can't be verified without it.
+type AuditConfig struct {
+	Key string `conf:"env:AUDIT_KEY,required,mask"`
+}
+
 // Config holds the application configuration. This struct is populated from the .env in the current directory.
 type Config struct {
 	ListenPort     uint16   `conf:"env:LISTEN_PORT,required"`
 	MigrationsPath string   `conf:"env:MIGRATIONS_PATH,required"`
-	ApiKey string   `conf:"env:API_KEY,required"`
+	PromptsPath    string   `conf:"env:PROMPTS_PATH,default:prompts"`
+	RedFlagRulesPath string `conf:"env:REDFLAG_RULES_PATH"` // emergency rules JSON, the built-in rules when empty
+	// Origins of the web apps allowed to open the chat WebSocket besides the API's own, separated by ";", e.g. https://app.example.com.
+	AllowedOrigins []string `conf:"env:ALLOWED_ORIGINS"`
+	ApiKey string   `conf:"env:API_KEY,mask"` // Gemini API key, required when LLM_PROVIDER=gemini
 	Model string   `conf:"env:DEFAULT_MODEL,required"`
 	DB             DBConfig
+	Auth           AuthConfig
+	LLM            LLMConfig
+	Encryption     EncryptionConfig
+	Retention      RetentionConfig
+	Audit          AuditConfig
 }
 
 func main() {
 
 	// We call run() here because main cannot return an error. If run() returns an error we print the error and exit.
 	// This is a common pattern in Go applications to handle errors gracefully.
-	err := run()
+	// `medibot rekey` re-encrypts the stored content under the current master key instead of serving.
+	var err error
+	if len(os.Args) > 1 && os.Args[1] == "rekey" {
+		err = rekey()
+	} else {
+		err = run()
+	}
 	if err != nil {
 		fmt.Println("Error:", err)
 		os.Exit(1)
@@ -61,6 +147,9 @@ func run() error {
 		fmt.Println("Have you configured your .env with the required variables?")
 		return err
 	}
+	if len(config.Audit.Key) < audit.MinKeySize {
+		return fmt.Errorf("AUDIT_KEY must be at least %d bytes", audit.MinKeySize)
+	}
 
 	// We use the configuration values to get the database connection URL.
 	dbConnectionURL := getPostgresConnectionURL(config.DB)
@@ -77,11 +166,61 @@ func run() error {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
-	geminiClient := gemini.NewGeminiClient("https://generativelanguage.googleapis.com/v1beta/models",config.ApiKey,config.Model)
-	querier := repo.New(db)
+	// We load the identity token signing keys so every request can be authenticated.
+	keys, err := auth.NewKeySet(ctx, config.Auth.JWKS)
+	if err != nil {
+		return fmt.Errorf("failed to load auth keys: %w", err)
+	}
+	verifier := auth.NewVerifier(keys, config.Auth.Issuer, config.Auth.Audience)
 
-	// We create a new http handler using the database querier.
-	handler := api.NewMedibotHandler(querier,*geminiClient).WireHttpHandler()
+	// We create the AI provider selected in the configuration.
+	provider, err := newProvider(config)
+	if err != nil {
+		return err
+	}
+	store, err := newStore(config, db)
+	if err != nil {
+		return err
+	}
+
+	// We load the versioned system prompt templates. New versions dropped in the directory are picked up without a restart.
+	prompts, err := prompt.NewStore(config.PromptsPath)
+	if err != nil {
+		return fmt.Errorf("failed to load prompts: %w", err)
+	}
+
+	// We load the emergency red flag rules checked on every patient message before the AI is called.
+	redflags, err := redflag.NewEngine(config.RedFlagRulesPath)
+	if err != nil {
+		return fmt.Errorf("failed to load red flag rules: %w", err)
+	}
+
+	// We start the background worker naming the conversations after their first exchange.
+	titles := title.NewWorker(store, provider)
+	go titles.Run(ctx)
+
+	// We start the background worker summarizing the earlier part of long conversations.
+	summarizer := history.NewWorker(store, provider, history.Budget{
+		MaxTokens: config.LLM.ContextTokenBudget,
+		MinRecent: config.LLM.ContextMinRecent,
+	})
+	go summarizer.Run(ctx)
+
+	// We start the background worker deleting and archiving the data past its retention period.
+	go retention.NewWorker(store, retention.Policy{
+		ConversationDays:    config.Retention.ConversationDays,
+		SummaryArchiveYears: config.Retention.SummaryArchiveYears,
+		Interval:            config.Retention.Interval,
+		BatchSize:           config.Retention.BatchSize,
+		DryRun:              config.Retention.DryRun,
+	}).Run(ctx)
+
+	// We record every access to patient data made through the API in the audit log.
+	auditLog := audit.NewLogger(store, []byte(config.Audit.Key))
+
+	// We create a new http handler using the database store.
+	quota := api.Quota{DailyRequests: config.LLM.DailyRequestQuota, DailyTokens: config.LLM.DailyTokenQuota}
+	handler := api.NewMedibotHandler(audit.NewStore(store),provider,prompts,verifier,redflags,titles,summarizer,quota,auditLog,config.AllowedOrigins).WireHttpHandler()
 
 	// And finally we start the HTTP server on the configured port.
 	err = http.ListenAndServe(fmt.Sprintf(":%d", config.ListenPort), handler)
@@ -92,6 +231,119 @@ func run() error {
 	return nil
 }
 
+// rekey encrypts the plaintext content under the current master key and rewraps the data keys of the previous ones.
+func rekey() error {
+	ctx := context.Background()
+	config := Config{}
+	if err := LoadConfig(&config); err != nil {
+		return err
+	}
+
+	keys, err := newKeyring(config.Encryption)
+	if err != nil {
+		return err
+	}
+	if keys == nil {
+		return errors.New("ENCRYPTION_KEYS or ENCRYPTION_KEYFILE is required to rekey")
+	}
+
+	db, err := pgxpool.New(ctx, getPostgresConnectionURL(config.DB))
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	stats, err := encryption.Rekey(ctx, repo.New(db), keys)
+	fmt.Printf("Rekeyed to master key %q: %d messages, %d summaries, %d rolling summaries, %d notifications, %d conversation titles\n",
+		keys.Current(), stats.Messages, stats.Summaries, stats.RollingSummaries, stats.Notifications, stats.Titles)
+	return err
+}
+
+// newStore creates the database store, encrypting the medical content when master keys are configured.
+func newStore(config Config, db *pgxpool.Pool) (repo.Store, error) {
+	keys, err := newKeyring(config.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		fmt.Println("WARNING: No encryption key configured, medical content is stored in plaintext")
+		return repo.NewStore(db), nil
+	}
+	return encryption.NewStore(repo.NewStore(db), keys), nil
+}
+
+// newKeyring loads the master keys from ENCRYPTION_KEYS or ENCRYPTION_KEYFILE, nil when neither is set.
+func newKeyring(config EncryptionConfig) (*encryption.Keyring, error) {
+	var keys []encryption.MasterKey
+	switch {
+	case len(config.Keys) > 0:
+		for _, entry := range config.Keys {
+			key, err := encryption.ParseKey(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ENCRYPTION_KEYS: %w", err)
+			}
+			keys = append(keys, key)
+		}
+	case config.Keyfile != "":
+		var err error
+		if keys, err = encryption.LoadKeyfile(config.Keyfile); err != nil {
+			return nil, fmt.Errorf("failed to load ENCRYPTION_KEYFILE: %w", err)
+		}
+	default:
+		return nil, nil
+	}
+	return encryption.NewKeyring(keys...)
+}
+
+// newProvider creates the llm.Provider selected by LLM_PROVIDER and DEFAULT_MODEL,
+// falling back to the LLM_FALLBACKS models in order.
+func newProvider(config Config) (llm.Provider, error) {
+	primary, err := newModelProvider(config, config.LLM.Provider, config.Model)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.LLM.Fallbacks) == 0 {
+		return primary, nil
+	}
+
+	providers := []llm.Provider{primary}
+	for _, fallback := range config.LLM.Fallbacks {
+		kind, model, found := strings.Cut(strings.TrimSpace(fallback), ":")
+		if !found || model == "" {
+			return nil, fmt.Errorf("invalid LLM_FALLBACKS entry %q, expected provider:model", fallback)
+		}
+		provider, err := newModelProvider(config, kind, model)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+	return llm.NewFallback(providers...), nil
+}
+
+// newModelProvider creates an llm.Provider of the given kind (gemini or openai) for model.
+func newModelProvider(config Config, kind, model string) (llm.Provider, error) {
+	switch kind {
+	case "gemini":
+		if config.ApiKey == "" {
+			return nil, errors.New("API_KEY is required when LLM_PROVIDER is gemini")
+		}
+		return llm.NewGemini(gemini.NewGeminiClientWithOptions(config.LLM.GeminiBaseURL, config.ApiKey, model, gemini.Options{
+			Timeout:          config.LLM.GeminiTimeout,
+			MaxRetries:       config.LLM.GeminiMaxRetries,
+			BreakerThreshold: config.LLM.GeminiBreakerThreshold,
+			BreakerCooldown:  config.LLM.GeminiBreakerCooldown,
+		})), nil
+	case "openai":
+		if config.LLM.OpenAIBaseURL == "" {
+			return nil, errors.New("OPENAI_BASE_URL is required when LLM_PROVIDER is openai")
+		}
+		return llm.NewOpenAI(config.LLM.OpenAIBaseURL, config.LLM.OpenAIApiKey, model, config.LLM.OpenAITimeout), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", kind)
+	}
+}
+
 // LoadConfig reads configuration from file or environment variables.
 func LoadConfig(cfg *Config) error {
 	if _, err := os.Stat(".env"); err == nil {
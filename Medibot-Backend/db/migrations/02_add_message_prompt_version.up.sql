@@ -0,0 +1,3 @@
+-- Records which prompt template version produced each assistant message (e.g. 'cardiology.v1').
+-- User messages keep the empty string.
+ALTER TABLE "messages" ADD COLUMN "prompt_version" TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE "conversation" DROP COLUMN "specialty";
+DROP TABLE "specialties";
@@ -0,0 +1,34 @@
+-- Assistant personas. Each specialty renders its own prompt template (prompts/<prompt_name>.v<N>.tmpl)
+-- with its follow-up question count and severity rules.
+CREATE TABLE "specialties" (
+    "slug" TEXT PRIMARY KEY,
+    "name" TEXT NOT NULL,
+    "description" TEXT NOT NULL DEFAULT '',
+    "prompt_name" TEXT NOT NULL,
+    "follow_up_questions" INT NOT NULL DEFAULT 6 CHECK (follow_up_questions BETWEEN 0 AND 20),
+    "severity_rules" TEXT NOT NULL,
+    "active" BOOLEAN NOT NULL DEFAULT true,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO "specialties" (slug, name, description, prompt_name, follow_up_questions, severity_rules) VALUES
+('cardiology', 'Cardiology', 'Heart and circulation symptoms such as chest pain, palpitations or leg swelling.', 'cardiology', 6,
+$$- Low severity: Mild, can be managed and observed.
+- Moderate severity: Needs medical attention soon but not urgent.
+- High severity: Serious and needs urgent care. Do not panic the user — explain it firmly but kindly.$$),
+('diabetes', 'Diabetes', 'Blood sugar problems, known or suspected diabetes and its complications.', 'diabetes', 5,
+$$- Low severity: Mild symptoms with blood sugar mostly under control, can be managed at home with diet and follow-up.
+- Moderate severity: Repeated high readings, slow-healing wounds or new numbness; needs a doctor within a few days.
+- High severity: Confusion, fainting, repeated vomiting, very high or very low readings, or an infected foot wound; needs urgent care today. Do not panic the user — explain it firmly but kindly.$$),
+('pediatrics', 'Pediatrics', 'Health of babies and children, answered for their parents or caregivers.', 'pediatrics', 5,
+$$- Low severity: The child is playing, feeding and drinking normally; can be managed at home and observed.
+- Moderate severity: Symptoms lasting more than two days or fever that keeps returning; the child should see a health worker soon.
+- High severity: Any danger sign — convulsions, unable to drink or breastfeed, vomiting everything, very sleepy or hard to wake, chest pulling in, or a baby under two months with fever; go to the hospital now. Do not panic the user — explain it firmly but kindly.$$),
+('maternal-health', 'Maternal health', 'Pregnancy, antenatal care and the weeks after delivery.', 'maternal-health', 5,
+$$- Low severity: Common pregnancy discomforts such as mild nausea or back pain; can be managed and discussed at the next antenatal visit.
+- Moderate severity: Symptoms that need a check at the antenatal clinic within a day or two.
+- High severity: Any bleeding, severe headache with blurred vision, convulsions, fever, leaking fluid, severe abdominal pain, or the baby moving less; go to the hospital now. Do not panic the user — explain it firmly but kindly.$$);
+
+-- Existing conversations were all held with the cardiology assistant.
+ALTER TABLE "conversation"
+    ADD COLUMN "specialty" TEXT NOT NULL DEFAULT 'cardiology' REFERENCES specialties(slug);
@@ -0,0 +1,10 @@
+DROP INDEX "summaries_doctor_severity_idx";
+DROP INDEX "summaries_conversation_id_key";
+INSERT INTO "summaries" SELECT * FROM "superseded_summaries";
+DROP TABLE "superseded_summaries";
+ALTER TABLE "summaries"
+    DROP COLUMN "severity",
+    DROP COLUMN "suspected_condition",
+    DROP COLUMN "recommended_tests",
+    DROP COLUMN "lifestyle_advice",
+    DROP COLUMN "helpful";
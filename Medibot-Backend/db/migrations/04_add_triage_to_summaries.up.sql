@@ -0,0 +1,34 @@
+-- Structured triage extracted from the consultation instead of free text only.
+-- Summaries written before this migration keep severity 'unknown'.
+ALTER TABLE "summaries"
+    ADD COLUMN "severity" TEXT NOT NULL DEFAULT 'unknown' CHECK (severity IN ('unknown', 'low', 'moderate', 'high')),
+    ADD COLUMN "suspected_condition" TEXT NOT NULL DEFAULT '',
+    ADD COLUMN "recommended_tests" TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN "lifestyle_advice" TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN "helpful" BOOLEAN;
+
+-- Summaries are no longer created with a placeholder doctor; the doctor is set once one is assigned.
+ALTER TABLE "summaries" ALTER COLUMN "doctor_id" DROP NOT NULL;
+UPDATE "summaries" SET doctor_id = NULL WHERE doctor_id = '00000000-0000-0000-0000-000000000000';
+
+-- One triage summary per conversation, refreshed as the consultation goes on.
+-- The older summaries of a conversation are medical records: they are moved to superseded_summaries
+-- rather than deleted, and are moved back by the down migration. They go with their patient.
+CREATE TABLE "superseded_summaries" (
+    LIKE "summaries" INCLUDING DEFAULTS,
+    PRIMARY KEY ("id"),
+    FOREIGN KEY ("conversation_id") REFERENCES conversation(id) ON DELETE CASCADE,
+    FOREIGN KEY ("patient_id") REFERENCES users(id) ON DELETE CASCADE
+);
+WITH superseded AS (
+    DELETE FROM "summaries" s
+    USING "summaries" newer
+    WHERE s.conversation_id = newer.conversation_id
+      AND (s.created_at, s.id) < (newer.created_at, newer.id)
+    RETURNING s.*
+)
+INSERT INTO "superseded_summaries" SELECT * FROM superseded;
+CREATE UNIQUE INDEX "summaries_conversation_id_key" ON "summaries" (conversation_id);
+
+-- Lets doctors list their cases by severity.
+CREATE INDEX "summaries_doctor_severity_idx" ON "summaries" (doctor_id, severity, created_at DESC);
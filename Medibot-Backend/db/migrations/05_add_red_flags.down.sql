@@ -0,0 +1,3 @@
+DROP TABLE "notifications";
+ALTER TABLE "users" DROP COLUMN "on_call";
+ALTER TABLE "conversation" DROP COLUMN "red_flag";
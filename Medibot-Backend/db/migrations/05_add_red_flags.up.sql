@@ -0,0 +1,17 @@
+-- Set when the red-flag engine detected an emergency in the conversation (rule id, '' otherwise).
+ALTER TABLE "conversation" ADD COLUMN "red_flag" TEXT NOT NULL DEFAULT '';
+
+-- Doctors who currently receive emergency alerts.
+ALTER TABLE "users" ADD COLUMN "on_call" BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE "notifications" (
+    "id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    "user_id" UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    "kind" TEXT NOT NULL,
+    "conversation_id" UUID REFERENCES conversation(id) ON DELETE CASCADE,
+    "body" TEXT NOT NULL,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+    "read_at" TIMESTAMPTZ
+);
+
+CREATE INDEX "notifications_user_created_idx" ON "notifications" (user_id, created_at DESC);
@@ -0,0 +1,6 @@
+ALTER TABLE "summaries" DROP CONSTRAINT "summaries_doctor_id_fkey";
+ALTER TABLE "summaries" ADD CONSTRAINT "summaries_doctor_id_fkey"
+    FOREIGN KEY (doctor_id) REFERENCES users(id);
+
+DROP INDEX "users_doctor_specialty_idx";
+ALTER TABLE "users" DROP COLUMN "specialty";
@@ -0,0 +1,9 @@
+-- Specialty slug of a doctor, used by the doctor directory ('' for other roles).
+ALTER TABLE "users" ADD COLUMN "specialty" TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX "users_doctor_specialty_idx" ON "users" (specialty) WHERE role = 'doctor';
+
+-- Removing a doctor from the directory keeps their patients' summaries, unassigned.
+ALTER TABLE "summaries" DROP CONSTRAINT "summaries_doctor_id_fkey";
+ALTER TABLE "summaries" ADD CONSTRAINT "summaries_doctor_id_fkey"
+    FOREIGN KEY (doctor_id) REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,18 @@
+-- A patient sending one of their summaries to a doctor.
+-- Status machine: pending -> accepted | declined -> closed.
+CREATE TABLE "referrals" (
+    "id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    "summary_id" UUID NOT NULL REFERENCES summaries(id) ON DELETE CASCADE,
+    "patient_id" UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    "doctor_id" UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    "status" TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined', 'closed')),
+    "note" TEXT NOT NULL DEFAULT '',
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+    "updated_at" TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- A summary can only be under review by one doctor at a time.
+CREATE UNIQUE INDEX "referrals_open_summary_key" ON "referrals" (summary_id) WHERE status IN ('pending', 'accepted');
+
+CREATE INDEX "referrals_doctor_status_idx" ON "referrals" (doctor_id, status, created_at DESC);
+CREATE INDEX "referrals_patient_idx" ON "referrals" (patient_id, created_at DESC);
@@ -0,0 +1,5 @@
+DROP TABLE "conversation_reads";
+
+DELETE FROM "messages" WHERE sender = 'doctor';
+ALTER TABLE "messages" DROP CONSTRAINT "messages_sender_check";
+ALTER TABLE "messages" ADD CONSTRAINT "messages_sender_check" CHECK (sender IN ('user', 'assistant'));
@@ -0,0 +1,12 @@
+-- Doctors write in the conversations referred to them.
+ALTER TABLE "messages" DROP CONSTRAINT "messages_sender_check";
+ALTER TABLE "messages" ADD CONSTRAINT "messages_sender_check" CHECK (sender IN ('user', 'assistant', 'doctor'));
+
+-- Read receipts: when each participant last read a conversation.
+CREATE TABLE "conversation_reads" (
+    "conversation_id" UUID NOT NULL REFERENCES conversation(id) ON DELETE CASCADE,
+    "user_id" UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    "last_read_message_id" UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    "read_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (conversation_id, user_id)
+);
@@ -0,0 +1,37 @@
+-- Needed to mix equality and range overlap in the exclusion constraints below.
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+-- Weekly opening hours of a doctor, cut into slots of slot_minutes.
+-- Minutes are counted from midnight in the doctor's timezone; weekday 0 is Sunday.
+CREATE TABLE "doctor_availability" (
+    "id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    "doctor_id" UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    "weekday" INT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    "start_minute" INT NOT NULL CHECK (start_minute BETWEEN 0 AND 1439),
+    "end_minute" INT NOT NULL CHECK (end_minute <= 1440),
+    "slot_minutes" INT NOT NULL DEFAULT 30 CHECK (slot_minutes BETWEEN 5 AND 240),
+    "timezone" TEXT NOT NULL DEFAULT 'Africa/Douala',
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (end_minute > start_minute),
+    EXCLUDE USING gist (doctor_id WITH =, weekday WITH =, int4range(start_minute, end_minute) WITH &&)
+);
+
+CREATE TABLE "appointments" (
+    "id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    "doctor_id" UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    "patient_id" UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    "conversation_id" UUID REFERENCES conversation(id) ON DELETE SET NULL,
+    "summary_id" UUID REFERENCES summaries(id) ON DELETE SET NULL,
+    "starts_at" TIMESTAMPTZ NOT NULL,
+    "ends_at" TIMESTAMPTZ NOT NULL,
+    "status" TEXT NOT NULL DEFAULT 'booked' CHECK (status IN ('booked', 'cancelled')),
+    "note" TEXT NOT NULL DEFAULT '',
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+    "updated_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (ends_at > starts_at),
+    -- No double booking, neither of the doctor nor of the patient.
+    CONSTRAINT "appointments_doctor_overlap" EXCLUDE USING gist (doctor_id WITH =, tstzrange(starts_at, ends_at) WITH &&) WHERE (status = 'booked'),
+    CONSTRAINT "appointments_patient_overlap" EXCLUDE USING gist (patient_id WITH =, tstzrange(starts_at, ends_at) WITH &&) WHERE (status = 'booked')
+);
+
+CREATE INDEX "appointments_patient_starts_idx" ON "appointments" (patient_id, starts_at);
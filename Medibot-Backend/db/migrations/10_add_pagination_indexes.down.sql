@@ -0,0 +1,2 @@
+DROP INDEX "messages_con_id_timestamp_idx";
+DROP INDEX "conversation_user_created_idx";
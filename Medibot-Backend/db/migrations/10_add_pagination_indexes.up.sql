@@ -0,0 +1,3 @@
+-- Keyset pagination of conversations (newest first) and of the messages of a conversation.
+CREATE INDEX "conversation_user_created_idx" ON "conversation" (user_id, created_at DESC, id DESC);
+CREATE INDEX "messages_con_id_timestamp_idx" ON "messages" (con_id, timestamp, id);
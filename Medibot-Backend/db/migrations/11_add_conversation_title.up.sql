@@ -0,0 +1,2 @@
+-- Short title of the conversation, generated by the AI after the first exchange or set by the patient ('' until then).
+ALTER TABLE "conversation" ADD COLUMN "title" TEXT NOT NULL DEFAULT '';
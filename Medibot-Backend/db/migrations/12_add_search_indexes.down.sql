@@ -0,0 +1,2 @@
+DROP INDEX "summaries_content_search_idx";
+DROP INDEX "messages_content_search_idx";
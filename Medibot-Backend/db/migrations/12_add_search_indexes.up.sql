@@ -0,0 +1,6 @@
+-- Full-text search of messages and summaries. Patients write in English and French, so the text is
+-- indexed under both configurations; queries must repeat the exact same expression to use the index.
+CREATE INDEX "messages_content_search_idx" ON "messages"
+    USING GIN ((to_tsvector('english', content) || to_tsvector('french', content)));
+CREATE INDEX "summaries_content_search_idx" ON "summaries"
+    USING GIN ((to_tsvector('english', content) || to_tsvector('french', content)));
@@ -0,0 +1,2 @@
+-- Model that produced an assistant message, e.g. gemini-2.0-flash ('' for messages not written by a model).
+ALTER TABLE "messages" ADD COLUMN "model" TEXT NOT NULL DEFAULT '';
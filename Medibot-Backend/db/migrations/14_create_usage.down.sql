@@ -0,0 +1,4 @@
+DROP TABLE "usage_daily";
+ALTER TABLE "messages" DROP COLUMN "total_tokens";
+ALTER TABLE "messages" DROP COLUMN "completion_tokens";
+ALTER TABLE "messages" DROP COLUMN "prompt_tokens";
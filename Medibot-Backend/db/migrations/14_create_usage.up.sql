@@ -0,0 +1,18 @@
+-- Tokens billed by the AI provider for an assistant message (0 for messages not written by a model).
+ALTER TABLE "messages" ADD COLUMN "prompt_tokens" INT NOT NULL DEFAULT 0;
+ALTER TABLE "messages" ADD COLUMN "completion_tokens" INT NOT NULL DEFAULT 0;
+ALTER TABLE "messages" ADD COLUMN "total_tokens" INT NOT NULL DEFAULT 0;
+
+-- AI usage of each user per UTC day, every AI request included (replies, triage extraction),
+-- used for the daily quotas and the admin usage reports.
+CREATE TABLE "usage_daily" (
+    "user_id" UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    "day" DATE NOT NULL,
+    "requests" BIGINT NOT NULL DEFAULT 0,
+    "prompt_tokens" BIGINT NOT NULL DEFAULT 0,
+    "completion_tokens" BIGINT NOT NULL DEFAULT 0,
+    "total_tokens" BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY ("user_id", "day")
+);
+
+CREATE INDEX "usage_daily_day_idx" ON "usage_daily" (day);
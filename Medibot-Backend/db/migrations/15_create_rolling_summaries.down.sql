@@ -0,0 +1 @@
+DROP TABLE "rolling_summaries";
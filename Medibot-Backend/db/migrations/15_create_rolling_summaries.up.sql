@@ -0,0 +1,8 @@
+-- Rolling summary of the earlier part of a long conversation, sent to the model instead of the
+-- messages it covers: every message up to and including last_message_id.
+CREATE TABLE "rolling_summaries" (
+    "conversation_id" UUID PRIMARY KEY REFERENCES conversation(id) ON DELETE CASCADE,
+    "content" TEXT NOT NULL,
+    "last_message_id" UUID NOT NULL,
+    "updated_at" TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,14 @@
+-- Idempotency-Key of the chat requests, so a retried request gets the original response instead
+-- of prompting the model and saving the messages again. status_code is 0 while the request is
+-- in progress, then the response is stored with the messages of the turn.
+CREATE TABLE "idempotency_keys" (
+    "user_id" UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    "key" TEXT NOT NULL,
+    "request_hash" TEXT NOT NULL,
+    "status_code" INT NOT NULL DEFAULT 0,
+    "response" JSONB,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY ("user_id", "key")
+);
+
+CREATE INDEX "idempotency_keys_created_at_idx" ON "idempotency_keys" (created_at);
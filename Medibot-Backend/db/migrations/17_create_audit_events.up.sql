@@ -0,0 +1,44 @@
+-- Append-only log of the access to patient data. Every event is chained to the previous one:
+-- hash covers the event and prev_hash, so changing or removing an event breaks the chain after it.
+-- The ids have no gaps, they are assigned by the writer holding the audit log lock.
+-- actor_id has no foreign key, the events outlive the users.
+-- hash covers the keyed hashes of the actor and the IP instead of their values, so erasing a user
+-- can forget both (nil actor_id, empty ip) and the chain stays verifiable.
+CREATE TABLE "audit_events" (
+    "id" BIGINT PRIMARY KEY,
+    "created_at" TIMESTAMPTZ NOT NULL,
+    "actor_id" UUID NOT NULL,
+    "actor_hash" TEXT NOT NULL,
+    "actor_role" TEXT NOT NULL,
+    "action" TEXT NOT NULL,
+    "target_type" TEXT NOT NULL,
+    "target_id" UUID NOT NULL,
+    "ip" TEXT NOT NULL,
+    "ip_hash" TEXT NOT NULL,
+    "prev_hash" TEXT NOT NULL,
+    "hash" TEXT NOT NULL
+);
+
+CREATE INDEX "audit_events_actor_idx" ON "audit_events" (actor_id, id);
+CREATE INDEX "audit_events_target_idx" ON "audit_events" (target_type, target_id, id);
+
+-- The only update let through is the pseudonymization of an event: clearing its actor and IP.
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND NEW.actor_id = '00000000-0000-0000-0000-000000000000' AND NEW.ip = ''
+        AND (NEW.id, NEW.created_at, NEW.actor_hash, NEW.actor_role, NEW.action, NEW.target_type,
+             NEW.target_id, NEW.ip_hash, NEW.prev_hash, NEW.hash)
+        IS NOT DISTINCT FROM
+            (OLD.id, OLD.created_at, OLD.actor_hash, OLD.actor_role, OLD.action, OLD.target_type,
+             OLD.target_id, OLD.ip_hash, OLD.prev_hash, OLD.hash) THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "audit_events_no_change" BEFORE UPDATE OR DELETE ON "audit_events"
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+CREATE TRIGGER "audit_events_no_truncate" BEFORE TRUNCATE ON "audit_events"
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,3 @@
+-- Set by the retention worker once a summary is older than the archive period.
+-- Archived summaries are left out of the summary lists but stay readable and exported.
+ALTER TABLE "summaries" ADD COLUMN "archived_at" TIMESTAMPTZ;
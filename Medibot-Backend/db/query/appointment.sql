@@ -0,0 +1,66 @@
+-- name: CreateAvailability :one
+INSERT INTO doctor_availability (doctor_id, weekday, start_minute, end_minute, slot_minutes, timezone)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: DeleteDoctorAvailability :exec
+DELETE FROM doctor_availability
+WHERE doctor_id = $1;
+
+-- name: ListDoctorAvailability :many
+SELECT * FROM doctor_availability
+WHERE doctor_id = $1
+ORDER BY weekday, start_minute;
+
+-- name: CreateAppointment :one
+-- A nil conversation or summary id is stored as NULL.
+INSERT INTO appointments (doctor_id, patient_id, conversation_id, summary_id, starts_at, ends_at, note)
+VALUES (
+    @doctor_id,
+    @patient_id,
+    NULLIF(@conversation_id::uuid, '00000000-0000-0000-0000-000000000000'),
+    NULLIF(@summary_id::uuid, '00000000-0000-0000-0000-000000000000'),
+    @starts_at,
+    @ends_at,
+    @note
+)
+RETURNING *;
+
+-- name: GetAppointmentForUser :one
+SELECT * FROM appointments
+WHERE id = @id AND (patient_id = @user_id OR doctor_id = @user_id);
+
+-- name: ListAppointmentsForUser :many
+-- Patients list their appointments, doctors their schedule, from the given time on.
+SELECT * FROM appointments
+WHERE (patient_id = @user_id OR doctor_id = @user_id)
+  AND ends_at >= @since
+ORDER BY starts_at
+LIMIT @page_limit OFFSET @page_offset;
+
+-- name: ListDoctorAppointments :many
+-- Booked appointments of a doctor overlapping [since, until).
+SELECT * FROM appointments
+WHERE doctor_id = @doctor_id AND status = 'booked'
+  AND starts_at < @until AND ends_at > @since
+ORDER BY starts_at;
+
+-- name: ListDoctorCalendar :many
+-- Appointments of a doctor overlapping [since, until) for their calendar feed: the booked ones, and the
+-- ones cancelled since cancelled_since so the calendars subscribed to the feed remove them.
+SELECT * FROM appointments
+WHERE doctor_id = @doctor_id
+  AND (status = 'booked' OR (status = 'cancelled' AND updated_at >= @cancelled_since))
+  AND starts_at < @until AND ends_at > @since
+ORDER BY starts_at;
+
+-- name: RescheduleAppointment :one
+UPDATE appointments SET starts_at = @starts_at, ends_at = @ends_at, updated_at = now()
+WHERE id = @id AND patient_id = @patient_id AND status = 'booked'
+RETURNING *;
+
+-- name: CancelAppointment :one
+-- Either the patient or the doctor can cancel a booked appointment.
+UPDATE appointments SET status = 'cancelled', updated_at = now()
+WHERE id = @id AND (patient_id = @user_id OR doctor_id = @user_id) AND status = 'booked'
+RETURNING *;
@@ -0,0 +1,36 @@
+-- name: LockAuditLog :exec
+-- Serializes the writers of the audit log until the end of the transaction, so the chain never forks.
+SELECT pg_advisory_xact_lock(hashtext('audit_events'));
+
+-- name: GetLastAuditEvent :one
+SELECT * FROM audit_events
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (id, created_at, actor_id, actor_hash, actor_role, action, target_type, target_id, ip, ip_hash, prev_hash, hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);
+
+-- name: ListAuditEvents :many
+-- Events between two UTC days included, newest first. Every filter left empty matches everything.
+SELECT * FROM audit_events
+WHERE (created_at AT TIME ZONE 'UTC')::date BETWEEN @from_day::date AND @to_day::date
+  AND (@actor_id::uuid = '00000000-0000-0000-0000-000000000000' OR actor_id = @actor_id::uuid)
+  AND (@action::text = '' OR action = @action::text)
+  AND (@target_type::text = '' OR target_type = @target_type::text)
+  AND (@target_id::uuid = '00000000-0000-0000-0000-000000000000' OR target_id = @target_id::uuid)
+ORDER BY id DESC
+LIMIT @page_limit OFFSET @page_offset;
+
+-- name: ListAuditChain :many
+-- One batch of the chain in order, for its verification.
+SELECT * FROM audit_events
+WHERE id > $1
+ORDER BY id
+LIMIT $2;
+
+-- name: PseudonymizeAuditEvents :execrows
+-- Forgets the actor and the IP of the events of an erased user, only their keyed hashes are left.
+-- It is the only change the audit_events triggers let through.
+UPDATE audit_events SET actor_id = '00000000-0000-0000-0000-000000000000', ip = ''
+WHERE actor_id = $1;
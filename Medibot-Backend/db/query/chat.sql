@@ -0,0 +1,30 @@
+-- name: GetConversationForDoctor :one
+-- A doctor can join a conversation once they accepted a referral of its summary,
+-- or once they were alerted of its red flag while on call.
+SELECT c.* FROM conversation c
+WHERE c.id = @id AND (
+    EXISTS (
+        SELECT 1 FROM summaries s
+        JOIN referrals r ON r.summary_id = s.id
+        WHERE s.conversation_id = c.id AND r.doctor_id = @doctor_id AND r.status = 'accepted'
+    ) OR EXISTS (
+        SELECT 1 FROM notifications n
+        WHERE n.conversation_id = c.id AND n.user_id = @doctor_id AND n.kind = 'red_flag'
+    )
+);
+
+-- name: CreateChatMessage :one
+INSERT INTO messages (con_id, sender, content)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: MarkConversationRead :execrows
+-- The marker only points at a message of the conversation, and only moves forward in (timestamp, id) order.
+INSERT INTO conversation_reads (conversation_id, user_id, last_read_message_id)
+SELECT m.con_id, @user_id, m.id FROM messages m
+WHERE m.id = @last_read_message_id AND m.con_id = @conversation_id
+ON CONFLICT (conversation_id, user_id) DO UPDATE SET
+    last_read_message_id = EXCLUDED.last_read_message_id,
+    read_at = now()
+WHERE (SELECT (m.timestamp, m.id) FROM messages m WHERE m.id = EXCLUDED.last_read_message_id)
+    > (SELECT (m.timestamp, m.id) FROM messages m WHERE m.id = conversation_reads.last_read_message_id);
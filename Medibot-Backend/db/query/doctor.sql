@@ -0,0 +1,31 @@
+-- name: ListDoctors :many
+-- An empty location or specialty matches every doctor; location matches any part of the city/region.
+SELECT * FROM users
+WHERE role = 'doctor'
+  AND (@location::text = '' OR location ILIKE '%' || @location::text || '%')
+  AND (@specialty::text = '' OR specialty = @specialty::text)
+ORDER BY username, created_at
+LIMIT @page_limit OFFSET @page_offset;
+
+-- name: GetDoctor :one
+SELECT * FROM users
+WHERE id = $1 AND role = 'doctor';
+
+-- name: CreateDoctor :one
+INSERT INTO users (email, username, role, experience, location, license_number, specialty)
+VALUES ($1, $2, 'doctor', $3, $4, $5, $6)
+RETURNING *;
+
+-- name: UpdateDoctor :one
+UPDATE users SET
+    username = $2,
+    experience = $3,
+    location = $4,
+    license_number = $5,
+    specialty = $6
+WHERE id = $1 AND role = 'doctor'
+RETURNING *;
+
+-- name: DeleteDoctor :execrows
+DELETE FROM users
+WHERE id = $1 AND role = 'doctor';
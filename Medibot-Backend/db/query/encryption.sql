@@ -0,0 +1,59 @@
+-- name: ListMessageContents :many
+-- One batch of the messages in id order, for re-encryption.
+SELECT id, content FROM messages
+WHERE id > @after_id
+ORDER BY id
+LIMIT @page_limit;
+
+-- name: UpdateMessageContent :execrows
+-- Replaces the content only if it is still the one the new content was computed from.
+UPDATE messages SET content = @new_content
+WHERE id = @id AND content = @old_content;
+
+-- name: ListSummaryContents :many
+-- One batch of the summaries in id order, for re-encryption.
+SELECT id, content FROM summaries
+WHERE id > @after_id
+ORDER BY id
+LIMIT @page_limit;
+
+-- name: UpdateSummaryContent :execrows
+-- Replaces the content only if it is still the one the new content was computed from.
+UPDATE summaries SET content = @new_content
+WHERE id = @id AND content = @old_content;
+
+-- name: ListRollingSummaryContents :many
+-- One batch of the rolling summaries in conversation id order, for re-encryption.
+SELECT conversation_id, content FROM rolling_summaries
+WHERE conversation_id > @after_id
+ORDER BY conversation_id
+LIMIT @page_limit;
+
+-- name: UpdateRollingSummaryContent :execrows
+-- Replaces the content only if it is still the one the new content was computed from.
+UPDATE rolling_summaries SET content = @new_content
+WHERE conversation_id = @conversation_id AND content = @old_content;
+
+-- name: ListNotificationBodies :many
+-- One batch of the notifications in id order, for re-encryption.
+SELECT id, body FROM notifications
+WHERE id > @after_id
+ORDER BY id
+LIMIT @page_limit;
+
+-- name: UpdateNotificationBody :execrows
+-- Replaces the body only if it is still the one the new body was computed from.
+UPDATE notifications SET body = @new_body
+WHERE id = @id AND body = @old_body;
+
+-- name: ListConversationTitles :many
+-- One batch of the titled conversations in id order, for re-encryption.
+SELECT id, title FROM conversation
+WHERE id > @after_id AND title <> ''
+ORDER BY id
+LIMIT @page_limit;
+
+-- name: ReplaceConversationTitle :execrows
+-- Replaces the title only if it is still the one the new title was computed from.
+UPDATE conversation SET title = @new_title
+WHERE id = @id AND title = @old_title;
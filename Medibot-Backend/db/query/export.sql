@@ -0,0 +1,19 @@
+-- name: ExportConversations :many
+-- Every conversation of a user, for the export of their data.
+SELECT * FROM conversation
+WHERE user_id = $1
+ORDER BY created_at, id;
+
+-- name: ExportMessages :many
+-- Every message of a user's conversations, grouped by conversation and in order.
+SELECT m.* FROM conversation c
+JOIN messages m
+ON c.id = m.con_id
+WHERE c.user_id = $1
+ORDER BY m.con_id, m.timestamp, m.id;
+
+-- name: ExportSummaries :many
+-- Every summary of a patient, for the export of their data.
+SELECT * FROM summaries
+WHERE patient_id = $1
+ORDER BY created_at, id;
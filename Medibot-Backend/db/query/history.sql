@@ -0,0 +1,11 @@
+-- name: GetRollingSummary :one
+SELECT * FROM rolling_summaries
+WHERE conversation_id = $1;
+
+-- name: UpsertRollingSummary :exec
+INSERT INTO rolling_summaries (conversation_id, content, last_message_id)
+VALUES ($1, $2, $3)
+ON CONFLICT (conversation_id) DO UPDATE SET
+    content = EXCLUDED.content,
+    last_message_id = EXCLUDED.last_message_id,
+    updated_at = now();
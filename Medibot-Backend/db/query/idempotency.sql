@@ -0,0 +1,26 @@
+-- name: ReserveIdempotencyKey :execrows
+-- Claims a key for a new request, 0 rows when it is already taken. A key expires after a day,
+-- and a request that never completed (the server stopped mid-turn) releases it after 5 minutes.
+INSERT INTO idempotency_keys (user_id, key, request_hash)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, key) DO UPDATE SET
+    request_hash = EXCLUDED.request_hash,
+    status_code = 0,
+    response = NULL,
+    created_at = now()
+WHERE idempotency_keys.created_at < now() - interval '1 day'
+   OR (idempotency_keys.status_code = 0 AND idempotency_keys.created_at < now() - interval '5 minutes');
+
+-- name: GetIdempotencyKey :one
+SELECT * FROM idempotency_keys
+WHERE user_id = $1 AND key = $2;
+
+-- name: CompleteIdempotencyKey :exec
+UPDATE idempotency_keys
+SET status_code = $3, response = $4
+WHERE user_id = $1 AND key = $2;
+
+-- name: ReleaseIdempotencyKey :exec
+-- Frees the key of a request that failed, a completed request keeps its response.
+DELETE FROM idempotency_keys
+WHERE user_id = $1 AND key = $2 AND status_code = 0;
@@ -1,6 +1,7 @@
--- name: CreateUser :exec
+-- name: CreateUser :one
 INSERT INTO users (email,username,role,experience,location,license_number)
-VALUES ($1,$2,$3,$4,$5,$6);
+VALUES ($1,$2,$3,$4,$5,$6)
+RETURNING id;
 
 -- name: GetUser :one
 SELECT * FROM users 
@@ -11,49 +12,110 @@ SELECT * FROM users
 WHERE email = $1;
 
 
--- name: CreateConversation :one
-INSERT INTO conversation (user_id)
-VALUES ($1)
-RETURNING id;
+-- name: CreateConversation :exec
+-- The id is chosen by the caller, so it can be announced before the conversation is saved.
+INSERT INTO conversation (id,user_id,specialty)
+VALUES ($1,$2,$3);
 
 -- name: GetConversation :one
-SELECT id, user_id, created_at FROM conversation
+SELECT id, user_id, created_at, specialty, red_flag, title FROM conversation
 WHERE id = $1 AND user_id = $2;
 
 -- name: CreateMessage :exec
-INSERT INTO messages (con_id,sender,content)
-VALUES($1,$2,$3);
-
--- name: CreateSummaries :exec
-INSERT INTO summaries (content,conversation_id,patient_id,doctor_id)
-VALUES ($1,$2,$3,$4);
+-- The patient's message and the reply are saved in the same transaction, where now() is the same
+-- for both: the time of the statement keeps them in order.
+INSERT INTO messages (con_id,sender,content,prompt_version,model,prompt_tokens,completion_tokens,total_tokens,timestamp)
+VALUES($1,$2,$3,$4,$5,$6,$7,$8,clock_timestamp());
 
 -- name: GetSummary :one
 SELECT * FROM summaries WHERE id = $1;
 
+-- name: GetSummaryForUser :one
+-- Patients see their own summaries, doctors only the ones assigned to them.
+SELECT * FROM summaries
+WHERE id = @id AND (patient_id = @user_id OR doctor_id = @user_id);
+
 -- name: GetConMessages :many
 SELECT m.* FROM conversation c
 JOIN messages m 
 ON c.id = m.con_id
-WHERE c.id = $1;
+WHERE c.id = $1
+ORDER BY m.timestamp, m.id;
 
--- name: ListFullConversationsByUserID :many
+-- name: GetConMessagesForUser :many
+SELECT m.* FROM conversation c
+JOIN messages m
+ON c.id = m.con_id
+WHERE c.id = $1 AND c.user_id = $2
+ORDER BY m.timestamp ASC;
+
+-- name: ListConversationHeaders :many
+-- One page of a user's conversations, newest first, starting after the cursor when has_cursor is set.
+-- Untitled conversations show the beginning of the first message, the preview is the beginning of the last one.
+-- The messages are returned whole, the caller shortens them once decrypted.
 SELECT
-    c.id AS conversation_id,
-    c.created_at AS conversation_created_at,
-    m.id AS message_id,
-    m.sender AS message_sender,
-    m.content AS message_content,
-    m.timestamp AS message_timestamp
-FROM
-    conversation c
-LEFT JOIN
-    messages m ON c.id = m.con_id
-WHERE
-    c.user_id = $1
-ORDER BY
-    c.created_at DESC, m.timestamp ASC;
+    c.id,
+    c.created_at,
+    c.specialty,
+    c.red_flag,
+    c.title,
+    COALESCE(first_msg.content, '')::text AS first_message,
+    COALESCE(last_msg.content, '')::text AS last_message,
+    COALESCE(last_msg.sender, '')::text AS last_sender,
+    COALESCE(last_msg.timestamp, c.created_at)::timestamp AS last_activity,
+    (SELECT count(*) FROM messages m WHERE m.con_id = c.id) AS message_count
+FROM conversation c
+LEFT JOIN LATERAL (
+    SELECT content FROM messages
+    WHERE con_id = c.id
+    ORDER BY timestamp, id
+    LIMIT 1
+) first_msg ON true
+LEFT JOIN LATERAL (
+    SELECT content, sender, timestamp FROM messages
+    WHERE con_id = c.id
+    ORDER BY timestamp DESC, id DESC
+    LIMIT 1
+) last_msg ON true
+WHERE c.user_id = @user_id
+  AND (NOT @has_cursor::bool OR (c.created_at, c.id) < (@cursor_created_at::timestamp, @cursor_id::uuid))
+ORDER BY c.created_at DESC, c.id DESC
+LIMIT @page_limit;
+
+-- name: ListMessagesBefore :many
+-- The page of messages right before the cursor, newest first; the latest page without cursor.
+SELECT * FROM messages
+WHERE con_id = @con_id
+  AND (NOT @has_cursor::bool OR (timestamp, id) < (@cursor_timestamp::timestamp, @cursor_id::uuid))
+ORDER BY timestamp DESC, id DESC
+LIMIT @page_limit;
+
+-- name: ListMessagesAfter :many
+-- The page of messages right after the cursor, oldest first.
+SELECT * FROM messages
+WHERE con_id = @con_id
+  AND (timestamp, id) > (@cursor_timestamp::timestamp, @cursor_id::uuid)
+ORDER BY timestamp ASC, id ASC
+LIMIT @page_limit;
 
 -- name: DeleteConversation :exec
 DELETE FROM conversation 
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: DeleteConversationForUser :execrows
+DELETE FROM conversation
+WHERE id = $1 AND user_id = $2;
+
+-- name: MarkConversationRedFlag :exec
+UPDATE conversation SET red_flag = $2
+WHERE id = $1;
+
+-- name: UpdateConversationTitle :one
+UPDATE conversation SET title = $3
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: SetGeneratedConversationTitle :execrows
+-- Generated titles never replace a title the patient has set in the meantime.
+UPDATE conversation SET title = $2
+WHERE id = $1 AND title = '';
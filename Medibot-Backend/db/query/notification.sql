@@ -0,0 +1,14 @@
+-- name: CreateNotification :exec
+-- A nil conversation id is stored as NULL.
+INSERT INTO notifications (user_id, kind, conversation_id, body)
+VALUES (@user_id, @kind, NULLIF(@conversation_id::uuid, '00000000-0000-0000-0000-000000000000'), @body);
+
+-- name: ListNotifications :many
+SELECT * FROM notifications
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: MarkNotificationRead :execrows
+UPDATE notifications SET read_at = now()
+WHERE id = $1 AND user_id = $2 AND read_at IS NULL;
@@ -0,0 +1,30 @@
+-- name: CreateReferral :one
+INSERT INTO referrals (summary_id, patient_id, doctor_id, note)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetReferralForUser :one
+-- Only the patient who sent the referral and the doctor it was sent to can see it.
+SELECT * FROM referrals
+WHERE id = @id AND (patient_id = @user_id OR doctor_id = @user_id);
+
+-- name: ListReferralsForUser :many
+-- Patients list the referrals they sent, doctors their inbox. An empty status lists every status.
+SELECT r.*, s.severity, s.suspected_condition FROM referrals r
+JOIN summaries s ON s.id = r.summary_id
+WHERE (r.patient_id = @user_id OR r.doctor_id = @user_id)
+  AND (@status::text = '' OR r.status = @status::text)
+ORDER BY r.created_at DESC
+LIMIT @page_limit OFFSET @page_offset;
+
+-- name: UpdateReferralStatus :one
+-- Moves a referral sent to the doctor from from_status to to_status; no rows if it is no longer in from_status.
+UPDATE referrals SET status = @to_status, updated_at = now()
+WHERE id = @id AND doctor_id = @doctor_id AND status = @from_status
+RETURNING *;
+
+-- name: CloseReferral :one
+-- Either side can close a referral once the doctor has answered it.
+UPDATE referrals SET status = 'closed', updated_at = now()
+WHERE id = @id AND (patient_id = @user_id OR doctor_id = @user_id) AND status IN ('accepted', 'declined')
+RETURNING *;
@@ -0,0 +1,37 @@
+-- name: ListExpiredConversations :many
+-- One batch, in id order, of the conversations that were never shared with a doctor (no referral of
+-- their summary, no appointment), never raised a red flag and have had no message for the given number of days.
+SELECT c.id FROM conversation c
+WHERE c.id > @after_id
+  AND c.created_at < now() - make_interval(days => @days::int)
+  AND NOT EXISTS (SELECT 1 FROM messages m WHERE m.con_id = c.id AND m.timestamp >= now() - make_interval(days => @days::int))
+  AND NOT EXISTS (SELECT 1 FROM summaries s JOIN referrals r ON r.summary_id = s.id WHERE s.conversation_id = c.id)
+  AND NOT EXISTS (SELECT 1 FROM appointments a WHERE a.conversation_id = c.id)
+  AND c.red_flag = ''
+ORDER BY c.id
+LIMIT @page_limit;
+
+-- name: DeleteExpiredConversations :many
+-- Deletes those of the given conversations that are still expired, with their messages and summaries.
+DELETE FROM conversation c
+WHERE c.id = ANY(@ids::uuid[])
+  AND c.created_at < now() - make_interval(days => @days::int)
+  AND NOT EXISTS (SELECT 1 FROM messages m WHERE m.con_id = c.id AND m.timestamp >= now() - make_interval(days => @days::int))
+  AND NOT EXISTS (SELECT 1 FROM summaries s JOIN referrals r ON r.summary_id = s.id WHERE s.conversation_id = c.id)
+  AND NOT EXISTS (SELECT 1 FROM appointments a WHERE a.conversation_id = c.id)
+  AND c.red_flag = ''
+RETURNING c.id;
+
+-- name: ListSummariesToArchive :many
+-- One batch, in id order, of the summaries written more than the given number of years ago and not archived yet.
+SELECT id FROM summaries
+WHERE id > @after_id
+  AND archived_at IS NULL
+  AND created_at < now() - make_interval(years => @years::int)
+ORDER BY id
+LIMIT @page_limit;
+
+-- name: ArchiveSummaries :many
+UPDATE summaries SET archived_at = now()
+WHERE id = ANY(@ids::uuid[]) AND archived_at IS NULL
+RETURNING id;
@@ -0,0 +1,41 @@
+-- name: SearchForUser :many
+-- Messages and summaries matching the query in English or French, best matches first, limited to
+-- what the user may see: their own conversations and summaries, and for doctors the summaries
+-- assigned to them and the conversations of the referrals they accepted.
+-- The snippet is the raw content with the matches, in the configuration that matched, between
+-- U+E000 and U+E001: the caller escapes it before turning them into markup.
+WITH q AS (
+    SELECT websearch_to_tsquery('english', @query::text) AS en,
+           websearch_to_tsquery('french', @query::text) AS fr,
+           -- U+E000 and U+E001 (private use) delimit the matches, see api.highlightSnippet
+           chr(57344) || chr(57345) AS markers,
+           'StartSel=' || chr(57344) || ', StopSel=' || chr(57345) || ', MaxFragments=2, MaxWords=20, MinWords=5' AS options
+), hits AS (
+    SELECT 'message'::text AS kind, m.id, m.con_id AS conversation_id, m.content, m.timestamp AS created_at
+    FROM messages m
+    JOIN conversation c ON c.id = m.con_id, q
+    WHERE (to_tsvector('english', m.content) || to_tsvector('french', m.content)) @@ (q.en || q.fr)
+      AND (c.user_id = @user_id OR EXISTS (
+          SELECT 1 FROM summaries s
+          JOIN referrals r ON r.summary_id = s.id
+          WHERE s.conversation_id = c.id AND r.doctor_id = @user_id AND r.status = 'accepted'
+      ))
+    UNION ALL
+    SELECT 'summary'::text, s.id, s.conversation_id, s.content, s.created_at
+    FROM summaries s, q
+    WHERE (to_tsvector('english', s.content) || to_tsvector('french', s.content)) @@ (q.en || q.fr)
+      AND (s.patient_id = @user_id OR s.doctor_id = @user_id)
+)
+SELECT
+    hits.kind,
+    hits.id,
+    hits.conversation_id,
+    hits.created_at,
+    CASE WHEN to_tsvector('french', hits.content) @@ q.fr
+        THEN ts_headline('french', translate(hits.content, q.markers, ''), q.fr, q.options)
+        ELSE ts_headline('english', translate(hits.content, q.markers, ''), q.en, q.options)
+    END::text AS snippet,
+    ts_rank(to_tsvector('english', hits.content) || to_tsvector('french', hits.content), q.en || q.fr) AS rank
+FROM hits, q
+ORDER BY rank DESC, hits.created_at DESC
+LIMIT @page_limit OFFSET @page_offset;
@@ -0,0 +1,8 @@
+-- name: ListSpecialties :many
+SELECT * FROM specialties
+WHERE active
+ORDER BY name;
+
+-- name: GetSpecialty :one
+SELECT * FROM specialties
+WHERE slug = $1;
@@ -0,0 +1,30 @@
+-- name: UpsertTriageSummary :one
+INSERT INTO summaries (content, conversation_id, patient_id, severity, suspected_condition, recommended_tests, lifestyle_advice, helpful)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (conversation_id) DO UPDATE SET
+    content = EXCLUDED.content,
+    severity = EXCLUDED.severity,
+    suspected_condition = EXCLUDED.suspected_condition,
+    recommended_tests = EXCLUDED.recommended_tests,
+    lifestyle_advice = EXCLUDED.lifestyle_advice,
+    helpful = EXCLUDED.helpful
+RETURNING *;
+
+-- name: ListSummariesForUser :many
+-- Patients list their own summaries, doctors the ones assigned to them.
+-- An empty severity lists every severity; by_severity sorts the most severe cases first.
+-- Archived summaries are left out.
+SELECT * FROM summaries
+WHERE (patient_id = @user_id OR doctor_id = @user_id)
+  AND archived_at IS NULL
+  AND (@severity::text = '' OR severity = @severity::text)
+ORDER BY
+    CASE WHEN @by_severity::bool THEN
+        CASE severity WHEN 'high' THEN 3 WHEN 'moderate' THEN 2 WHEN 'low' THEN 1 ELSE 0 END
+    END DESC,
+    created_at DESC
+LIMIT @page_limit OFFSET @page_offset;
+
+-- name: AssignSummaryDoctor :exec
+UPDATE summaries SET doctor_id = $2
+WHERE id = $1;
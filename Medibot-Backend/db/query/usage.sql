@@ -0,0 +1,50 @@
+-- name: RecordUsage :exec
+-- Adds one AI request to the user's usage of the current UTC day.
+INSERT INTO usage_daily (user_id, day, requests, prompt_tokens, completion_tokens, total_tokens)
+VALUES (@user_id, (now() AT TIME ZONE 'UTC')::date, 1, @prompt_tokens, @completion_tokens, @total_tokens)
+ON CONFLICT (user_id, day) DO UPDATE SET
+    requests = usage_daily.requests + 1,
+    prompt_tokens = usage_daily.prompt_tokens + EXCLUDED.prompt_tokens,
+    completion_tokens = usage_daily.completion_tokens + EXCLUDED.completion_tokens,
+    total_tokens = usage_daily.total_tokens + EXCLUDED.total_tokens;
+
+-- name: GetTodayUsage :one
+-- The user's usage of the current UTC day, zero when they made no request yet.
+SELECT
+    COALESCE(sum(requests), 0)::bigint AS requests,
+    COALESCE(sum(total_tokens), 0)::bigint AS total_tokens
+FROM usage_daily
+WHERE user_id = @user_id AND day = (now() AT TIME ZONE 'UTC')::date;
+
+-- name: ListUsageByUser :many
+-- Usage per user between two UTC days included, biggest consumers first.
+SELECT
+    u.id AS user_id,
+    u.email,
+    u.username,
+    u.role,
+    sum(d.requests)::bigint AS requests,
+    sum(d.prompt_tokens)::bigint AS prompt_tokens,
+    sum(d.completion_tokens)::bigint AS completion_tokens,
+    sum(d.total_tokens)::bigint AS total_tokens
+FROM usage_daily d
+JOIN users u ON u.id = d.user_id
+WHERE d.day BETWEEN @from_day::date AND @to_day::date
+GROUP BY u.id
+ORDER BY total_tokens DESC, u.id
+LIMIT @page_limit OFFSET @page_offset;
+
+-- name: ListUsageByDay :many
+-- Usage per UTC day between two days included, of every user or only of user_id when it is set.
+SELECT
+    d.day,
+    count(DISTINCT d.user_id) AS users,
+    sum(d.requests)::bigint AS requests,
+    sum(d.prompt_tokens)::bigint AS prompt_tokens,
+    sum(d.completion_tokens)::bigint AS completion_tokens,
+    sum(d.total_tokens)::bigint AS total_tokens
+FROM usage_daily d
+WHERE d.day BETWEEN @from_day::date AND @to_day::date
+  AND (@user_id::uuid = '00000000-0000-0000-0000-000000000000' OR d.user_id = @user_id::uuid)
+GROUP BY d.day
+ORDER BY d.day;
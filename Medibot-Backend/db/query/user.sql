@@ -0,0 +1,23 @@
+-- name: ListUsers :many
+SELECT * FROM users
+ORDER BY created_at DESC
+LIMIT $1 OFFSET $2;
+
+-- name: UpdateUserRole :one
+UPDATE users SET role = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE id = $1;
+
+-- name: SetUserOnCall :one
+UPDATE users SET on_call = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: ListOnCallDoctors :many
+SELECT * FROM users
+WHERE role = 'doctor' AND on_call
+ORDER BY created_at;
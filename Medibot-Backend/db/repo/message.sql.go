@@ -12,60 +12,59 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-const createConversation = `-- name: CreateConversation :one
-INSERT INTO conversation (user_id)
-VALUES ($1)
-RETURNING id
+const createConversation = `-- name: CreateConversation :exec
+INSERT INTO conversation (id,user_id,specialty)
+VALUES ($1,$2,$3)
 `
 
-func (q *Queries) CreateConversation(ctx context.Context, userID uuid.UUID) (uuid.UUID, error) {
-	row := q.db.QueryRow(ctx, createConversation, userID)
-	var id uuid.UUID
-	err := row.Scan(&id)
-	return id, err
+type CreateConversationParams struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Specialty string    `json:"specialty"`
 }
 
-const createMessage = `-- name: CreateMessage :exec
-INSERT INTO messages (con_id,sender,content)
-VALUES($1,$2,$3)
-`
-
-type CreateMessageParams struct {
-	ConID   uuid.UUID `json:"con_id"`
-	Sender  string    `json:"sender"`
-	Content string    `json:"content"`
-}
-
-func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) error {
-	_, err := q.db.Exec(ctx, createMessage, arg.ConID, arg.Sender, arg.Content)
+// The id is chosen by the caller, so it can be announced before the conversation is saved.
+func (q *Queries) CreateConversation(ctx context.Context, arg CreateConversationParams) error {
+	_, err := q.db.Exec(ctx, createConversation, arg.ID, arg.UserID, arg.Specialty)
 	return err
 }
 
-const createSummaries = `-- name: CreateSummaries :exec
-INSERT INTO summaries (content,conversation_id,patient_id,doctor_id)
-VALUES ($1,$2,$3,$4)
+const createMessage = `-- name: CreateMessage :exec
+INSERT INTO messages (con_id,sender,content,prompt_version,model,prompt_tokens,completion_tokens,total_tokens,timestamp)
+VALUES($1,$2,$3,$4,$5,$6,$7,$8,clock_timestamp())
 `
 
-type CreateSummariesParams struct {
-	Content        string    `json:"content"`
-	ConversationID uuid.UUID `json:"conversation_id"`
-	PatientID      uuid.UUID `json:"patient_id"`
-	DoctorID       uuid.UUID `json:"doctor_id"`
+type CreateMessageParams struct {
+	ConID            uuid.UUID `json:"con_id"`
+	Sender           string    `json:"sender"`
+	Content          string    `json:"content"`
+	PromptVersion    string    `json:"prompt_version"`
+	Model            string    `json:"model"`
+	PromptTokens     int32     `json:"prompt_tokens"`
+	CompletionTokens int32     `json:"completion_tokens"`
+	TotalTokens      int32     `json:"total_tokens"`
 }
 
-func (q *Queries) CreateSummaries(ctx context.Context, arg CreateSummariesParams) error {
-	_, err := q.db.Exec(ctx, createSummaries,
+// The patient's message and the reply are saved in the same transaction, where now() is the same
+// for both: the time of the statement keeps them in order.
+func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) error {
+	_, err := q.db.Exec(ctx, createMessage,
+		arg.ConID,
+		arg.Sender,
 		arg.Content,
-		arg.ConversationID,
-		arg.PatientID,
-		arg.DoctorID,
+		arg.PromptVersion,
+		arg.Model,
+		arg.PromptTokens,
+		arg.CompletionTokens,
+		arg.TotalTokens,
 	)
 	return err
 }
 
-const createUser = `-- name: CreateUser :exec
+const createUser = `-- name: CreateUser :one
 INSERT INTO users (email,username,role,experience,location,license_number)
 VALUES ($1,$2,$3,$4,$5,$6)
+RETURNING id
 `
 
 type CreateUserParams struct {
@@ -77,8 +76,8 @@ type CreateUserParams struct {
 	LicenseNumber string `json:"license_number"`
 }
 
-func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) error {
-	_, err := q.db.Exec(ctx, createUser,
+func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, createUser,
 		arg.Email,
 		arg.Username,
 		arg.Role,
@@ -86,7 +85,9 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) error {
 		arg.Location,
 		arg.LicenseNumber,
 	)
-	return err
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
 }
 
 const deleteConversation = `-- name: DeleteConversation :exec
@@ -99,11 +100,30 @@ func (q *Queries) DeleteConversation(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteConversationForUser = `-- name: DeleteConversationForUser :execrows
+DELETE FROM conversation
+WHERE id = $1 AND user_id = $2
+`
+
+type DeleteConversationForUserParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) DeleteConversationForUser(ctx context.Context, arg DeleteConversationForUserParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteConversationForUser, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const getConMessages = `-- name: GetConMessages :many
-SELECT m.id, m.con_id, m.sender, m.content, m.timestamp FROM conversation c
+SELECT m.id, m.con_id, m.sender, m.content, m.timestamp, m.prompt_version, m.model, m.prompt_tokens, m.completion_tokens, m.total_tokens FROM conversation c
 JOIN messages m 
 ON c.id = m.con_id
 WHERE c.id = $1
+ORDER BY m.timestamp, m.id
 `
 
 func (q *Queries) GetConMessages(ctx context.Context, id uuid.UUID) ([]Message, error) {
@@ -121,6 +141,55 @@ func (q *Queries) GetConMessages(ctx context.Context, id uuid.UUID) ([]Message,
 			&i.Sender,
 			&i.Content,
 			&i.Timestamp,
+			&i.PromptVersion,
+			&i.Model,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.TotalTokens,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getConMessagesForUser = `-- name: GetConMessagesForUser :many
+SELECT m.id, m.con_id, m.sender, m.content, m.timestamp, m.prompt_version, m.model, m.prompt_tokens, m.completion_tokens, m.total_tokens FROM conversation c
+JOIN messages m
+ON c.id = m.con_id
+WHERE c.id = $1 AND c.user_id = $2
+ORDER BY m.timestamp ASC
+`
+
+type GetConMessagesForUserParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) GetConMessagesForUser(ctx context.Context, arg GetConMessagesForUserParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, getConMessagesForUser, arg.ID, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Message{}
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.ConID,
+			&i.Sender,
+			&i.Content,
+			&i.Timestamp,
+			&i.PromptVersion,
+			&i.Model,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.TotalTokens,
 		); err != nil {
 			return nil, err
 		}
@@ -133,7 +202,7 @@ func (q *Queries) GetConMessages(ctx context.Context, id uuid.UUID) ([]Message,
 }
 
 const getConversation = `-- name: GetConversation :one
-SELECT id, user_id, created_at FROM conversation
+SELECT id, user_id, created_at, specialty, red_flag, title FROM conversation
 WHERE id = $1 AND user_id = $2
 `
 
@@ -145,12 +214,19 @@ type GetConversationParams struct {
 func (q *Queries) GetConversation(ctx context.Context, arg GetConversationParams) (Conversation, error) {
 	row := q.db.QueryRow(ctx, getConversation, arg.ID, arg.UserID)
 	var i Conversation
-	err := row.Scan(&i.ID, &i.UserID, &i.CreatedAt)
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.Specialty,
+		&i.RedFlag,
+		&i.Title,
+	)
 	return i, err
 }
 
 const getSummary = `-- name: GetSummary :one
-SELECT id, content, conversation_id, patient_id, doctor_id, created_at FROM summaries WHERE id = $1
+SELECT id, content, conversation_id, patient_id, doctor_id, created_at, severity, suspected_condition, recommended_tests, lifestyle_advice, helpful, archived_at FROM summaries WHERE id = $1
 `
 
 func (q *Queries) GetSummary(ctx context.Context, id uuid.UUID) (Summary, error) {
@@ -163,12 +239,49 @@ func (q *Queries) GetSummary(ctx context.Context, id uuid.UUID) (Summary, error)
 		&i.PatientID,
 		&i.DoctorID,
 		&i.CreatedAt,
+		&i.Severity,
+		&i.SuspectedCondition,
+		&i.RecommendedTests,
+		&i.LifestyleAdvice,
+		&i.Helpful,
+		&i.ArchivedAt,
+	)
+	return i, err
+}
+
+const getSummaryForUser = `-- name: GetSummaryForUser :one
+SELECT id, content, conversation_id, patient_id, doctor_id, created_at, severity, suspected_condition, recommended_tests, lifestyle_advice, helpful, archived_at FROM summaries
+WHERE id = $1 AND (patient_id = $2 OR doctor_id = $2)
+`
+
+type GetSummaryForUserParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// Patients see their own summaries, doctors only the ones assigned to them.
+func (q *Queries) GetSummaryForUser(ctx context.Context, arg GetSummaryForUserParams) (Summary, error) {
+	row := q.db.QueryRow(ctx, getSummaryForUser, arg.ID, arg.UserID)
+	var i Summary
+	err := row.Scan(
+		&i.ID,
+		&i.Content,
+		&i.ConversationID,
+		&i.PatientID,
+		&i.DoctorID,
+		&i.CreatedAt,
+		&i.Severity,
+		&i.SuspectedCondition,
+		&i.RecommendedTests,
+		&i.LifestyleAdvice,
+		&i.Helpful,
+		&i.ArchivedAt,
 	)
 	return i, err
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, email, username, role, experience, location, license_number, created_at FROM users 
+SELECT id, email, username, role, experience, location, license_number, created_at, on_call, specialty FROM users 
 WHERE id = $1
 `
 
@@ -184,12 +297,14 @@ func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Location,
 		&i.LicenseNumber,
 		&i.CreatedAt,
+		&i.OnCall,
+		&i.Specialty,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, username, role, experience, location, license_number, created_at FROM users 
+SELECT id, email, username, role, experience, location, license_number, created_at, on_call, specialty FROM users 
 WHERE email = $1
 `
 
@@ -205,53 +320,199 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Location,
 		&i.LicenseNumber,
 		&i.CreatedAt,
+		&i.OnCall,
+		&i.Specialty,
 	)
 	return i, err
 }
 
-const listFullConversationsByUserID = `-- name: ListFullConversationsByUserID :many
+const listConversationHeaders = `-- name: ListConversationHeaders :many
 SELECT
-    c.id AS conversation_id,
-    c.created_at AS conversation_created_at,
-    m.id AS message_id,
-    m.sender AS message_sender,
-    m.content AS message_content,
-    m.timestamp AS message_timestamp
-FROM
-    conversation c
-LEFT JOIN
-    messages m ON c.id = m.con_id
-WHERE
-    c.user_id = $1
-ORDER BY
-    c.created_at DESC, m.timestamp ASC
+    c.id,
+    c.created_at,
+    c.specialty,
+    c.red_flag,
+    c.title,
+    COALESCE(first_msg.content, '')::text AS first_message,
+    COALESCE(last_msg.content, '')::text AS last_message,
+    COALESCE(last_msg.sender, '')::text AS last_sender,
+    COALESCE(last_msg.timestamp, c.created_at)::timestamp AS last_activity,
+    (SELECT count(*) FROM messages m WHERE m.con_id = c.id) AS message_count
+FROM conversation c
+LEFT JOIN LATERAL (
+    SELECT content FROM messages
+    WHERE con_id = c.id
+    ORDER BY timestamp, id
+    LIMIT 1
+) first_msg ON true
+LEFT JOIN LATERAL (
+    SELECT content, sender, timestamp FROM messages
+    WHERE con_id = c.id
+    ORDER BY timestamp DESC, id DESC
+    LIMIT 1
+) last_msg ON true
+WHERE c.user_id = $1
+  AND (NOT $2::bool OR (c.created_at, c.id) < ($3::timestamp, $4::uuid))
+ORDER BY c.created_at DESC, c.id DESC
+LIMIT $5
+`
+
+type ListConversationHeadersParams struct {
+	UserID          uuid.UUID        `json:"user_id"`
+	HasCursor       bool             `json:"has_cursor"`
+	CursorCreatedAt pgtype.Timestamp `json:"cursor_created_at"`
+	CursorID        uuid.UUID        `json:"cursor_id"`
+	PageLimit       int32            `json:"page_limit"`
+}
+
+type ListConversationHeadersRow struct {
+	ID           uuid.UUID        `json:"id"`
+	CreatedAt    pgtype.Timestamp `json:"created_at"`
+	Specialty    string           `json:"specialty"`
+	RedFlag      string           `json:"red_flag"`
+	Title        string           `json:"title"`
+	FirstMessage string           `json:"first_message"`
+	LastMessage  string           `json:"last_message"`
+	LastSender   string           `json:"last_sender"`
+	LastActivity pgtype.Timestamp `json:"last_activity"`
+	MessageCount int64            `json:"message_count"`
+}
+
+// One page of a user's conversations, newest first, starting after the cursor when has_cursor is set.
+// Untitled conversations show the beginning of the first message, the preview is the beginning of the last one.
+// The messages are returned whole, the caller shortens them once decrypted.
+func (q *Queries) ListConversationHeaders(ctx context.Context, arg ListConversationHeadersParams) ([]ListConversationHeadersRow, error) {
+	rows, err := q.db.Query(ctx, listConversationHeaders,
+		arg.UserID,
+		arg.HasCursor,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListConversationHeadersRow{}
+	for rows.Next() {
+		var i ListConversationHeadersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Specialty,
+			&i.RedFlag,
+			&i.Title,
+			&i.FirstMessage,
+			&i.LastMessage,
+			&i.LastSender,
+			&i.LastActivity,
+			&i.MessageCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMessagesAfter = `-- name: ListMessagesAfter :many
+SELECT id, con_id, sender, content, timestamp, prompt_version, model, prompt_tokens, completion_tokens, total_tokens FROM messages
+WHERE con_id = $1
+  AND (timestamp, id) > ($2::timestamp, $3::uuid)
+ORDER BY timestamp ASC, id ASC
+LIMIT $4
+`
+
+type ListMessagesAfterParams struct {
+	ConID           uuid.UUID        `json:"con_id"`
+	CursorTimestamp pgtype.Timestamp `json:"cursor_timestamp"`
+	CursorID        uuid.UUID        `json:"cursor_id"`
+	PageLimit       int32            `json:"page_limit"`
+}
+
+// The page of messages right after the cursor, oldest first.
+func (q *Queries) ListMessagesAfter(ctx context.Context, arg ListMessagesAfterParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, listMessagesAfter,
+		arg.ConID,
+		arg.CursorTimestamp,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Message{}
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.ConID,
+			&i.Sender,
+			&i.Content,
+			&i.Timestamp,
+			&i.PromptVersion,
+			&i.Model,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.TotalTokens,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMessagesBefore = `-- name: ListMessagesBefore :many
+SELECT id, con_id, sender, content, timestamp, prompt_version, model, prompt_tokens, completion_tokens, total_tokens FROM messages
+WHERE con_id = $1
+  AND (NOT $2::bool OR (timestamp, id) < ($3::timestamp, $4::uuid))
+ORDER BY timestamp DESC, id DESC
+LIMIT $5
 `
 
-type ListFullConversationsByUserIDRow struct {
-	ConversationID        uuid.UUID        `json:"conversation_id"`
-	ConversationCreatedAt pgtype.Timestamp `json:"conversation_created_at"`
-	MessageID             uuid.UUID        `json:"message_id"`
-	MessageSender         string           `json:"message_sender"`
-	MessageContent        string           `json:"message_content"`
-	MessageTimestamp      pgtype.Timestamp `json:"message_timestamp"`
+type ListMessagesBeforeParams struct {
+	ConID           uuid.UUID        `json:"con_id"`
+	HasCursor       bool             `json:"has_cursor"`
+	CursorTimestamp pgtype.Timestamp `json:"cursor_timestamp"`
+	CursorID        uuid.UUID        `json:"cursor_id"`
+	PageLimit       int32            `json:"page_limit"`
 }
 
-func (q *Queries) ListFullConversationsByUserID(ctx context.Context, userID uuid.UUID) ([]ListFullConversationsByUserIDRow, error) {
-	rows, err := q.db.Query(ctx, listFullConversationsByUserID, userID)
+// The page of messages right before the cursor, newest first; the latest page without cursor.
+func (q *Queries) ListMessagesBefore(ctx context.Context, arg ListMessagesBeforeParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, listMessagesBefore,
+		arg.ConID,
+		arg.HasCursor,
+		arg.CursorTimestamp,
+		arg.CursorID,
+		arg.PageLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []ListFullConversationsByUserIDRow{}
+	items := []Message{}
 	for rows.Next() {
-		var i ListFullConversationsByUserIDRow
+		var i Message
 		if err := rows.Scan(
-			&i.ConversationID,
-			&i.ConversationCreatedAt,
-			&i.MessageID,
-			&i.MessageSender,
-			&i.MessageContent,
-			&i.MessageTimestamp,
+			&i.ID,
+			&i.ConID,
+			&i.Sender,
+			&i.Content,
+			&i.Timestamp,
+			&i.PromptVersion,
+			&i.Model,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.TotalTokens,
 		); err != nil {
 			return nil, err
 		}
@@ -262,3 +523,63 @@ func (q *Queries) ListFullConversationsByUserID(ctx context.Context, userID uuid
 	}
 	return items, nil
 }
+
+const markConversationRedFlag = `-- name: MarkConversationRedFlag :exec
+UPDATE conversation SET red_flag = $2
+WHERE id = $1
+`
+
+type MarkConversationRedFlagParams struct {
+	ID      uuid.UUID `json:"id"`
+	RedFlag string    `json:"red_flag"`
+}
+
+func (q *Queries) MarkConversationRedFlag(ctx context.Context, arg MarkConversationRedFlagParams) error {
+	_, err := q.db.Exec(ctx, markConversationRedFlag, arg.ID, arg.RedFlag)
+	return err
+}
+
+const setGeneratedConversationTitle = `-- name: SetGeneratedConversationTitle :execrows
+UPDATE conversation SET title = $2
+WHERE id = $1 AND title = ''
+`
+
+type SetGeneratedConversationTitleParams struct {
+	ID    uuid.UUID `json:"id"`
+	Title string    `json:"title"`
+}
+
+// Generated titles never replace a title the patient has set in the meantime.
+func (q *Queries) SetGeneratedConversationTitle(ctx context.Context, arg SetGeneratedConversationTitleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setGeneratedConversationTitle, arg.ID, arg.Title)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateConversationTitle = `-- name: UpdateConversationTitle :one
+UPDATE conversation SET title = $3
+WHERE id = $1 AND user_id = $2
+RETURNING id, user_id, created_at, specialty, red_flag, title
+`
+
+type UpdateConversationTitleParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	Title  string    `json:"title"`
+}
+
+func (q *Queries) UpdateConversationTitle(ctx context.Context, arg UpdateConversationTitleParams) (Conversation, error) {
+	row := q.db.QueryRow(ctx, updateConversationTitle, arg.ID, arg.UserID, arg.Title)
+	var i Conversation
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.Specialty,
+		&i.RedFlag,
+		&i.Title,
+	)
+	return i, err
+}
@@ -5,31 +5,151 @@
 package repo
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type Appointment struct {
+	ID             uuid.UUID `json:"id"`
+	DoctorID       uuid.UUID `json:"doctor_id"`
+	PatientID      uuid.UUID `json:"patient_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	SummaryID      uuid.UUID `json:"summary_id"`
+	StartsAt       time.Time `json:"starts_at"`
+	EndsAt         time.Time `json:"ends_at"`
+	Status         string    `json:"status"`
+	Note           string    `json:"note"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type AuditEvent struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	ActorID    uuid.UUID `json:"actor_id"`
+	ActorHash  string    `json:"actor_hash"`
+	ActorRole  string    `json:"actor_role"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"target_type"`
+	TargetID   uuid.UUID `json:"target_id"`
+	Ip         string    `json:"ip"`
+	IpHash     string    `json:"ip_hash"`
+	PrevHash   string    `json:"prev_hash"`
+	Hash       string    `json:"hash"`
+}
+
 type Conversation struct {
 	ID        uuid.UUID        `json:"id"`
 	UserID    uuid.UUID        `json:"user_id"`
 	CreatedAt pgtype.Timestamp `json:"created_at"`
+	Specialty string           `json:"specialty"`
+	RedFlag   string           `json:"red_flag"`
+	Title     string           `json:"title"`
+}
+
+type ConversationRead struct {
+	ConversationID    uuid.UUID `json:"conversation_id"`
+	UserID            uuid.UUID `json:"user_id"`
+	LastReadMessageID uuid.UUID `json:"last_read_message_id"`
+	ReadAt            time.Time `json:"read_at"`
+}
+
+type DoctorAvailability struct {
+	ID          uuid.UUID `json:"id"`
+	DoctorID    uuid.UUID `json:"doctor_id"`
+	Weekday     int32     `json:"weekday"`
+	StartMinute int32     `json:"start_minute"`
+	EndMinute   int32     `json:"end_minute"`
+	SlotMinutes int32     `json:"slot_minutes"`
+	Timezone    string    `json:"timezone"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type IdempotencyKey struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Key         string    `json:"key"`
+	RequestHash string    `json:"request_hash"`
+	StatusCode  int32     `json:"status_code"`
+	Response    []byte    `json:"response"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 type Message struct {
-	ID        uuid.UUID        `json:"id"`
-	ConID     uuid.UUID        `json:"con_id"`
-	Sender    string           `json:"sender"`
-	Content   string           `json:"content"`
-	Timestamp pgtype.Timestamp `json:"timestamp"`
+	ID               uuid.UUID        `json:"id"`
+	ConID            uuid.UUID        `json:"con_id"`
+	Sender           string           `json:"sender"`
+	Content          string           `json:"content"`
+	Timestamp        pgtype.Timestamp `json:"timestamp"`
+	PromptVersion    string           `json:"prompt_version"`
+	Model            string           `json:"model"`
+	PromptTokens     int32            `json:"prompt_tokens"`
+	CompletionTokens int32            `json:"completion_tokens"`
+	TotalTokens      int32            `json:"total_tokens"`
+}
+
+type Notification struct {
+	ID             uuid.UUID          `json:"id"`
+	UserID         uuid.UUID          `json:"user_id"`
+	Kind           string             `json:"kind"`
+	ConversationID uuid.UUID          `json:"conversation_id"`
+	Body           string             `json:"body"`
+	CreatedAt      time.Time          `json:"created_at"`
+	ReadAt         pgtype.Timestamptz `json:"read_at"`
+}
+
+type Referral struct {
+	ID        uuid.UUID `json:"id"`
+	SummaryID uuid.UUID `json:"summary_id"`
+	PatientID uuid.UUID `json:"patient_id"`
+	DoctorID  uuid.UUID `json:"doctor_id"`
+	Status    string    `json:"status"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type RollingSummary struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	Content        string    `json:"content"`
+	LastMessageID  uuid.UUID `json:"last_message_id"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type Specialty struct {
+	Slug              string    `json:"slug"`
+	Name              string    `json:"name"`
+	Description       string    `json:"description"`
+	PromptName        string    `json:"prompt_name"`
+	FollowUpQuestions int32     `json:"follow_up_questions"`
+	SeverityRules     string    `json:"severity_rules"`
+	Active            bool      `json:"active"`
+	CreatedAt         time.Time `json:"created_at"`
 }
 
 type Summary struct {
-	ID             uuid.UUID        `json:"id"`
-	Content        string           `json:"content"`
-	ConversationID uuid.UUID        `json:"conversation_id"`
-	PatientID      uuid.UUID        `json:"patient_id"`
-	DoctorID       uuid.UUID        `json:"doctor_id"`
-	CreatedAt      pgtype.Timestamp `json:"created_at"`
+	ID                 uuid.UUID          `json:"id"`
+	Content            string             `json:"content"`
+	ConversationID     uuid.UUID          `json:"conversation_id"`
+	PatientID          uuid.UUID          `json:"patient_id"`
+	DoctorID           uuid.UUID          `json:"doctor_id"`
+	CreatedAt          pgtype.Timestamp   `json:"created_at"`
+	Severity           string             `json:"severity"`
+	SuspectedCondition string             `json:"suspected_condition"`
+	RecommendedTests   []string           `json:"recommended_tests"`
+	LifestyleAdvice    []string           `json:"lifestyle_advice"`
+	Helpful            *bool              `json:"helpful"`
+	ArchivedAt         pgtype.Timestamptz `json:"archived_at"`
+}
+
+type UsageDaily struct {
+	UserID           uuid.UUID   `json:"user_id"`
+	Day              pgtype.Date `json:"day"`
+	Requests         int64       `json:"requests"`
+	PromptTokens     int64       `json:"prompt_tokens"`
+	CompletionTokens int64       `json:"completion_tokens"`
+	TotalTokens      int64       `json:"total_tokens"`
 }
 
 type User struct {
@@ -41,4 +161,6 @@ type User struct {
 	Location      string           `json:"location"`
 	LicenseNumber string           `json:"license_number"`
 	CreatedAt     pgtype.Timestamp `json:"created_at"`
+	OnCall        bool             `json:"on_call"`
+	Specialty     string           `json:"specialty"`
 }
@@ -11,17 +11,156 @@ import (
 )
 
 type Querier interface {
-	CreateConversation(ctx context.Context, userID uuid.UUID) (uuid.UUID, error)
+	ArchiveSummaries(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error)
+	AssignSummaryDoctor(ctx context.Context, arg AssignSummaryDoctorParams) error
+	// Either the patient or the doctor can cancel a booked appointment.
+	CancelAppointment(ctx context.Context, arg CancelAppointmentParams) (Appointment, error)
+	// Either side can close a referral once the doctor has answered it.
+	CloseReferral(ctx context.Context, arg CloseReferralParams) (Referral, error)
+	CompleteIdempotencyKey(ctx context.Context, arg CompleteIdempotencyKeyParams) error
+	// A nil conversation or summary id is stored as NULL.
+	CreateAppointment(ctx context.Context, arg CreateAppointmentParams) (Appointment, error)
+	CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) error
+	CreateAvailability(ctx context.Context, arg CreateAvailabilityParams) (DoctorAvailability, error)
+	CreateChatMessage(ctx context.Context, arg CreateChatMessageParams) (Message, error)
+	// The id is chosen by the caller, so it can be announced before the conversation is saved.
+	CreateConversation(ctx context.Context, arg CreateConversationParams) error
+	CreateDoctor(ctx context.Context, arg CreateDoctorParams) (User, error)
+	// The patient's message and the reply are saved in the same transaction, where now() is the same
+	// for both: the time of the statement keeps them in order.
 	CreateMessage(ctx context.Context, arg CreateMessageParams) error
-	CreateSummaries(ctx context.Context, arg CreateSummariesParams) error
-	CreateUser(ctx context.Context, arg CreateUserParams) error
+	// A nil conversation id is stored as NULL.
+	CreateNotification(ctx context.Context, arg CreateNotificationParams) error
+	CreateReferral(ctx context.Context, arg CreateReferralParams) (Referral, error)
+	CreateUser(ctx context.Context, arg CreateUserParams) (uuid.UUID, error)
 	DeleteConversation(ctx context.Context, id uuid.UUID) error
+	DeleteConversationForUser(ctx context.Context, arg DeleteConversationForUserParams) (int64, error)
+	DeleteDoctor(ctx context.Context, id uuid.UUID) (int64, error)
+	DeleteDoctorAvailability(ctx context.Context, doctorID uuid.UUID) error
+	// Deletes those of the given conversations that are still expired, with their messages and summaries.
+	DeleteExpiredConversations(ctx context.Context, arg DeleteExpiredConversationsParams) ([]uuid.UUID, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) (int64, error)
+	// Every conversation of a user, for the export of their data.
+	ExportConversations(ctx context.Context, userID uuid.UUID) ([]Conversation, error)
+	// Every message of a user's conversations, grouped by conversation and in order.
+	ExportMessages(ctx context.Context, userID uuid.UUID) ([]Message, error)
+	// Every summary of a patient, for the export of their data.
+	ExportSummaries(ctx context.Context, patientID uuid.UUID) ([]Summary, error)
+	GetAppointmentForUser(ctx context.Context, arg GetAppointmentForUserParams) (Appointment, error)
 	GetConMessages(ctx context.Context, id uuid.UUID) ([]Message, error)
+	GetConMessagesForUser(ctx context.Context, arg GetConMessagesForUserParams) ([]Message, error)
 	GetConversation(ctx context.Context, arg GetConversationParams) (Conversation, error)
+	// A doctor can join a conversation once they accepted a referral of its summary,
+	// or once they were alerted of its red flag while on call.
+	GetConversationForDoctor(ctx context.Context, arg GetConversationForDoctorParams) (Conversation, error)
+	GetDoctor(ctx context.Context, id uuid.UUID) (User, error)
+	GetIdempotencyKey(ctx context.Context, arg GetIdempotencyKeyParams) (IdempotencyKey, error)
+	GetLastAuditEvent(ctx context.Context) (AuditEvent, error)
+	// Only the patient who sent the referral and the doctor it was sent to can see it.
+	GetReferralForUser(ctx context.Context, arg GetReferralForUserParams) (Referral, error)
+	GetRollingSummary(ctx context.Context, conversationID uuid.UUID) (RollingSummary, error)
+	GetSpecialty(ctx context.Context, slug string) (Specialty, error)
 	GetSummary(ctx context.Context, id uuid.UUID) (Summary, error)
+	// Patients see their own summaries, doctors only the ones assigned to them.
+	GetSummaryForUser(ctx context.Context, arg GetSummaryForUserParams) (Summary, error)
+	// The user's usage of the current UTC day, zero when they made no request yet.
+	GetTodayUsage(ctx context.Context, userID uuid.UUID) (GetTodayUsageRow, error)
 	GetUser(ctx context.Context, id uuid.UUID) (User, error)
 	GetUserByEmail(ctx context.Context, email string) (User, error)
-	ListFullConversationsByUserID(ctx context.Context, userID uuid.UUID) ([]ListFullConversationsByUserIDRow, error)
+	// Patients list their appointments, doctors their schedule, from the given time on.
+	ListAppointmentsForUser(ctx context.Context, arg ListAppointmentsForUserParams) ([]Appointment, error)
+	// One batch of the chain in order, for its verification.
+	ListAuditChain(ctx context.Context, arg ListAuditChainParams) ([]AuditEvent, error)
+	// Events between two UTC days included, newest first. Every filter left empty matches everything.
+	ListAuditEvents(ctx context.Context, arg ListAuditEventsParams) ([]AuditEvent, error)
+	// One page of a user's conversations, newest first, starting after the cursor when has_cursor is set.
+	// Untitled conversations show the beginning of the first message, the preview is the beginning of the last one.
+	// The messages are returned whole, the caller shortens them once decrypted.
+	ListConversationHeaders(ctx context.Context, arg ListConversationHeadersParams) ([]ListConversationHeadersRow, error)
+	// One batch of the titled conversations in id order, for re-encryption.
+	ListConversationTitles(ctx context.Context, arg ListConversationTitlesParams) ([]ListConversationTitlesRow, error)
+	// Booked appointments of a doctor overlapping [since, until).
+	ListDoctorAppointments(ctx context.Context, arg ListDoctorAppointmentsParams) ([]Appointment, error)
+	ListDoctorAvailability(ctx context.Context, doctorID uuid.UUID) ([]DoctorAvailability, error)
+	// Appointments of a doctor overlapping [since, until) for their calendar feed: the booked ones, and the
+	// ones cancelled since cancelled_since so the calendars subscribed to the feed remove them.
+	ListDoctorCalendar(ctx context.Context, arg ListDoctorCalendarParams) ([]Appointment, error)
+	// An empty location or specialty matches every doctor; location matches any part of the city/region.
+	ListDoctors(ctx context.Context, arg ListDoctorsParams) ([]User, error)
+	// One batch, in id order, of the conversations that were never shared with a doctor (no referral of
+	// their summary, no appointment), never raised a red flag and have had no message for the given number of days.
+	ListExpiredConversations(ctx context.Context, arg ListExpiredConversationsParams) ([]uuid.UUID, error)
+	// One batch of the messages in id order, for re-encryption.
+	ListMessageContents(ctx context.Context, arg ListMessageContentsParams) ([]ListMessageContentsRow, error)
+	// The page of messages right after the cursor, oldest first.
+	ListMessagesAfter(ctx context.Context, arg ListMessagesAfterParams) ([]Message, error)
+	// The page of messages right before the cursor, newest first; the latest page without cursor.
+	ListMessagesBefore(ctx context.Context, arg ListMessagesBeforeParams) ([]Message, error)
+	// One batch of the notifications in id order, for re-encryption.
+	ListNotificationBodies(ctx context.Context, arg ListNotificationBodiesParams) ([]ListNotificationBodiesRow, error)
+	ListNotifications(ctx context.Context, arg ListNotificationsParams) ([]Notification, error)
+	ListOnCallDoctors(ctx context.Context) ([]User, error)
+	// Patients list the referrals they sent, doctors their inbox. An empty status lists every status.
+	ListReferralsForUser(ctx context.Context, arg ListReferralsForUserParams) ([]ListReferralsForUserRow, error)
+	// One batch of the rolling summaries in conversation id order, for re-encryption.
+	ListRollingSummaryContents(ctx context.Context, arg ListRollingSummaryContentsParams) ([]ListRollingSummaryContentsRow, error)
+	ListSpecialties(ctx context.Context) ([]Specialty, error)
+	// Patients list their own summaries, doctors the ones assigned to them.
+	// An empty severity lists every severity; by_severity sorts the most severe cases first.
+	// Archived summaries are left out.
+	ListSummariesForUser(ctx context.Context, arg ListSummariesForUserParams) ([]Summary, error)
+	// One batch, in id order, of the summaries written more than the given number of years ago and not archived yet.
+	ListSummariesToArchive(ctx context.Context, arg ListSummariesToArchiveParams) ([]uuid.UUID, error)
+	// One batch of the summaries in id order, for re-encryption.
+	ListSummaryContents(ctx context.Context, arg ListSummaryContentsParams) ([]ListSummaryContentsRow, error)
+	// Usage per UTC day between two days included, of every user or only of user_id when it is set.
+	ListUsageByDay(ctx context.Context, arg ListUsageByDayParams) ([]ListUsageByDayRow, error)
+	// Usage per user between two UTC days included, biggest consumers first.
+	ListUsageByUser(ctx context.Context, arg ListUsageByUserParams) ([]ListUsageByUserRow, error)
+	ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error)
+	// Serializes the writers of the audit log until the end of the transaction, so the chain never forks.
+	LockAuditLog(ctx context.Context) error
+	// The marker only points at a message of the conversation, and only moves forward in (timestamp, id) order.
+	MarkConversationRead(ctx context.Context, arg MarkConversationReadParams) (int64, error)
+	MarkConversationRedFlag(ctx context.Context, arg MarkConversationRedFlagParams) error
+	MarkNotificationRead(ctx context.Context, arg MarkNotificationReadParams) (int64, error)
+	// Forgets the actor and the IP of the events of an erased user, only their keyed hashes are left.
+	// It is the only change the audit_events triggers let through.
+	PseudonymizeAuditEvents(ctx context.Context, actorID uuid.UUID) (int64, error)
+	// Adds one AI request to the user's usage of the current UTC day.
+	RecordUsage(ctx context.Context, arg RecordUsageParams) error
+	// Frees the key of a request that failed, a completed request keeps its response.
+	ReleaseIdempotencyKey(ctx context.Context, arg ReleaseIdempotencyKeyParams) error
+	// Replaces the title only if it is still the one the new title was computed from.
+	ReplaceConversationTitle(ctx context.Context, arg ReplaceConversationTitleParams) (int64, error)
+	RescheduleAppointment(ctx context.Context, arg RescheduleAppointmentParams) (Appointment, error)
+	// Claims a key for a new request, 0 rows when it is already taken. A key expires after a day,
+	// and a request that never completed (the server stopped mid-turn) releases it after 5 minutes.
+	ReserveIdempotencyKey(ctx context.Context, arg ReserveIdempotencyKeyParams) (int64, error)
+	// Messages and summaries matching the query in English or French, best matches first, limited to
+	// what the user may see: their own conversations and summaries, and for doctors the summaries
+	// assigned to them and the conversations of the referrals they accepted.
+	// The snippet is the raw content with the matches, in the configuration that matched, between
+	// U+E000 and U+E001: the caller escapes it before turning them into markup.
+	SearchForUser(ctx context.Context, arg SearchForUserParams) ([]SearchForUserRow, error)
+	// Generated titles never replace a title the patient has set in the meantime.
+	SetGeneratedConversationTitle(ctx context.Context, arg SetGeneratedConversationTitleParams) (int64, error)
+	SetUserOnCall(ctx context.Context, arg SetUserOnCallParams) (User, error)
+	UpdateConversationTitle(ctx context.Context, arg UpdateConversationTitleParams) (Conversation, error)
+	UpdateDoctor(ctx context.Context, arg UpdateDoctorParams) (User, error)
+	// Replaces the content only if it is still the one the new content was computed from.
+	UpdateMessageContent(ctx context.Context, arg UpdateMessageContentParams) (int64, error)
+	// Replaces the body only if it is still the one the new body was computed from.
+	UpdateNotificationBody(ctx context.Context, arg UpdateNotificationBodyParams) (int64, error)
+	// Moves a referral sent to the doctor from from_status to to_status; no rows if it is no longer in from_status.
+	UpdateReferralStatus(ctx context.Context, arg UpdateReferralStatusParams) (Referral, error)
+	// Replaces the content only if it is still the one the new content was computed from.
+	UpdateRollingSummaryContent(ctx context.Context, arg UpdateRollingSummaryContentParams) (int64, error)
+	// Replaces the content only if it is still the one the new content was computed from.
+	UpdateSummaryContent(ctx context.Context, arg UpdateSummaryContentParams) (int64, error)
+	UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error)
+	UpsertRollingSummary(ctx context.Context, arg UpsertRollingSummaryParams) error
+	UpsertTriageSummary(ctx context.Context, arg UpsertTriageSummaryParams) (Summary, error)
 }
 
 var _ Querier = (*Queries)(nil)
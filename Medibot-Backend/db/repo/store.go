@@ -0,0 +1,38 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Store is a Querier that can also run several queries in one transaction.
+type Store interface {
+	Querier
+	// ExecTx runs fn in a transaction, committed only if fn returns nil.
+	ExecTx(ctx context.Context, fn func(Querier) error) error
+}
+
+// SQLStore is the Postgres implementation of Store.
+type SQLStore struct {
+	*Queries
+	pool *pgxpool.Pool
+}
+
+// NewStore creates a Store on top of a connection pool.
+func NewStore(pool *pgxpool.Pool) *SQLStore {
+	return &SQLStore{
+		Queries: New(pool),
+		pool:    pool,
+	}
+}
+
+// ExecTx implements Store.
+func (s *SQLStore) ExecTx(ctx context.Context, fn func(Querier) error) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		return fn(s.WithTx(tx))
+	})
+}
+
+var _ Store = (*SQLStore)(nil)
@@ -0,0 +1,54 @@
+// Package repotest gives the tests a migrated Postgres database.
+package repotest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"medibot.go/db/repo"
+)
+
+// DatabaseURLEnv names the variable holding the URL of the test database. The tests needing
+// a database are skipped when it is not set; they share the database and never clean it up,
+// so it must not hold any real data.
+const DatabaseURLEnv = "TEST_DATABASE_URL"
+
+// Pool migrates the test database and returns a pool closed at the end of the test.
+func Pool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv(DatabaseURLEnv)
+	if url == "" {
+		t.Skip(DatabaseURLEnv + " is not set")
+	}
+
+	_, file, _, _ := runtime.Caller(0)
+	if err := repo.Migrate(url, filepath.Join(filepath.Dir(file), "..", "migrations")); err != nil {
+		t.Fatalf("failed to migrate the test database: %v", err)
+	}
+	pool, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		t.Fatalf("failed to open the test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// CreateUser creates a user with a unique email.
+func CreateUser(t *testing.T, q repo.Querier, role string) repo.User {
+	t.Helper()
+	ctx := context.Background()
+	email := uuid.NewString() + "@example.com"
+	if _, err := q.CreateUser(ctx, repo.CreateUserParams{Email: email, Username: "Test " + role, Role: role}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	user, err := q.GetUserByEmail(ctx, email)
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	return user
+}
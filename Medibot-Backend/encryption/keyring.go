@@ -0,0 +1,237 @@
+// Package encryption encrypts the medical content stored in the database (messages, summaries, titles, notifications)
+// with envelope encryption: every value is encrypted with AES-256-GCM under its own random data key,
+// and the data key is stored next to it, wrapped by a master key from the configuration.
+// Rotating the master key only rewraps the data keys, see Rekey.
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// prefix marks an encrypted value, values without it are plaintext stored before encryption was enabled.
+// An encrypted value is prefix + master key ID + ":" + wrapped data key + ":" + encrypted content,
+// both base64 encoded with their nonce in front.
+const prefix = "enc:v1:"
+
+// keySize is the size of the master and data keys, AES-256.
+const keySize = 32
+
+// MasterKey is a key wrapping the data keys, identified by an ID stored with every value it wraps.
+type MasterKey struct {
+	ID  string
+	Key []byte
+}
+
+// ParseKey parses a master key written as "id:base64-key".
+func ParseKey(entry string) (MasterKey, error) {
+	id, encoded, found := strings.Cut(strings.TrimSpace(entry), ":")
+	if !found || id == "" {
+		return MasterKey{}, errors.New("invalid master key, expected id:base64-key")
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return MasterKey{}, fmt.Errorf("invalid master key %q: %w", id, err)
+	}
+	if len(key) != keySize {
+		return MasterKey{}, fmt.Errorf("invalid master key %q: %d bytes, expected %d", id, len(key), keySize)
+	}
+	return MasterKey{ID: id, Key: key}, nil
+}
+
+// LoadKeyfile reads the master keys of a keyfile, one "id:base64-key" per line.
+// Empty lines and lines starting with # are ignored.
+func LoadKeyfile(path string) ([]MasterKey, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var keys []MasterKey
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := ParseKey(line)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, scanner.Err()
+}
+
+// Keyring encrypts with its current master key and decrypts with any of its master keys.
+type Keyring struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring creates a Keyring encrypting with the first key. The other keys are the previous
+// master keys, kept to decrypt the values that were not rekeyed yet.
+func NewKeyring(keys ...MasterKey) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no master key")
+	}
+
+	k := &Keyring{current: keys[0].ID, keys: make(map[string]cipher.AEAD, len(keys))}
+	for _, key := range keys {
+		if key.ID == "" || strings.Contains(key.ID, ":") {
+			return nil, fmt.Errorf("invalid master key ID %q", key.ID)
+		}
+		if _, found := k.keys[key.ID]; found {
+			return nil, fmt.Errorf("duplicate master key ID %q", key.ID)
+		}
+		aead, err := newAEAD(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key %q: %w", key.ID, err)
+		}
+		k.keys[key.ID] = aead
+	}
+	return k, nil
+}
+
+// Current is the ID of the master key new values are encrypted with.
+func (k *Keyring) Current() string {
+	return k.current
+}
+
+// Encrypt encrypts plaintext under a new data key wrapped by the current master key.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	wrapped, err := seal(k.keys[k.current], dataKey, []byte(k.current))
+	if err != nil {
+		return "", err
+	}
+	content, err := seal(data, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	return format(k.current, wrapped, content), nil
+}
+
+// Decrypt decrypts a value written by Encrypt. Plaintext values are returned as they are.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, prefix) {
+		return value, nil
+	}
+
+	keyID, wrapped, content, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := k.unwrap(keyID, wrapped)
+	if err != nil {
+		return "", err
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(data, content, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// Rekey returns value encrypted under the current master key, and whether it changed:
+// plaintext is encrypted, and the data key of a value wrapped by a previous master key
+// is rewrapped, the content itself is not decrypted.
+func (k *Keyring) Rekey(value string) (string, bool, error) {
+	if !strings.HasPrefix(value, prefix) {
+		encrypted, err := k.Encrypt(value)
+		return encrypted, err == nil, err
+	}
+
+	keyID, wrapped, content, err := parse(value)
+	if err != nil {
+		return "", false, err
+	}
+	if keyID == k.current {
+		return value, false, nil
+	}
+	dataKey, err := k.unwrap(keyID, wrapped)
+	if err != nil {
+		return "", false, err
+	}
+	if wrapped, err = seal(k.keys[k.current], dataKey, []byte(k.current)); err != nil {
+		return "", false, err
+	}
+	return format(k.current, wrapped, content), true, nil
+}
+
+// unwrap decrypts a data key wrapped by the master key keyID.
+func (k *Keyring) unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	master, found := k.keys[keyID]
+	if !found {
+		return nil, fmt.Errorf("unknown master key %q", keyID)
+	}
+	dataKey, err := open(master, wrapped, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key with master key %q: %w", keyID, err)
+	}
+	return dataKey, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce, returned in front of the ciphertext.
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts the output of seal.
+func open(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func format(keyID string, wrapped, content []byte) string {
+	return prefix + keyID + ":" + base64.RawStdEncoding.EncodeToString(wrapped) + ":" + base64.RawStdEncoding.EncodeToString(content)
+}
+
+func parse(value string) (keyID string, wrapped, content []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	if wrapped, err = base64.RawStdEncoding.DecodeString(parts[1]); err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	if content, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	return parts[0], wrapped, content, nil
+}
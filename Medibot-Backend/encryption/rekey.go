@@ -0,0 +1,169 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"medibot.go/db/repo"
+)
+
+// rekeyBatchSize is the number of rows read at once by Rekey.
+const rekeyBatchSize = 500
+
+// RekeyStore is the part of the repository Rekey needs, it must not be encrypted itself.
+type RekeyStore interface {
+	ListMessageContents(ctx context.Context, arg repo.ListMessageContentsParams) ([]repo.ListMessageContentsRow, error)
+	UpdateMessageContent(ctx context.Context, arg repo.UpdateMessageContentParams) (int64, error)
+	ListSummaryContents(ctx context.Context, arg repo.ListSummaryContentsParams) ([]repo.ListSummaryContentsRow, error)
+	UpdateSummaryContent(ctx context.Context, arg repo.UpdateSummaryContentParams) (int64, error)
+	ListRollingSummaryContents(ctx context.Context, arg repo.ListRollingSummaryContentsParams) ([]repo.ListRollingSummaryContentsRow, error)
+	UpdateRollingSummaryContent(ctx context.Context, arg repo.UpdateRollingSummaryContentParams) (int64, error)
+	ListNotificationBodies(ctx context.Context, arg repo.ListNotificationBodiesParams) ([]repo.ListNotificationBodiesRow, error)
+	UpdateNotificationBody(ctx context.Context, arg repo.UpdateNotificationBodyParams) (int64, error)
+	ListConversationTitles(ctx context.Context, arg repo.ListConversationTitlesParams) ([]repo.ListConversationTitlesRow, error)
+	ReplaceConversationTitle(ctx context.Context, arg repo.ReplaceConversationTitleParams) (int64, error)
+}
+
+// RekeyStats counts the rows Rekey rewrote per table.
+type RekeyStats struct {
+	Messages         int
+	Summaries        int
+	RollingSummaries int
+	Notifications    int
+	Titles           int
+}
+
+// Rekey rewrites the content of every message, summary and rolling summary, the body of every notification
+// and the title of every conversation that is not encrypted under the current master key of keys: plaintext is encrypted and the data keys of the
+// previous master keys are rewrapped. It is safe to run while the server is up, once the server encrypts with the same current key,
+// and to run again after a failure. Once it succeeds, and a day later for the responses kept for idempotency
+// which are not rekeyed but expire, the previous master keys can be removed from the configuration.
+func Rekey(ctx context.Context, store RekeyStore, keys *Keyring) (RekeyStats, error) {
+	var stats RekeyStats
+	var err error
+
+	stats.Messages, err = rekeyTable(ctx, keys,
+		func(after uuid.UUID) ([]row, error) {
+			rows, err := store.ListMessageContents(ctx, repo.ListMessageContentsParams{AfterID: after, PageLimit: rekeyBatchSize})
+			out := make([]row, len(rows))
+			for i, r := range rows {
+				out[i] = row{r.ID, r.Content}
+			}
+			return out, err
+		},
+		func(id uuid.UUID, oldContent, newContent string) (int64, error) {
+			return store.UpdateMessageContent(ctx, repo.UpdateMessageContentParams{NewContent: newContent, ID: id, OldContent: oldContent})
+		})
+	if err != nil {
+		return stats, fmt.Errorf("failed to rekey messages: %w", err)
+	}
+
+	stats.Summaries, err = rekeyTable(ctx, keys,
+		func(after uuid.UUID) ([]row, error) {
+			rows, err := store.ListSummaryContents(ctx, repo.ListSummaryContentsParams{AfterID: after, PageLimit: rekeyBatchSize})
+			out := make([]row, len(rows))
+			for i, r := range rows {
+				out[i] = row{r.ID, r.Content}
+			}
+			return out, err
+		},
+		func(id uuid.UUID, oldContent, newContent string) (int64, error) {
+			return store.UpdateSummaryContent(ctx, repo.UpdateSummaryContentParams{NewContent: newContent, ID: id, OldContent: oldContent})
+		})
+	if err != nil {
+		return stats, fmt.Errorf("failed to rekey summaries: %w", err)
+	}
+
+	stats.RollingSummaries, err = rekeyTable(ctx, keys,
+		func(after uuid.UUID) ([]row, error) {
+			rows, err := store.ListRollingSummaryContents(ctx, repo.ListRollingSummaryContentsParams{AfterID: after, PageLimit: rekeyBatchSize})
+			out := make([]row, len(rows))
+			for i, r := range rows {
+				out[i] = row{r.ConversationID, r.Content}
+			}
+			return out, err
+		},
+		func(id uuid.UUID, oldContent, newContent string) (int64, error) {
+			return store.UpdateRollingSummaryContent(ctx, repo.UpdateRollingSummaryContentParams{NewContent: newContent, ConversationID: id, OldContent: oldContent})
+		})
+	if err != nil {
+		return stats, fmt.Errorf("failed to rekey rolling summaries: %w", err)
+	}
+
+	stats.Notifications, err = rekeyTable(ctx, keys,
+		func(after uuid.UUID) ([]row, error) {
+			rows, err := store.ListNotificationBodies(ctx, repo.ListNotificationBodiesParams{AfterID: after, PageLimit: rekeyBatchSize})
+			out := make([]row, len(rows))
+			for i, r := range rows {
+				out[i] = row{r.ID, r.Body}
+			}
+			return out, err
+		},
+		func(id uuid.UUID, oldBody, newBody string) (int64, error) {
+			return store.UpdateNotificationBody(ctx, repo.UpdateNotificationBodyParams{NewBody: newBody, ID: id, OldBody: oldBody})
+		})
+	if err != nil {
+		return stats, fmt.Errorf("failed to rekey notifications: %w", err)
+	}
+
+	stats.Titles, err = rekeyTable(ctx, keys,
+		func(after uuid.UUID) ([]row, error) {
+			rows, err := store.ListConversationTitles(ctx, repo.ListConversationTitlesParams{AfterID: after, PageLimit: rekeyBatchSize})
+			out := make([]row, len(rows))
+			for i, r := range rows {
+				out[i] = row{r.ID, r.Title}
+			}
+			return out, err
+		},
+		func(id uuid.UUID, oldTitle, newTitle string) (int64, error) {
+			return store.ReplaceConversationTitle(ctx, repo.ReplaceConversationTitleParams{NewTitle: newTitle, ID: id, OldTitle: oldTitle})
+		})
+	if err != nil {
+		return stats, fmt.Errorf("failed to rekey conversation titles: %w", err)
+	}
+
+	return stats, nil
+}
+
+// row is the content of a row of any of the encrypted tables.
+type row struct {
+	id      uuid.UUID
+	content string
+}
+
+// rekeyTable rekeys the rows of a table one batch at a time, in id order, and returns how many it rewrote.
+// A row changed in the meantime is left as it is: it was written encrypted under the current master key.
+func rekeyTable(ctx context.Context, keys *Keyring, list func(after uuid.UUID) ([]row, error), update func(id uuid.UUID, oldContent, newContent string) (int64, error)) (int, error) {
+	var rewritten int
+	var after uuid.UUID
+	for {
+		if err := ctx.Err(); err != nil {
+			return rewritten, err
+		}
+
+		rows, err := list(after)
+		if err != nil {
+			return rewritten, err
+		}
+		for _, r := range rows {
+			content, changed, err := keys.Rekey(r.content)
+			if err != nil {
+				return rewritten, fmt.Errorf("row %s: %w", r.id.String(), err)
+			}
+			if !changed {
+				continue
+			}
+			updated, err := update(r.id, r.content, content)
+			if err != nil {
+				return rewritten, err
+			}
+			rewritten += int(updated)
+		}
+
+		if len(rows) < rekeyBatchSize {
+			return rewritten, nil
+		}
+		after = rows[len(rows)-1].id
+	}
+}
@@ -0,0 +1,284 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+	"medibot.go/db/repo"
+)
+
+// ErrSearchUnavailable is returned by SearchForUser: the database can't index or search encrypted content.
+var ErrSearchUnavailable = errors.New("search is not available on encrypted content")
+
+// Querier encrypts the content of messages, summaries and rolling summaries, the title of conversations,
+// the body of notifications and the chat responses kept for idempotency, before they are written and decrypts
+// them when they are read.
+// The other queries are passed through.
+type Querier struct {
+	repo.Querier
+	keys *Keyring
+}
+
+// NewQuerier wraps q with the keys of keyring.
+func NewQuerier(q repo.Querier, keys *Keyring) *Querier {
+	return &Querier{Querier: q, keys: keys}
+}
+
+// Store is a Querier whose transactions are encrypted too.
+type Store struct {
+	*Querier
+	store repo.Store
+}
+
+// NewStore wraps store with the keys of keyring.
+func NewStore(store repo.Store, keys *Keyring) *Store {
+	return &Store{Querier: NewQuerier(store, keys), store: store}
+}
+
+// ExecTx implements repo.Store.
+func (s *Store) ExecTx(ctx context.Context, fn func(repo.Querier) error) error {
+	return s.store.ExecTx(ctx, func(q repo.Querier) error {
+		return fn(NewQuerier(q, s.keys))
+	})
+}
+
+var _ repo.Store = (*Store)(nil)
+
+func (q *Querier) CreateMessage(ctx context.Context, arg repo.CreateMessageParams) error {
+	var err error
+	if arg.Content, err = q.keys.Encrypt(arg.Content); err != nil {
+		return err
+	}
+	return q.Querier.CreateMessage(ctx, arg)
+}
+
+func (q *Querier) CreateChatMessage(ctx context.Context, arg repo.CreateChatMessageParams) (repo.Message, error) {
+	content := arg.Content
+	var err error
+	if arg.Content, err = q.keys.Encrypt(arg.Content); err != nil {
+		return repo.Message{}, err
+	}
+	message, err := q.Querier.CreateChatMessage(ctx, arg)
+	message.Content = content
+	return message, err
+}
+
+func (q *Querier) GetConMessages(ctx context.Context, id uuid.UUID) ([]repo.Message, error) {
+	return q.decryptMessages(q.Querier.GetConMessages(ctx, id))
+}
+
+func (q *Querier) GetConMessagesForUser(ctx context.Context, arg repo.GetConMessagesForUserParams) ([]repo.Message, error) {
+	return q.decryptMessages(q.Querier.GetConMessagesForUser(ctx, arg))
+}
+
+func (q *Querier) ListMessagesAfter(ctx context.Context, arg repo.ListMessagesAfterParams) ([]repo.Message, error) {
+	return q.decryptMessages(q.Querier.ListMessagesAfter(ctx, arg))
+}
+
+func (q *Querier) ListMessagesBefore(ctx context.Context, arg repo.ListMessagesBeforeParams) ([]repo.Message, error) {
+	return q.decryptMessages(q.Querier.ListMessagesBefore(ctx, arg))
+}
+
+func (q *Querier) ExportMessages(ctx context.Context, userID uuid.UUID) ([]repo.Message, error) {
+	return q.decryptMessages(q.Querier.ExportMessages(ctx, userID))
+}
+
+func (q *Querier) ListConversationHeaders(ctx context.Context, arg repo.ListConversationHeadersParams) ([]repo.ListConversationHeadersRow, error) {
+	rows, err := q.Querier.ListConversationHeaders(ctx, arg)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		if rows[i].FirstMessage, err = q.keys.Decrypt(rows[i].FirstMessage); err != nil {
+			return nil, err
+		}
+		if rows[i].LastMessage, err = q.keys.Decrypt(rows[i].LastMessage); err != nil {
+			return nil, err
+		}
+		if rows[i].Title, err = q.keys.Decrypt(rows[i].Title); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+func (q *Querier) GetConversation(ctx context.Context, arg repo.GetConversationParams) (repo.Conversation, error) {
+	return q.decryptConversation(q.Querier.GetConversation(ctx, arg))
+}
+
+func (q *Querier) GetConversationForDoctor(ctx context.Context, arg repo.GetConversationForDoctorParams) (repo.Conversation, error) {
+	return q.decryptConversation(q.Querier.GetConversationForDoctor(ctx, arg))
+}
+
+func (q *Querier) ExportConversations(ctx context.Context, userID uuid.UUID) ([]repo.Conversation, error) {
+	conversations, err := q.Querier.ExportConversations(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range conversations {
+		if conversations[i].Title, err = q.keys.Decrypt(conversations[i].Title); err != nil {
+			return nil, err
+		}
+	}
+	return conversations, nil
+}
+
+// SetGeneratedConversationTitle encrypts the title. The query only sets it while the title is empty,
+// which is never the ciphertext of a title.
+func (q *Querier) SetGeneratedConversationTitle(ctx context.Context, arg repo.SetGeneratedConversationTitleParams) (int64, error) {
+	var err error
+	if arg.Title, err = q.keys.Encrypt(arg.Title); err != nil {
+		return 0, err
+	}
+	return q.Querier.SetGeneratedConversationTitle(ctx, arg)
+}
+
+func (q *Querier) UpdateConversationTitle(ctx context.Context, arg repo.UpdateConversationTitleParams) (repo.Conversation, error) {
+	title := arg.Title
+	var err error
+	if arg.Title, err = q.keys.Encrypt(arg.Title); err != nil {
+		return repo.Conversation{}, err
+	}
+	conversation, err := q.Querier.UpdateConversationTitle(ctx, arg)
+	conversation.Title = title
+	return conversation, err
+}
+
+func (q *Querier) GetSummary(ctx context.Context, id uuid.UUID) (repo.Summary, error) {
+	return q.decryptSummary(q.Querier.GetSummary(ctx, id))
+}
+
+func (q *Querier) GetSummaryForUser(ctx context.Context, arg repo.GetSummaryForUserParams) (repo.Summary, error) {
+	return q.decryptSummary(q.Querier.GetSummaryForUser(ctx, arg))
+}
+
+func (q *Querier) ListSummariesForUser(ctx context.Context, arg repo.ListSummariesForUserParams) ([]repo.Summary, error) {
+	return q.decryptSummaries(q.Querier.ListSummariesForUser(ctx, arg))
+}
+
+func (q *Querier) ExportSummaries(ctx context.Context, patientID uuid.UUID) ([]repo.Summary, error) {
+	return q.decryptSummaries(q.Querier.ExportSummaries(ctx, patientID))
+}
+
+func (q *Querier) UpsertTriageSummary(ctx context.Context, arg repo.UpsertTriageSummaryParams) (repo.Summary, error) {
+	content := arg.Content
+	var err error
+	if arg.Content, err = q.keys.Encrypt(arg.Content); err != nil {
+		return repo.Summary{}, err
+	}
+	summary, err := q.Querier.UpsertTriageSummary(ctx, arg)
+	summary.Content = content
+	return summary, err
+}
+
+func (q *Querier) GetRollingSummary(ctx context.Context, conversationID uuid.UUID) (repo.RollingSummary, error) {
+	summary, err := q.Querier.GetRollingSummary(ctx, conversationID)
+	if err != nil {
+		return summary, err
+	}
+	summary.Content, err = q.keys.Decrypt(summary.Content)
+	return summary, err
+}
+
+func (q *Querier) UpsertRollingSummary(ctx context.Context, arg repo.UpsertRollingSummaryParams) error {
+	var err error
+	if arg.Content, err = q.keys.Encrypt(arg.Content); err != nil {
+		return err
+	}
+	return q.Querier.UpsertRollingSummary(ctx, arg)
+}
+
+// CompleteIdempotencyKey stores the response, which holds the reply, as an encrypted JSON string.
+func (q *Querier) CompleteIdempotencyKey(ctx context.Context, arg repo.CompleteIdempotencyKeyParams) error {
+	encrypted, err := q.keys.Encrypt(string(arg.Response))
+	if err != nil {
+		return err
+	}
+	if arg.Response, err = json.Marshal(encrypted); err != nil {
+		return err
+	}
+	return q.Querier.CompleteIdempotencyKey(ctx, arg)
+}
+
+func (q *Querier) GetIdempotencyKey(ctx context.Context, arg repo.GetIdempotencyKeyParams) (repo.IdempotencyKey, error) {
+	key, err := q.Querier.GetIdempotencyKey(ctx, arg)
+	if err != nil || !bytes.HasPrefix(key.Response, []byte(`"`)) {
+		return key, err
+	}
+	var encrypted string
+	if err := json.Unmarshal(key.Response, &encrypted); err != nil {
+		return key, err
+	}
+	response, err := q.keys.Decrypt(encrypted)
+	key.Response = []byte(response)
+	return key, err
+}
+
+func (q *Querier) CreateNotification(ctx context.Context, arg repo.CreateNotificationParams) error {
+	var err error
+	if arg.Body, err = q.keys.Encrypt(arg.Body); err != nil {
+		return err
+	}
+	return q.Querier.CreateNotification(ctx, arg)
+}
+
+func (q *Querier) ListNotifications(ctx context.Context, arg repo.ListNotificationsParams) ([]repo.Notification, error) {
+	notifications, err := q.Querier.ListNotifications(ctx, arg)
+	if err != nil {
+		return nil, err
+	}
+	for i := range notifications {
+		if notifications[i].Body, err = q.keys.Decrypt(notifications[i].Body); err != nil {
+			return nil, err
+		}
+	}
+	return notifications, nil
+}
+
+// SearchForUser always fails with ErrSearchUnavailable: the full-text indexes only see ciphertext.
+func (q *Querier) SearchForUser(ctx context.Context, arg repo.SearchForUserParams) ([]repo.SearchForUserRow, error) {
+	return nil, ErrSearchUnavailable
+}
+
+func (q *Querier) decryptMessages(messages []repo.Message, err error) ([]repo.Message, error) {
+	if err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		if messages[i].Content, err = q.keys.Decrypt(messages[i].Content); err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
+func (q *Querier) decryptConversation(conversation repo.Conversation, err error) (repo.Conversation, error) {
+	if err != nil {
+		return conversation, err
+	}
+	conversation.Title, err = q.keys.Decrypt(conversation.Title)
+	return conversation, err
+}
+
+func (q *Querier) decryptSummary(summary repo.Summary, err error) (repo.Summary, error) {
+	if err != nil {
+		return summary, err
+	}
+	summary.Content, err = q.keys.Decrypt(summary.Content)
+	return summary, err
+}
+
+func (q *Querier) decryptSummaries(summaries []repo.Summary, err error) ([]repo.Summary, error) {
+	if err != nil {
+		return nil, err
+	}
+	for i := range summaries {
+		if summaries[i].Content, err = q.keys.Decrypt(summaries[i].Content); err != nil {
+			return nil, err
+		}
+	}
+	return summaries, nil
+}
@@ -0,0 +1,296 @@
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"medibot.go/db/repo"
+	"medibot.go/db/repotest"
+)
+
+func newTestKeyring(t *testing.T) *Keyring {
+	t.Helper()
+	key := make([]byte, keySize)
+	rand.Read(key)
+	master, err := ParseKey("test:" + base64.StdEncoding.EncodeToString(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewKeyring(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// notificationStore keeps the notifications as they are written.
+type notificationStore struct {
+	repo.Querier
+	notifications []repo.Notification
+}
+
+func (s *notificationStore) CreateNotification(ctx context.Context, arg repo.CreateNotificationParams) error {
+	s.notifications = append(s.notifications, repo.Notification{ID: uuid.New(), UserID: arg.UserID, Kind: arg.Kind, Body: arg.Body})
+	return nil
+}
+
+func (s *notificationStore) ListNotifications(ctx context.Context, arg repo.ListNotificationsParams) ([]repo.Notification, error) {
+	return s.notifications, nil
+}
+
+func TestNotificationBodiesAreEncrypted(t *testing.T) {
+	ctx := context.Background()
+	store := &notificationStore{notifications: []repo.Notification{{Body: "written before encryption"}}}
+	q := NewQuerier(store, newTestKeyring(t))
+
+	const body = "Red flag: Breathing difficulty /chat/messages?conId=1"
+	if err := q.CreateNotification(ctx, repo.CreateNotificationParams{UserID: uuid.New(), Kind: "red_flag", Body: body}); err != nil {
+		t.Fatal(err)
+	}
+	if stored := store.notifications[1].Body; !strings.HasPrefix(stored, prefix) || strings.Contains(stored, "Breathing") {
+		t.Errorf("stored body = %q, want ciphertext", stored)
+	}
+
+	notifications, err := q.ListNotifications(ctx, repo.ListNotificationsParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notifications[0].Body != "written before encryption" || notifications[1].Body != body {
+		t.Errorf("bodies = %q, %q, want them decrypted", notifications[0].Body, notifications[1].Body)
+	}
+}
+
+// conversationStore keeps the conversations as they are written.
+type conversationStore struct {
+	repo.Querier
+	conversations []repo.Conversation
+}
+
+func (s *conversationStore) SetGeneratedConversationTitle(ctx context.Context, arg repo.SetGeneratedConversationTitleParams) (int64, error) {
+	if s.conversations[0].Title != "" {
+		return 0, nil
+	}
+	s.conversations[0].Title = arg.Title
+	return 1, nil
+}
+
+func (s *conversationStore) UpdateConversationTitle(ctx context.Context, arg repo.UpdateConversationTitleParams) (repo.Conversation, error) {
+	s.conversations[0].Title = arg.Title
+	return s.conversations[0], nil
+}
+
+func (s *conversationStore) GetConversation(ctx context.Context, arg repo.GetConversationParams) (repo.Conversation, error) {
+	return s.conversations[0], nil
+}
+
+func (s *conversationStore) ListConversationHeaders(ctx context.Context, arg repo.ListConversationHeadersParams) ([]repo.ListConversationHeadersRow, error) {
+	return []repo.ListConversationHeadersRow{{ID: s.conversations[0].ID, Title: s.conversations[0].Title}}, nil
+}
+
+func (s *conversationStore) ExportConversations(ctx context.Context, userID uuid.UUID) ([]repo.Conversation, error) {
+	return s.conversations, nil
+}
+
+func TestConversationTitlesAreEncrypted(t *testing.T) {
+	ctx := context.Background()
+	store := &conversationStore{conversations: []repo.Conversation{{ID: uuid.New()}}}
+	q := NewQuerier(store, newTestKeyring(t))
+	id := store.conversations[0].ID
+
+	if _, err := q.SetGeneratedConversationTitle(ctx, repo.SetGeneratedConversationTitleParams{ID: id, Title: "Fever for three days"}); err != nil {
+		t.Fatal(err)
+	}
+	if stored := store.conversations[0].Title; !strings.HasPrefix(stored, prefix) || strings.Contains(stored, "Fever") {
+		t.Errorf("stored generated title = %q, want ciphertext", stored)
+	}
+
+	const title = "Chest pain at night"
+	conversation, err := q.UpdateConversationTitle(ctx, repo.UpdateConversationTitleParams{ID: id, Title: title})
+	if err != nil || conversation.Title != title {
+		t.Errorf("renamed conversation = %+v, %v, want the title in plaintext", conversation, err)
+	}
+	if stored := store.conversations[0].Title; !strings.HasPrefix(stored, prefix) || strings.Contains(stored, "Chest") {
+		t.Errorf("stored title = %q, want ciphertext", stored)
+	}
+
+	if conversation, err := q.GetConversation(ctx, repo.GetConversationParams{ID: id}); err != nil || conversation.Title != title {
+		t.Errorf("GetConversation = %+v, %v, want the title decrypted", conversation, err)
+	}
+	if headers, err := q.ListConversationHeaders(ctx, repo.ListConversationHeadersParams{}); err != nil || headers[0].Title != title {
+		t.Errorf("ListConversationHeaders = %+v, %v, want the title decrypted", headers, err)
+	}
+	if conversations, err := q.ExportConversations(ctx, uuid.Nil); err != nil || conversations[0].Title != title {
+		t.Errorf("ExportConversations = %+v, %v, want the title decrypted", conversations, err)
+	}
+}
+
+// titleStore is a RekeyStore holding only conversation titles.
+type titleStore struct {
+	titles map[uuid.UUID]string
+}
+
+func (s *titleStore) ListMessageContents(ctx context.Context, arg repo.ListMessageContentsParams) ([]repo.ListMessageContentsRow, error) {
+	return nil, nil
+}
+
+func (s *titleStore) UpdateMessageContent(ctx context.Context, arg repo.UpdateMessageContentParams) (int64, error) {
+	return 0, nil
+}
+
+func (s *titleStore) ListSummaryContents(ctx context.Context, arg repo.ListSummaryContentsParams) ([]repo.ListSummaryContentsRow, error) {
+	return nil, nil
+}
+
+func (s *titleStore) UpdateSummaryContent(ctx context.Context, arg repo.UpdateSummaryContentParams) (int64, error) {
+	return 0, nil
+}
+
+func (s *titleStore) ListRollingSummaryContents(ctx context.Context, arg repo.ListRollingSummaryContentsParams) ([]repo.ListRollingSummaryContentsRow, error) {
+	return nil, nil
+}
+
+func (s *titleStore) UpdateRollingSummaryContent(ctx context.Context, arg repo.UpdateRollingSummaryContentParams) (int64, error) {
+	return 0, nil
+}
+
+func (s *titleStore) ListNotificationBodies(ctx context.Context, arg repo.ListNotificationBodiesParams) ([]repo.ListNotificationBodiesRow, error) {
+	return nil, nil
+}
+
+func (s *titleStore) UpdateNotificationBody(ctx context.Context, arg repo.UpdateNotificationBodyParams) (int64, error) {
+	return 0, nil
+}
+
+func (s *titleStore) ListConversationTitles(ctx context.Context, arg repo.ListConversationTitlesParams) ([]repo.ListConversationTitlesRow, error) {
+	var rows []repo.ListConversationTitlesRow
+	for id, title := range s.titles {
+		if id.String() > arg.AfterID.String() {
+			rows = append(rows, repo.ListConversationTitlesRow{ID: id, Title: title})
+		}
+	}
+	slices.SortFunc(rows, func(a, b repo.ListConversationTitlesRow) int { return strings.Compare(a.ID.String(), b.ID.String()) })
+	return rows[:min(len(rows), int(arg.PageLimit))], nil
+}
+
+func (s *titleStore) ReplaceConversationTitle(ctx context.Context, arg repo.ReplaceConversationTitleParams) (int64, error) {
+	if s.titles[arg.ID] != arg.OldTitle {
+		return 0, nil
+	}
+	s.titles[arg.ID] = arg.NewTitle
+	return 1, nil
+}
+
+func TestRekeyEncryptsTitles(t *testing.T) {
+	ctx := context.Background()
+	masterKey := func(id string) MasterKey {
+		key := make([]byte, keySize)
+		rand.Read(key)
+		return MasterKey{ID: id, Key: key}
+	}
+	previous, current := masterKey("previous"), masterKey("current")
+	old, err := NewKeyring(previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewKeyring(current, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := old.Encrypt("Headache since Monday")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, rotated := uuid.New(), uuid.New()
+	store := &titleStore{titles: map[uuid.UUID]string{plain: "Fever for three days", rotated: encrypted}}
+
+	stats, err := Rekey(ctx, store, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Titles != 2 {
+		t.Errorf("rekeyed %d titles, want 2", stats.Titles)
+	}
+	for id, want := range map[uuid.UUID]string{plain: "Fever for three days", rotated: "Headache since Monday"} {
+		if !strings.HasPrefix(store.titles[id], prefix+"current:") {
+			t.Errorf("title = %q, want it encrypted under the current key", store.titles[id])
+		}
+		if got, err := keys.Decrypt(store.titles[id]); err != nil || got != want {
+			t.Errorf("title = %q, %v, want %q", got, err, want)
+		}
+	}
+}
+
+func TestSearchIsUnavailable(t *testing.T) {
+	q := NewQuerier(&notificationStore{}, newTestKeyring(t))
+	if _, err := q.SearchForUser(context.Background(), repo.SearchForUserParams{Query: "fever"}); !errors.Is(err, ErrSearchUnavailable) {
+		t.Errorf("err = %v, want ErrSearchUnavailable", err)
+	}
+}
+
+// TestColumnsHoldCiphertext writes through the encrypted store and reads the columns as they are in the database.
+func TestColumnsHoldCiphertext(t *testing.T) {
+	pool := repotest.Pool(t)
+	ctx := context.Background()
+	store := NewStore(repo.NewStore(pool), newTestKeyring(t))
+
+	patient := repotest.CreateUser(t, store, "patient")
+	conID := uuid.New()
+	const content, body, title = "I have had a fever for three days", "Red flag in your patient's conversation", "Three days of fever"
+	err := store.ExecTx(ctx, func(q repo.Querier) error {
+		if err := q.CreateConversation(ctx, repo.CreateConversationParams{ID: conID, UserID: patient.ID, Specialty: "cardiology"}); err != nil {
+			return err
+		}
+		if _, err := q.SetGeneratedConversationTitle(ctx, repo.SetGeneratedConversationTitleParams{ID: conID, Title: title}); err != nil {
+			return err
+		}
+		if err := q.CreateMessage(ctx, repo.CreateMessageParams{ConID: conID, Sender: "user", Content: content}); err != nil {
+			return err
+		}
+		if err := q.UpsertRollingSummary(ctx, repo.UpsertRollingSummaryParams{ConversationID: conID, Content: content}); err != nil {
+			return err
+		}
+		return q.CreateNotification(ctx, repo.CreateNotificationParams{UserID: patient.ID, Kind: "test", ConversationID: conID, Body: body})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns := []struct {
+		name  string
+		query string
+	}{
+		{"messages.content", "SELECT content FROM messages WHERE con_id = $1"},
+		{"rolling_summaries.content", "SELECT content FROM rolling_summaries WHERE conversation_id = $1"},
+		{"notifications.body", "SELECT body FROM notifications WHERE conversation_id = $1"},
+		{"conversation.title", "SELECT title FROM conversation WHERE id = $1"},
+	}
+	for _, column := range columns {
+		var stored string
+		if err := pool.QueryRow(ctx, column.query, conID).Scan(&stored); err != nil {
+			t.Fatalf("%s: %v", column.name, err)
+		}
+		if !strings.HasPrefix(stored, prefix) || strings.Contains(stored, "fever") || strings.Contains(stored, "Red flag") {
+			t.Errorf("%s = %q, want ciphertext", column.name, stored)
+		}
+	}
+
+	messages, err := store.GetConMessages(ctx, conID)
+	if err != nil || len(messages) != 1 || messages[0].Content != content {
+		t.Errorf("messages = %+v, %v, want the message decrypted", messages, err)
+	}
+	conversation, err := store.GetConversation(ctx, repo.GetConversationParams{ID: conID, UserID: patient.ID})
+	if err != nil || conversation.Title != title {
+		t.Errorf("conversation = %+v, %v, want the title decrypted", conversation, err)
+	}
+	notifications, err := store.ListNotifications(ctx, repo.ListNotificationsParams{UserID: patient.ID, Limit: 10})
+	if err != nil || len(notifications) != 1 || notifications[0].Body != body {
+		t.Errorf("notifications = %+v, %v, want the body decrypted", notifications, err)
+	}
+}
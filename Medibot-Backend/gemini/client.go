@@ -1,87 +1,21 @@
 package gemini
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 )
 
 // Constants for AI configuration
+// The system instruction itself lives in the versioned prompt templates (see the prompt package).
 const (
-	SystemInstruction = `You are a kind and experienced cardiologist in Cameroon. Your job is to help patients understand their heart-related symptoms clearly and gently. Speak like a real professional Cameroonian doctor who explains things in simple, easy English.
-Do not say I am called a particular anem for the doctor, you are a cardiologist assistant.
-Here’s how to handle each case:
-
-1. The user will report any symptom related to the heart or circulation. You should help with all cardiovascular-related symptoms — not just the ones listed as examples. 
-
-2. First, ask 6 follow-up questions to understand the symptom better. Ask one question at a time and wait for the user’s response before asking the next.
-
-3. Based on the answers, assess the severity:
-- Low severity: Mild, can be managed and observed.
-- Moderate severity: Needs medical attention soon but not urgent.
-- High severity: Serious and needs urgent care. Do not panic the user — explain it firmly but kindly.
-
-4. Then respond in two steps:
-
-MEDICAL GUIDANCE (STRICT FORMAT)
-
-Provide your recommendation in one or two or at most three short paragraph, no more than 60 words.
-
-Start with the severity like this: “This is a low severity case and can be managed…” or "Your condition may be serious and needs urgent care, but don’t panic...”. 
-Then go on to give a clear diagnosis, a treatment plan, and specific instructions to the condition. 
-Suggest simple lifestyle changes like eating low-salt food, drinking more water, or walking, and tell them why it helps. 
-You can add natural things to take like garlic or hibiscus tea if helpful. 
-Low severity can follow the recommendations and observe, medium severity should consult a specialist toavoid things degrading over time, high severity should immediately book an appointment with a doctor, ans why. 
-End by explaining how all these things relate to what they are feeling using plain English.
-Mention the tests they should do (like blood tests) and why.
-Tie all above to patient’s condition using simple words.
-
-
-Use plain Cameroon English but formal and professional. No medical jargon. Be warm, kind, and clear.
-
-5. After this, ask: “Was this helpful to you?”
-
-→ If the user says “yes”:
-Reply warmly: “I’m glad it helped. Let’s now go over everything in a small summary.”
-
-→ If the user says “no”:
-Respond gently: “I’m sorry it wasn’t helpful enough. Maybe I can explain another way or try again. Let me give you a summary of what I’ve said so far.”
-
-6. SUMMARY
-
-Mention that the patient said it was (or wasn’t) helpful in the summary.
-On a separate request, return only this format:
-"Summary: <summary text>"
-
-Always keep it clear, kind, short, and focused on the patient’s health. Be honest and professional, and treat every case with care.
-
-7. You can also answer questions about heart health, lifestyle changes, or general advice related to cardiovascular health.
-
-SYMPTOM EXAMPLES FOR GUIDANCE ONLY
-
-These are not limits — just examples to help you know how to ask follow-up questions:
-
-- Chest pain → Ask: how long? what kind of pain?
-- Dizziness → Ask: when does it happen? any fainting?
-- Palpitations → Ask: how often? during rest or stress?
-- Leg swelling → Ask: one leg or both? painful?
-- Fatigue → Ask: how long? is it constant?
-- Shortness of breath → Ask: when does it happen? at rest?
-
-If it’s a new symptom you haven’t seen, apply the same logic: ask questions, assess severity, and respond with a structured recommendation.
-
-COMMUNICATION AND ETHICS
-
-- Speak in clear, Cameroon-style English.
-- Keep all advice short and clear.
-- Avoid panic. Even for serious cases, speak calmly: say “don’t panic” or “try to stay calm.”
-- Keep the patient involved. Speak to them with care and respect.
-- Always prioritize the patient’s health and protect their privacy.
-
-Your goal is to guide the patient clearly, safely, and kindly, just like a trusted cardiologist in Cameroon would..`
-
 	Temperature       = 0.7
 	MaxOutputTokens   = 800
 	TopP              = 0.8
@@ -96,16 +30,53 @@ type GeminiClient struct {
 	ApiKey  string
 	DefaultModel string
 	Client *http.Client
+	// Timeout bounds every call, retries included; 0 leaves it to the caller's context.
+	Timeout time.Duration
+	// MaxRetries is the number of times a call failing with a transient error is retried.
+	MaxRetries int
+
+	breaker *circuitBreaker
+	// now, sleep and jitter are the clock and the randomness of the retries, replaced in tests.
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration) error
+	jitter func(ceiling time.Duration) time.Duration
+}
+
+// Options tunes how a GeminiClient copes with a slow or failing API.
+type Options struct {
+	Timeout          time.Duration // per call, retries included
+	MaxRetries       int
+	BreakerThreshold int           // consecutive failed calls opening the circuit, 0 disables the breaker
+	BreakerCooldown  time.Duration // how long the circuit stays open before a trial call
+}
+
+// DefaultOptions are the options used by NewGeminiClient.
+var DefaultOptions = Options{
+	Timeout:          DefaultTimeout,
+	MaxRetries:       DefaultMaxRetries,
+	BreakerThreshold: DefaultBreakerThreshold,
+	BreakerCooldown:  DefaultBreakerCooldown,
 }
 
 // NewGeminiClient creates a new GeminiClient with the provided base URL, API key, and default model.
 // It initializes the HTTP client used for making requests.
 func NewGeminiClient(baseUrl, apiKey, defaultModel string) *GeminiClient {
+	return NewGeminiClientWithOptions(baseUrl, apiKey, defaultModel, DefaultOptions)
+}
+
+// NewGeminiClientWithOptions works like NewGeminiClient with explicit timeout, retry and circuit breaker settings.
+func NewGeminiClientWithOptions(baseUrl, apiKey, defaultModel string, opts Options) *GeminiClient {
 	return &GeminiClient{
 		BaseUrl:      baseUrl,
 		ApiKey:       apiKey,
 		DefaultModel: defaultModel,
 		Client:       &http.Client{},
+		Timeout:      opts.Timeout,
+		MaxRetries:   opts.MaxRetries,
+		breaker:      newCircuitBreaker(opts.BreakerThreshold, opts.BreakerCooldown),
+		now:          time.Now,
+		sleep:        sleepContext,
+		jitter:       fullJitter,
 	}
 }
 
@@ -124,6 +95,21 @@ type GenerationConfig struct {
 	MaxOutputTokens int     `json:"maxOutputTokens"`
 	TopP            float64 `json:"topP"`
 	TopK            int     `json:"topK"`
+	// ResponseMimeType and ResponseSchema constrain the reply to JSON matching the schema.
+	ResponseMimeType string  `json:"responseMimeType,omitempty"`
+	ResponseSchema   *Schema `json:"responseSchema,omitempty"`
+}
+
+// Schema is the OpenAPI subset Gemini accepts as responseSchema.
+// Type is one of STRING, INTEGER, NUMBER, BOOLEAN, ARRAY or OBJECT.
+type Schema struct {
+	Type        string             `json:"type"`
+	Description string             `json:"description,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Nullable    bool               `json:"nullable,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
 }
 
 // SafetySetting defines safety thresholds for AI content generation.
@@ -134,12 +120,14 @@ type SafetySetting struct {
 
 // AIPayload is the top-level structure for the request to the AI model.
 type AIPayload struct {
+	SystemInstruction *Content        `json:"systemInstruction,omitempty"`
 	Contents         []Content        `json:"contents"`
 	GenerationConfig GenerationConfig `json:"generationConfig"`
 	SafetySettings   []SafetySetting  `json:"safetySettings"`
 }
 
 // GeminiAPIResponse represents the expected structure of the Gemini API's JSON response.
+// Use Err to know whether it holds a complete reply.
 type GeminiAPIResponse struct {
 	Candidates []struct {
 		Content struct {
@@ -147,14 +135,43 @@ type GeminiAPIResponse struct {
 				Text string `json:"text"`
 			} `json:"parts"`
 		} `json:"content"`
+		FinishReason  string         `json:"finishReason"`
+		SafetyRatings []SafetyRating `json:"safetyRatings"`
 	} `json:"candidates"`
-	// You might want to add other fields like 'promptFeedback', 'usageMetadata' etc. if needed
+	PromptFeedback PromptFeedback `json:"promptFeedback"`
+	UsageMetadata  UsageMetadata  `json:"usageMetadata"`
 }
 
-//request to prommp the ai
-func (c *GeminiClient) RequestResponse(contents []Content) (string, error) {
-	//constrcut the full ai payload
-	payload := AIPayload{
+// UsageMetadata reports the token counts Gemini billed for a request.
+type UsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+// Text returns the text of the first candidate, or "" when there is none.
+func (r *GeminiAPIResponse) Text() string {
+	if len(r.Candidates) == 0 {
+		return ""
+	}
+
+	var text strings.Builder
+	for _, part := range r.Candidates[0].Content.Parts {
+		text.WriteString(part.Text)
+	}
+	return text.String()
+}
+
+// newPayload wraps the system instruction and conversation contents with the default generation and safety settings.
+// An empty systemInstruction is omitted from the payload.
+func newPayload(systemInstruction string, contents []Content) AIPayload {
+	var system *Content
+	if systemInstruction != "" {
+		system = &Content{Parts: []Part{{Text: systemInstruction}}}
+	}
+
+	return AIPayload{
+		SystemInstruction: system,
 		Contents: contents,
 		GenerationConfig: GenerationConfig{
 			Temperature:     Temperature,
@@ -166,40 +183,182 @@ func (c *GeminiClient) RequestResponse(contents []Content) (string, error) {
 			{Category: HarmCategoryDangerousContent, Threshold: BlockOnlyHigh},
 		},
 	}
+}
+
+//request to prommp the ai
+// A reply that was blocked, cut or empty is returned as the error of GeminiAPIResponse.Err,
+// with the partial text for ErrMaxTokens.
+func (c *GeminiClient) RequestResponse(ctx context.Context, contents []Content) (string, error) {
+	geminiResponse, err := c.GenerateContent(ctx, "", contents)
+	if err != nil {
+		return "", err
+	}
+
+	return geminiResponse.Text(), geminiResponse.Err()
+}
+
+// GenerateContent prompts the AI and returns the decoded Gemini response, including usage metadata.
+// The systemInstruction is sent through Gemini's dedicated systemInstruction field.
+// The response may still be blocked or incomplete, see GeminiAPIResponse.Err.
+func (c *GeminiClient) GenerateContent(ctx context.Context, systemInstruction string, contents []Content) (*GeminiAPIResponse, error) {
+	//constrcut the full ai payload
+	return c.generate(ctx, newPayload(systemInstruction, contents))
+}
+
+// GenerateJSON works like GenerateContent but asks Gemini for a JSON reply conforming to schema.
+func (c *GeminiClient) GenerateJSON(ctx context.Context, systemInstruction string, contents []Content, schema *Schema) (*GeminiAPIResponse, error) {
+	payload := newPayload(systemInstruction, contents)
+	payload.GenerationConfig.ResponseMimeType = "application/json"
+	payload.GenerationConfig.ResponseSchema = schema
+
+	return c.generate(ctx, payload)
+}
 
+// generate sends the payload to the generateContent endpoint and decodes the response,
+// retrying transient failures within the client's timeout.
+func (c *GeminiClient) generate(ctx context.Context, payload AIPayload) (*GeminiAPIResponse, error) {
 	reqBody, err := json.Marshal(payload)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal AI payload: %w", err)
+		return nil, fmt.Errorf("failed to marshal AI payload: %w", err)
+	}
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	var geminiResponse GeminiAPIResponse
+	err = c.withRetries(ctx, func(ctx context.Context) error {
+		resp, err := c.post(ctx, c.BaseUrl+"/"+c.DefaultModel+":generateContent?key="+c.ApiKey, "application/json", reqBody)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		geminiResponse = GeminiAPIResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(&geminiResponse); err != nil {
+			return fmt.Errorf("failed to decode Gemini API response: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	req, err := http.NewRequest("POST",c.BaseUrl+"/"+c.DefaultModel+":generateContent?key="+c.ApiKey,bytes.NewBuffer(reqBody))
-	// You should implement the rest of the function to return a string and error as appropriate
+	return &geminiResponse, nil
+}
+
+// withTimeout applies the client's per-call timeout to ctx.
+func (c *GeminiClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.Timeout)
+}
+
+// post sends one JSON request. A non-OK answer is returned as a *StatusError with the body closed.
+func (c *GeminiClient) post(ctx context.Context, url, accept string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
 	if err != nil {
-		return "", fmt.Errorf("failed to create AI request: %w", err)
+		return nil, fmt.Errorf("failed to create AI request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
 
 	resp, err := c.Client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("AI API request failed: %w", err)
+		return nil, &requestError{err: err}
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("AI API returned non-OK status %d: %s", resp.StatusCode, string(bodyBytes))
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			Body:       string(bodyBytes),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), c.now()),
+		}
 	}
 
-	var geminiResponse GeminiAPIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&geminiResponse); err != nil {
-		return "", fmt.Errorf("failed to decode Gemini API response: %w", err)
+	return resp, nil
+}
+
+// StreamResponse prompts the AI through the streamGenerateContent endpoint and calls onChunk
+// with every piece of text as soon as it arrives. It returns the fully assembled reply once the
+// stream completes, together with the usage reported by the last chunk.
+// Returning an error from onChunk aborts the stream.
+// Only opening the stream is retried: once text has been passed to onChunk, a failure is final.
+// A blocked or cut reply ends with the same errors as GeminiAPIResponse.Err, after its text was streamed.
+func (c *GeminiClient) StreamResponse(ctx context.Context, systemInstruction string, contents []Content, onChunk func(text string) error) (string, UsageMetadata, error) {
+	var usage UsageMetadata
+
+	reqBody, err := json.Marshal(newPayload(systemInstruction, contents))
+	if err != nil {
+		return "", usage, fmt.Errorf("failed to marshal AI payload: %w", err)
+	}
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	var resp *http.Response
+	err = c.withRetries(ctx, func(ctx context.Context) error {
+		resp, err = c.post(ctx, c.BaseUrl+"/"+c.DefaultModel+":streamGenerateContent?alt=sse&key="+c.ApiKey, "text/event-stream", reqBody)
+		return err
+	})
+	if err != nil {
+		return "", usage, err
 	}
+	defer resp.Body.Close()
 
-	if len(geminiResponse.Candidates) > 0 && len(geminiResponse.Candidates[0].Content.Parts) > 0 {
-		return geminiResponse.Candidates[0].Content.Parts[0].Text, nil
+	// With alt=sse every event carries one partial GeminiAPIResponse on a "data:" line.
+	var reply strings.Builder
+	var finishErr error
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		var chunk GeminiAPIResponse
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &chunk); err != nil {
+			return "", usage, fmt.Errorf("failed to decode Gemini stream chunk: %w", err)
+		}
+
+		if chunk.UsageMetadata.TotalTokenCount > 0 {
+			usage = chunk.UsageMetadata
+		}
+
+		// Only the chunk carrying the prompt feedback or the finish reason says how the reply ended.
+		if chunk.PromptFeedback.BlockReason != "" || (len(chunk.Candidates) > 0 && chunk.Candidates[0].FinishReason != "") {
+			if err := chunk.Err(); err != nil && !errors.Is(err, ErrEmptyResponse) {
+				finishErr = err
+			}
+		}
+
+		if len(chunk.Candidates) == 0 {
+			continue
+		}
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			if part.Text == "" {
+				continue
+			}
+			reply.WriteString(part.Text)
+			if err := onChunk(part.Text); err != nil {
+				return "", usage, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", usage, fmt.Errorf("failed to read Gemini stream: %w", err)
 	}
 
-	return "AI did not provide a valid response.", nil // Default response if no candidates/parts
+	if finishErr != nil {
+		return reply.String(), usage, finishErr
+	}
+	if reply.Len() == 0 {
+		return "", usage, ErrEmptyResponse
+	}
 
-}
\ No newline at end of file
+	return reply.String(), usage, nil
+}
@@ -0,0 +1,323 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeGemini serves the generateContent and streamGenerateContent endpoints with canned answers
+// and keeps the payloads it received.
+type fakeGemini struct {
+	t        *testing.T
+	status   int
+	body     string   // generateContent answer
+	events   []string // streamGenerateContent data lines
+	payloads []AIPayload
+	paths    []string
+}
+
+func (f *fakeGemini) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		f.t.Errorf("failed to read request: %v", err)
+	}
+	var payload AIPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		f.t.Errorf("request is not an AIPayload: %v", err)
+	}
+	f.payloads = append(f.payloads, payload)
+	f.paths = append(f.paths, r.URL.Path+"?"+r.URL.RawQuery)
+
+	if f.status != 0 && f.status != http.StatusOK {
+		http.Error(w, f.body, f.status)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, ":streamGenerateContent") {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range f.events {
+			fmt.Fprintf(w, "data: %s\r\n\r\n", event)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, f.body)
+}
+
+// newTestClient returns a client of fake without retries nor circuit breaker.
+func newTestClient(t *testing.T, fake *fakeGemini) *GeminiClient {
+	fake.t = t
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return NewGeminiClientWithOptions(server.URL, "test-key", "gemini-test", Options{})
+}
+
+func TestGenerateContentSendsSystemInstruction(t *testing.T) {
+	fake := &fakeGemini{body: `{"candidates":[{"content":{"parts":[{"text":"Hello"},{"text":" there"}]},"finishReason":"STOP"}],
+		"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":3,"totalTokenCount":15}}`}
+	client := newTestClient(t, fake)
+
+	contents := []Content{{Role: "user", Parts: []Part{{Text: "Hi"}}}}
+	resp, err := client.GenerateContent(context.Background(), "You are a cardiologist.", contents)
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if err := resp.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if got := resp.Text(); got != "Hello there" {
+		t.Errorf("Text = %q, want %q", got, "Hello there")
+	}
+	if resp.UsageMetadata.TotalTokenCount != 15 {
+		t.Errorf("TotalTokenCount = %d, want 15", resp.UsageMetadata.TotalTokenCount)
+	}
+
+	if want := "/gemini-test:generateContent?key=test-key"; fake.paths[0] != want {
+		t.Errorf("request sent to %q, want %q", fake.paths[0], want)
+	}
+	payload := fake.payloads[0]
+	if payload.SystemInstruction == nil || payload.SystemInstruction.Parts[0].Text != "You are a cardiologist." {
+		t.Errorf("systemInstruction = %+v, want the instruction", payload.SystemInstruction)
+	}
+	if len(payload.Contents) != 1 || payload.Contents[0].Parts[0].Text != "Hi" {
+		t.Errorf("contents = %+v, want only the conversation", payload.Contents)
+	}
+	if payload.GenerationConfig.ResponseSchema != nil {
+		t.Errorf("responseSchema = %+v, want none", payload.GenerationConfig.ResponseSchema)
+	}
+}
+
+func TestGenerateContentOmitsEmptySystemInstruction(t *testing.T) {
+	fake := &fakeGemini{body: `{"candidates":[{"content":{"parts":[{"text":"ok"}]},"finishReason":"STOP"}]}`}
+	client := newTestClient(t, fake)
+
+	if _, err := client.RequestResponse(context.Background(), []Content{{Role: "user", Parts: []Part{{Text: "Hi"}}}}); err != nil {
+		t.Fatalf("RequestResponse: %v", err)
+	}
+	if fake.payloads[0].SystemInstruction != nil {
+		t.Errorf("systemInstruction = %+v, want none", fake.payloads[0].SystemInstruction)
+	}
+}
+
+func TestGenerateJSONSendsSchema(t *testing.T) {
+	fake := &fakeGemini{body: `{"candidates":[{"content":{"parts":[{"text":"{\"severity\":\"low\"}"}]},"finishReason":"STOP"}]}`}
+	client := newTestClient(t, fake)
+
+	schema := &Schema{Type: "OBJECT", Properties: map[string]*Schema{"severity": {Type: "STRING", Enum: []string{"low", "high"}}}, Required: []string{"severity"}}
+	resp, err := client.GenerateJSON(context.Background(), "Triage.", nil, schema)
+	if err != nil {
+		t.Fatalf("GenerateJSON: %v", err)
+	}
+	if got := resp.Text(); got != `{"severity":"low"}` {
+		t.Errorf("Text = %q", got)
+	}
+
+	config := fake.payloads[0].GenerationConfig
+	if config.ResponseMimeType != "application/json" {
+		t.Errorf("responseMimeType = %q, want application/json", config.ResponseMimeType)
+	}
+	if config.ResponseSchema == nil || config.ResponseSchema.Properties["severity"].Enum[1] != "high" {
+		t.Errorf("responseSchema = %+v, want the schema", config.ResponseSchema)
+	}
+}
+
+func TestGenerateJSONRejectedSchema(t *testing.T) {
+	fake := &fakeGemini{status: http.StatusBadRequest, body: `{"error":{"code":400,"message":"Invalid JSON payload received. Unknown name \"format\""}}`}
+	client := newTestClient(t, fake)
+	client.MaxRetries = 3
+
+	_, err := client.GenerateJSON(context.Background(), "", nil, &Schema{Type: "STRING"})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("err = %v, want a *StatusError", err)
+	}
+	if statusErr.StatusCode != http.StatusBadRequest || !strings.Contains(statusErr.Body, "Unknown name") {
+		t.Errorf("StatusError = %+v, want the 400 with Gemini's message", statusErr)
+	}
+	if IsTransient(err) {
+		t.Error("a rejected schema is reported as transient")
+	}
+	if len(fake.payloads) != 1 {
+		t.Errorf("sent %d requests, a rejected request must not be retried", len(fake.payloads))
+	}
+}
+
+func TestResponseErr(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		text     string
+		wantErr  error
+		blocked  bool
+		byPrompt bool
+	}{
+		{
+			name: "stop",
+			body: `{"candidates":[{"content":{"parts":[{"text":"Drink water."}]},"finishReason":"STOP"}]}`,
+			text: "Drink water.",
+		},
+		{
+			name:    "max tokens keeps the partial text",
+			body:    `{"candidates":[{"content":{"parts":[{"text":"First, "}]},"finishReason":"MAX_TOKENS"}]}`,
+			text:    "First, ",
+			wantErr: ErrMaxTokens,
+		},
+		{
+			name:    "reply blocked",
+			body:    `{"candidates":[{"finishReason":"SAFETY","safetyRatings":[{"category":"HARM_CATEGORY_DANGEROUS_CONTENT","probability":"HIGH","blocked":true}]}]}`,
+			blocked: true,
+		},
+		{
+			name:     "prompt blocked",
+			body:     `{"promptFeedback":{"blockReason":"SAFETY"}}`,
+			blocked:  true,
+			byPrompt: true,
+		},
+		{
+			name:    "no candidate",
+			body:    `{"candidates":[]}`,
+			wantErr: ErrEmptyResponse,
+		},
+		{
+			name:    "empty text",
+			body:    `{"candidates":[{"content":{"parts":[]},"finishReason":"STOP"}]}`,
+			wantErr: ErrEmptyResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, &fakeGemini{body: tt.body})
+
+			text, err := client.RequestResponse(context.Background(), []Content{{Role: "user", Parts: []Part{{Text: "Hi"}}}})
+			if text != tt.text {
+				t.Errorf("text = %q, want %q", text, tt.text)
+			}
+
+			var blocked *BlockedError
+			switch {
+			case tt.blocked:
+				if !errors.As(err, &blocked) {
+					t.Fatalf("err = %v, want a *BlockedError", err)
+				}
+				if blocked.Prompt != tt.byPrompt || blocked.Reason != "SAFETY" {
+					t.Errorf("BlockedError = %+v", blocked)
+				}
+			case !errors.Is(err, tt.wantErr):
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStreamResponse(t *testing.T) {
+	fake := &fakeGemini{events: []string{
+		`{"candidates":[{"content":{"parts":[{"text":"Rest "}]}}]}`,
+		`{"candidates":[{"content":{"parts":[{"text":"and drink "}]}}]}`,
+		`{"candidates":[{"content":{"parts":[{"text":"water."}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":20,"candidatesTokenCount":5,"totalTokenCount":25}}`,
+	}}
+	client := newTestClient(t, fake)
+
+	var chunks []string
+	reply, usage, err := client.StreamResponse(context.Background(), "Be brief.", []Content{{Role: "user", Parts: []Part{{Text: "Hi"}}}}, func(text string) error {
+		chunks = append(chunks, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamResponse: %v", err)
+	}
+	if reply != "Rest and drink water." {
+		t.Errorf("reply = %q", reply)
+	}
+	if strings.Join(chunks, "|") != "Rest |and drink |water." {
+		t.Errorf("chunks = %q, want every piece in order", chunks)
+	}
+	if usage.TotalTokenCount != 25 {
+		t.Errorf("usage = %+v, want the last chunk's", usage)
+	}
+	if want := "/gemini-test:streamGenerateContent?alt=sse&key=test-key"; fake.paths[0] != want {
+		t.Errorf("request sent to %q, want %q", fake.paths[0], want)
+	}
+	if fake.payloads[0].SystemInstruction == nil || fake.payloads[0].SystemInstruction.Parts[0].Text != "Be brief." {
+		t.Errorf("systemInstruction = %+v, want the instruction", fake.payloads[0].SystemInstruction)
+	}
+}
+
+func TestStreamResponseFinishReason(t *testing.T) {
+	tests := []struct {
+		name    string
+		events  []string
+		reply   string
+		wantErr error
+		blocked bool
+	}{
+		{
+			name: "max tokens",
+			events: []string{
+				`{"candidates":[{"content":{"parts":[{"text":"First, "}]}}]}`,
+				`{"candidates":[{"content":{"parts":[{"text":"second"}]},"finishReason":"MAX_TOKENS"}]}`,
+			},
+			reply:   "First, second",
+			wantErr: ErrMaxTokens,
+		},
+		{
+			name: "blocked midway",
+			events: []string{
+				`{"candidates":[{"content":{"parts":[{"text":"You could "}]}}]}`,
+				`{"candidates":[{"finishReason":"SAFETY"}]}`,
+			},
+			reply:   "You could ",
+			blocked: true,
+		},
+		{
+			name:    "nothing streamed",
+			events:  []string{`{"candidates":[{"content":{"parts":[]},"finishReason":"STOP"}]}`},
+			wantErr: ErrEmptyResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, &fakeGemini{events: tt.events})
+
+			reply, _, err := client.StreamResponse(context.Background(), "", nil, func(string) error { return nil })
+			if reply != tt.reply {
+				t.Errorf("reply = %q, want %q", reply, tt.reply)
+			}
+			var blocked *BlockedError
+			if tt.blocked {
+				if !errors.As(err, &blocked) || blocked.Reason != "SAFETY" {
+					t.Errorf("err = %v, want a SAFETY *BlockedError", err)
+				}
+			} else if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStreamResponseAbortedByCaller(t *testing.T) {
+	client := newTestClient(t, &fakeGemini{events: []string{
+		`{"candidates":[{"content":{"parts":[{"text":"one"}]}}]}`,
+		`{"candidates":[{"content":{"parts":[{"text":"two"}]},"finishReason":"STOP"}]}`,
+	}})
+
+	errGone := errors.New("client gone")
+	calls := 0
+	_, _, err := client.StreamResponse(context.Background(), "", nil, func(string) error {
+		calls++
+		return errGone
+	})
+	if !errors.Is(err, errGone) {
+		t.Errorf("err = %v, want the callback's error", err)
+	}
+	if calls != 1 {
+		t.Errorf("onChunk called %d times after failing, want 1", calls)
+	}
+}
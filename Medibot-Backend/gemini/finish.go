@@ -0,0 +1,74 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Finish reasons of a candidate that matter to the caller.
+const (
+	FinishReasonStop      = "STOP"
+	FinishReasonMaxTokens = "MAX_TOKENS"
+)
+
+// ErrEmptyResponse is returned when Gemini answers without any candidate text and without saying why.
+var ErrEmptyResponse = errors.New("AI API returned no candidate text")
+
+// ErrMaxTokens is returned together with the partial reply when the candidate was cut at MaxOutputTokens.
+// The reply can be completed by asking the model to continue it.
+var ErrMaxTokens = errors.New("AI reply was cut at the maximum output tokens")
+
+// BlockedError is returned when Gemini refused the prompt or withheld its reply,
+// for safety reasons or because the reply recited protected content.
+type BlockedError struct {
+	// Prompt is true when the prompt itself was blocked, false when the reply was.
+	Prompt  bool
+	Reason  string // promptFeedback.blockReason or the candidate's finishReason
+	Ratings []SafetyRating
+}
+
+func (e *BlockedError) Error() string {
+	if e.Prompt {
+		return fmt.Sprintf("AI API blocked the prompt: %s", e.Reason)
+	}
+	return fmt.Sprintf("AI API blocked the reply: %s", e.Reason)
+}
+
+// SafetyRating is Gemini's assessment of one harm category.
+type SafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability"`
+	Blocked     bool   `json:"blocked,omitempty"`
+}
+
+// PromptFeedback is set when Gemini blocked the prompt before generating anything.
+type PromptFeedback struct {
+	BlockReason   string         `json:"blockReason"`
+	SafetyRatings []SafetyRating `json:"safetyRatings"`
+}
+
+// Err reports why the response carries no usable reply: a *BlockedError, ErrMaxTokens when
+// the text is only the beginning of the reply, ErrEmptyResponse, or nil for a complete reply.
+func (r *GeminiAPIResponse) Err() error {
+	if r.PromptFeedback.BlockReason != "" {
+		return &BlockedError{Prompt: true, Reason: r.PromptFeedback.BlockReason, Ratings: r.PromptFeedback.SafetyRatings}
+	}
+	if len(r.Candidates) == 0 {
+		return ErrEmptyResponse
+	}
+
+	candidate := r.Candidates[0]
+	switch candidate.FinishReason {
+	case "", FinishReasonStop:
+	case FinishReasonMaxTokens:
+		return ErrMaxTokens
+	default:
+		// SAFETY, RECITATION, BLOCKLIST, PROHIBITED_CONTENT, SPII...: the reply was withheld.
+		return &BlockedError{Reason: candidate.FinishReason, Ratings: candidate.SafetyRatings}
+	}
+
+	if r.Text() == "" {
+		return ErrEmptyResponse
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults of the resilience settings, see NewGeminiClient.
+const (
+	DefaultTimeout          = 60 * time.Second
+	DefaultMaxRetries       = 3
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+
+	// baseBackoff and maxBackoff bound the exponential backoff between retries.
+	baseBackoff = 500 * time.Millisecond
+	maxBackoff  = 8 * time.Second
+)
+
+// ErrUnavailable is returned without calling the API while the circuit breaker is open,
+// after too many consecutive failures.
+var ErrUnavailable = errors.New("AI API is temporarily unavailable")
+
+// StatusError is returned when the API answers with a non-OK status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+	// RetryAfter is the delay requested by the Retry-After header, 0 if absent.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("AI API returned non-OK status %d: %s", e.StatusCode, e.Body)
+}
+
+// Temporary reports whether the request may succeed if retried later.
+func (e *StatusError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsTransient reports whether err is a failure of the AI API that may go away on its own:
+// an open circuit, a rate limit, a server error, a network error or a timeout.
+// Cancellations by the caller and rejected requests are not transient.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrUnavailable) {
+		return true
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+	// Everything else failed before an answer was received: network errors and deadlines.
+	var requestErr *requestError
+	return errors.As(err, &requestErr)
+}
+
+// requestError wraps the errors of http.Client.Do, which never reached an answer.
+type requestError struct{ err error }
+
+func (e *requestError) Error() string { return fmt.Sprintf("AI API request failed: %v", e.err) }
+func (e *requestError) Unwrap() error { return e.err }
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// backoff returns the delay before the given retry (0 for the first one): the server's
+// Retry-After when it sent one, otherwise an exponential backoff with full jitter.
+func (c *GeminiClient) backoff(retry int, err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return statusErr.RetryAfter
+	}
+
+	ceiling := min(baseBackoff<<retry, maxBackoff)
+	return c.jitter(ceiling)
+}
+
+// fullJitter returns a random delay in (0, ceiling].
+func fullJitter(ceiling time.Duration) time.Duration {
+	return rand.N(ceiling) + 1
+}
+
+// sleepContext waits for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// withRetries calls do until it succeeds, fails with a permanent error or the retries are exhausted.
+// It gives up early when the next attempt could not start before ctx's deadline.
+func (c *GeminiClient) withRetries(ctx context.Context, do func(ctx context.Context) error) error {
+	if !c.breaker.allow() {
+		return ErrUnavailable
+	}
+
+	var err error
+	for retry := 0; ; retry++ {
+		err = do(ctx)
+		if err == nil || !IsTransient(err) || retry >= c.MaxRetries {
+			break
+		}
+
+		wait := c.backoff(retry, err)
+		if deadline, ok := ctx.Deadline(); ok && deadline.Sub(c.now()) < wait {
+			break
+		}
+		if sleepErr := c.sleep(ctx, wait); sleepErr != nil {
+			c.breaker.record(err)
+			return errors.Join(err, sleepErr)
+		}
+	}
+
+	c.breaker.record(err)
+	return err
+}
+
+// circuitBreaker stops calling the API after threshold consecutive transient failures.
+// Once cooldown has elapsed a single trial call is let through: its success closes the
+// circuit again, its failure keeps it open for another cooldown.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow reports whether a call may be made now.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return true
+	}
+	if b.trial || b.now().Before(b.openUntil) {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// record updates the breaker with the outcome of an allowed call.
+// Permanent errors, like a rejected request, say nothing about the API's health.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	switch {
+	case err == nil:
+		b.failures = 0
+	case IsTransient(err):
+		b.failures++
+		if b.failures >= b.threshold {
+			b.openUntil = b.now().Add(b.cooldown)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+const okBody = `{"candidates":[{"content":{"parts":[{"text":"Hello"}]},"finishReason":"STOP"}]}`
+
+// answer is one canned response of a flakyServer.
+type answer struct {
+	status     int
+	retryAfter string
+}
+
+// flakyServer answers the requests with its answers in order, repeating the last one.
+type flakyServer struct {
+	mu       sync.Mutex
+	answers  []answer
+	requests int
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.answers[min(s.requests, len(s.answers)-1)]
+	s.requests++
+
+	if a.retryAfter != "" {
+		w.Header().Set("Retry-After", a.retryAfter)
+	}
+	if a.status != http.StatusOK {
+		http.Error(w, `{"error":{"message":"failed"}}`, a.status)
+		return
+	}
+	io.WriteString(w, okBody)
+}
+
+func (s *flakyServer) requested() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// fakeClock stands still until the client sleeps, which advances it at once.
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+	return nil
+}
+
+// newRetryClient returns a client of server on clock, whose jitter always picks the longest delay.
+func newRetryClient(t *testing.T, server *flakyServer, clock *fakeClock, opts Options) *GeminiClient {
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	client := NewGeminiClientWithOptions(ts.URL, "test-key", "gemini-test", opts)
+	client.now = clock.Now
+	client.sleep = clock.Sleep
+	client.jitter = func(ceiling time.Duration) time.Duration { return ceiling }
+	client.breaker.now = clock.Now
+	return client
+}
+
+func generate(ctx context.Context, client *GeminiClient) error {
+	_, err := client.GenerateContent(ctx, "", []Content{{Role: "user", Parts: []Part{{Text: "Hi"}}}})
+	return err
+}
+
+func statusCode(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
+func TestRetries(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		answers      []answer
+		maxRetries   int
+		wantStatus   int // 0 on success
+		wantRequests int
+		wantSlept    []time.Duration
+	}{
+		{
+			name:         "transient errors",
+			answers:      []answer{{status: 503}, {status: 500}, {status: 200}},
+			maxRetries:   3,
+			wantRequests: 3,
+			wantSlept:    []time.Duration{500 * time.Millisecond, time.Second},
+		},
+		{
+			name:         "exhausted",
+			answers:      []answer{{status: 502}},
+			maxRetries:   2,
+			wantStatus:   502,
+			wantRequests: 3,
+			wantSlept:    []time.Duration{500 * time.Millisecond, time.Second},
+		},
+		{
+			name:         "permanent error",
+			answers:      []answer{{status: 400}, {status: 200}},
+			maxRetries:   3,
+			wantStatus:   400,
+			wantRequests: 1,
+		},
+		{
+			name:         "retry after seconds",
+			answers:      []answer{{status: 429, retryAfter: "7"}, {status: 200}},
+			maxRetries:   3,
+			wantRequests: 2,
+			wantSlept:    []time.Duration{7 * time.Second},
+		},
+		{
+			name:         "retry after date",
+			answers:      []answer{{status: 503, retryAfter: now.Add(30 * time.Second).UTC().Format(http.TimeFormat)}, {status: 200}},
+			maxRetries:   3,
+			wantRequests: 2,
+			// The HTTP date has no sub-second part.
+			wantSlept: []time.Duration{now.Add(30 * time.Second).Truncate(time.Second).Sub(now)},
+		},
+		{
+			name:         "no retries",
+			answers:      []answer{{status: 503}, {status: 200}},
+			wantStatus:   503,
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &flakyServer{answers: tt.answers}
+			clock := &fakeClock{now: now}
+			client := newRetryClient(t, server, clock, Options{MaxRetries: tt.maxRetries})
+
+			err := generate(context.Background(), client)
+			if got := statusCode(err); got != tt.wantStatus || (tt.wantStatus == 0) != (err == nil) {
+				t.Errorf("err = %v, want status %d", err, tt.wantStatus)
+			}
+			if got := server.requested(); got != tt.wantRequests {
+				t.Errorf("sent %d requests, want %d", got, tt.wantRequests)
+			}
+			if !slices.Equal(clock.slept, tt.wantSlept) {
+				t.Errorf("slept %v, want %v", clock.slept, tt.wantSlept)
+			}
+		})
+	}
+}
+
+func TestBackoffGrowsUpToMax(t *testing.T) {
+	var ceilings []time.Duration
+	client := NewGeminiClientWithOptions("", "", "", Options{})
+	client.jitter = func(ceiling time.Duration) time.Duration {
+		ceilings = append(ceilings, ceiling)
+		return ceiling / 2
+	}
+
+	var waits []time.Duration
+	for retry := range 6 {
+		waits = append(waits, client.backoff(retry, &StatusError{StatusCode: 503}))
+	}
+
+	want := []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second}
+	if !slices.Equal(ceilings, want) {
+		t.Errorf("ceilings = %v, want %v", ceilings, want)
+	}
+	if waits[0] != 250*time.Millisecond || waits[5] != 4*time.Second {
+		t.Errorf("waits = %v, want the jittered delays", waits)
+	}
+	if got := client.backoff(0, &StatusError{StatusCode: 429, RetryAfter: time.Minute}); got != time.Minute {
+		t.Errorf("backoff = %v, Retry-After is used as is", got)
+	}
+}
+
+func TestFullJitterStaysWithinCeiling(t *testing.T) {
+	for range 1000 {
+		if d := fullJitter(time.Second); d <= 0 || d > time.Second {
+			t.Fatalf("fullJitter(1s) = %v", d)
+		}
+	}
+}
+
+func TestRetriesGiveUpBeforeDeadline(t *testing.T) {
+	server := &flakyServer{answers: []answer{{status: 429, retryAfter: "10"}, {status: 200}}}
+	clock := &fakeClock{now: time.Now()}
+	client := newRetryClient(t, server, clock, Options{MaxRetries: 3})
+
+	// The server asks to wait longer than the caller is willing to.
+	ctx, cancel := context.WithDeadline(context.Background(), clock.now.Add(5*time.Second))
+	defer cancel()
+
+	err := generate(ctx, client)
+	if statusCode(err) != 429 {
+		t.Errorf("err = %v, want the rate limit", err)
+	}
+	if server.requested() != 1 || len(clock.slept) != 0 {
+		t.Errorf("sent %d requests and slept %v, want to give up at once", server.requested(), clock.slept)
+	}
+}
+
+func TestRetriesStopWhenCanceled(t *testing.T) {
+	server := &flakyServer{answers: []answer{{status: 503}, {status: 200}}}
+	clock := &fakeClock{now: time.Now()}
+	client := newRetryClient(t, server, clock, Options{MaxRetries: 3})
+	ctx, cancel := context.WithCancel(context.Background())
+	client.sleep = func(context.Context, time.Duration) error {
+		cancel()
+		return ctx.Err()
+	}
+
+	err := generate(ctx, client)
+	if !errors.Is(err, context.Canceled) || statusCode(err) != 503 {
+		t.Errorf("err = %v, want the failure and the cancellation", err)
+	}
+	if server.requested() != 1 {
+		t.Errorf("sent %d requests, want 1", server.requested())
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	server := &flakyServer{answers: []answer{{status: 503}}}
+	clock := &fakeClock{now: time.Now()}
+	client := newRetryClient(t, server, clock, Options{BreakerThreshold: 2, BreakerCooldown: 30 * time.Second})
+
+	call := func(want error, wantStatus int) {
+		t.Helper()
+		err := generate(context.Background(), client)
+		if want != nil && !errors.Is(err, want) {
+			t.Fatalf("err = %v, want %v", err, want)
+		}
+		if want == nil && statusCode(err) != wantStatus {
+			t.Fatalf("err = %v, want status %d", err, wantStatus)
+		}
+	}
+
+	// A rejected request says nothing about the API's health.
+	server.answers = []answer{{status: 400}}
+	call(nil, 400)
+	call(nil, 400)
+
+	server.answers = []answer{{status: 503}}
+	call(nil, 503)
+	call(nil, 503)
+	requests := server.requested()
+
+	// Open: the API is not called.
+	call(ErrUnavailable, 0)
+	clock.now = clock.now.Add(29 * time.Second)
+	call(ErrUnavailable, 0)
+	if server.requested() != requests {
+		t.Fatalf("the open circuit called the API")
+	}
+	if !IsTransient(ErrUnavailable) {
+		t.Error("ErrUnavailable is not transient")
+	}
+
+	// After the cooldown a single trial call goes through; it fails and the circuit stays open.
+	clock.now = clock.now.Add(time.Second)
+	if !client.breaker.allow() {
+		t.Fatal("no trial call after the cooldown")
+	}
+	if client.breaker.allow() {
+		t.Fatal("a second call was let through during the trial")
+	}
+	client.breaker.record(&StatusError{StatusCode: 503})
+	call(ErrUnavailable, 0)
+
+	// The next trial succeeds and closes the circuit.
+	clock.now = clock.now.Add(30 * time.Second)
+	server.answers = []answer{{status: 200}}
+	call(nil, 0)
+	call(nil, 0)
+	if got := server.requested(); got != requests+2 {
+		t.Errorf("sent %d requests after closing, want 2", got-requests)
+	}
+}
@@ -0,0 +1,128 @@
+// Package history keeps the conversation sent to the model within a token budget. The latest
+// messages are sent verbatim and the earlier ones are replaced by a rolling summary, regenerated
+// in the background by a Worker, so the cost of a turn stays roughly constant however long the chat.
+package history
+
+import (
+	"unicode/utf8"
+
+	"medibot.go/db/repo"
+	"medibot.go/llm"
+)
+
+const (
+	// charsPerToken is a conservative average for English and French text.
+	charsPerToken = 4
+	// messageOverhead accounts for the role and separators of every message.
+	messageOverhead = 4
+)
+
+// EstimateTokens estimates the number of tokens of text without calling the provider.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
+
+// Budget bounds the prompt of a turn.
+type Budget struct {
+	// MaxTokens is the estimated size allowed for the system instruction, the rolling summary and the messages.
+	MaxTokens int
+	// MinRecent is the number of latest messages always sent verbatim, even over MaxTokens.
+	MinRecent int
+}
+
+// Window is the part of a conversation sent to the model for a turn.
+type Window struct {
+	// Summary covers the messages before Messages, "" if there is none.
+	Summary string
+	// Messages are the latest messages, sent verbatim.
+	Messages []repo.Message
+	// Compact is set when the rolling summary should be regenerated: the window is getting
+	// close to the budget, or older messages had to be left out because the summary is behind.
+	Compact bool
+}
+
+// ForModel returns the messages meant for the model, in order.
+// The doctor's chat messages are meant for the patient, not for the AI.
+func ForModel(messages []repo.Message) []repo.Message {
+	out := make([]repo.Message, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Sender == "doctor" {
+			continue
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+// ToLLM maps stored messages to the model's conversation format.
+func ToLLM(messages []repo.Message) []llm.Message {
+	out := make([]llm.Message, 0, len(messages))
+	for _, msg := range messages {
+		role := llm.RoleUser
+		if msg.Sender == "assistant" {
+			role = llm.RoleAssistant
+		}
+		out = append(out, llm.Message{Role: role, Text: msg.Content})
+	}
+	return out
+}
+
+// Window chooses what to send for a turn: the stored summary, when there is one, and as many of the
+// messages it doesn't cover as fit in the budget, newest first. messages must be in order.
+func (b Budget) Window(system string, messages []repo.Message, summary repo.RollingSummary) Window {
+	start := uncovered(messages, summary)
+	window := Window{}
+	used := EstimateTokens(system)
+	if start > 0 {
+		window.Summary = summary.Content
+		used += EstimateTokens(summary.Content)
+	}
+
+	first := b.fit(messages, start, used, b.MaxTokens)
+	for _, msg := range messages[first:] {
+		used += messageTokens(msg)
+	}
+	window.Messages = messages[first:]
+	window.Compact = first > start || used > b.MaxTokens*3/4
+	return window
+}
+
+// compactable returns the range messages[start:end] the next summary should fold in: the messages
+// not covered yet, except the latest ones fitting in half the budget, which stay verbatim.
+func (b Budget) compactable(messages []repo.Message, summary repo.RollingSummary) (start, end int) {
+	start = uncovered(messages, summary)
+	return start, b.fit(messages, start, 0, b.MaxTokens/2)
+}
+
+// fit returns the index of the oldest message from start such that messages[index:] fit in limit
+// with used tokens already taken, keeping at least MinRecent messages.
+func (b Budget) fit(messages []repo.Message, start, used, limit int) int {
+	first := len(messages)
+	for first > start {
+		cost := messageTokens(messages[first-1])
+		if len(messages)-first >= b.MinRecent && used+cost > limit {
+			break
+		}
+		used += cost
+		first--
+	}
+	return first
+}
+
+// uncovered returns the index of the first message the summary doesn't cover,
+// 0 when there is no summary or its last message is gone.
+func uncovered(messages []repo.Message, summary repo.RollingSummary) int {
+	if summary.Content == "" {
+		return 0
+	}
+	for i, msg := range messages {
+		if msg.ID == summary.LastMessageID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func messageTokens(msg repo.Message) int {
+	return EstimateTokens(msg.Content) + messageOverhead
+}
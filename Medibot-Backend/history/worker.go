@@ -0,0 +1,167 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"medibot.go/db/repo"
+	"medibot.go/llm"
+)
+
+const (
+	// queueSize is the number of conversations waiting for a new summary before new ones are dropped.
+	queueSize = 256
+	// summarizeTimeout bounds a single summarization.
+	summarizeTimeout = 60 * time.Second
+)
+
+const instruction = `You maintain the running summary of a consultation between a patient and a medical assistant.
+You receive the previous summary, if any, and the messages that followed it.
+Write an updated summary that keeps every medically relevant fact: symptoms with their onset, duration and severity,
+answers to the assistant's questions, medication, allergies, history, advice already given and the patient's concerns.
+Write it in the language of the conversation, as short factual notes. Never invent information.`
+
+// Summarize folds messages into the previous summary, it also returns the tokens the request used.
+func Summarize(ctx context.Context, provider llm.Provider, previous string, messages []llm.Message) (string, llm.Usage, error) {
+	var transcript strings.Builder
+	if previous != "" {
+		fmt.Fprintf(&transcript, "Previous summary:\n%s\n\nMessages that followed:\n\n", previous)
+	}
+	for _, msg := range messages {
+		speaker := "Patient"
+		if msg.Role == llm.RoleAssistant {
+			speaker = "Assistant"
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n\n", speaker, msg.Text)
+	}
+
+	reply, err := provider.Generate(ctx, llm.Request{
+		System:   instruction,
+		Messages: []llm.Message{{Role: llm.RoleUser, Text: transcript.String()}},
+	})
+	if err != nil {
+		return "", llm.Usage{}, fmt.Errorf("summarization failed: %w", err)
+	}
+
+	summary := strings.TrimSpace(reply.Text)
+	if summary == "" {
+		return "", reply.Usage, errors.New("summarization returned an empty summary")
+	}
+	return summary, reply.Usage, nil
+}
+
+// Store is the part of the repository the worker needs to read conversations, save their summaries
+// and count the tokens spent on them.
+type Store interface {
+	GetConMessages(ctx context.Context, id uuid.UUID) ([]repo.Message, error)
+	GetRollingSummary(ctx context.Context, conversationID uuid.UUID) (repo.RollingSummary, error)
+	UpsertRollingSummary(ctx context.Context, arg repo.UpsertRollingSummaryParams) error
+	RecordUsage(ctx context.Context, arg repo.RecordUsageParams) error
+}
+
+// job is a conversation to summarize, the tokens are counted in its patient's usage.
+type job struct {
+	conID  uuid.UUID
+	userID uuid.UUID
+}
+
+// Worker regenerates the rolling summaries of the queued conversations one at a time.
+type Worker struct {
+	store    Store
+	provider llm.Provider
+	budget   Budget
+	queue    chan job
+}
+
+// NewWorker creates a Worker keeping conversations within budget. Call Run to start it.
+func NewWorker(store Store, provider llm.Provider, budget Budget) *Worker {
+	return &Worker{
+		store:    store,
+		provider: provider,
+		budget:   budget,
+		queue:    make(chan job, queueSize),
+	}
+}
+
+// Budget is the budget the worker keeps conversations within.
+func (w *Worker) Budget() Budget {
+	return w.budget
+}
+
+// Enqueue schedules a new summary of a conversation of the patient userID. It never blocks: when the queue
+// is full the conversation is skipped, and it is queued again on its next turn since it is still over budget.
+func (w *Worker) Enqueue(conID, userID uuid.UUID) {
+	select {
+	case w.queue <- job{conID: conID, userID: userID}:
+	default:
+		log.Printf("WARNING: Summary queue is full, skipping conversation %s", conID.String())
+	}
+}
+
+// Run summarizes the queued conversations until ctx is done.
+func (w *Worker) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-w.queue:
+			if err := w.compact(ctx, job); err != nil {
+				log.Printf("ERROR: Failed to summarize conversation %s: %v", job.conID.String(), err)
+			}
+		}
+	}
+}
+
+// compact folds the messages that no longer need to be sent verbatim into the conversation's summary.
+// A conversation queued twice is only summarized once, the second time there is nothing left to fold.
+func (w *Worker) compact(ctx context.Context, job job) error {
+	ctx, cancel := context.WithTimeout(ctx, summarizeTimeout)
+	defer cancel()
+
+	conID := job.conID
+	messages, err := w.store.GetConMessages(ctx, conID)
+	if err != nil {
+		return err
+	}
+	messages = ForModel(messages)
+
+	summary, err := w.store.GetRollingSummary(ctx, conID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	start, end := w.budget.compactable(messages, summary)
+	if end <= start {
+		return nil
+	}
+
+	previous := ""
+	if start > 0 {
+		previous = summary.Content
+	}
+	// The summary is generated for the patient: it counts in their daily usage, like their own messages.
+	content, usage, err := Summarize(ctx, w.provider, previous, ToLLM(messages[start:end]))
+	if err := w.store.RecordUsage(ctx, repo.RecordUsageParams{
+		UserID:           job.userID,
+		PromptTokens:     int64(usage.PromptTokens),
+		CompletionTokens: int64(usage.CompletionTokens),
+		TotalTokens:      int64(usage.TotalTokens),
+	}); err != nil {
+		log.Printf("ERROR: Failed to record AI usage of user %s: %v", job.userID.String(), err)
+	}
+	if err != nil {
+		return err
+	}
+
+	return w.store.UpsertRollingSummary(ctx, repo.UpsertRollingSummaryParams{
+		ConversationID: conID,
+		Content:        content,
+		LastMessageID:  messages[end-1].ID,
+	})
+}
@@ -0,0 +1,71 @@
+package history
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"medibot.go/db/repo"
+	"medibot.go/llm"
+)
+
+// fakeStore holds the messages of one conversation and what the worker saved.
+type fakeStore struct {
+	messages  []repo.Message
+	summaries []repo.UpsertRollingSummaryParams
+	usage     []repo.RecordUsageParams
+}
+
+func (s *fakeStore) GetConMessages(ctx context.Context, id uuid.UUID) ([]repo.Message, error) {
+	return s.messages, nil
+}
+
+func (s *fakeStore) GetRollingSummary(ctx context.Context, conversationID uuid.UUID) (repo.RollingSummary, error) {
+	return repo.RollingSummary{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) UpsertRollingSummary(ctx context.Context, arg repo.UpsertRollingSummaryParams) error {
+	s.summaries = append(s.summaries, arg)
+	return nil
+}
+
+func (s *fakeStore) RecordUsage(ctx context.Context, arg repo.RecordUsageParams) error {
+	s.usage = append(s.usage, arg)
+	return nil
+}
+
+func TestWorkerCountsUsageOfPatient(t *testing.T) {
+	conID, patientID := uuid.New(), uuid.New()
+	store := &fakeStore{messages: []repo.Message{
+		{ID: uuid.New(), ConID: conID, Sender: "user", Content: "My chest hurts when I climb stairs"},
+		{ID: uuid.New(), ConID: conID, Sender: "assistant", Content: "How long has it lasted?"},
+		{ID: uuid.New(), ConID: conID, Sender: "user", Content: "Two weeks"},
+	}}
+	// Only the latest message fits: the two before it are summarized.
+	worker := NewWorker(store, llm.NewScripted("Chest pain climbing stairs."), Budget{MaxTokens: 0, MinRecent: 1})
+
+	worker.Enqueue(conID, patientID)
+	if err := worker.compact(context.Background(), <-worker.queue); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+
+	if len(store.summaries) != 1 || store.summaries[0].LastMessageID != store.messages[1].ID {
+		t.Errorf("summaries = %+v, want the first two messages summarized", store.summaries)
+	}
+	if len(store.usage) != 1 || store.usage[0].UserID != patientID || store.usage[0].TotalTokens == 0 {
+		t.Errorf("usage = %+v, want the tokens counted for the patient", store.usage)
+	}
+}
+
+func TestWorkerSkipsConversationsWithinBudget(t *testing.T) {
+	store := &fakeStore{messages: []repo.Message{{ID: uuid.New(), Sender: "user", Content: "Hello"}}}
+	worker := NewWorker(store, llm.NewScripted(), Budget{MaxTokens: 10000, MinRecent: 1})
+
+	if err := worker.compact(context.Background(), job{conID: uuid.New(), userID: uuid.New()}); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if len(store.summaries) != 0 || len(store.usage) != 0 {
+		t.Errorf("summarized a conversation within budget: %+v %+v", store.summaries, store.usage)
+	}
+}
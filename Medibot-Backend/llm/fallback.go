@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Fallback is a Provider trying an ordered chain of providers: when one fails, times out or
+// answers with an empty reply, the request goes to the next one. Reply.Model tells which one answered.
+// A reply blocked by a provider's safety policy is final.
+type Fallback struct {
+	providers []Provider
+}
+
+// NewFallback creates a Provider trying providers in order. It needs at least one provider.
+func NewFallback(providers ...Provider) *Fallback {
+	return &Fallback{providers: providers}
+}
+
+// Generate implements Provider.
+func (f *Fallback) Generate(ctx context.Context, req Request) (Reply, error) {
+	var errs []error
+	for i, provider := range f.providers {
+		reply, err := provider.Generate(ctx, req)
+		if err == nil {
+			return reply, nil
+		}
+		if ctx.Err() != nil || errors.Is(err, ErrBlocked) {
+			// The caller gave up, or the conversation itself was refused: don't shop for another model.
+			return Reply{}, err
+		}
+
+		errs = append(errs, err)
+		f.logFallback(i, err)
+	}
+	return Reply{}, f.exhausted(errs)
+}
+
+// Stream implements Provider. A provider can only be replaced until it has sent its first chunk;
+// a failure after that is returned as is, since the client already shows part of the reply.
+func (f *Fallback) Stream(ctx context.Context, req Request, onChunk func(text string) error) (Reply, error) {
+	var errs []error
+	for i, provider := range f.providers {
+		var started bool
+		reply, err := provider.Stream(ctx, req, func(text string) error {
+			started = true
+			return onChunk(text)
+		})
+		if err == nil {
+			return reply, nil
+		}
+		if started || ctx.Err() != nil || errors.Is(err, ErrBlocked) {
+			return Reply{}, err
+		}
+
+		errs = append(errs, err)
+		f.logFallback(i, err)
+	}
+	return Reply{}, f.exhausted(errs)
+}
+
+func (f *Fallback) logFallback(i int, err error) {
+	if i+1 < len(f.providers) {
+		log.Printf("WARNING: AI provider %d of %d failed, falling back to the next one: %v", i+1, len(f.providers), err)
+	}
+}
+
+// exhausted is the error once every provider failed. It wraps each provider's error, so it is
+// still ErrUnavailable when one of them was only unavailable.
+func (f *Fallback) exhausted(errs []error) error {
+	if len(errs) == 0 {
+		return errors.New("no AI provider configured")
+	}
+	return fmt.Errorf("every AI provider failed: %w", errors.Join(errs...))
+}
@@ -0,0 +1,122 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// stubProvider answers every request with its chunks and then err, or a reply from model when err is nil.
+type stubProvider struct {
+	model  string
+	chunks []string
+	err    error
+	// cancel, when set, is called before answering, as if the caller gave up meanwhile.
+	cancel context.CancelFunc
+	calls  int
+}
+
+func (p *stubProvider) Generate(ctx context.Context, req Request) (Reply, error) {
+	return p.Stream(ctx, req, func(string) error { return nil })
+}
+
+func (p *stubProvider) Stream(ctx context.Context, req Request, onChunk func(text string) error) (Reply, error) {
+	p.calls++
+	if p.cancel != nil {
+		p.cancel()
+	}
+	for _, chunk := range p.chunks {
+		if err := onChunk(chunk); err != nil {
+			return Reply{}, err
+		}
+	}
+	if p.err != nil {
+		return Reply{}, p.err
+	}
+	return Reply{Text: strings.Join(p.chunks, ""), Model: p.model}, nil
+}
+
+func TestFallbackGenerate(t *testing.T) {
+	tests := []struct {
+		name      string
+		first     stubProvider
+		cancel    bool
+		wantErr   error
+		wantModel string
+		wantCalls int // of the second provider
+	}{
+		{"first answers", stubProvider{model: "primary", chunks: []string{"Rest well."}}, false, nil, "primary", 0},
+		{"unavailable", stubProvider{err: ErrUnavailable}, false, nil, "backup", 1},
+		{"empty reply", stubProvider{err: ErrEmptyReply}, false, nil, "backup", 1},
+		{"other failure", stubProvider{err: errors.New("connection reset")}, false, nil, "backup", 1},
+		{"blocked", stubProvider{err: ErrBlocked}, false, ErrBlocked, "", 0},
+		{"caller gave up", stubProvider{err: context.Canceled}, true, context.Canceled, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			first := tt.first
+			if tt.cancel {
+				first.cancel = cancel
+			}
+			backup := &stubProvider{model: "backup", chunks: []string{"Drink water."}}
+
+			reply, err := NewFallback(&first, backup).Generate(ctx, Request{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Generate error = %v, want %v", err, tt.wantErr)
+			}
+			if reply.Model != tt.wantModel {
+				t.Errorf("reply from %q, want %q", reply.Model, tt.wantModel)
+			}
+			if backup.calls != tt.wantCalls {
+				t.Errorf("backup asked %d times, want %d", backup.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestFallbackExhausted(t *testing.T) {
+	_, err := NewFallback(&stubProvider{err: ErrEmptyReply}, &stubProvider{err: ErrUnavailable}).Generate(context.Background(), Request{})
+	if !errors.Is(err, ErrEmptyReply) || !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Generate error = %v, want both providers' errors", err)
+	}
+}
+
+func TestFallbackStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		first      *stubProvider
+		wantErr    error
+		wantChunks string
+		wantModel  string
+	}{
+		{"fails before the first chunk", &stubProvider{err: ErrUnavailable}, nil, "Drink water.", "backup"},
+		{"fails after a chunk", &stubProvider{chunks: []string{"Rest "}, err: ErrUnavailable}, ErrUnavailable, "Rest ", ""},
+		{"blocked", &stubProvider{err: ErrBlocked}, ErrBlocked, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backup := &stubProvider{model: "backup", chunks: []string{"Drink ", "water."}}
+
+			var chunks strings.Builder
+			reply, err := NewFallback(tt.first, backup).Stream(context.Background(), Request{}, func(text string) error {
+				chunks.WriteString(text)
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Stream error = %v, want %v", err, tt.wantErr)
+			}
+			// The client never sees a reply mixing two models.
+			if chunks.String() != tt.wantChunks {
+				t.Errorf("streamed %q, want %q", chunks.String(), tt.wantChunks)
+			}
+			if reply.Model != tt.wantModel {
+				t.Errorf("reply from %q, want %q", reply.Model, tt.wantModel)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"medibot.go/gemini"
+)
+
+// Gemini adapts a gemini.GeminiClient to the Provider interface.
+type Gemini struct {
+	client *gemini.GeminiClient
+}
+
+// NewGemini creates a Provider backed by the Gemini API.
+func NewGemini(client *gemini.GeminiClient) *Gemini {
+	return &Gemini{client: client}
+}
+
+// maxContinuations is how many times a reply cut at the maximum output tokens is continued.
+const maxContinuations = 2
+
+// continuePrompt asks the model to complete a reply it could not finish.
+const continuePrompt = "Continue your previous answer exactly where it stopped, without repeating anything."
+
+// Generate implements Provider. Replies cut at the maximum output tokens are continued
+// automatically, except JSON replies which can't be resumed.
+func (g *Gemini) Generate(ctx context.Context, req Request) (Reply, error) {
+	contents := toGeminiContents(req.Messages)
+	var reply Reply
+	for continuation := 0; ; continuation++ {
+		var resp *gemini.GeminiAPIResponse
+		var err error
+		if req.Schema != nil {
+			resp, err = g.client.GenerateJSON(ctx, req.System, contents, toGeminiSchema(req.Schema))
+		} else {
+			resp, err = g.client.GenerateContent(ctx, req.System, contents)
+		}
+		if err != nil {
+			return Reply{}, fromGeminiError(err)
+		}
+
+		part := resp.Text()
+		reply.Text += part
+		reply.Usage = reply.Usage.Add(fromGeminiUsage(resp.UsageMetadata))
+
+		err = resp.Err()
+		if errors.Is(err, gemini.ErrMaxTokens) && req.Schema == nil {
+			if continuation == maxContinuations {
+				// Better a long answer cut short than no answer at all.
+				break
+			}
+			contents = appendContinuation(contents, part)
+			continue
+		}
+		if err != nil {
+			return Reply{}, fromGeminiError(err)
+		}
+		break
+	}
+
+	reply.Model = g.client.DefaultModel
+	return reply, nil
+}
+
+// Stream implements Provider. Replies cut at the maximum output tokens are continued
+// automatically, the continuation is streamed as more chunks of the same reply.
+func (g *Gemini) Stream(ctx context.Context, req Request, onChunk func(text string) error) (Reply, error) {
+	contents := toGeminiContents(req.Messages)
+	var reply Reply
+	for continuation := 0; ; continuation++ {
+		part, usage, err := g.client.StreamResponse(ctx, req.System, contents, onChunk)
+		reply.Text += part
+		reply.Usage = reply.Usage.Add(fromGeminiUsage(usage))
+
+		if errors.Is(err, gemini.ErrMaxTokens) {
+			if continuation == maxContinuations {
+				break
+			}
+			contents = appendContinuation(contents, part)
+			continue
+		}
+		if err != nil {
+			return Reply{}, fromGeminiError(err)
+		}
+		break
+	}
+
+	reply.Model = g.client.DefaultModel
+	return reply, nil
+}
+
+// appendContinuation adds the cut reply and the request to continue it to the conversation.
+func appendContinuation(contents []gemini.Content, part string) []gemini.Content {
+	return append(contents,
+		gemini.Content{Role: "model", Parts: []gemini.Part{{Text: part}}},
+		gemini.Content{Role: "user", Parts: []gemini.Part{{Text: continuePrompt}}},
+	)
+}
+
+// toGeminiContents maps conversation messages to Gemini contents; Gemini calls the assistant "model".
+func toGeminiContents(messages []Message) []gemini.Content {
+	contents := make([]gemini.Content, 0, len(messages))
+	for _, msg := range messages {
+		role := "user"
+		if msg.Role == RoleAssistant {
+			role = "model"
+		}
+
+		contents = append(contents, gemini.Content{
+			Role:  role,
+			Parts: []gemini.Part{{Text: msg.Text}},
+		})
+	}
+	return contents
+}
+
+// toGeminiSchema converts a JSON Schema subset to Gemini's OpenAPI flavour, which spells types in upper case.
+func toGeminiSchema(s *Schema) *gemini.Schema {
+	if s == nil {
+		return nil
+	}
+
+	out := &gemini.Schema{
+		Type:        strings.ToUpper(s.Type),
+		Description: s.Description,
+		Enum:        s.Enum,
+		Items:       toGeminiSchema(s.Items),
+		Required:    s.Required,
+	}
+	if len(s.Properties) > 0 {
+		out.Properties = make(map[string]*gemini.Schema, len(s.Properties))
+		for name, prop := range s.Properties {
+			out.Properties[name] = toGeminiSchema(prop)
+		}
+	}
+	return out
+}
+
+// fromGeminiError maps the errors of the Gemini client to the provider-neutral ones:
+// ErrUnavailable for the failures it could not recover from, ErrBlocked, ErrMaxTokens and ErrEmptyReply.
+func fromGeminiError(err error) error {
+	var blocked *gemini.BlockedError
+	switch {
+	case gemini.IsTransient(err):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	case errors.As(err, &blocked):
+		return fmt.Errorf("%w: %w", ErrBlocked, err)
+	case errors.Is(err, gemini.ErrMaxTokens):
+		return fmt.Errorf("%w: %w", ErrMaxTokens, err)
+	case errors.Is(err, gemini.ErrEmptyResponse):
+		return fmt.Errorf("%w: %w", ErrEmptyReply, err)
+	default:
+		return err
+	}
+}
+
+func fromGeminiUsage(u gemini.UsageMetadata) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokenCount,
+		CompletionTokens: u.CandidatesTokenCount,
+		TotalTokens:      u.TotalTokenCount,
+	}
+}
@@ -0,0 +1,196 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"medibot.go/gemini"
+)
+
+// fakeGemini answers the generateContent endpoint with one body per request, in order,
+// and the streamGenerateContent endpoint with one list of data lines per request.
+type fakeGemini struct {
+	t        *testing.T
+	bodies   []string
+	streams  [][]string
+	status   int
+	payloads []gemini.AIPayload
+}
+
+func (f *fakeGemini) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var payload gemini.AIPayload
+	raw, _ := io.ReadAll(r.Body)
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		f.t.Errorf("request is not an AIPayload: %v", err)
+	}
+	f.payloads = append(f.payloads, payload)
+	n := len(f.payloads) - 1
+
+	if f.status != 0 {
+		http.Error(w, `{"error":{"message":"failed"}}`, f.status)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, ":streamGenerateContent") {
+		for _, event := range f.streams[n] {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+		return
+	}
+	io.WriteString(w, f.bodies[n])
+}
+
+func newTestGemini(t *testing.T, fake *fakeGemini) *Gemini {
+	fake.t = t
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return NewGemini(gemini.NewGeminiClientWithOptions(server.URL, "test-key", "gemini-test", gemini.Options{}))
+}
+
+func TestGeminiGenerate(t *testing.T) {
+	fake := &fakeGemini{bodies: []string{
+		`{"candidates":[{"content":{"parts":[{"text":"Rest well."}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":3,"totalTokenCount":13}}`,
+	}}
+	provider := newTestGemini(t, fake)
+
+	reply, err := provider.Generate(context.Background(), Request{
+		System:   "You are a cardiologist.",
+		Messages: []Message{{Role: RoleUser, Text: "Hi"}, {Role: RoleAssistant, Text: "Hello"}, {Role: RoleUser, Text: "I'm tired"}},
+	})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if reply.Text != "Rest well." || reply.Model != "gemini-test" || reply.Usage.TotalTokens != 13 {
+		t.Errorf("reply = %+v", reply)
+	}
+
+	payload := fake.payloads[0]
+	if payload.SystemInstruction == nil || payload.SystemInstruction.Parts[0].Text != "You are a cardiologist." {
+		t.Errorf("systemInstruction = %+v, want the system prompt", payload.SystemInstruction)
+	}
+	var roles []string
+	for _, content := range payload.Contents {
+		roles = append(roles, content.Role)
+	}
+	if strings.Join(roles, ",") != "user,model,user" {
+		t.Errorf("roles = %v, the assistant must be sent as model", roles)
+	}
+}
+
+func TestGeminiGenerateContinuesCutReplies(t *testing.T) {
+	fake := &fakeGemini{bodies: []string{
+		`{"candidates":[{"content":{"parts":[{"text":"First, "}]},"finishReason":"MAX_TOKENS"}],"usageMetadata":{"totalTokenCount":10}}`,
+		`{"candidates":[{"content":{"parts":[{"text":"second."}]},"finishReason":"STOP"}],"usageMetadata":{"totalTokenCount":12}}`,
+	}}
+	provider := newTestGemini(t, fake)
+
+	reply, err := provider.Generate(context.Background(), Request{Messages: []Message{{Role: RoleUser, Text: "Explain"}}})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if reply.Text != "First, second." {
+		t.Errorf("text = %q, want both parts", reply.Text)
+	}
+	if reply.Usage.TotalTokens != 22 {
+		t.Errorf("total tokens = %d, want the sum of both requests", reply.Usage.TotalTokens)
+	}
+
+	continued := fake.payloads[1].Contents
+	if len(continued) != 3 || continued[1].Role != "model" || continued[1].Parts[0].Text != "First, " || continued[2].Parts[0].Text != continuePrompt {
+		t.Errorf("continuation contents = %+v", continued)
+	}
+}
+
+func TestGeminiGenerateStopsContinuing(t *testing.T) {
+	cut := `{"candidates":[{"content":{"parts":[{"text":"more "}]},"finishReason":"MAX_TOKENS"}]}`
+	fake := &fakeGemini{bodies: []string{cut, cut, cut, cut}}
+	provider := newTestGemini(t, fake)
+
+	reply, err := provider.Generate(context.Background(), Request{Messages: []Message{{Role: RoleUser, Text: "Explain"}}})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if len(fake.payloads) != maxContinuations+1 {
+		t.Errorf("sent %d requests, want %d", len(fake.payloads), maxContinuations+1)
+	}
+	if reply.Text != "more more more " {
+		t.Errorf("text = %q", reply.Text)
+	}
+}
+
+func TestGeminiGenerateJSON(t *testing.T) {
+	fake := &fakeGemini{bodies: []string{
+		`{"candidates":[{"content":{"parts":[{"text":"{\"severity\":\"lo"}]},"finishReason":"MAX_TOKENS"}]}`,
+	}}
+	provider := newTestGemini(t, fake)
+
+	_, err := provider.Generate(context.Background(), Request{
+		Messages: []Message{{Role: RoleUser, Text: "Triage"}},
+		Schema: &Schema{
+			Type:       "object",
+			Properties: map[string]*Schema{"tests": {Type: "array", Items: &Schema{Type: "string"}}},
+			Required:   []string{"tests"},
+		},
+	})
+	if !errors.Is(err, gemini.ErrMaxTokens) {
+		t.Errorf("err = %v, a cut JSON reply can't be continued", err)
+	}
+	if len(fake.payloads) != 1 {
+		t.Errorf("sent %d requests, want 1", len(fake.payloads))
+	}
+
+	schema := fake.payloads[0].GenerationConfig.ResponseSchema
+	if schema == nil || schema.Type != "OBJECT" || schema.Properties["tests"].Type != "ARRAY" || schema.Properties["tests"].Items.Type != "STRING" {
+		t.Errorf("responseSchema = %+v, want the upper-case types", schema)
+	}
+}
+
+func TestGeminiErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		fake    *fakeGemini
+		wantErr error
+	}{
+		{"blocked", &fakeGemini{bodies: []string{`{"promptFeedback":{"blockReason":"SAFETY"}}`}}, ErrBlocked},
+		{"empty", &fakeGemini{bodies: []string{`{"candidates":[{"content":{"parts":[]},"finishReason":"STOP"}]}`}}, ErrEmptyReply},
+		{"overloaded", &fakeGemini{status: http.StatusServiceUnavailable}, ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTestGemini(t, tt.fake).Generate(context.Background(), Request{Messages: []Message{{Role: RoleUser, Text: "Hi"}}})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGeminiStreamContinuesCutReplies(t *testing.T) {
+	fake := &fakeGemini{streams: [][]string{
+		{`{"candidates":[{"content":{"parts":[{"text":"First, "}]},"finishReason":"MAX_TOKENS"}]}`},
+		{`{"candidates":[{"content":{"parts":[{"text":"second."}]},"finishReason":"STOP"}],"usageMetadata":{"totalTokenCount":7}}`},
+	}}
+	provider := newTestGemini(t, fake)
+
+	var chunks []string
+	reply, err := provider.Stream(context.Background(), Request{System: "Be brief.", Messages: []Message{{Role: RoleUser, Text: "Explain"}}}, func(text string) error {
+		chunks = append(chunks, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if reply.Text != "First, second." || strings.Join(chunks, "") != reply.Text {
+		t.Errorf("reply = %q, chunks = %q", reply.Text, chunks)
+	}
+	if fake.payloads[1].SystemInstruction == nil || fake.payloads[1].SystemInstruction.Parts[0].Text != "Be brief." {
+		t.Errorf("the continuation lost the system instruction: %+v", fake.payloads[1].SystemInstruction)
+	}
+}
@@ -0,0 +1,92 @@
+// Package llm defines a provider-neutral interface for the chat models behind the assistant.
+// Each backend (Gemini, OpenAI-compatible servers, the scripted fake used in tests) is an adapter
+// implementing Provider, so handlers never build vendor specific payloads themselves.
+package llm
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrUnavailable is wrapped by the errors of a provider that is down or overloaded, after its own
+// retries. Callers should tell the patient to try again later rather than show the error.
+var ErrUnavailable = errors.New("AI provider is temporarily unavailable")
+
+// ErrEmptyReply is returned when the model answered without any text.
+var ErrEmptyReply = errors.New("AI provider returned an empty reply")
+
+// ErrMaxTokens is wrapped by the errors of a reply cut at the maximum output tokens that could not be
+// continued, such as a JSON reply.
+var ErrMaxTokens = errors.New("AI reply was cut at the maximum output tokens")
+
+// ErrBlocked is wrapped by the errors of a provider that refused the prompt or withheld its reply
+// under its safety policy. Retrying the same conversation won't help.
+var ErrBlocked = errors.New("AI provider blocked the reply")
+
+// Role identifies who authored a message in the conversation sent to the model.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+// Message is a single turn of the conversation.
+type Message struct {
+	Role Role
+	Text string
+}
+
+// Request is everything a provider needs to produce the next assistant reply.
+type Request struct {
+	// System is the system instruction, sent through the provider's dedicated field.
+	System   string
+	Messages []Message
+	// Schema, when set, constrains the reply to a JSON document matching it.
+	// It is only honoured by Generate.
+	Schema *Schema
+}
+
+// Schema describes the expected JSON reply with the common subset of JSON Schema
+// understood by every provider. Type is one of string, integer, number, boolean, array or object.
+type Schema struct {
+	Type        string             `json:"type"`
+	Description string             `json:"description,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+}
+
+// Usage reports the tokens consumed by a request, as counted by the provider.
+type Usage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	TotalTokens      int `json:"totalTokens"`
+}
+
+// Add returns the sum of two usages, for replies produced by several requests.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+	}
+}
+
+// Reply is the assistant's answer to a Request.
+type Reply struct {
+	Text  string
+	Usage Usage
+	// Model is the model that produced the reply.
+	Model string
+}
+
+// Provider generates assistant replies from a conversation.
+type Provider interface {
+	// Generate returns the complete reply once the model has finished.
+	Generate(ctx context.Context, req Request) (Reply, error)
+	// Stream calls onChunk with every piece of text as soon as it is produced and returns the
+	// assembled reply at the end. Returning an error from onChunk aborts the stream.
+	Stream(ctx context.Context, req Request, onChunk func(text string) error) (Reply, error)
+}
@@ -0,0 +1,355 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"medibot.go/gemini"
+)
+
+// OpenAI is a Provider for any server implementing the OpenAI chat completions API,
+// such as llama.cpp's server, Ollama or vLLM.
+type OpenAI struct {
+	BaseUrl string // e.g. http://localhost:11434/v1
+	ApiKey  string // optional for local servers
+	Model   string
+	Client  *http.Client
+	// Timeout bounds every call, continuations and streaming included; 0 leaves it to the caller's context.
+	Timeout time.Duration
+}
+
+// NewOpenAI creates an OpenAI-compatible Provider whose calls last at most timeout.
+func NewOpenAI(baseUrl, apiKey, model string, timeout time.Duration) *OpenAI {
+	return &OpenAI{
+		BaseUrl: strings.TrimSuffix(baseUrl, "/"),
+		ApiKey:  apiKey,
+		Model:   model,
+		Client:  &http.Client{},
+		Timeout: timeout,
+	}
+}
+
+// OpenAIStatusError is a non-OK answer of the server.
+type OpenAIStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *OpenAIStatusError) Error() string {
+	return fmt.Sprintf("AI API returned non-OK status %d: %s", e.StatusCode, e.Body)
+}
+
+// Temporary reports whether the server is overloaded or failing, rather than refusing the request.
+func (e *OpenAIStatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Finish reasons of a choice.
+const (
+	openAIFinishLength        = "length"
+	openAIFinishContentFilter = "content_filter"
+)
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIJSONSchema struct {
+	Name   string  `json:"name"`
+	Strict bool    `json:"strict"`
+	Schema *Schema `json:"schema"`
+}
+
+type openAIResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *openAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+type openAIRequest struct {
+	Model          string                `json:"model"`
+	Messages       []openAIMessage       `json:"messages"`
+	Temperature    float64               `json:"temperature"`
+	TopP           float64               `json:"top_p"`
+	MaxTokens      int                   `json:"max_tokens"`
+	Stream         bool                  `json:"stream,omitempty"`
+	StreamOptions  *openAIStreamOptions  `json:"stream_options,omitempty"`
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		Delta        openAIMessage `json:"delta"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+// Generate implements Provider. Replies cut at the maximum output tokens are continued
+// automatically, except JSON replies which can't be resumed.
+func (o *OpenAI) Generate(ctx context.Context, req Request) (Reply, error) {
+	callCtx, cancel := o.withTimeout(ctx)
+	defer cancel()
+
+	messages := req.Messages
+	var reply Reply
+	for continuation := 0; ; continuation++ {
+		part, finishReason, usage, err := o.generate(callCtx, req, messages)
+		if err != nil {
+			return Reply{}, o.callError(ctx, err)
+		}
+		reply.Text += part
+		reply.Usage = reply.Usage.Add(usage)
+
+		if finishReason == openAIFinishContentFilter {
+			return Reply{}, fmt.Errorf("%w: finish reason %s", ErrBlocked, finishReason)
+		}
+		if finishReason == openAIFinishLength {
+			if req.Schema != nil {
+				return Reply{}, fmt.Errorf("%w: finish reason %s", ErrMaxTokens, finishReason)
+			}
+			if continuation < maxContinuations {
+				messages = appendOpenAIContinuation(messages, part)
+				continue
+			}
+			// Better a long answer cut short than no answer at all.
+		}
+		break
+	}
+
+	if reply.Text == "" {
+		return Reply{}, ErrEmptyReply
+	}
+	reply.Model = o.Model
+	return reply, nil
+}
+
+// generate requests one chat completion of messages.
+func (o *OpenAI) generate(ctx context.Context, req Request, messages []Message) (text, finishReason string, usage Usage, err error) {
+	resp, err := o.do(ctx, o.newRequest(req, messages, false))
+	if err != nil {
+		return "", "", Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	var completion openAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return "", "", Usage{}, fmt.Errorf("failed to decode chat completion: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", "", completion.Usage.toUsage(), nil
+	}
+	choice := completion.Choices[0]
+	return choice.Message.Content, choice.FinishReason, completion.Usage.toUsage(), nil
+}
+
+// Stream implements Provider. Replies cut at the maximum output tokens are continued
+// automatically, the continuation is streamed as more chunks of the same reply.
+func (o *OpenAI) Stream(ctx context.Context, req Request, onChunk func(text string) error) (Reply, error) {
+	callCtx, cancel := o.withTimeout(ctx)
+	defer cancel()
+
+	messages := req.Messages
+	var reply Reply
+	for continuation := 0; ; continuation++ {
+		part, finishReason, usage, err := o.stream(callCtx, req, messages, onChunk)
+		reply.Text += part
+		reply.Usage = reply.Usage.Add(usage)
+		if err != nil {
+			return Reply{}, o.callError(ctx, err)
+		}
+
+		if finishReason == openAIFinishContentFilter {
+			return Reply{}, fmt.Errorf("%w: finish reason %s", ErrBlocked, finishReason)
+		}
+		if finishReason == openAIFinishLength && continuation < maxContinuations {
+			messages = appendOpenAIContinuation(messages, part)
+			continue
+		}
+		break
+	}
+
+	if reply.Text == "" {
+		return Reply{}, ErrEmptyReply
+	}
+	reply.Model = o.Model
+	return reply, nil
+}
+
+// stream streams one chat completion of messages.
+func (o *OpenAI) stream(ctx context.Context, req Request, messages []Message, onChunk func(text string) error) (text, finishReason string, usage Usage, err error) {
+	resp, err := o.do(ctx, o.newRequest(req, messages, true))
+	if err != nil {
+		return "", "", Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	var out strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk openAIResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return out.String(), "", usage, fmt.Errorf("failed to decode chat completion chunk: %w", err)
+		}
+
+		if chunk.Usage != nil {
+			usage = chunk.Usage.toUsage()
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			out.WriteString(choice.Delta.Content)
+			if err := onChunk(choice.Delta.Content); err != nil {
+				return out.String(), "", usage, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return out.String(), "", usage, &requestError{err}
+	}
+	return out.String(), finishReason, usage, nil
+}
+
+// appendOpenAIContinuation adds the cut reply and the request to continue it to the conversation.
+func appendOpenAIContinuation(messages []Message, part string) []Message {
+	return append(slices.Clip(messages),
+		Message{Role: RoleAssistant, Text: part},
+		Message{Role: RoleUser, Text: continuePrompt},
+	)
+}
+
+// withTimeout applies the provider's per-call timeout to ctx.
+func (o *OpenAI) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, o.Timeout)
+}
+
+// callError maps the failures of the server, and of the network while the caller was still waiting
+// (the provider's own timeout included), to ErrUnavailable.
+func (o *OpenAI) callError(ctx context.Context, err error) error {
+	var statusErr *OpenAIStatusError
+	var reqErr *requestError
+	switch {
+	case errors.As(err, &statusErr) && statusErr.Temporary():
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	case errors.As(err, &reqErr) && ctx.Err() == nil:
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	default:
+		return err
+	}
+}
+
+// requestError wraps the failures of the connection: no answer, or an answer cut off.
+type requestError struct{ err error }
+
+func (e *requestError) Error() string { return fmt.Sprintf("AI API request failed: %v", e.err) }
+func (e *requestError) Unwrap() error { return e.err }
+
+// newRequest builds the chat completion payload of messages with the same sampling settings used for Gemini.
+func (o *OpenAI) newRequest(req Request, conversation []Message, stream bool) openAIRequest {
+	messages := make([]openAIMessage, 0, len(conversation)+1)
+	if req.System != "" {
+		messages = append(messages, openAIMessage{Role: "system", Content: req.System})
+	}
+	for _, msg := range conversation {
+		messages = append(messages, openAIMessage{Role: string(msg.Role), Content: msg.Text})
+	}
+
+	payload := openAIRequest{
+		Model:       o.Model,
+		Messages:    messages,
+		Temperature: gemini.Temperature,
+		TopP:        gemini.TopP,
+		MaxTokens:   gemini.MaxOutputTokens,
+	}
+	if stream {
+		payload.Stream = true
+		payload.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	} else if req.Schema != nil {
+		payload.ResponseFormat = &openAIResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: &openAIJSONSchema{Name: "response", Schema: req.Schema},
+		}
+	}
+	return payload
+}
+
+// do posts the payload to /chat/completions and returns the response when the status is OK.
+func (o *OpenAI) do(ctx context.Context, payload openAIRequest) (*http.Response, error) {
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal chat completion payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.BaseUrl+"/chat/completions", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AI request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if o.ApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.ApiKey)
+	}
+
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return nil, &requestError{err}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, &OpenAIStatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	return resp, nil
+}
+
+func (u *openAIUsage) toUsage() Usage {
+	if u == nil {
+		return Usage{}
+	}
+	return Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+}
@@ -0,0 +1,192 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeOpenAI answers the chat completions endpoint with one body, or one list of data lines
+// when streaming, per request, in order.
+type fakeOpenAI struct {
+	t        *testing.T
+	bodies   []string
+	streams  [][]string
+	status   int
+	delay    time.Duration
+	payloads []openAIRequest
+}
+
+func (f *fakeOpenAI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var payload openAIRequest
+	raw, _ := io.ReadAll(r.Body)
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		f.t.Errorf("request is not a chat completion: %v", err)
+	}
+	f.payloads = append(f.payloads, payload)
+	n := len(f.payloads) - 1
+
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if f.status != 0 {
+		http.Error(w, `{"error":{"message":"failed"}}`, f.status)
+		return
+	}
+	if payload.Stream {
+		for _, event := range f.streams[n] {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+		return
+	}
+	io.WriteString(w, f.bodies[n])
+}
+
+func newTestOpenAI(t *testing.T, fake *fakeOpenAI, timeout time.Duration) *OpenAI {
+	fake.t = t
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return NewOpenAI(server.URL+"/", "test-key", "llama-test", timeout)
+}
+
+func completion(text, finishReason string) string {
+	return fmt.Sprintf(`{"choices":[{"message":{"role":"assistant","content":%q},"finish_reason":%q}],"usage":{"prompt_tokens":5,"completion_tokens":3,"total_tokens":8}}`, text, finishReason)
+}
+
+func TestOpenAIGenerate(t *testing.T) {
+	fake := &fakeOpenAI{bodies: []string{completion("Rest well.", "stop")}}
+	provider := newTestOpenAI(t, fake, time.Second)
+
+	reply, err := provider.Generate(context.Background(), Request{
+		System:   "You are a cardiologist.",
+		Messages: []Message{{Role: RoleUser, Text: "Hi"}, {Role: RoleAssistant, Text: "Hello"}, {Role: RoleUser, Text: "I'm tired"}},
+	})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if reply.Text != "Rest well." || reply.Model != "llama-test" || reply.Usage.TotalTokens != 8 {
+		t.Errorf("reply = %+v", reply)
+	}
+
+	var roles []string
+	for _, message := range fake.payloads[0].Messages {
+		roles = append(roles, message.Role)
+	}
+	if strings.Join(roles, ",") != "system,user,assistant,user" || fake.payloads[0].Model != "llama-test" {
+		t.Errorf("payload = %+v", fake.payloads[0])
+	}
+}
+
+func TestOpenAIGenerateContinuesCutReplies(t *testing.T) {
+	fake := &fakeOpenAI{bodies: []string{completion("First, ", "length"), completion("second.", "stop")}}
+	provider := newTestOpenAI(t, fake, time.Second)
+
+	reply, err := provider.Generate(context.Background(), Request{Messages: []Message{{Role: RoleUser, Text: "Explain"}}})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if reply.Text != "First, second." || reply.Usage.TotalTokens != 16 {
+		t.Errorf("reply = %+v, want both parts and the usage of both requests", reply)
+	}
+	continued := fake.payloads[1].Messages
+	if len(continued) != 3 || continued[1].Role != "assistant" || continued[1].Content != "First, " || continued[2].Content != continuePrompt {
+		t.Errorf("continuation messages = %+v", continued)
+	}
+}
+
+func TestOpenAIGenerateStopsContinuing(t *testing.T) {
+	cut := completion("more ", "length")
+	fake := &fakeOpenAI{bodies: []string{cut, cut, cut, cut}}
+	reply, err := newTestOpenAI(t, fake, time.Second).Generate(context.Background(), Request{Messages: []Message{{Role: RoleUser, Text: "Explain"}}})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if len(fake.payloads) != maxContinuations+1 || reply.Text != "more more more " {
+		t.Errorf("sent %d requests for %q, want %d", len(fake.payloads), reply.Text, maxContinuations+1)
+	}
+}
+
+func TestOpenAIErrors(t *testing.T) {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{"severity": {Type: "string"}}}
+
+	tests := []struct {
+		name    string
+		fake    *fakeOpenAI
+		schema  *Schema
+		wantErr error
+	}{
+		{"rate limited", &fakeOpenAI{status: http.StatusTooManyRequests}, nil, ErrUnavailable},
+		{"overloaded", &fakeOpenAI{status: http.StatusServiceUnavailable}, nil, ErrUnavailable},
+		{"timeout", &fakeOpenAI{delay: time.Second, bodies: []string{completion("Late", "stop")}}, nil, ErrUnavailable},
+		{"filtered", &fakeOpenAI{bodies: []string{completion("", "content_filter")}}, nil, ErrBlocked},
+		{"cut JSON", &fakeOpenAI{bodies: []string{completion(`{"severity":"lo`, "length")}}, schema, ErrMaxTokens},
+		{"empty", &fakeOpenAI{bodies: []string{completion("", "stop")}}, nil, ErrEmptyReply},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestOpenAI(t, tt.fake, 50*time.Millisecond)
+			_, err := provider.Generate(context.Background(), Request{Messages: []Message{{Role: RoleUser, Text: "Hi"}}, Schema: tt.schema})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := newTestOpenAI(t, &fakeOpenAI{status: http.StatusBadRequest}, time.Second).Generate(context.Background(), Request{Messages: []Message{{Role: RoleUser, Text: "Hi"}}})
+		var statusErr *OpenAIStatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest || errors.Is(err, ErrUnavailable) {
+			t.Errorf("err = %v, want a permanent 400", err)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := newTestOpenAI(t, &fakeOpenAI{delay: time.Second}, time.Minute).Generate(ctx, Request{Messages: []Message{{Role: RoleUser, Text: "Hi"}}})
+		if err == nil || errors.Is(err, ErrUnavailable) {
+			t.Errorf("err = %v, the caller gave up, the provider is not unavailable", err)
+		}
+	})
+}
+
+func TestOpenAIStream(t *testing.T) {
+	fake := &fakeOpenAI{streams: [][]string{
+		{`{"choices":[{"delta":{"content":"First, "}}]}`, `{"choices":[{"delta":{},"finish_reason":"length"}]}`},
+		{`{"choices":[{"delta":{"content":"second."}}]}`, `{"choices":[{"delta":{},"finish_reason":"stop"}]}`, `{"choices":[],"usage":{"total_tokens":7}}`},
+	}}
+	provider := newTestOpenAI(t, fake, time.Second)
+
+	var chunks []string
+	reply, err := provider.Stream(context.Background(), Request{System: "Be brief.", Messages: []Message{{Role: RoleUser, Text: "Explain"}}}, func(text string) error {
+		chunks = append(chunks, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if reply.Text != "First, second." || strings.Join(chunks, "") != reply.Text || reply.Usage.TotalTokens != 7 {
+		t.Errorf("reply = %+v, chunks = %q", reply, chunks)
+	}
+	if !fake.payloads[0].Stream || fake.payloads[0].StreamOptions == nil || len(fake.payloads[1].Messages) != 4 {
+		t.Errorf("payloads = %+v", fake.payloads)
+	}
+
+	_, err = newTestOpenAI(t, &fakeOpenAI{status: http.StatusBadGateway}, time.Second).Stream(context.Background(), Request{}, func(string) error { return nil })
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("err = %v, want ErrUnavailable", err)
+	}
+}
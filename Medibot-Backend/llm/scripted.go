@@ -0,0 +1,85 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ScriptedModel is the model name reported in the replies of Scripted.
+const ScriptedModel = "scripted"
+
+// ErrScriptExhausted is returned by Scripted once every scripted reply has been used.
+var ErrScriptExhausted = errors.New("scripted provider has no replies left")
+
+// Scripted is a deterministic Provider for tests and local development.
+// It answers with the scripted replies in order and records every request it receives.
+type Scripted struct {
+	mu       sync.Mutex
+	replies  []string
+	requests []Request
+}
+
+// NewScripted creates a Scripted provider that answers with the given replies in order.
+func NewScripted(replies ...string) *Scripted {
+	return &Scripted{replies: replies}
+}
+
+// Generate implements Provider.
+func (s *Scripted) Generate(ctx context.Context, req Request) (Reply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, req)
+	if len(s.replies) == 0 {
+		return Reply{}, ErrScriptExhausted
+	}
+
+	text := s.replies[0]
+	s.replies = s.replies[1:]
+
+	return Reply{Text: text, Usage: scriptedUsage(req, text), Model: ScriptedModel}, nil
+}
+
+// Stream implements Provider. The scripted reply is streamed word by word.
+func (s *Scripted) Stream(ctx context.Context, req Request, onChunk func(text string) error) (Reply, error) {
+	reply, err := s.Generate(ctx, req)
+	if err != nil {
+		return Reply{}, err
+	}
+
+	for _, word := range strings.SplitAfter(reply.Text, " ") {
+		if err := ctx.Err(); err != nil {
+			return Reply{}, err
+		}
+		if err := onChunk(word); err != nil {
+			return Reply{}, err
+		}
+	}
+
+	return reply, nil
+}
+
+// Requests returns a copy of every request received so far.
+func (s *Scripted) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// scriptedUsage counts whitespace separated words as tokens, which is enough for deterministic tests.
+func scriptedUsage(req Request, reply string) Usage {
+	var prompt int
+	for _, msg := range req.Messages {
+		prompt += len(strings.Fields(msg.Text))
+	}
+	completion := len(strings.Fields(reply))
+
+	return Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      prompt + completion,
+	}
+}
@@ -0,0 +1,196 @@
+// Package prompt loads the assistant's system instructions from versioned template files,
+// so clinicians can revise them without recompiling the server.
+//
+// Templates live in one directory and are named "<name>.v<version>.tmpl", for example
+// "cardiology.v3.tmpl". The highest version of a name is the one used for new replies.
+package prompt
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+var fileNamePattern = regexp.MustCompile(`^([a-z0-9_-]+)\.v([0-9]+)\.tmpl$`)
+
+// MaxNameLength is the number of characters of a patient's name kept in a prompt.
+const MaxNameLength = 40
+
+// Vars are the variables available inside a prompt template.
+type Vars struct {
+	// PatientName is chosen by the patient: Render passes it through QuoteName.
+	PatientName string
+	Locale      string
+	Specialty   string
+	// FollowUpQuestions and SeverityRules come from the conversation's specialty.
+	FollowUpQuestions int
+	SeverityRules     string
+}
+
+// Rendered is a prompt ready to be sent to the model.
+type Rendered struct {
+	Text string
+	// Version identifies the template that produced Text, e.g. "cardiology.v3".
+	Version string
+}
+
+type versionedTemplate struct {
+	version  int
+	template *template.Template
+}
+
+// Store holds the latest version of every prompt template found in a directory.
+// When a new file is added to the directory the store reloads on the next Render.
+type Store struct {
+	dir string
+
+	mu       sync.RWMutex
+	latest   map[string]versionedTemplate
+	loadedAt time.Time
+}
+
+// NewStore loads every template in dir. Invalid templates are reported immediately.
+func NewStore(dir string) (*Store, error) {
+	s := &Store{dir: dir}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Render executes the latest version of the named template with vars.
+func (s *Store) Render(name string, vars Vars) (Rendered, error) {
+	if err := s.reloadIfChanged(); err != nil {
+		return Rendered{}, err
+	}
+
+	s.mu.RLock()
+	tmpl, ok := s.latest[name]
+	s.mu.RUnlock()
+	if !ok {
+		return Rendered{}, fmt.Errorf("prompt %q not found in %s", name, s.dir)
+	}
+
+	vars.PatientName = QuoteName(vars.PatientName)
+
+	var text strings.Builder
+	if err := tmpl.template.Execute(&text, vars); err != nil {
+		return Rendered{}, fmt.Errorf("failed to render prompt %q: %w", name, err)
+	}
+
+	return Rendered{
+		Text:    strings.TrimSpace(text.String()),
+		Version: name + ".v" + strconv.Itoa(tmpl.version),
+	}, nil
+}
+
+// QuoteName makes a user-chosen name safe to put in a system instruction: only letters, digits,
+// spaces and the punctuation of names are kept, on one line and at most MaxNameLength characters,
+// between double quotes so the model reads it as a name and not as instructions.
+// It returns "" when nothing is left of the name.
+func QuoteName(name string) string {
+	var kept []rune
+	space := false
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r), unicode.IsMark(r), unicode.IsDigit(r), strings.ContainsRune("-'.", r):
+			if space && len(kept) > 0 {
+				kept = append(kept, ' ')
+			}
+			kept = append(kept, r)
+			space = false
+		default:
+			// Whitespace, line breaks and any other symbol separate words.
+			space = true
+		}
+	}
+	if len(kept) > MaxNameLength {
+		kept = []rune(strings.TrimSpace(string(kept[:MaxNameLength])))
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	return `"` + string(kept) + `"`
+}
+
+// reloadIfChanged reloads the templates when the directory was modified since the last load,
+// which is the case whenever a new version file is added. A broken new file is logged and the
+// previously loaded templates keep being served.
+func (s *Store) reloadIfChanged() error {
+	info, err := os.Stat(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to stat prompts directory: %w", err)
+	}
+
+	s.mu.RLock()
+	stale := info.ModTime().After(s.loadedAt)
+	s.mu.RUnlock()
+	if !stale {
+		return nil
+	}
+
+	if err := s.load(); err != nil {
+		log.Printf("ERROR: Failed to reload prompts, keeping the previous versions: %v", err)
+
+		s.mu.Lock()
+		s.loadedAt = info.ModTime()
+		s.mu.Unlock()
+	}
+
+	return nil
+}
+
+func (s *Store) load() error {
+	info, err := os.Stat(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to stat prompts directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read prompts directory: %w", err)
+	}
+
+	latest := make(map[string]versionedTemplate)
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		name := match[1]
+		version, err := strconv.Atoi(match[2])
+		if err != nil {
+			return fmt.Errorf("invalid prompt version in %s: %w", entry.Name(), err)
+		}
+		if current, ok := latest[name]; ok && current.version >= version {
+			continue
+		}
+
+		tmpl, err := template.New(entry.Name()).Option("missingkey=error").ParseFiles(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to parse prompt %s: %w", entry.Name(), err)
+		}
+
+		latest[name] = versionedTemplate{version: version, template: tmpl}
+	}
+
+	if len(latest) == 0 {
+		return fmt.Errorf("no prompt templates found in %s", s.dir)
+	}
+
+	s.mu.Lock()
+	s.latest = latest
+	s.loadedAt = info.ModTime()
+	s.mu.Unlock()
+
+	return nil
+}
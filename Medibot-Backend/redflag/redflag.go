@@ -0,0 +1,242 @@
+// Package redflag detects emergency warning signs in patient messages with simple phrase rules,
+// so life-threatening situations are answered immediately instead of going through the AI's
+// follow-up questions.
+//
+// Rules are loaded from a JSON file (see rules.json for the format and the built-in defaults).
+// Each rule lists trigger phrases and emergency instructions per language code.
+package redflag
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// FallbackLanguage is used for instructions when a rule has none in the matched language.
+const FallbackLanguage = "en"
+
+//go:embed rules.json
+var defaultRules []byte
+
+// Rule is one emergency condition.
+type Rule struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Phrases maps a language code to the phrases that trigger the rule in that language.
+	Phrases map[string][]string `json:"phrases"`
+	// Instructions maps a language code to the emergency instructions sent to the patient.
+	Instructions map[string]string `json:"instructions"`
+}
+
+// Match describes the rule that fired on a message.
+type Match struct {
+	Rule     Rule
+	Language string // language of the phrase that matched
+	Phrase   string
+}
+
+// alertNotices tell the patient, per language, whether a doctor was alerted: the rules' instructions
+// don't, as there may be no doctor on call.
+var alertNotices = map[string]struct{ alerted, unattended string }{
+	"en": {
+		alerted:    "A doctor on call has been alerted.",
+		unattended: "No doctor is on call right now, so don't wait to be contacted: go to the emergency department.",
+	},
+	"fr": {
+		alerted:    "Un médecin de garde a été alerté.",
+		unattended: "Aucun médecin n'est de garde en ce moment, n'attendez donc pas d'être contacté : rendez-vous aux urgences.",
+	},
+	"pcm": {
+		alerted:    "We don alert doctor wey dey on call.",
+		unattended: "No doctor dey on call now now, so no wait make person call you: go hospital emergency.",
+	},
+}
+
+// Instructions returns the emergency instructions in the preferred language (e.g. the patient's
+// locale language), else in the language of the matched phrase, else in FallbackLanguage,
+// followed by whether a doctor was alerted.
+func (m Match) Instructions(preferred string, doctorAlerted bool) string {
+	language := FallbackLanguage
+	for _, candidate := range []string{preferred, m.Language} {
+		if _, ok := m.Rule.Instructions[candidate]; ok {
+			language = candidate
+			break
+		}
+	}
+
+	notice, ok := alertNotices[language]
+	if !ok {
+		notice = alertNotices[FallbackLanguage]
+	}
+	if doctorAlerted {
+		return m.Rule.Instructions[language] + " " + notice.alerted
+	}
+	return m.Rule.Instructions[language] + " " + notice.unattended
+}
+
+type compiledPhrase struct {
+	language string
+	original string
+	words    []string // normalized
+}
+
+type compiledRule struct {
+	rule    Rule
+	phrases []compiledPhrase
+}
+
+// Engine checks messages against a set of rules, in order.
+type Engine struct {
+	rules []compiledRule
+}
+
+// NewEngine loads the rules from path, or the built-in rules when path is empty.
+func NewEngine(path string) (*Engine, error) {
+	raw := defaultRules
+	if path != "" {
+		var err error
+		raw, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read red flag rules: %w", err)
+		}
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return nil, fmt.Errorf("failed to decode red flag rules: %w", err)
+	}
+
+	return newEngine(rules)
+}
+
+func newEngine(rules []Rule) (*Engine, error) {
+	e := &Engine{}
+	for _, rule := range rules {
+		if rule.ID == "" {
+			return nil, fmt.Errorf("red flag rule %q has no id", rule.Name)
+		}
+		if rule.Instructions[FallbackLanguage] == "" {
+			return nil, fmt.Errorf("red flag rule %q has no %q instructions", rule.ID, FallbackLanguage)
+		}
+
+		compiled := compiledRule{rule: rule}
+		// Languages are compiled in a fixed order so a phrase shared by two languages always matches the same one.
+		for _, language := range slices.Sorted(maps.Keys(rule.Phrases)) {
+			for _, phrase := range rule.Phrases[language] {
+				words := strings.Fields(normalize(phrase))
+				if len(words) == 0 {
+					continue
+				}
+				compiled.phrases = append(compiled.phrases, compiledPhrase{
+					language: language,
+					original: phrase,
+					words:    words,
+				})
+			}
+		}
+		if len(compiled.phrases) == 0 {
+			return nil, fmt.Errorf("red flag rule %q has no phrases", rule.ID)
+		}
+
+		e.rules = append(e.rules, compiled)
+	}
+	return e, nil
+}
+
+// negationWindow is the number of words before a phrase searched for a negation.
+const negationWindow = 3
+
+// negations are the words that deny the phrase following them, e.g. "I have no crushing chest pain".
+// "never" and "jamais" are left out: "I've never had chest pain like this" reports an emergency.
+var negations = map[string]bool{
+	// en
+	"no": true, "not": true, "without": true, "denies": true,
+	"don't": true, "doesn't": true, "didn't": true, "haven't": true, "hasn't": true, "isn't": true,
+	// fr
+	"pas": true, "sans": true, "aucun": true, "aucune": true, "ni": true,
+}
+
+// scopeBreaks end the scope of a negation: in "no fever but crushing chest pain" the pain is not denied.
+var scopeBreaks = map[string]bool{
+	"but": true, "and": true, "however": true, "though": true, "although": true, "now": true,
+	"mais": true, "et": true, "cependant": true, "pourtant": true, "maintenant": true,
+}
+
+// Check returns the first rule matching the message. A phrase doesn't match where the patient
+// denies it ("I have no crushing chest pain"); when in doubt a phrase matches, as a missed
+// emergency costs more than a needless alert.
+func (e *Engine) Check(message string) (Match, bool) {
+	var clauses [][]string
+	for _, clause := range strings.FieldsFunc(message, isClauseBreak) {
+		if words := strings.Fields(normalize(clause)); len(words) > 0 {
+			clauses = append(clauses, words)
+		}
+	}
+
+	for _, rule := range e.rules {
+		for _, phrase := range rule.phrases {
+			for _, words := range clauses {
+				if affirmed(words, phrase.words) {
+					return Match{Rule: rule.rule, Language: phrase.language, Phrase: phrase.original}, true
+				}
+			}
+		}
+	}
+	return Match{}, false
+}
+
+// isClauseBreak reports whether r ends a clause, which ends the scope of a negation.
+func isClauseBreak(r rune) bool {
+	return strings.ContainsRune(".,;:!?()\n", r)
+}
+
+// affirmed reports whether phrase occurs in the words of a clause without being negated.
+func affirmed(words, phrase []string) bool {
+	for start := 0; start+len(phrase) <= len(words); start++ {
+		if slices.Equal(words[start:start+len(phrase)], phrase) && !negated(words[:start]) {
+			return true
+		}
+	}
+	return false
+}
+
+// negated reports whether the words before a phrase deny it.
+func negated(before []string) bool {
+	for i := len(before) - 1; i >= 0 && i >= len(before)-negationWindow; i-- {
+		if scopeBreaks[before[i]] {
+			return false
+		}
+		if negations[before[i]] {
+			return true
+		}
+	}
+	return false
+}
+
+// apostrophes folds the typographic apostrophes of phone keyboards ("can’t") to the ASCII one of the rules.
+var apostrophes = strings.NewReplacer("\u2019", "'", "\u02bc", "'", "\u2018", "'")
+
+// normalize lower-cases text, strips accents (so "ecrasante" matches "écrasante"), folds apostrophes
+// and replaces punctuation with single spaces, so phrases match regardless of formatting.
+func normalize(text string) string {
+	text = apostrophes.Replace(strings.ToLower(text))
+	stripAccents := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(stripAccents, text)
+	if err != nil {
+		folded = text
+	}
+
+	fields := strings.FieldsFunc(folded, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+	return strings.Join(fields, " ")
+}
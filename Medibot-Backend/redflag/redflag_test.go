@@ -0,0 +1,118 @@
+package redflag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	engine, err := NewEngine("")
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+
+	tests := []struct {
+		message  string
+		wantRule string // "" when no rule must match
+		wantLang string
+	}{
+		// en
+		{"I have crushing chest pain", "heart-attack", "en"},
+		{"CRUSHING chest-pain since this morning!", "heart-attack", "en"},
+		{"I can't breathe", "breathing", "en"},
+		{"I can’t breathe", "breathing", "en"},
+		{"I canʼt breathe", "breathing", "en"},
+		{"I have no crushing chest pain", "", ""},
+		{"I don't have crushing chest pain, just a cough", "", ""},
+		{"I've never had crushing chest pain like this before", "heart-attack", "en"},
+		{"I have never felt pressure in my chest like this", "heart-attack", "en"},
+		{"No fever but crushing chest pain", "heart-attack", "en"},
+		{"No fever, crushing chest pain", "heart-attack", "en"},
+		{"I don't know what is happening I can't breathe", "breathing", "en"},
+		{"I cannot breathe", "breathing", "en"},
+		{"my chest hurts a little", "", ""},
+
+		// fr
+		{"Je n'arrive pas à respirer", "breathing", "fr"},
+		{"Je n’arrive pas à respirer", "breathing", "fr"},
+		{"J'ai une douleur thoracique écrasante", "heart-attack", "fr"},
+		{"Je n'ai pas de douleur thoracique écrasante", "", ""},
+		{"Sans douleur thoracique ecrasante", "", ""},
+		{"Pas de fièvre mais une douleur thoracique écrasante", "heart-attack", "fr"},
+		{"Je n'arrive plus à parler", "stroke", "fr"},
+		{"Je n'ai jamais eu une douleur thoracique écrasante comme ça", "heart-attack", "fr"},
+		{"J'ai un peu mal à la tête", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			match, ok := engine.Check(tt.message)
+			if tt.wantRule == "" {
+				if ok {
+					t.Errorf("matched %s on %q", match.Rule.ID, match.Phrase)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("no match, want %s", tt.wantRule)
+			}
+			if match.Rule.ID != tt.wantRule || match.Language != tt.wantLang {
+				t.Errorf("matched %s (%s), want %s (%s)", match.Rule.ID, match.Language, tt.wantRule, tt.wantLang)
+			}
+		})
+	}
+}
+
+func TestInstructions(t *testing.T) {
+	engine, err := NewEngine("")
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	match, ok := engine.Check("Je n'arrive pas à respirer")
+	if !ok {
+		t.Fatal("no match")
+	}
+
+	tests := []struct {
+		preferred string
+		alerted   bool
+		want      string
+	}{
+		{"fr", true, alertNotices["fr"].alerted},
+		{"fr", false, alertNotices["fr"].unattended},
+		{"en", true, alertNotices["en"].alerted},
+		{"en", false, alertNotices["en"].unattended},
+		{"pcm", false, alertNotices["pcm"].unattended},
+		{"de", true, alertNotices["fr"].alerted}, // the language of the phrase
+	}
+
+	for _, tt := range tests {
+		got := match.Instructions(tt.preferred, tt.alerted)
+		if !strings.HasSuffix(got, " "+tt.want) {
+			t.Errorf("Instructions(%q, %v) = %q, want it to end with %q", tt.preferred, tt.alerted, got, tt.want)
+		}
+		if !tt.alerted && strings.Contains(got, alertNotices["en"].alerted) {
+			t.Errorf("Instructions(%q, false) claims a doctor was alerted", tt.preferred)
+		}
+	}
+}
+
+func TestInstructionsOfCustomLanguage(t *testing.T) {
+	engine, err := newEngine([]Rule{{
+		ID:           "fever",
+		Name:         "High fever",
+		Phrases:      map[string][]string{"en": {"very high fever"}, "de": {"sehr hohes fieber"}},
+		Instructions: map[string]string{"en": "Go to a hospital.", "de": "Gehen Sie ins Krankenhaus."},
+	}})
+	if err != nil {
+		t.Fatalf("newEngine: %v", err)
+	}
+	match, ok := engine.Check("Sehr hohes Fieber")
+	if !ok {
+		t.Fatal("no match")
+	}
+	// A language without a notice gets the instructions in its language and the notice in FallbackLanguage.
+	if got, want := match.Instructions("de", true), "Gehen Sie ins Krankenhaus. "+alertNotices["en"].alerted; got != want {
+		t.Errorf("Instructions = %q, want %q", got, want)
+	}
+}
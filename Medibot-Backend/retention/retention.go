@@ -0,0 +1,183 @@
+// Package retention enforces how long patient data is kept. A background Worker periodically deletes
+// the triage conversations that were never shared with a doctor once they have been inactive for long
+// enough, and archives the old summaries, one batch at a time.
+package retention
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"medibot.go/db/repo"
+)
+
+const (
+	// defaultInterval is the time between two purges when the policy sets none.
+	defaultInterval = 24 * time.Hour
+	// defaultBatchSize is the number of rows purged at once when the policy sets none.
+	defaultBatchSize = 500
+)
+
+// Policy is what the worker purges, and how. A zero period keeps that data forever.
+type Policy struct {
+	// ConversationDays is how many days a conversation never shared with a doctor (no referral, no
+	// appointment) and without red flag is kept after its last message.
+	ConversationDays int
+	// SummaryArchiveYears is how many years after they were written summaries are archived.
+	SummaryArchiveYears int
+	// Interval is the time between two purges, the first one runs on start.
+	Interval time.Duration
+	// BatchSize is the number of rows purged at once.
+	BatchSize int
+	// DryRun only logs what would be purged.
+	DryRun bool
+}
+
+// Enabled reports whether the policy purges anything.
+func (p Policy) Enabled() bool {
+	return p.ConversationDays > 0 || p.SummaryArchiveYears > 0
+}
+
+// Store is the part of the repository the worker needs to find and purge the expired data.
+type Store interface {
+	ListExpiredConversations(ctx context.Context, arg repo.ListExpiredConversationsParams) ([]uuid.UUID, error)
+	DeleteExpiredConversations(ctx context.Context, arg repo.DeleteExpiredConversationsParams) ([]uuid.UUID, error)
+	ListSummariesToArchive(ctx context.Context, arg repo.ListSummariesToArchiveParams) ([]uuid.UUID, error)
+	ArchiveSummaries(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error)
+}
+
+// Stats counts what a purge deleted and archived, or would have in dry-run mode.
+type Stats struct {
+	Conversations int
+	Summaries     int
+}
+
+// Worker purges the data past the retention periods of its policy.
+type Worker struct {
+	store  Store
+	policy Policy
+}
+
+// NewWorker creates a Worker enforcing policy. Call Run to start it.
+func NewWorker(store Store, policy Policy) *Worker {
+	if policy.Interval <= 0 {
+		policy.Interval = defaultInterval
+	}
+	if policy.BatchSize <= 0 {
+		policy.BatchSize = defaultBatchSize
+	}
+	return &Worker{store: store, policy: policy}
+}
+
+// Run purges the expired data on start and then every interval, until ctx is done.
+func (w *Worker) Run(ctx context.Context) {
+	if !w.policy.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(w.policy.Interval)
+	defer ticker.Stop()
+	for {
+		stats, err := w.Purge(ctx)
+		if err != nil {
+			log.Printf("ERROR: Retention purge failed: %v", err)
+		}
+		if w.policy.DryRun {
+			log.Printf("INFO: Retention dry run: %d conversations would be deleted and %d summaries archived", stats.Conversations, stats.Summaries)
+		} else {
+			log.Printf("INFO: Retention: %d conversations deleted and %d summaries archived", stats.Conversations, stats.Summaries)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge deletes the expired conversations and archives the old summaries once, batch after batch.
+// Each batch is logged. In dry-run mode nothing is changed, the batches that would be are logged.
+func (w *Worker) Purge(ctx context.Context) (Stats, error) {
+	var stats Stats
+	var err error
+
+	if days := w.policy.ConversationDays; days > 0 {
+		stats.Conversations, err = w.purge(ctx, "conversations", "deleted",
+			func(after uuid.UUID) ([]uuid.UUID, error) {
+				return w.store.ListExpiredConversations(ctx, repo.ListExpiredConversationsParams{AfterID: after, Days: int32(days), PageLimit: int32(w.policy.BatchSize)})
+			},
+			func(ids []uuid.UUID) ([]uuid.UUID, error) {
+				return w.store.DeleteExpiredConversations(ctx, repo.DeleteExpiredConversationsParams{Ids: ids, Days: int32(days)})
+			})
+		if err != nil {
+			return stats, fmt.Errorf("failed to delete expired conversations: %w", err)
+		}
+	}
+
+	if years := w.policy.SummaryArchiveYears; years > 0 {
+		stats.Summaries, err = w.purge(ctx, "summaries", "archived",
+			func(after uuid.UUID) ([]uuid.UUID, error) {
+				return w.store.ListSummariesToArchive(ctx, repo.ListSummariesToArchiveParams{AfterID: after, Years: int32(years), PageLimit: int32(w.policy.BatchSize)})
+			},
+			func(ids []uuid.UUID) ([]uuid.UUID, error) {
+				return w.store.ArchiveSummaries(ctx, ids)
+			})
+		if err != nil {
+			return stats, fmt.Errorf("failed to archive old summaries: %w", err)
+		}
+	}
+
+	return stats, nil
+}
+
+// purge lists the expired rows of a table one batch at a time, in id order, applies apply to each batch
+// unless in dry-run mode, logs the ids, and returns how many rows were purged.
+// apply checks the rows again: a row that changed since it was listed is left as it is.
+func (w *Worker) purge(ctx context.Context, what, done string, list func(after uuid.UUID) ([]uuid.UUID, error), apply func(ids []uuid.UUID) ([]uuid.UUID, error)) (int, error) {
+	var purged int
+	var after uuid.UUID
+	for {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+
+		ids, err := list(after)
+		if err != nil {
+			return purged, err
+		}
+		if len(ids) == 0 {
+			return purged, nil
+		}
+
+		if w.policy.DryRun {
+			log.Printf("INFO: Retention dry run, %d %s would be %s: %s", len(ids), what, done, joinIDs(ids))
+			purged += len(ids)
+		} else {
+			applied, err := apply(ids)
+			if err != nil {
+				return purged, err
+			}
+			if len(applied) > 0 {
+				log.Printf("INFO: Retention, %d %s %s: %s", len(applied), what, done, joinIDs(applied))
+			}
+			purged += len(applied)
+		}
+
+		if len(ids) < w.policy.BatchSize {
+			return purged, nil
+		}
+		after = ids[len(ids)-1]
+	}
+}
+
+func joinIDs(ids []uuid.UUID) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = id.String()
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,181 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"medibot.go/db/repo"
+	"medibot.go/db/repotest"
+)
+
+// fakeStore holds conversations and summaries by id, with whether each one is expired.
+type fakeStore struct {
+	conversations map[uuid.UUID]bool
+	summaries     map[uuid.UUID]bool
+	lists         []uuid.UUID // the after id of every ListExpiredConversations call
+	deletes       int
+	// beforeDelete runs before DeleteExpiredConversations, e.g. to change rows after they were listed.
+	beforeDelete func()
+}
+
+// testIDs returns n ids in increasing order.
+func testIDs(n int) []uuid.UUID {
+	ids := make([]uuid.UUID, n)
+	for i := range ids {
+		ids[i] = uuid.MustParse(fmt.Sprintf("00000000-0000-0000-0000-%012d", i+1))
+	}
+	return ids
+}
+
+func expired(ids []uuid.UUID) map[uuid.UUID]bool {
+	rows := map[uuid.UUID]bool{}
+	for _, id := range ids {
+		rows[id] = true
+	}
+	return rows
+}
+
+// list returns a batch of the expired rows after the given id.
+func list(rows map[uuid.UUID]bool, after uuid.UUID, limit int32) []uuid.UUID {
+	var ids []uuid.UUID
+	for id, expired := range rows {
+		if expired && id.String() > after.String() {
+			ids = append(ids, id)
+		}
+	}
+	slices.SortFunc(ids, func(a, b uuid.UUID) int { return strings.Compare(a.String(), b.String()) })
+	return ids[:min(len(ids), int(limit))]
+}
+
+// purge removes the given rows that are still expired and returns them.
+func purge(rows map[uuid.UUID]bool, ids []uuid.UUID) []uuid.UUID {
+	var purged []uuid.UUID
+	for _, id := range ids {
+		if rows[id] {
+			delete(rows, id)
+			purged = append(purged, id)
+		}
+	}
+	return purged
+}
+
+func (s *fakeStore) ListExpiredConversations(ctx context.Context, arg repo.ListExpiredConversationsParams) ([]uuid.UUID, error) {
+	s.lists = append(s.lists, arg.AfterID)
+	return list(s.conversations, arg.AfterID, arg.PageLimit), nil
+}
+
+func (s *fakeStore) DeleteExpiredConversations(ctx context.Context, arg repo.DeleteExpiredConversationsParams) ([]uuid.UUID, error) {
+	s.deletes++
+	if s.beforeDelete != nil {
+		s.beforeDelete()
+	}
+	return purge(s.conversations, arg.Ids), nil
+}
+
+func (s *fakeStore) ListSummariesToArchive(ctx context.Context, arg repo.ListSummariesToArchiveParams) ([]uuid.UUID, error) {
+	return list(s.summaries, arg.AfterID, arg.PageLimit), nil
+}
+
+func (s *fakeStore) ArchiveSummaries(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	return purge(s.summaries, ids), nil
+}
+
+func TestPurgePagesThroughBatches(t *testing.T) {
+	ids := testIDs(5)
+	store := &fakeStore{conversations: expired(ids), summaries: expired(testIDs(3))}
+	store.conversations[uuid.New()] = false // recent, kept
+
+	stats, err := NewWorker(store, Policy{ConversationDays: 30, SummaryArchiveYears: 5, BatchSize: 2}).Purge(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (Stats{Conversations: 5, Summaries: 3}) {
+		t.Errorf("stats = %+v, want 5 conversations and 3 summaries", stats)
+	}
+	// Full batches are followed by the next one, after the last id of the batch.
+	if want := []uuid.UUID{uuid.Nil, ids[1], ids[3]}; !slices.Equal(store.lists, want) {
+		t.Errorf("listed after %v, want %v", store.lists, want)
+	}
+	if len(store.conversations) != 1 || len(store.summaries) != 0 {
+		t.Errorf("left %d conversations and %d summaries, want only the recent conversation", len(store.conversations), len(store.summaries))
+	}
+}
+
+func TestPurgeDryRunChangesNothing(t *testing.T) {
+	store := &fakeStore{conversations: expired(testIDs(3)), summaries: expired(testIDs(2))}
+
+	stats, err := NewWorker(store, Policy{ConversationDays: 30, SummaryArchiveYears: 5, BatchSize: 2, DryRun: true}).Purge(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (Stats{Conversations: 3, Summaries: 2}) {
+		t.Errorf("stats = %+v, want what would be purged", stats)
+	}
+	if store.deletes != 0 || len(store.conversations) != 3 || len(store.summaries) != 2 {
+		t.Errorf("dry run deleted %d times, left %d conversations and %d summaries", store.deletes, len(store.conversations), len(store.summaries))
+	}
+}
+
+func TestPurgeSkipsRowsChangedSinceListed(t *testing.T) {
+	ids := testIDs(3)
+	store := &fakeStore{conversations: expired(ids)}
+	// The patient writes in a listed conversation before it is deleted.
+	store.beforeDelete = func() { store.conversations[ids[1]] = false }
+
+	stats, err := NewWorker(store, Policy{ConversationDays: 30}).Purge(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Conversations != 2 {
+		t.Errorf("deleted %d conversations, want 2", stats.Conversations)
+	}
+	if _, kept := store.conversations[ids[1]]; !kept || len(store.conversations) != 1 {
+		t.Errorf("conversations = %v, want only the changed one kept", store.conversations)
+	}
+}
+
+func TestDisabledPolicyPurgesNothing(t *testing.T) {
+	store := &fakeStore{conversations: expired(testIDs(2)), summaries: expired(testIDs(2))}
+
+	stats, err := NewWorker(store, Policy{}).Purge(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (Stats{}) || len(store.lists) != 0 {
+		t.Errorf("stats = %+v after %d lists, want nothing purged", stats, len(store.lists))
+	}
+}
+
+// TestRedFlaggedConversationsAreKept runs the queries on the test database: the conversation that
+// raised a red flag is kept however old, the other one is deleted.
+func TestRedFlaggedConversationsAreKept(t *testing.T) {
+	pool := repotest.Pool(t)
+	ctx := context.Background()
+	q := repo.New(pool)
+
+	patient := repotest.CreateUser(t, q, "patient")
+	quiet, flagged := uuid.New(), uuid.New()
+	for _, id := range []uuid.UUID{quiet, flagged} {
+		if err := q.CreateConversation(ctx, repo.CreateConversationParams{ID: id, UserID: patient.ID, Specialty: "cardiology"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pool.Exec(ctx, "UPDATE conversation SET created_at = now() - interval '60 days' WHERE id = $1", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.MarkConversationRedFlag(ctx, repo.MarkConversationRedFlagParams{ID: flagged, RedFlag: "heart-attack"}); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := q.DeleteExpiredConversations(ctx, repo.DeleteExpiredConversationsParams{Ids: []uuid.UUID{quiet, flagged}, Days: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(deleted, []uuid.UUID{quiet}) {
+		t.Errorf("deleted %v, want only %s", deleted, quiet)
+	}
+}
@@ -0,0 +1,49 @@
+package schedule
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"medibot.go/db/repo"
+)
+
+const icsTimeFormat = "20060102T150405Z"
+
+// WriteICS writes the appointments as an iCalendar (RFC 5545) feed.
+// Events only carry generic titles: calendars get synced to third-party services,
+// so no patient name or medical detail is exported.
+func WriteICS(w io.Writer, calendarName string, appointments []repo.Appointment) error {
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\n")
+	b.WriteString("VERSION:2.0\r\n")
+	b.WriteString("PRODID:-//Medibot//Appointments//EN\r\n")
+	b.WriteString("CALSCALE:GREGORIAN\r\n")
+	b.WriteString("METHOD:PUBLISH\r\n")
+	fmt.Fprintf(&b, "X-WR-CALNAME:%s\r\n", escapeText(calendarName))
+
+	for _, appointment := range appointments {
+		b.WriteString("BEGIN:VEVENT\r\n")
+		fmt.Fprintf(&b, "UID:%s@medibot\r\n", appointment.ID.String())
+		fmt.Fprintf(&b, "DTSTAMP:%s\r\n", appointment.UpdatedAt.UTC().Format(icsTimeFormat))
+		fmt.Fprintf(&b, "DTSTART:%s\r\n", appointment.StartsAt.UTC().Format(icsTimeFormat))
+		fmt.Fprintf(&b, "DTEND:%s\r\n", appointment.EndsAt.UTC().Format(icsTimeFormat))
+		b.WriteString("SUMMARY:Medibot consultation\r\n")
+		if appointment.Status == "cancelled" {
+			b.WriteString("STATUS:CANCELLED\r\n")
+		} else {
+			b.WriteString("STATUS:CONFIRMED\r\n")
+		}
+		b.WriteString("END:VEVENT\r\n")
+	}
+
+	b.WriteString("END:VCALENDAR\r\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// escapeText escapes a TEXT value (RFC 5545 section 3.3.11).
+func escapeText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(text)
+}
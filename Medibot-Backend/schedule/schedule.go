@@ -0,0 +1,124 @@
+// Package schedule turns the weekly availability windows of a doctor into bookable slots
+// and exports appointments as an iCalendar feed.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+	_ "time/tzdata" // doctors' timezones must resolve even on images without zoneinfo
+
+	"medibot.go/db/repo"
+)
+
+// DefaultTimezone is used for availability published without a timezone.
+const DefaultTimezone = "Africa/Douala"
+
+// ErrNotAvailable is returned when a requested time is not one of the doctor's slots.
+var ErrNotAvailable = errors.New("the doctor is not available at this time")
+
+// Slot is a bookable period.
+type Slot struct {
+	StartsAt time.Time `json:"startsAt"`
+	EndsAt   time.Time `json:"endsAt"`
+}
+
+// ParseClock parses a "15:04" time of day into minutes since midnight. "24:00" is accepted as an end of day.
+func ParseClock(clock string) (int32, error) {
+	if clock == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", clock)
+	}
+	return int32(t.Hour()*60 + t.Minute()), nil
+}
+
+// FormatClock formats minutes since midnight as "15:04".
+func FormatClock(minutes int32) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// Slots lists the slots of the windows starting in [from, to) that don't overlap a booked appointment.
+func Slots(windows []repo.DoctorAvailability, booked []repo.Appointment, from, to time.Time) ([]Slot, error) {
+	slots := []Slot{}
+	for _, window := range windows {
+		loc, err := time.LoadLocation(window.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", window.Timezone, err)
+		}
+
+		// Walk the local days covered by [from, to), one day of margin on each side for timezone shifts.
+		first := from.In(loc)
+		day := time.Date(first.Year(), first.Month(), first.Day()-1, 0, 0, 0, 0, loc)
+		for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+			if int32(day.Weekday()) != window.Weekday {
+				continue
+			}
+			for minute := window.StartMinute; minute+window.SlotMinutes <= window.EndMinute; minute += window.SlotMinutes {
+				slot := Slot{
+					StartsAt: dayAt(day, minute),
+					EndsAt:   dayAt(day, minute+window.SlotMinutes),
+				}
+				if !onClock(slot.StartsAt, minute) || slot.StartsAt.Before(from) || !slot.StartsAt.Before(to) || overlapsAny(slot, booked) {
+					continue
+				}
+				slots = append(slots, slot)
+			}
+		}
+	}
+
+	slices.SortFunc(slots, func(a, b Slot) int { return a.StartsAt.Compare(b.StartsAt) })
+	return slots, nil
+}
+
+// Fit returns the slot starting exactly at start in one of the windows, or ErrNotAvailable.
+// Whether the slot is still free is left to the database constraints.
+func Fit(windows []repo.DoctorAvailability, start time.Time) (Slot, error) {
+	for _, window := range windows {
+		loc, err := time.LoadLocation(window.Timezone)
+		if err != nil {
+			return Slot{}, fmt.Errorf("invalid timezone %q: %w", window.Timezone, err)
+		}
+
+		local := start.In(loc)
+		if int32(local.Weekday()) != window.Weekday || local.Second() != 0 || local.Nanosecond() != 0 {
+			continue
+		}
+
+		minute := int32(local.Hour()*60 + local.Minute())
+		if minute < window.StartMinute || minute+window.SlotMinutes > window.EndMinute {
+			continue
+		}
+		if (minute-window.StartMinute)%window.SlotMinutes != 0 {
+			continue
+		}
+
+		day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+		return Slot{StartsAt: dayAt(day, minute), EndsAt: dayAt(day, minute+window.SlotMinutes)}, nil
+	}
+	return Slot{}, ErrNotAvailable
+}
+
+// dayAt returns the time minutes after the local midnight of day. Using time.Date keeps the
+// wall clock right on days with a daylight saving change.
+func dayAt(day time.Time, minutes int32) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, int(minutes), 0, 0, day.Location())
+}
+
+// onClock reports whether t is minutes after midnight on the wall clock. It is not for the times
+// skipped when the clocks go forward, which time.Date moves to the next hour, onto another slot.
+func onClock(t time.Time, minutes int32) bool {
+	return int32(t.Hour()*60+t.Minute()) == minutes
+}
+
+func overlapsAny(slot Slot, booked []repo.Appointment) bool {
+	for _, appointment := range booked {
+		if slot.StartsAt.Before(appointment.EndsAt) && appointment.StartsAt.Before(slot.EndsAt) {
+			return true
+		}
+	}
+	return false
+}
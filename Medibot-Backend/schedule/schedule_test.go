@@ -0,0 +1,242 @@
+package schedule
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"medibot.go/db/repo"
+)
+
+// mustLoad returns the location named name.
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+// window is an availability window from start to end, in minutes since midnight, on weekday.
+func window(weekday time.Weekday, start, end, slot int32, timezone string) repo.DoctorAvailability {
+	return repo.DoctorAvailability{Weekday: int32(weekday), StartMinute: start, EndMinute: end, SlotMinutes: slot, Timezone: timezone}
+}
+
+func TestClock(t *testing.T) {
+	tests := []struct {
+		clock   string
+		minutes int32
+		wantErr bool
+	}{
+		{"09:00", 540, false},
+		{"12:30", 750, false},
+		{"00:00", 0, false},
+		{"24:00", 1440, false},
+		{"9h", 0, true},
+		{"25:00", 0, true},
+	}
+
+	for _, tt := range tests {
+		minutes, err := ParseClock(tt.clock)
+		if (err != nil) != tt.wantErr || minutes != tt.minutes {
+			t.Errorf("ParseClock(%q) = %d, %v, want %d (error %v)", tt.clock, minutes, err, tt.minutes, tt.wantErr)
+		}
+		if err == nil && tt.clock != "24:00" && FormatClock(minutes) != tt.clock {
+			t.Errorf("FormatClock(%d) = %q, want %q", minutes, FormatClock(minutes), tt.clock)
+		}
+	}
+}
+
+func TestSlots(t *testing.T) {
+	douala := mustLoad(t, DefaultTimezone)
+	// Monday 2 March 2026, 00:00 in Douala (UTC+1, no daylight saving)
+	monday := time.Date(2026, 3, 2, 0, 0, 0, 0, douala)
+	morning := window(time.Monday, 9*60, 11*60, 30, DefaultTimezone)
+
+	tests := []struct {
+		name     string
+		windows  []repo.DoctorAvailability
+		booked   []repo.Appointment
+		from, to time.Time
+		want     []string // local start times
+	}{
+		{
+			name:    "whole window",
+			windows: []repo.DoctorAvailability{morning},
+			from:    monday, to: monday.AddDate(0, 0, 1),
+			want: []string{"09:00", "09:30", "10:00", "10:30"},
+		},
+		{
+			name:    "booked slot skipped",
+			windows: []repo.DoctorAvailability{morning},
+			booked:  []repo.Appointment{{StartsAt: monday.Add(9*time.Hour + 30*time.Minute), EndsAt: monday.Add(10 * time.Hour)}},
+			from:    monday, to: monday.AddDate(0, 0, 1),
+			want: []string{"09:00", "10:00", "10:30"},
+		},
+		{
+			name:    "partly overlapping appointment",
+			windows: []repo.DoctorAvailability{morning},
+			booked:  []repo.Appointment{{StartsAt: monday.Add(9*time.Hour + 45*time.Minute), EndsAt: monday.Add(10*time.Hour + 15*time.Minute)}},
+			from:    monday, to: monday.AddDate(0, 0, 1),
+			want: []string{"09:00", "10:30"},
+		},
+		{
+			name:    "started slots are not offered",
+			windows: []repo.DoctorAvailability{morning},
+			from:    monday.Add(9*time.Hour + 10*time.Minute), to: monday.AddDate(0, 0, 1),
+			want: []string{"09:30", "10:00", "10:30"},
+		},
+		{
+			name:    "slot longer than the rest of the window",
+			windows: []repo.DoctorAvailability{window(time.Monday, 9*60, 10*60+45, 30, DefaultTimezone)},
+			from:    monday, to: monday.AddDate(0, 0, 1),
+			want: []string{"09:00", "09:30", "10:00"},
+		},
+		{
+			name:    "other weekday",
+			windows: []repo.DoctorAvailability{window(time.Tuesday, 9*60, 10*60, 30, DefaultTimezone)},
+			from:    monday, to: monday.AddDate(0, 0, 1),
+			want: nil,
+		},
+		{
+			name:    "two weeks, sorted across windows",
+			windows: []repo.DoctorAvailability{window(time.Monday, 14*60, 15*60, 60, DefaultTimezone), window(time.Monday, 8*60, 9*60, 60, DefaultTimezone)},
+			from:    monday, to: monday.AddDate(0, 0, 14),
+			want: []string{"08:00", "14:00", "08:00", "14:00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slots, err := Slots(tt.windows, tt.booked, tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, slot := range slots {
+				got = append(got, slot.StartsAt.In(douala).Format("15:04"))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("slots = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Slots([]repo.DoctorAvailability{window(time.Monday, 0, 60, 30, "Mars/Olympus")}, nil, monday, monday.AddDate(0, 0, 1)); err == nil {
+		t.Error("Slots accepted an unknown timezone")
+	}
+}
+
+func TestFit(t *testing.T) {
+	douala := mustLoad(t, DefaultTimezone)
+	monday := time.Date(2026, 3, 2, 0, 0, 0, 0, douala)
+	windows := []repo.DoctorAvailability{window(time.Monday, 9*60, 11*60, 30, DefaultTimezone)}
+
+	tests := []struct {
+		name  string
+		start time.Time
+		want  bool
+	}{
+		{"first slot", monday.Add(9 * time.Hour), true},
+		{"last slot", monday.Add(10*time.Hour + 30*time.Minute), true},
+		{"same instant in UTC", monday.Add(9 * time.Hour).UTC(), true},
+		{"between slots", monday.Add(9*time.Hour + 15*time.Minute), false},
+		{"with seconds", monday.Add(9*time.Hour + time.Second), false},
+		{"end of the window", monday.Add(11 * time.Hour), false},
+		{"before the window", monday.Add(8*time.Hour + 30*time.Minute), false},
+		{"other weekday", monday.AddDate(0, 0, 1).Add(9 * time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		slot, err := Fit(windows, tt.start)
+		if !tt.want {
+			if !errors.Is(err, ErrNotAvailable) {
+				t.Errorf("%s: Fit = %v, %v, want ErrNotAvailable", tt.name, slot, err)
+			}
+			continue
+		}
+		if err != nil || !slot.StartsAt.Equal(tt.start) || slot.EndsAt.Sub(slot.StartsAt) != 30*time.Minute {
+			t.Errorf("%s: Fit = %v, %v, want the 30 minute slot at %v", tt.name, slot, err, tt.start)
+		}
+	}
+}
+
+// TestDaylightSaving checks that slots keep their wall clock time on the days the clocks change:
+// 29 March and 25 October 2026 in Paris are Sundays.
+func TestDaylightSaving(t *testing.T) {
+	paris := mustLoad(t, "Europe/Paris")
+	windows := []repo.DoctorAvailability{
+		window(time.Sunday, 1*60, 4*60, 60, "Europe/Paris"),
+		window(time.Sunday, 9*60, 10*60, 60, "Europe/Paris"),
+	}
+
+	tests := []struct {
+		name string
+		day  time.Time
+		want []string // local start time and UTC offset
+	}{
+		// 02:00 doesn't exist, there is no slot then rather than a second 03:00 one.
+		{"spring forward", time.Date(2026, 3, 29, 0, 0, 0, 0, paris), []string{"01:00+01:00", "03:00+02:00", "09:00+02:00"}},
+		// 02:00 happens twice, the slot is at the second one.
+		{"fall back", time.Date(2026, 10, 25, 0, 0, 0, 0, paris), []string{"01:00+02:00", "02:00+01:00", "03:00+01:00", "09:00+01:00"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slots, err := Slots(windows, nil, tt.day, tt.day.AddDate(0, 0, 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, slot := range slots {
+				got = append(got, slot.StartsAt.In(paris).Format("15:04-07:00"))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("slots = %v, want %v", got, tt.want)
+			}
+
+			// The slots away from the change last an hour.
+			nine := slots[len(slots)-1]
+			if nine.EndsAt.Sub(nine.StartsAt) != time.Hour {
+				t.Errorf("09:00 slot lasts %v, want 1h", nine.EndsAt.Sub(nine.StartsAt))
+			}
+			if _, err := Fit(windows, nine.StartsAt); err != nil {
+				t.Errorf("Fit(%v) = %v, want the 09:00 slot", nine.StartsAt, err)
+			}
+		})
+	}
+}
+
+func TestWriteICS(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	booked := repo.Appointment{ID: uuid.New(), StartsAt: start, EndsAt: start.Add(30 * time.Minute), Status: "booked", UpdatedAt: start.AddDate(0, 0, -1), Note: "Chest pain"}
+	cancelled := repo.Appointment{ID: uuid.New(), StartsAt: start.Add(time.Hour), EndsAt: start.Add(90 * time.Minute), Status: "cancelled", UpdatedAt: start}
+
+	var b strings.Builder
+	if err := WriteICS(&b, "Medibot - Dr Ngo, Marie; clinic\\annex\nnight", []repo.Appointment{booked, cancelled}); err != nil {
+		t.Fatal(err)
+	}
+	ics := b.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		`X-WR-CALNAME:Medibot - Dr Ngo\, Marie\; clinic\\annex\nnight` + "\r\n",
+		"UID:" + booked.ID.String() + "@medibot\r\nDTSTAMP:20260301T090000Z\r\nDTSTART:20260302T090000Z\r\nDTEND:20260302T093000Z\r\nSUMMARY:Medibot consultation\r\nSTATUS:CONFIRMED\r\n",
+		"UID:" + cancelled.ID.String() + "@medibot\r\n",
+		"STATUS:CANCELLED\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("calendar is missing %q:\n%s", want, ics)
+		}
+	}
+	if strings.Contains(ics, "Chest pain") {
+		t.Error("calendar exports the appointment's note")
+	}
+	if strings.Count(ics, "BEGIN:VEVENT") != 2 || strings.Contains(strings.ReplaceAll(ics, "\r\n", ""), "\n") {
+		t.Errorf("calendar is not 2 events with CRLF line ends:\n%q", ics)
+	}
+}
@@ -0,0 +1,167 @@
+// Package title names conversations. After the first exchange of a conversation, a background
+// Worker asks the model for a short title so the patient's history doesn't list a bare "hello",
+// without ever delaying the reply to the patient.
+package title
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"medibot.go/db/repo"
+	"medibot.go/llm"
+)
+
+const (
+	// MaxLength is the longest title kept, in characters, whether generated or set by the patient.
+	MaxLength = 80
+	// queueSize is the number of conversations waiting for a title before new ones are dropped.
+	queueSize = 256
+	// generateTimeout bounds a single title generation.
+	generateTimeout = 30 * time.Second
+)
+
+const instruction = `You name the conversations of a medical assistant app.
+Reply with a title of at most six words describing the patient's health concern, in the language of the conversation.
+Reply with the title only: no quotes, no trailing punctuation, no patient name.`
+
+// Generate asks the provider for a title summarizing the conversation, together with the tokens
+// the request used.
+func Generate(ctx context.Context, provider llm.Provider, history []llm.Message) (string, llm.Usage, error) {
+	var transcript strings.Builder
+	for _, msg := range history {
+		speaker := "Patient"
+		if msg.Role == llm.RoleAssistant {
+			speaker = "Assistant"
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n\n", speaker, msg.Text)
+	}
+
+	reply, err := provider.Generate(ctx, llm.Request{
+		System:   instruction,
+		Messages: []llm.Message{{Role: llm.RoleUser, Text: transcript.String()}},
+	})
+	if err != nil {
+		return "", llm.Usage{}, fmt.Errorf("title generation failed: %w", err)
+	}
+
+	title := Clean(reply.Text)
+	if title == "" {
+		return "", reply.Usage, errors.New("title generation returned an empty title")
+	}
+	return title, reply.Usage, nil
+}
+
+// Clean keeps the first line of a title, without surrounding quotes and punctuation,
+// truncated to MaxLength characters.
+func Clean(title string) string {
+	title, _, _ = strings.Cut(strings.TrimSpace(title), "\n")
+	title = strings.Trim(strings.TrimSpace(title), "\"'`*#.:")
+	title = strings.TrimSpace(title)
+	if utf8.RuneCountInString(title) > MaxLength {
+		title = strings.TrimSpace(string([]rune(title)[:MaxLength]))
+	}
+	return title
+}
+
+// Store is the part of the repository the worker needs to read conversations, save their titles
+// and count the tokens spent on them.
+type Store interface {
+	GetConMessages(ctx context.Context, id uuid.UUID) ([]repo.Message, error)
+	SetGeneratedConversationTitle(ctx context.Context, arg repo.SetGeneratedConversationTitleParams) (int64, error)
+	RecordUsage(ctx context.Context, arg repo.RecordUsageParams) error
+}
+
+// job is a conversation to title, the tokens are counted in its patient's usage.
+type job struct {
+	conID  uuid.UUID
+	userID uuid.UUID
+}
+
+// Worker generates the titles of the queued conversations one at a time.
+type Worker struct {
+	store    Store
+	provider llm.Provider
+	queue    chan job
+}
+
+// NewWorker creates a Worker reading and saving through store. Call Run to start it.
+func NewWorker(store Store, provider llm.Provider) *Worker {
+	return &Worker{
+		store:    store,
+		provider: provider,
+		queue:    make(chan job, queueSize),
+	}
+}
+
+// Enqueue schedules the titling of a conversation of the patient userID. It never blocks: when the queue
+// is full the conversation is skipped, and it is queued again on its next exchange since it is still untitled.
+func (w *Worker) Enqueue(conID, userID uuid.UUID) {
+	select {
+	case w.queue <- job{conID: conID, userID: userID}:
+	default:
+		log.Printf("WARNING: Title queue is full, skipping conversation %s", conID.String())
+	}
+}
+
+// Run titles the queued conversations until ctx is done.
+func (w *Worker) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-w.queue:
+			if err := w.title(ctx, job); err != nil {
+				log.Printf("ERROR: Failed to title conversation %s: %v", job.conID.String(), err)
+			}
+		}
+	}
+}
+
+func (w *Worker) title(ctx context.Context, job job) error {
+	ctx, cancel := context.WithTimeout(ctx, generateTimeout)
+	defer cancel()
+
+	messages, err := w.store.GetConMessages(ctx, job.conID)
+	if err != nil {
+		return err
+	}
+
+	var history []llm.Message
+	for _, msg := range messages {
+		switch msg.Sender {
+		case "user":
+			history = append(history, llm.Message{Role: llm.RoleUser, Text: msg.Content})
+		case "assistant":
+			history = append(history, llm.Message{Role: llm.RoleAssistant, Text: msg.Content})
+		}
+	}
+	if len(history) == 0 {
+		return nil
+	}
+
+	// The title is generated for the patient: it counts in their daily usage, like their own messages.
+	title, usage, err := Generate(ctx, w.provider, history)
+	if err := w.store.RecordUsage(ctx, repo.RecordUsageParams{
+		UserID:           job.userID,
+		PromptTokens:     int64(usage.PromptTokens),
+		CompletionTokens: int64(usage.CompletionTokens),
+		TotalTokens:      int64(usage.TotalTokens),
+	}); err != nil {
+		log.Printf("ERROR: Failed to record AI usage of user %s: %v", job.userID.String(), err)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = w.store.SetGeneratedConversationTitle(ctx, repo.SetGeneratedConversationTitleParams{
+		ID:    job.conID,
+		Title: title,
+	})
+	return err
+}
@@ -0,0 +1,83 @@
+package title
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"medibot.go/db/repo"
+	"medibot.go/llm"
+)
+
+// fakeStore holds the messages of one conversation and what the worker saved.
+type fakeStore struct {
+	messages []repo.Message
+	titles   []repo.SetGeneratedConversationTitleParams
+	usage    []repo.RecordUsageParams
+}
+
+func (s *fakeStore) GetConMessages(ctx context.Context, id uuid.UUID) ([]repo.Message, error) {
+	return s.messages, nil
+}
+
+func (s *fakeStore) SetGeneratedConversationTitle(ctx context.Context, arg repo.SetGeneratedConversationTitleParams) (int64, error) {
+	s.titles = append(s.titles, arg)
+	return 1, nil
+}
+
+func (s *fakeStore) RecordUsage(ctx context.Context, arg repo.RecordUsageParams) error {
+	s.usage = append(s.usage, arg)
+	return nil
+}
+
+func TestWorkerCountsUsageOfPatient(t *testing.T) {
+	conID, patientID := uuid.New(), uuid.New()
+	store := &fakeStore{messages: []repo.Message{
+		{ConID: conID, Sender: "user", Content: "My chest hurts when I climb stairs"},
+		{ConID: conID, Sender: "assistant", Content: "How long has it lasted?"},
+	}}
+	worker := NewWorker(store, llm.NewScripted(`"Chest pain on exertion."`))
+
+	worker.Enqueue(conID, patientID)
+	if err := worker.title(context.Background(), <-worker.queue); err != nil {
+		t.Fatalf("title: %v", err)
+	}
+
+	if len(store.titles) != 1 || store.titles[0].ID != conID || store.titles[0].Title != "Chest pain on exertion" {
+		t.Errorf("titles = %+v", store.titles)
+	}
+	if len(store.usage) != 1 || store.usage[0].UserID != patientID || store.usage[0].TotalTokens == 0 {
+		t.Errorf("usage = %+v, want the tokens counted for the patient", store.usage)
+	}
+}
+
+func TestWorkerCountsUsageOfFailedTitle(t *testing.T) {
+	store := &fakeStore{messages: []repo.Message{{Sender: "user", Content: "Hello"}}}
+	worker := NewWorker(store, llm.NewScripted("  "))
+	patientID := uuid.New()
+
+	if err := worker.title(context.Background(), job{conID: uuid.New(), userID: patientID}); err == nil {
+		t.Fatal("an empty title was accepted")
+	}
+	if len(store.titles) != 0 {
+		t.Errorf("saved %+v", store.titles)
+	}
+	if len(store.usage) != 1 || store.usage[0].UserID != patientID || store.usage[0].TotalTokens == 0 {
+		t.Errorf("usage = %+v, the tokens of a rejected title are spent all the same", store.usage)
+	}
+}
+
+func TestClean(t *testing.T) {
+	tests := map[string]string{
+		"Chest pain":                     "Chest pain",
+		`  "Chest pain."  `:              "Chest pain",
+		"**Headache**\nSecond line":      "Headache",
+		strings.Repeat("a", MaxLength+5): strings.Repeat("a", MaxLength),
+	}
+	for title, want := range tests {
+		if got := Clean(title); got != want {
+			t.Errorf("Clean(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Package triage extracts a structured triage record from a consultation transcript.
+// The model is asked for JSON constrained by Schema, and the result is validated in Go
+// before it is stored in the typed summaries columns.
+package triage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"medibot.go/llm"
+)
+
+// Severity levels, matching the summaries.severity CHECK constraint.
+const (
+	SeverityLow      = "low"
+	SeverityModerate = "moderate"
+	SeverityHigh     = "high"
+)
+
+// Helpfulness feedback given by the patient after the medical guidance.
+const (
+	FeedbackHelpful     = "helpful"
+	FeedbackNotHelpful  = "not_helpful"
+	FeedbackNotAnswered = "not_answered"
+)
+
+// ErrIncomplete is returned when the consultation has not reached a conclusion yet.
+var ErrIncomplete = errors.New("consultation is not complete yet")
+
+// Result is the structured outcome of a consultation.
+type Result struct {
+	// Complete is true once the assistant has given its guidance with a severity.
+	Complete           bool     `json:"complete"`
+	Severity           string   `json:"severity"`
+	SuspectedCondition string   `json:"suspectedCondition"`
+	RecommendedTests   []string `json:"recommendedTests"`
+	LifestyleAdvice    []string `json:"lifestyleAdvice"`
+	Feedback           string   `json:"feedback"`
+	Summary            string   `json:"summary"`
+}
+
+// Helpful maps the feedback to the nullable summaries.helpful column.
+func (r Result) Helpful() *bool {
+	switch r.Feedback {
+	case FeedbackHelpful:
+		helpful := true
+		return &helpful
+	case FeedbackNotHelpful:
+		helpful := false
+		return &helpful
+	default:
+		return nil
+	}
+}
+
+// Validate checks that a complete result only holds values the database accepts.
+func (r Result) Validate() error {
+	if !r.Complete {
+		return ErrIncomplete
+	}
+	if !slices.Contains([]string{SeverityLow, SeverityModerate, SeverityHigh}, r.Severity) {
+		return fmt.Errorf("invalid severity %q", r.Severity)
+	}
+	if !slices.Contains([]string{FeedbackHelpful, FeedbackNotHelpful, FeedbackNotAnswered}, r.Feedback) {
+		return fmt.Errorf("invalid feedback %q", r.Feedback)
+	}
+	if strings.TrimSpace(r.SuspectedCondition) == "" {
+		return errors.New("suspected condition is empty")
+	}
+	if strings.TrimSpace(r.Summary) == "" {
+		return errors.New("summary is empty")
+	}
+	return nil
+}
+
+// Schema constrains the model's reply to a Result.
+var Schema = &llm.Schema{
+	Type: "object",
+	Properties: map[string]*llm.Schema{
+		"complete": {
+			Type:        "boolean",
+			Description: "true only if the assistant has already given its medical guidance including a severity",
+		},
+		"severity": {
+			Type: "string",
+			Enum: []string{SeverityLow, SeverityModerate, SeverityHigh},
+		},
+		"suspectedCondition": {
+			Type:        "string",
+			Description: "the most likely condition in plain words",
+		},
+		"recommendedTests": {
+			Type:  "array",
+			Items: &llm.Schema{Type: "string"},
+		},
+		"lifestyleAdvice": {
+			Type:  "array",
+			Items: &llm.Schema{Type: "string"},
+		},
+		"feedback": {
+			Type:        "string",
+			Enum:        []string{FeedbackHelpful, FeedbackNotHelpful, FeedbackNotAnswered},
+			Description: "the patient's answer to \"Was this helpful to you?\"",
+		},
+		"summary": {
+			Type:        "string",
+			Description: "a short summary of the consultation for the patient and their doctor",
+		},
+	},
+	Required: []string{"complete", "severity", "suspectedCondition", "recommendedTests", "lifestyleAdvice", "feedback", "summary"},
+}
+
+const instruction = `You are a clinical documentation assistant. You receive the transcript of a consultation between a patient and a %s assistant.
+Extract a triage record using only what is said in the transcript:
+- complete: true only if the assistant has already given its medical guidance with a severity, otherwise false.
+- severity: the severity the assistant stated (low, moderate or high).
+- suspectedCondition: the condition the assistant suspected, in plain words.
+- recommendedTests: the tests the assistant recommended, empty if none.
+- lifestyleAdvice: the lifestyle changes the assistant recommended, empty if none.
+- feedback: helpful or not_helpful if the patient answered "Was this helpful to you?", otherwise not_answered.
+- summary: a short summary of the consultation, mentioning whether the patient found it helpful.
+Never invent information that is not in the transcript.`
+
+// Extract asks the provider for a triage record of the consultation, together with the tokens
+// the request used. It returns ErrIncomplete while the assistant has not concluded yet.
+func Extract(ctx context.Context, provider llm.Provider, specialty string, history []llm.Message) (Result, llm.Usage, error) {
+	var transcript strings.Builder
+	for _, msg := range history {
+		speaker := "Patient"
+		if msg.Role == llm.RoleAssistant {
+			speaker = "Assistant"
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n\n", speaker, msg.Text)
+	}
+
+	reply, err := provider.Generate(ctx, llm.Request{
+		System:   fmt.Sprintf(instruction, specialty),
+		Messages: []llm.Message{{Role: llm.RoleUser, Text: transcript.String()}},
+		Schema:   Schema,
+	})
+	if err != nil {
+		return Result{}, llm.Usage{}, fmt.Errorf("triage extraction failed: %w", err)
+	}
+
+	var result Result
+	if err := json.Unmarshal([]byte(reply.Text), &result); err != nil {
+		return Result{}, reply.Usage, fmt.Errorf("failed to decode triage result: %w", err)
+	}
+
+	if err := result.Validate(); err != nil {
+		return Result{}, reply.Usage, err
+	}
+
+	return result, reply.Usage, nil
+}
@@ -0,0 +1,150 @@
+package triage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"medibot.go/llm"
+)
+
+func validResult() Result {
+	return Result{
+		Complete:           true,
+		Severity:           SeverityModerate,
+		SuspectedCondition: "Tension headache",
+		RecommendedTests:   []string{"Blood pressure"},
+		LifestyleAdvice:    []string{"Sleep more"},
+		Feedback:           FeedbackHelpful,
+		Summary:            "Headache for three days, found the advice helpful.",
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(r *Result)
+		wantErr string // "" when valid
+	}{
+		{"valid", func(r *Result) {}, ""},
+		{"no tests nor advice", func(r *Result) { r.RecommendedTests, r.LifestyleAdvice = nil, nil }, ""},
+		{"incomplete", func(r *Result) { r.Complete = false }, ErrIncomplete.Error()},
+		{"unknown severity", func(r *Result) { r.Severity = "unknown" }, `invalid severity "unknown"`},
+		{"upper case severity", func(r *Result) { r.Severity = "HIGH" }, `invalid severity "HIGH"`},
+		{"invalid feedback", func(r *Result) { r.Feedback = "yes" }, `invalid feedback "yes"`},
+		{"blank condition", func(r *Result) { r.SuspectedCondition = "  " }, "suspected condition is empty"},
+		{"empty summary", func(r *Result) { r.Summary = "" }, "summary is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := validResult()
+			tt.change(&result)
+			err := result.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Validate = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHelpful(t *testing.T) {
+	for feedback, want := range map[string]string{FeedbackHelpful: "true", FeedbackNotHelpful: "false", FeedbackNotAnswered: "nil", "": "nil"} {
+		got := "nil"
+		if helpful := (Result{Feedback: feedback}).Helpful(); helpful != nil {
+			got = map[bool]string{true: "true", false: "false"}[*helpful]
+		}
+		if got != want {
+			t.Errorf("Helpful() of %q = %s, want %s", feedback, got, want)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	history := []llm.Message{
+		{Role: llm.RoleUser, Text: "I have had a headache for three days"},
+		{Role: llm.RoleAssistant, Text: "It looks like a tension headache, severity moderate. Was this helpful to you?"},
+		{Role: llm.RoleUser, Text: "Yes"},
+	}
+
+	tests := []struct {
+		name    string
+		reply   string
+		want    Result
+		wantErr error
+		wantAny bool // any error
+	}{
+		{
+			name:  "complete",
+			reply: `{"complete":true,"severity":"moderate","suspectedCondition":"Tension headache","recommendedTests":["Blood pressure"],"lifestyleAdvice":["Sleep more"],"feedback":"helpful","summary":"Headache for three days, found the advice helpful."}`,
+			want:  validResult(),
+		},
+		{
+			name:    "not concluded",
+			reply:   `{"complete":false,"severity":"low","suspectedCondition":"","recommendedTests":[],"lifestyleAdvice":[],"feedback":"not_answered","summary":""}`,
+			wantErr: ErrIncomplete,
+		},
+		{
+			name:    "invalid severity",
+			reply:   `{"complete":true,"severity":"critical","suspectedCondition":"Migraine","recommendedTests":[],"lifestyleAdvice":[],"feedback":"helpful","summary":"Migraine"}`,
+			wantAny: true,
+		},
+		{
+			name:    "not JSON",
+			reply:   "The patient has a headache.",
+			wantAny: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := llm.NewScripted(tt.reply)
+			result, usage, err := Extract(context.Background(), provider, "neurology", history)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantAny:
+				if err == nil {
+					t.Errorf("Extract = %+v, want an error", result)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("Extract: %v", err)
+				}
+				if result.Severity != tt.want.Severity || result.SuspectedCondition != tt.want.SuspectedCondition ||
+					strings.Join(result.RecommendedTests, ",") != "Blood pressure" || result.Summary != tt.want.Summary {
+					t.Errorf("result = %+v, want %+v", result, tt.want)
+				}
+			}
+			// The tokens are counted even when the reply is rejected.
+			if usage.TotalTokens == 0 {
+				t.Error("usage not reported")
+			}
+
+			request := provider.Requests()[0]
+			if request.Schema != Schema || !strings.Contains(request.System, "neurology assistant") {
+				t.Errorf("request = %+v, want the schema and the specialty", request)
+			}
+			transcript := request.Messages[0].Text
+			if !strings.Contains(transcript, "Patient: I have had a headache") || !strings.Contains(transcript, "Assistant: It looks like") {
+				t.Errorf("transcript = %q", transcript)
+			}
+		})
+	}
+}
+
+func TestExtractProviderFailure(t *testing.T) {
+	_, _, err := Extract(context.Background(), llm.NewScripted(), "cardiology", nil)
+	if !errors.Is(err, llm.ErrScriptExhausted) {
+		t.Errorf("err = %v, want the provider's error", err)
+	}
+}
@@ -30,6 +30,18 @@ type Conversation = {
   title: string;
   messages: Message[];
   createdAt?: string; // Crucial for sorting
+  messagesLoaded?: boolean; // Headers come without messages, they are fetched when the conversation is opened
+};
+
+// A page of GET /conversations
+type ConversationPage = {
+  conversations: { id: string; title: string; createdAt: string }[];
+  nextCursor: string;
+};
+
+// A page of GET /chat/messages
+type MessagePage = {
+  messages: { sender: Message['sender']; content: string }[];
 };
 
 // Get screen width for sidebar
@@ -91,6 +103,28 @@ export default function ChatAppDesign() {
     setActiveConvId(conversationId);
     setShowSidebar(false); // Close sidebar
     setInput(''); // Clear input when switching conversations
+    loadMessages(conversationId);
+  };
+
+  // --- Load the latest messages of a conversation the first time it is opened ---
+  const loadMessages = async (conversationId: string) => {
+    const conv = conversations.find(c => c.id === conversationId);
+    if (!conv || conv.messagesLoaded || conversationId.startsWith('temp-')) {
+      return;
+    }
+
+    try {
+      const res = await api.get<MessagePage>('/chat/messages', {
+        params: { conId: conversationId },
+      });
+      const messages: Message[] = (res.data?.messages || []).map(m => ({ sender: m.sender, text: m.content }));
+      setConversations(prevConvs =>
+        prevConvs.map(c => (c.id === conversationId ? { ...c, messages, messagesLoaded: true } : c))
+      );
+    } catch (error) {
+      console.error('Error fetching messages:', error);
+      Alert.alert('Error', 'Failed to load the messages of this conversation.');
+    }
   };
 
 
@@ -106,19 +140,15 @@ export default function ChatAppDesign() {
 
       setIsLoadingConversations(true); // Start loading state
       try {
-        // Assuming your backend returns an array directly:
-        const res = await api.get<Conversation[]>('/conversations', {
-          params: { userId: user.id },
-        });
+        // The backend returns the latest conversation headers; messages are loaded when a conversation is opened
+        const res = await api.get<ConversationPage>('/conversations');
 
         // Safely access fetched conversations. Use a default empty array if undefined/null.
-        let fetchedConversations: Conversation[] = res.data || [];
-
-        // Ensure messages array exists and sort by createdAt (most recent first)
-        fetchedConversations = fetchedConversations
+        let fetchedConversations: Conversation[] = (res.data?.conversations || [])
             .map(conv => ({
-                ...conv,
-                messages: conv.messages || [],
+                id: conv.id,
+                title: conv.title,
+                messages: [],
                 createdAt: conv.createdAt || new Date().toISOString(), // Fallback for createdAt
             }))
             .sort((a, b) => {